@@ -2,7 +2,36 @@ package assets
 
 import (
 	"embed"
+	"sync"
+
+	"github.com/sglmr/gowebstart/internal/fingerprint"
+	"github.com/sglmr/gowebstart/internal/i18n"
 )
 
-//go:embed "static" "templates" "emails"
+// DefaultLocale is the language of the messages in the templates and code
+const DefaultLocale = "en"
+
+//go:embed "static" "templates" "emails" "locales" "migrations"
 var EmbeddedFiles embed.FS
+
+// StaticManifest returns the content hashed file names for the embedded static files.
+// The manifest is built once, the first time it's used.
+var StaticManifest = sync.OnceValue(func() *fingerprint.Manifest {
+	manifest, err := fingerprint.New(EmbeddedFiles, "static")
+	if err != nil {
+		// The embedded files can't change after the build, so this can only fail for a broken binary
+		panic(err)
+	}
+	return manifest
+})
+
+// Locales returns the message catalogs in the locales folder. They're loaded once, the
+// first time they're used.
+var Locales = sync.OnceValue(func() *i18n.Bundle {
+	bundle, err := i18n.New(EmbeddedFiles, "locales", DefaultLocale)
+	if err != nil {
+		// The embedded catalogs can't change after the build, so this can only fail for a broken binary
+		panic(err)
+	}
+	return bundle
+})
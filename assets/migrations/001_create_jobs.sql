@@ -0,0 +1,15 @@
+-- Durable background jobs for internal/jobs.SQLStore
+CREATE TABLE IF NOT EXISTS jobs (
+    id           BIGSERIAL PRIMARY KEY,
+    kind         TEXT NOT NULL,
+    payload      JSONB NOT NULL DEFAULT 'null',
+    state        TEXT NOT NULL DEFAULT 'pending',
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    run_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Workers claim the next due job by state and run_at
+CREATE INDEX IF NOT EXISTS jobs_state_run_at_idx ON jobs (state, run_at);
@@ -0,0 +1,12 @@
+-- Notes for the example notes module, internal/notes.SQLStore
+CREATE TABLE IF NOT EXISTS notes (
+    id         BIGSERIAL PRIMARY KEY,
+    owner      TEXT NOT NULL,
+    title      TEXT NOT NULL,
+    body       TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Notes are listed by owner, newest first
+CREATE INDEX IF NOT EXISTS notes_owner_id_idx ON notes (owner, id DESC);
@@ -0,0 +1,20 @@
+-- Outgoing webhook endpoints and the delivery log, internal/webhooks.SQLStore
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id         BIGSERIAL PRIMARY KEY,
+    url        TEXT NOT NULL,
+    secret     TEXT NOT NULL,
+    events     TEXT NOT NULL DEFAULT '', -- Comma separated event types, empty for every event
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id          BIGSERIAL PRIMARY KEY,
+    endpoint_id BIGINT NOT NULL,
+    url         TEXT NOT NULL,
+    event_id    TEXT NOT NULL,
+    event_type  TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error       TEXT NOT NULL DEFAULT '',
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+-- Application settings edited on the admin page, internal/settings.SQLStore
+CREATE TABLE IF NOT EXISTS settings (
+    key        TEXT PRIMARY KEY,
+    value      TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS notes_tenant_owner_id_idx;
+CREATE INDEX IF NOT EXISTS notes_owner_id_idx ON notes (owner, id DESC);
+ALTER TABLE notes DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,6 @@
+-- Tenant of each note, internal/notes.SQLStore. Existing notes belong to the main site.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+
+-- Notes are listed by tenant and owner, newest first
+DROP INDEX IF EXISTS notes_owner_id_idx;
+CREATE INDEX IF NOT EXISTS notes_tenant_owner_id_idx ON notes (tenant_id, owner, id DESC);
@@ -0,0 +1,14 @@
+-- In-app notifications, internal/notifications.SQLStore
+CREATE TABLE IF NOT EXISTS notifications (
+    id         BIGSERIAL PRIMARY KEY,
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    recipient  TEXT NOT NULL,
+    title      TEXT NOT NULL,
+    body       TEXT NOT NULL DEFAULT '',
+    url        TEXT NOT NULL DEFAULT '',
+    read_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Notifications are listed by recipient, newest first
+CREATE INDEX IF NOT EXISTS notifications_recipient_id_idx ON notifications (tenant_id, recipient, id DESC);
@@ -0,0 +1,12 @@
+-- Login history, internal/logins.SQLStore
+CREATE TABLE IF NOT EXISTS logins (
+    id         BIGSERIAL PRIMARY KEY,
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    email      TEXT NOT NULL,
+    ip         TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Logins are listed by user, newest first
+CREATE INDEX IF NOT EXISTS logins_email_id_idx ON logins (tenant_id, email, id DESC);
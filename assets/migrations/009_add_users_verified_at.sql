@@ -0,0 +1,2 @@
+-- When users verified their email, NULL until they do
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ;
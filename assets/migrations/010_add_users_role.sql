@@ -0,0 +1,2 @@
+-- Role of users, one of internal/users.Roles
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'viewer';
@@ -0,0 +1,12 @@
+-- API tokens of users, internal/apitokens.SQLStore. Only the SHA-256 hash of a token is saved.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id         BIGSERIAL PRIMARY KEY,
+    tenant_id  TEXT NOT NULL DEFAULT '',
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT NOT NULL DEFAULT '',
+    hash       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Tokens are listed by user, newest first
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (tenant_id, user_id, id DESC);
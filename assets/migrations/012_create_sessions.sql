@@ -0,0 +1,9 @@
+-- Sessions of the -session-store=postgres flag, internal/sessions.SQLStore
+CREATE TABLE IF NOT EXISTS sessions (
+    token  TEXT PRIMARY KEY,
+    data   BYTEA NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL
+);
+
+-- Expired sessions are deleted by their expiry
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
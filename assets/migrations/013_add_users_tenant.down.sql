@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_tenant_id_email_idx;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,6 @@
+-- Tenant of each user, internal/users.SQLStore. Existing users belong to the main site.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+
+-- An email can sign up once in each tenant
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_id_email_idx ON users (tenant_id, email);
@@ -2,15 +2,38 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
 	"syscall"
+	"time"
 
 	"github.com/sglmr/gowebstart/internal/argon2id"
+	"github.com/sglmr/gowebstart/internal/pwned"
+	"github.com/sglmr/gowebstart/internal/validator"
 	"golang.org/x/term"
 )
 
 func main() {
+	memory := flag.Uint("argon2-memory", uint(argon2id.DefaultParams.Memory), "Memory of the argon2id hash in KiB")
+	iterations := flag.Uint("argon2-iterations", uint(argon2id.DefaultParams.Iterations), "Iterations of the argon2id hash")
+	parallelism := flag.Uint("argon2-parallelism", uint(argon2id.DefaultParams.Parallelism), "Threads of the argon2id hash")
+	passwordPeppers := flag.String("password-peppers", os.Getenv("PASSWORD_PEPPERS"), "Comma separated secrets mixed into the hash, like 2:new-secret,1:old-secret. The first is used")
+	pwnedSource := flag.String("pwned-passwords", "api", `Reject passwords from data breaches: "api" for the Have I Been Pwned API, a file of SHA-1 hashes, or "off"`)
+	flag.Parse()
+
+	currentPepper, peppers, err := argon2id.ParsePeppers(*passwordPeppers)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	checker, err := pwned.New(*pwnedSource, 5*time.Second)
+	if err != nil {
+		log.Fatalln("could not load pwned passwords:", err)
+	}
+
 	// Try to read password securely first (won't echo characters)
 	fmt.Print("   Enter password: ")
 	password, err := term.ReadPassword(int(syscall.Stdin))
@@ -30,8 +53,20 @@ func main() {
 		log.Fatalln("passwords don't match")
 	}
 
+	// Exit if the password appeared in a data breach. The check fails open when the
+	// API can't be reached.
+	if !validator.NotPwned(context.Background(), checker, string(password)) {
+		log.Fatalln("\nthis password appeared in a data breach, choose another one")
+	}
+
 	// Generate an argon2id hash
-	encodedHash, err := argon2id.CreateHash(string(password), argon2id.DefaultParams)
+	params := *argon2id.DefaultParams
+	params.Memory = uint32(*memory)
+	params.Iterations = uint32(*iterations)
+	params.Parallelism = uint8(*parallelism)
+	params.KeyID = currentPepper
+	params.Peppers = peppers
+	encodedHash, err := argon2id.CreateHash(string(password), &params)
 	if err != nil {
 		log.Fatalln("Error generating hash:", err)
 	}
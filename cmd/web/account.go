@@ -0,0 +1,764 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/antispam"
+	"github.com/sglmr/gowebstart/internal/apitokens"
+	"github.com/sglmr/gowebstart/internal/argon2id"
+	"github.com/sglmr/gowebstart/internal/captcha"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/jobs"
+	"github.com/sglmr/gowebstart/internal/logins"
+	"github.com/sglmr/gowebstart/internal/pagination"
+	"github.com/sglmr/gowebstart/internal/password"
+	"github.com/sglmr/gowebstart/internal/pwned"
+	"github.com/sglmr/gowebstart/internal/signing"
+	"github.com/sglmr/gowebstart/internal/users"
+	"github.com/sglmr/gowebstart/internal/validator"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+)
+
+// minPasswordLength is the minimum number of characters of a new password
+const minPasswordLength = 8
+
+// passwordResetTTL is how long a password reset link works
+const passwordResetTTL = time.Hour
+
+// verifyEmailTTL is how long an email verification link works
+const verifyEmailTTL = 48 * time.Hour
+
+// stickyVerifyEmail is the ID of the sticky flash message that reminds new users to
+// verify their email
+const stickyVerifyEmail = "verify-email"
+
+// loginsPerPage is the number of logins on a page of the login history
+const loginsPerPage = 20
+
+// recordLogin shows the user's previous login, so they notice logins that weren't them,
+// then records this one for the login history
+func recordLogin(r *http.Request, loginStore logins.Store, sessionManager *scs.SessionManager, email string) error {
+	last, err := logins.Last(r.Context(), loginStore, email)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		putFlashInfo(r, translate(r, "Your last login was on %s from %s.", last.CreatedAt.Format("Jan 2, 2006 15:04"), last.IP), sessionManager)
+	}
+	return loginStore.Insert(r.Context(), &logins.Login{Email: email, IP: clientIP(r), UserAgent: r.UserAgent()})
+}
+
+// accountLogins handles the login history of the logged in user
+func accountLogins(
+	logger *slog.Logger,
+	showTrace bool,
+	store logins.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := authenticatedEmail(r)
+		page := pagination.FromRequest(r)
+
+		list, total, err := store.List(r.Context(), email, loginsPerPage, (page-1)*loginsPerPage)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		// Show the last page when the requested page is past the end
+		pages := pagination.New(page, loginsPerPage, total)
+		if pages.Page != page {
+			list, _, err = store.List(r.Context(), email, loginsPerPage, pages.Offset())
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Logins"] = list
+		data["Pagination"] = pages
+
+		if err := renderPage(w, r, http.StatusOK, data, "account-logins.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// accountTokens lists the user's API tokens and creates new ones. A new token is shown
+// once, in the response of the form, since only its hash is saved.
+func accountTokens(
+	logger *slog.Logger,
+	showTrace bool,
+	store apitokens.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	type tokenForm struct {
+		Name string
+		validator.Validator
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		form := tokenForm{}
+		data := newTemplateData(r, sessionManager)
+
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				clientError(w, r, http.StatusBadRequest)
+				return
+			}
+
+			form.Name = strings.TrimSpace(r.FormValue("name"))
+			form.Check("Name", validator.NotBlank(form.Name), "This field cannot be blank.")
+			form.Check("Name", validator.MaxRunes(form.Name, 100), "This field cannot be more than 100 characters.")
+
+			if form.Valid() {
+				plaintext, hash := apitokens.New()
+				token := &apitokens.Token{UserID: authenticatedUserID(r), Name: form.Name, Hash: hash}
+				if err := store.Insert(r.Context(), token); err != nil {
+					serverError(w, r, err, logger, showTrace)
+					return
+				}
+
+				data["NewToken"] = plaintext
+				form = tokenForm{}
+			} else {
+				status = http.StatusUnprocessableEntity
+			}
+		}
+
+		list, err := store.List(r.Context(), authenticatedUserID(r))
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		data["Form"] = form
+		data["Tokens"] = list
+
+		// The page may show a new token, which shouldn't be cached
+		w.Header().Set("Cache-Control", "no-store")
+		if err := renderPage(w, r, status, data, "account-tokens.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// accountTokenDelete revokes an API token of the user
+func accountTokenDelete(
+	logger *slog.Logger,
+	showTrace bool,
+	store apitokens.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		err = store.Delete(r.Context(), authenticatedUserID(r), id)
+		switch {
+		case errors.Is(err, apitokens.ErrNotFound):
+			clientError(w, r, http.StatusNotFound)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		putFlashSuccess(r, translate(r, "API token revoked."), sessionManager)
+		redirect(w, r, "/account/tokens/", http.StatusSeeOther)
+	}
+}
+
+// signup handles new accounts. The form is protected against bots like the contact form.
+// The password is hashed with argon2Params, the new user is logged in, a link to verify
+// their email is sent to them, and a user.registered webhook event is sent.
+func signup(
+	logger *slog.Logger,
+	sessionManager *scs.SessionManager,
+	showTrace bool,
+	userStore users.Store,
+	argon2Params *argon2id.Params,
+	pwnedPasswords pwned.Checker,
+	signer *signing.Signer,
+	siteURL string,
+	spamGuard *antispam.Guard,
+	captchaVerifier *captcha.Verifier,
+	jobQueue *jobs.Queue,
+	webhookStore webhooks.Store,
+) http.HandlerFunc {
+	type signupForm struct {
+		Email    string
+		Password string
+		validator.Validator
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderForm := func(status int, form signupForm) {
+			data := newTemplateData(r, sessionManager)
+			data["Form"] = form
+			data["MinPasswordLength"] = minPasswordLength
+			data["AntiSpam"] = spamGuard.Fields()
+			data["Captcha"] = captchaVerifier.Widget()
+			if err := renderPage(w, r, status, data, "signup.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+		}
+
+		if r.Method == http.MethodGet {
+			renderForm(http.StatusOK, signupForm{})
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		form := signupForm{
+			Email:    r.FormValue("email"),
+			Password: r.FormValue("password"),
+		}
+
+		// Pretend that bots signed up, so they don't try again. People who submit too fast
+		// or with an expired form can submit it again.
+		err = spamGuard.Check(r)
+		switch {
+		case errors.Is(err, antispam.ErrHoneypot):
+			logger.Info("signup spam blocked", "ip", clientIP(r), "reason", err)
+			redirect(w, r, "/", http.StatusSeeOther)
+			return
+		case err != nil:
+			logger.Info("signup spam blocked", "ip", clientIP(r), "reason", err)
+			form.AddError("Form", "Your account couldn't be created. Please wait a moment and submit it again.")
+		}
+
+		// Ask for the CAPTCHA again when it fails, or when the provider can't be reached
+		if err := captchaVerifier.Verify(r, clientIP(r)); err != nil {
+			logger.Info("signup captcha failed", "ip", clientIP(r), "error", err)
+			form.AddError("Captcha", "Please complete the CAPTCHA.")
+		}
+
+		form.Check("Email", validator.NotBlank(form.Email), "This field cannot be blank.")
+		form.Check("Email", validator.MaxRunes(form.Email, 100), "This field cannot be more than 100 characters.")
+		form.Check("Email", validator.IsEmail(form.Email), "Email must be a valid email.")
+		form.Check("Password", validator.MinRunes(form.Password, minPasswordLength), "Password must be at least 8 characters.")
+		form.Check("Password", validator.MaxRunes(form.Password, 100), "This field cannot be more than 100 characters.")
+		if form.Valid() {
+			form.Check("Password", validator.NotPwned(r.Context(), pwnedPasswords, form.Password), "This password appeared in a data breach. Please choose another one.")
+		}
+
+		if form.HasErrors() {
+			putFlashError(r, translate(r, "please correct the form errors"), sessionManager)
+			renderForm(http.StatusUnprocessableEntity, form)
+			return
+		}
+
+		hash, err := password.Hash(form.Password, argon2Params)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		user := &users.User{Email: form.Email, PasswordHash: hash}
+		err = userStore.Insert(r.Context(), user)
+		switch {
+		case errors.Is(err, users.ErrDuplicateEmail):
+			form.AddError("Email", "This email already has an account.")
+			putFlashError(r, translate(r, "please correct the form errors"), sessionManager)
+			renderForm(http.StatusUnprocessableEntity, form)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		logger.Info("user signed up", "user", user.ID)
+
+		err = emitWebhook(r.Context(), jobQueue, webhookStore, webhooks.EventUserRegistered, map[string]any{
+			"id":    user.ID,
+			"email": user.Email,
+		})
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		err = sendVerifyEmail(r, jobQueue, signer, siteURL, user.Email)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		err = startSession(r, sessionManager, user)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		putFlashSuccess(r, translate(r, "Welcome! Your account is ready."), sessionManager)
+		putStickyFlash(r, stickyVerifyEmail, FlashMessage{
+			Level:   flashInfo,
+			Message: translate(r, "We've sent you a link to verify your email."),
+		}, sessionManager)
+		redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// passwordResetPurpose is the signing purpose of a user's password reset tokens. It
+// includes the password hash, so a token stops working once the password changed.
+func passwordResetPurpose(user *users.User) string {
+	return purposePasswordReset + "\n" + user.PasswordHash
+}
+
+// forgotPassword handles the form that emails a password reset link. It responds the
+// same whether or not the email has an account, so it can't be used to find accounts.
+func forgotPassword(
+	logger *slog.Logger,
+	showTrace bool,
+	userStore users.Store,
+	signer *signing.Signer,
+	siteURL string,
+	jobQueue *jobs.Queue,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	type forgotPasswordForm struct {
+		Email string
+		validator.Validator
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderForm := func(status int, form forgotPasswordForm) {
+			data := newTemplateData(r, sessionManager)
+			data["Form"] = form
+			if err := renderPage(w, r, status, data, "forgot-password.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+		}
+
+		if r.Method == http.MethodGet {
+			renderForm(http.StatusOK, forgotPasswordForm{})
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		form := forgotPasswordForm{Email: r.FormValue("email")}
+		form.Check("Email", validator.NotBlank(form.Email), "This field cannot be blank.")
+		form.Check("Email", validator.IsEmail(form.Email), "Email must be a valid email.")
+		if form.HasErrors() {
+			putFlashError(r, translate(r, "please correct the form errors"), sessionManager)
+			renderForm(http.StatusUnprocessableEntity, form)
+			return
+		}
+
+		user, err := userStore.GetByEmail(r.Context(), form.Email)
+		switch {
+		case errors.Is(err, users.ErrNotFound):
+			logger.Info("password reset for an unknown email")
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		default:
+			token := signer.Token(strconv.FormatInt(user.ID, 10), passwordResetPurpose(user), passwordResetTTL)
+			err = jobQueue.Enqueue(r.Context(), jobSendEmail, emailJob{
+				To: []string{user.Email},
+				Data: map[string]any{
+					"URL":     absoluteURL(r, siteURL, "/reset-password/"+token),
+					"Minutes": int(passwordResetTTL.Minutes()),
+				},
+				Templates: []string{"password-reset.tmpl"},
+			})
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+		}
+
+		putFlashInfo(r, translate(r, "If %s has an account, we've sent it a link to reset the password.", form.Email), sessionManager)
+		redirect(w, r, "/login/", http.StatusSeeOther)
+	}
+}
+
+// resetPassword handles the password reset links from forgotPassword. A valid link sets
+// the new password and logs the user in.
+func resetPassword(
+	logger *slog.Logger,
+	showTrace bool,
+	userStore users.Store,
+	signer *signing.Signer,
+	argon2Params *argon2id.Params,
+	pwnedPasswords pwned.Checker,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	type resetPasswordForm struct {
+		Password string
+		validator.Validator
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Find the user of the token, then check the token with their password hash
+		token := r.PathValue("token")
+		user, err := passwordResetUser(r, userStore, signer, token)
+		switch {
+		case errors.Is(err, signing.ErrExpired), errors.Is(err, signing.ErrInvalidSignature):
+			putFlashError(r, translate(r, "This password reset link is invalid or has expired. Please request a new one."), sessionManager)
+			redirect(w, r, "/forgot-password/", http.StatusSeeOther)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		renderForm := func(status int, form resetPasswordForm) {
+			data := newTemplateData(r, sessionManager)
+			data["Form"] = form
+			data["MinPasswordLength"] = minPasswordLength
+			if err := renderPage(w, r, status, data, "reset-password.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+		}
+
+		if r.Method == http.MethodGet {
+			renderForm(http.StatusOK, resetPasswordForm{})
+			return
+		}
+
+		err = r.ParseForm()
+		if err != nil {
+			clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		form := resetPasswordForm{Password: r.FormValue("password")}
+		form.Check("Password", validator.MinRunes(form.Password, minPasswordLength), "Password must be at least 8 characters.")
+		form.Check("Password", validator.MaxRunes(form.Password, 100), "This field cannot be more than 100 characters.")
+		if form.Valid() {
+			form.Check("Password", validator.NotPwned(r.Context(), pwnedPasswords, form.Password), "This password appeared in a data breach. Please choose another one.")
+		}
+		if form.HasErrors() {
+			putFlashError(r, translate(r, "please correct the form errors"), sessionManager)
+			renderForm(http.StatusUnprocessableEntity, form)
+			return
+		}
+
+		hash, err := password.Hash(form.Password, argon2Params)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		err = userStore.SetPasswordHash(r.Context(), user.ID, hash)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		logger.Info("password reset", "user", user.ID)
+
+		err = startSession(r, sessionManager, user)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		putFlashSuccess(r, translate(r, "Your password has been changed."), sessionManager)
+		redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// passwordResetUser returns the user of a valid password reset token. Tokens of missing
+// users are invalid.
+func passwordResetUser(r *http.Request, userStore users.Store, signer *signing.Signer, token string) (*users.User, error) {
+	data, err := signing.TokenData(token)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return nil, signing.ErrInvalidSignature
+	}
+
+	user, err := userStore.Get(r.Context(), id)
+	if errors.Is(err, users.ErrNotFound) {
+		return nil, signing.ErrInvalidSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = signer.VerifyToken(token, passwordResetPurpose(user))
+	return user, err
+}
+
+// sendVerifyEmail queues an email with a link that verifies the email of a user. The
+// token holds the email, so it only verifies the address it was sent to.
+func sendVerifyEmail(r *http.Request, jobQueue *jobs.Queue, signer *signing.Signer, siteURL, email string) error {
+	token := signer.Token(email, purposeVerifyEmail, verifyEmailTTL)
+	return jobQueue.Enqueue(r.Context(), jobSendEmail, emailJob{
+		To: []string{email},
+		Data: map[string]any{
+			"URL":   absoluteURL(r, siteURL, "/verify-email/"+token),
+			"Hours": int(verifyEmailTTL.Hours()),
+		},
+		Templates: []string{"verify-email.tmpl"},
+	})
+}
+
+// verifyEmail handles the links from sendVerifyEmail. They work without a login, so the
+// link can be opened on another device.
+func verifyEmail(
+	logger *slog.Logger,
+	showTrace bool,
+	userStore users.Store,
+	signer *signing.Signer,
+	clk clock.Clock,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, err := signer.VerifyToken(r.PathValue("token"), purposeVerifyEmail)
+		if err != nil {
+			putFlashError(r, translate(r, "This verification link is invalid or has expired."), sessionManager)
+			redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		user, err := userStore.GetByEmail(r.Context(), email)
+		switch {
+		case errors.Is(err, users.ErrNotFound):
+			putFlashError(r, translate(r, "This verification link is invalid or has expired."), sessionManager)
+			redirect(w, r, "/", http.StatusSeeOther)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		err = userStore.SetVerified(r.Context(), user.ID, clk.Now())
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		removeStickyFlash(r, stickyVerifyEmail, sessionManager)
+		putFlashSuccess(r, translate(r, "Your email is verified."), sessionManager)
+		redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// verifyEmailPending handles the page that asks logged in users to verify their email,
+// and sends them a new link when they ask for one
+func verifyEmailPending(
+	logger *slog.Logger,
+	showTrace bool,
+	signer *signing.Signer,
+	siteURL string,
+	jobQueue *jobs.Queue,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isVerified(r) {
+			redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			err := sendVerifyEmail(r, jobQueue, signer, siteURL, authenticatedEmail(r))
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+			putFlashInfo(r, translate(r, "We've sent a new link to %s.", authenticatedEmail(r)), sessionManager)
+			redirect(w, r, "/verify-email/", http.StatusSeeOther)
+			return
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Email"] = authenticatedEmail(r)
+		if err := renderPage(w, r, http.StatusOK, data, "verify-email.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// magicLinkPurpose is the signing purpose of a user's login links. It includes the ID of
+// their last login, or 0 before the first one, so a link stops working after the next
+// login, including the one it's used for.
+func magicLinkPurpose(last *logins.Login) string {
+	var id int64
+	if last != nil {
+		id = last.ID
+	}
+	return purposeMagicLink + "\n" + strconv.FormatInt(id, 10)
+}
+
+// magicLinkRequest handles the form that emails a one-time login link instead of asking
+// for a password. It responds the same whether or not the email has an account.
+func magicLinkRequest(
+	logger *slog.Logger,
+	showTrace bool,
+	userStore users.Store,
+	loginStore logins.Store,
+	signer *signing.Signer,
+	ttl time.Duration,
+	siteURL string,
+	jobQueue *jobs.Queue,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	type magicLinkForm struct {
+		Email string
+		validator.Validator
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderForm := func(status int, form magicLinkForm) {
+			data := newTemplateData(r, sessionManager)
+			data["Form"] = form
+			data["Minutes"] = int(ttl.Minutes())
+			if err := renderPage(w, r, status, data, "login-link.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+		}
+
+		if r.Method == http.MethodGet {
+			renderForm(http.StatusOK, magicLinkForm{})
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		form := magicLinkForm{Email: r.FormValue("email")}
+		form.Check("Email", validator.NotBlank(form.Email), "This field cannot be blank.")
+		form.Check("Email", validator.IsEmail(form.Email), "Email must be a valid email.")
+		if form.HasErrors() {
+			putFlashError(r, translate(r, "please correct the form errors"), sessionManager)
+			renderForm(http.StatusUnprocessableEntity, form)
+			return
+		}
+
+		user, err := userStore.GetByEmail(r.Context(), form.Email)
+		switch {
+		case errors.Is(err, users.ErrNotFound):
+			logger.Info("login link for an unknown email")
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		default:
+			last, err := logins.Last(r.Context(), loginStore, user.Email)
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+			token := signer.Token(user.Email, magicLinkPurpose(last), ttl)
+			err = jobQueue.Enqueue(r.Context(), jobSendEmail, emailJob{
+				To: []string{user.Email},
+				Data: map[string]any{
+					"URL":     absoluteURL(r, siteURL, "/login/link/"+token),
+					"Minutes": int(ttl.Minutes()),
+				},
+				Templates: []string{"login-link.tmpl"},
+			})
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+		}
+
+		putFlashInfo(r, translate(r, "If %s has an account, we've sent it a login link.", form.Email), sessionManager)
+		redirect(w, r, "/login/", http.StatusSeeOther)
+	}
+}
+
+// magicLinkLogin handles the login links from magicLinkRequest. Opening a link shows a
+// button that logs in, so email scanners that open links don't use it up. Logging in
+// verifies the email, since the link was sent to it.
+func magicLinkLogin(
+	logger *slog.Logger,
+	showTrace bool,
+	userStore users.Store,
+	loginStore logins.Store,
+	signer *signing.Signer,
+	clk clock.Clock,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Find the user of the token, then check the token with their last login
+		token := r.PathValue("token")
+		user, err := magicLinkUser(r, userStore, loginStore, signer, token)
+		switch {
+		case errors.Is(err, signing.ErrExpired), errors.Is(err, signing.ErrInvalidSignature):
+			putFlashError(r, translate(r, "This login link is invalid, expired, or was already used. Please request a new one."), sessionManager)
+			redirect(w, r, "/login/link/", http.StatusSeeOther)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			data := newTemplateData(r, sessionManager)
+			data["Email"] = user.Email
+			if err := renderPage(w, r, http.StatusOK, data, "login-link-confirm.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+			return
+		}
+
+		err = userStore.SetVerified(r.Context(), user.ID, clk.Now())
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		err = startSession(r, sessionManager, user)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		putFlashSuccess(r, translate(r, "You are in!"), sessionManager)
+
+		// Recording the login uses up the link
+		err = recordLogin(r, loginStore, sessionManager, user.Email)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// magicLinkUser returns the user of a valid login link token. Tokens of missing users
+// are invalid.
+func magicLinkUser(r *http.Request, userStore users.Store, loginStore logins.Store, signer *signing.Signer, token string) (*users.User, error) {
+	email, err := signing.TokenData(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userStore.GetByEmail(r.Context(), email)
+	if errors.Is(err, users.ErrNotFound) {
+		return nil, signing.ErrInvalidSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := logins.Last(r.Context(), loginStore, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	_, err = signer.VerifyToken(token, magicLinkPurpose(last))
+	return user, err
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/email"
+	"github.com/sglmr/gowebstart/internal/password"
+	"github.com/sglmr/gowebstart/internal/users"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+)
+
+func TestAccountLogins(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// The login history requires login
+	response := ts.get(t, "/account/logins/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	// The first login has no previous login to show
+	ts.login(t)
+	response = ts.get(t, "/")
+	assert.StringIn(t, "You are in!", response.body)
+	assert.StringNotIn(t, "Your last login was", response.body)
+
+	// Logins are recorded with the client IP and user agent
+	list, total, err := ts.loginStore.List(context.Background(), testEmail, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "127.0.0.1", list[0].IP)
+	assert.Equal(t, "Go-http-client/1.1", list[0].UserAgent)
+
+	// The next login shows the previous one
+	ts.logout(t)
+	ts.login(t)
+	response = ts.get(t, "/")
+	assert.StringIn(t, "Your last login was on "+list[0].CreatedAt.Format("Jan 2, 2006 15:04")+" from 127.0.0.1.", response.body)
+
+	response = ts.get(t, "/account/logins/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "<h1>Login History</h1>", response.body)
+	assert.StringIn(t, "<td>Go-http-client/1.1</td>", response.body)
+	_, total, _ = ts.loginStore.List(context.Background(), testEmail, 10, 0)
+	assert.Equal(t, 2, total)
+}
+
+func TestSignup(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	response := ts.get(t, "/signup/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	form := response.form(t, "/signup/")
+
+	// Passwords need a minimum length
+	form.values.Set("email", "new@example.com")
+	form.values.Set("password", "short")
+	response = ts.submit(t, form)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+	assert.StringIn(t, "Password must be at least 8 characters.", response.body)
+
+	// An email can only sign up once
+	form.values.Set("email", "Test@Example.com")
+	form.values.Set("password", "a long password")
+	response = ts.submit(t, form)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+	assert.StringIn(t, "This email already has an account.", response.body)
+
+	// A new account is saved with an argon2id hash and logged in
+	form.values.Set("email", "new@example.com")
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/")
+
+	user, err := ts.userStore.GetByEmail(context.Background(), "new@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, password.FormatArgon2id, password.Format(user.PasswordHash))
+
+	response = ts.get(t, "/account/logins/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "Welcome! Your account is ready.", response.body)
+
+	// The new user can log in with the password
+	ts.logout(t)
+	response = ts.get(t, "/login/")
+	form = response.form(t, "/login/")
+	form.values.Set("email", "new@example.com")
+	form.values.Set("password", "a long password")
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/")
+}
+
+func TestSignupWebhook(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	received := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer receiver.Close()
+	err := ts.webhookStore.AddEndpoint(context.Background(), &webhooks.Endpoint{
+		URL:    receiver.URL,
+		Secret: "secret",
+		Events: []string{webhooks.EventUserRegistered},
+	})
+	assert.NoError(t, err)
+
+	response := ts.get(t, "/signup/")
+	form := response.form(t, "/signup/")
+	form.values.Set("email", "new@example.com")
+	form.values.Set("password", "a long password")
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/")
+
+	select {
+	case body := <-received:
+		assert.StringIn(t, `"type":"user.registered"`, string(body))
+		assert.StringIn(t, `"email":"new@example.com"`, string(body))
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't delivered")
+	}
+}
+
+func TestSignupSpam(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	response := ts.get(t, "/signup/")
+	assert.StringIn(t, `name="website"`, response.body)
+	form := response.form(t, "/signup/")
+	form.values.Set("email", "new@example.com")
+	form.values.Set("password", "a long password")
+
+	// Forms without a valid token can be submitted again
+	token := form.values.Get("form_token")
+	form.values.Set("form_token", "123.forged")
+	response = ts.submit(t, form)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+	assert.StringIn(t, "Please wait a moment and submit it again.", response.body)
+
+	// Bots that fill in the honeypot think they signed up, but they didn't
+	form.values.Set("form_token", token)
+	form.values.Set("website", "http://spam.example.com")
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/")
+	_, err := ts.userStore.GetByEmail(context.Background(), "new@example.com")
+	assert.Equal(t, true, errors.Is(err, users.ErrNotFound))
+}
+
+func TestAdminRequired(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Viewers and editors can't open the admin pages, or see their links
+	ts.loginAs(t, "other@example.com")
+	response := ts.get(t, "/admin/settings/")
+	assert.Equal(t, http.StatusForbidden, response.statusCode)
+	response = ts.get(t, "/notes/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringNotIn(t, `href="/admin/settings/"`, response.body)
+
+	user, err := ts.userStore.GetByEmail(context.Background(), "other@example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, ts.userStore.SetRole(context.Background(), user.ID, users.RoleEditor))
+	response = ts.get(t, "/admin/settings/")
+	assert.Equal(t, http.StatusForbidden, response.statusCode)
+
+	// The role applies to the next request, without a new login
+	assert.NoError(t, ts.userStore.SetRole(context.Background(), user.ID, users.RoleAdmin))
+	response = ts.get(t, "/admin/settings/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, `href="/admin/settings/"`, response.body)
+
+	// The -auth-email user is an admin
+	ts.loginAs(t, testEmail)
+	response = ts.get(t, "/admin/settings/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+}
+
+// dataMailer is a mailer that records the template data of the emails it sends
+type dataMailer struct {
+	email.LogMailer
+	data chan map[string]any
+}
+
+func (m *dataMailer) Send(ctx context.Context, msg email.Message) error {
+	m.data <- msg.Data.(map[string]any)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+
+	mailer := &dataMailer{data: make(chan map[string]any, 1)}
+	clk := clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	ts := newTestServer(t, withMailer(mailer), withClock(clk), withConfig(func(cfg *config) {
+		cfg.baseURL = "https://example.com"
+	}))
+	defer ts.Close()
+
+	// Unknown emails get the same response, without an email
+	response := ts.get(t, "/forgot-password/")
+	form := response.form(t, "/forgot-password/")
+	form.values.Set("email", "nobody@example.com")
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/login/")
+
+	form.values.Set("email", testEmail)
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/login/")
+	response = ts.get(t, "/login/")
+	assert.StringIn(t, "If "+testEmail+" has an account, we&#39;ve sent it a link to reset the password.", response.body)
+
+	// The email links to the -base-url, not the host of the request
+	link := receiveLink(t, mailer)
+	path, ok := strings.CutPrefix(link, "https://example.com")
+	assert.Equal(t, true, ok)
+
+	// A changed token doesn't work
+	response = ts.get(t, path+"x")
+	assert.RedirectsTo(t, response.Result(), "/forgot-password/")
+
+	// The link sets the new password and logs in
+	response = ts.get(t, path)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	form = response.form(t, path)
+	form.values.Set("password", "a new password")
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/")
+	response = ts.get(t, "/account/logins/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "Your password has been changed.", response.body)
+
+	user, err := ts.userStore.GetByEmail(context.Background(), testEmail)
+	assert.NoError(t, err)
+	match, _, err := password.Verify("a new password", user.PasswordHash, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, true, match)
+
+	// The link only works once
+	response = ts.get(t, path)
+	assert.RedirectsTo(t, response.Result(), "/forgot-password/")
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	t.Parallel()
+
+	mailer := &dataMailer{data: make(chan map[string]any, 1)}
+	clk := clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	ts := newTestServer(t, withMailer(mailer), withClock(clk))
+	defer ts.Close()
+
+	response := ts.get(t, "/forgot-password/")
+	form := response.form(t, "/forgot-password/")
+	form.values.Set("email", testEmail)
+	ts.submit(t, form)
+
+	link := receiveLink(t, mailer)
+
+	// Without -base-url, links use the host of the request
+	path, ok := strings.CutPrefix(link, ts.URL)
+	assert.Equal(t, true, ok)
+
+	clk.Add(passwordResetTTL + time.Minute)
+	response = ts.get(t, path)
+	assert.RedirectsTo(t, response.Result(), "/forgot-password/")
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Parallel()
+
+	mailer := &dataMailer{data: make(chan map[string]any, 1)}
+	ts := newTestServer(t, withMailer(mailer), withConfig(func(cfg *config) {
+		cfg.requireVerifiedEmail = true
+	}))
+	defer ts.Close()
+
+	// Signing up sends the verification link
+	response := ts.get(t, "/signup/")
+	form := response.form(t, "/signup/")
+	form.values.Set("email", "new@example.com")
+	form.values.Set("password", "a long password")
+	response = ts.submit(t, form)
+	assert.RedirectsTo(t, response.Result(), "/")
+	link := receiveLink(t, mailer)
+
+	// Unverified users can't open the pages that require login, but can log out
+	response = ts.get(t, "/notes/")
+	assert.RedirectsTo(t, response.Result(), "/verify-email/")
+	response = ts.get(t, "/verify-email/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "Please open the link we sent to new@example.com to verify your email.", response.body)
+	response = ts.get(t, "/logout/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+
+	// They can ask for a new link
+	response = ts.get(t, "/verify-email/")
+	response = ts.submit(t, response.form(t, "/verify-email/"))
+	assert.RedirectsTo(t, response.Result(), "/verify-email/")
+	newLink := receiveLink(t, mailer)
+
+	// A changed link doesn't verify the email
+	path := strings.TrimPrefix(newLink, ts.URL)
+	response = ts.get(t, path+"x")
+	assert.RedirectsTo(t, response.Result(), "/")
+	response = ts.get(t, "/notes/")
+	assert.RedirectsTo(t, response.Result(), "/verify-email/")
+
+	// Either link verifies the email
+	response = ts.get(t, strings.TrimPrefix(link, ts.URL))
+	assert.RedirectsTo(t, response.Result(), "/")
+	response = ts.get(t, "/notes/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "Your email is verified.", response.body)
+	assert.StringNotIn(t, "We&#39;ve sent you a link to verify your email.", response.body)
+
+	user, err := ts.userStore.GetByEmail(context.Background(), "new@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, true, user.Verified())
+
+	// Verified users don't see the page anymore
+	response = ts.get(t, "/verify-email/")
+	assert.RedirectsTo(t, response.Result(), "/")
+}
+
+func TestUnverifiedEmailAllowed(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Without -require-verified-email, unverified users can open every page
+	response := ts.get(t, "/signup/")
+	form := response.form(t, "/signup/")
+	form.values.Set("email", "new@example.com")
+	form.values.Set("password", "a long password")
+	ts.submit(t, form)
+
+	response = ts.get(t, "/notes/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+
+	// The reminder to verify the email is on every page until it's dismissed
+	assert.StringIn(t, "We&#39;ve sent you a link to verify your email.", response.body)
+	response = ts.get(t, "/notes/")
+	assert.StringIn(t, "We&#39;ve sent you a link to verify your email.", response.body)
+
+	response = ts.submit(t, response.form(t, "/flash/dismiss/"))
+	assert.RedirectsTo(t, response.Result(), "/notes/")
+	response = ts.get(t, "/notes/")
+	assert.StringNotIn(t, "We&#39;ve sent you a link to verify your email.", response.body)
+}
+
+// receiveLink returns the URL of the next email of a dataMailer
+func receiveLink(t *testing.T, mailer *dataMailer) string {
+	t.Helper()
+
+	select {
+	case data := <-mailer.data:
+		return data["URL"].(string)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the email wasn't sent")
+		return ""
+	}
+}
+
+func TestMagicLink(t *testing.T) {
+	t.Parallel()
+
+	mailer := &dataMailer{data: make(chan map[string]any, 1)}
+	clk := clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	ts := newTestServer(t, withMailer(mailer), withClock(clk), withConfig(func(cfg *config) {
+		cfg.magicLinkTTL = 15 * time.Minute
+	}))
+	defer ts.Close()
+
+	response := ts.get(t, "/login/")
+	assert.StringIn(t, `href="/login/link/"`, response.body)
+
+	requestLink := func() string {
+		response := ts.get(t, "/login/link/")
+		form := response.form(t, "/login/link/")
+		form.values.Set("email", testEmail)
+		response = ts.submit(t, form)
+		assert.RedirectsTo(t, response.Result(), "/login/")
+		return strings.TrimPrefix(receiveLink(t, mailer), ts.URL)
+	}
+
+	// Opening the link doesn't log in until the button is pressed
+	path := requestLink()
+	response = ts.get(t, path)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "Log in as "+testEmail, response.body)
+	response = ts.get(t, "/notes/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	response = ts.submit(t, ts.get(t, path).form(t, path))
+	assert.RedirectsTo(t, response.Result(), "/")
+	response = ts.get(t, "/notes/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "You are in!", response.body)
+
+	// The login used up the link
+	ts.logout(t)
+	response = ts.get(t, path)
+	assert.RedirectsTo(t, response.Result(), "/login/link/")
+
+	// Links expire
+	path = requestLink()
+	clk.Add(16 * time.Minute)
+	response = ts.get(t, path)
+	assert.RedirectsTo(t, response.Result(), "/login/link/")
+}
+
+func TestMagicLinkOff(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	response := ts.get(t, "/login/")
+	assert.StringNotIn(t, `href="/login/link/"`, response.body)
+	// The path falls through to the login page
+	response = ts.get(t, "/login/link/")
+	assert.StringNotIn(t, "Login Link", response.body)
+}
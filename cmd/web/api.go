@@ -0,0 +1,658 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justinas/nosurf"
+	"github.com/sglmr/gowebstart/internal/apitokens"
+	"github.com/sglmr/gowebstart/internal/notes"
+	"github.com/sglmr/gowebstart/internal/openapi"
+	"github.com/sglmr/gowebstart/internal/pagination"
+	"github.com/sglmr/gowebstart/internal/ratelimit"
+	"github.com/sglmr/gowebstart/internal/render"
+	"github.com/sglmr/gowebstart/internal/users"
+	"github.com/sglmr/gowebstart/internal/validator"
+	"github.com/sglmr/gowebstart/internal/vcs"
+)
+
+// apiMaxBodyBytes is the largest JSON request body the API reads
+const apiMaxBodyBytes = 1 << 20
+
+// apiMaxPerPage is the largest page of a list the API returns for the per_page query parameter
+const apiMaxPerPage = 100
+
+// addAPIRoutes adds the routes of the versioned JSON API under /api/v1/. The API has its
+// own middleware stack: API key, API token, or session authentication, JSON errors, rate
+// limiting, and no CSRF tokens. Every route is also described in the OpenAPI document
+// served at /api/openapi.json.
+func addAPIRoutes(
+	mux *http.ServeMux,
+	logger *slog.Logger,
+	cfg config,
+	noteStore notes.Store,
+	tokenStore apitokens.Store,
+	userStore users.Store,
+) {
+	api := http.NewServeMux()
+	spec := newAPISpec()
+	errorBody := spec.Schema("Error", apiErrorBody{})
+
+	// handle adds a route to the API and its operation to the OpenAPI document
+	handle := func(pattern string, handler http.Handler, op openapi.Operation) {
+		api.Handle(pattern, handler)
+		op.Responses["401"] = openapi.JSONResponse("Missing or invalid authentication", errorBody)
+		op.Responses["429"] = openapi.JSONResponse("Rate limit exceeded, retry after the Retry-After seconds", errorBody)
+		spec.Add(pattern, op)
+	}
+
+	note := spec.Schema("Note", apiNote{})
+	noteInput := spec.Schema("NoteInput", apiNoteInput{})
+	noteID := []openapi.Parameter{{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer", Format: "int64"}}}
+	notFound := openapi.JSONResponse("Note not found", errorBody)
+	invalid := openapi.JSONResponse("Invalid fields", errorBody)
+	badRequest := openapi.JSONResponse("Malformed JSON body", errorBody)
+
+	handle("GET /api/v1/me/{$}", apiMe(), openapi.Operation{
+		OperationID: "getMe",
+		Summary:     "Get the authenticated user",
+		Tags:        []string{"users"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("The authenticated user", spec.Schema("User", apiUser{})),
+		},
+	})
+	handle("DELETE /api/v1/tokens/current/{$}", apiTokenRevoke(logger, tokenStore), openapi.Operation{
+		OperationID: "revokeCurrentToken",
+		Summary:     "Revoke the API token of the request",
+		Tags:        []string{"users"},
+		Responses: map[string]openapi.Response{
+			"204": {Description: "The token was revoked"},
+			"400": openapi.JSONResponse("The request wasn't authenticated with an API token", errorBody),
+		},
+	})
+	handle("GET /api/v1/notes/{$}", apiNotesList(logger, noteStore), openapi.Operation{
+		OperationID: "listNotes",
+		Summary:     "List the user's notes, newest first",
+		Tags:        []string{"notes"},
+		Parameters: []openapi.Parameter{
+			{Name: "page", In: "query", Description: "Page number, starting at 1", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "per_page", In: "query", Description: fmt.Sprintf("Notes on a page, at most %d", apiMaxPerPage), Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("A page of notes", spec.Schema("NoteList", apiNoteList{})),
+		},
+	})
+	handle("POST /api/v1/notes/{$}", apiNoteCreate(logger, noteStore), openapi.Operation{
+		OperationID: "createNote",
+		Summary:     "Create a note",
+		Tags:        []string{"notes"},
+		RequestBody: openapi.JSONBody(noteInput),
+		Responses: map[string]openapi.Response{
+			"201": openapi.JSONResponse("The new note", note),
+			"400": badRequest,
+			"422": invalid,
+		},
+	})
+	handle("GET /api/v1/notes/{id}/{$}", apiNoteGet(logger, noteStore), openapi.Operation{
+		OperationID: "getNote",
+		Summary:     "Get a note",
+		Tags:        []string{"notes"},
+		Parameters:  noteID,
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("The note", note),
+			"404": notFound,
+		},
+	})
+	handle("PUT /api/v1/notes/{id}/{$}", apiNoteUpdate(logger, noteStore), openapi.Operation{
+		OperationID: "updateNote",
+		Summary:     "Replace the title and body of a note",
+		Tags:        []string{"notes"},
+		Parameters:  noteID,
+		RequestBody: openapi.JSONBody(noteInput),
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("The updated note", note),
+			"400": badRequest,
+			"404": notFound,
+			"422": invalid,
+		},
+	})
+	handle("DELETE /api/v1/notes/{id}/{$}", apiNoteDelete(logger, noteStore), openapi.Operation{
+		OperationID: "deleteNote",
+		Summary:     "Delete a note",
+		Tags:        []string{"notes"},
+		Parameters:  noteID,
+		Responses: map[string]openapi.Response{
+			"204": {Description: "The note was deleted"},
+			"404": notFound,
+		},
+	})
+
+	// Unknown API paths get a JSON error rather than the HTML 404 page
+	api.Handle("/api/v1/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiError(w, r, http.StatusNotFound, "not found")
+	}))
+
+	var handler http.Handler = api
+	handler = apiRequireAuthMW(handler)
+	if cfg.apiRateLimit > 0 {
+		limiter := ratelimit.PerMinute(cfg.apiRateLimit)
+		limiter.Clock = cfg.clock
+		handler = apiRateLimitMW(limiter)(handler)
+	}
+	handler = apiKeyAuthMW(cfg.apiKeys, cfg.authEmail, tokenStore, userStore, logger)(handler)
+
+	// Register every method, since a method-less pattern conflicts with "GET /"
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		mux.Handle(method+" /api/v1/", handler)
+	}
+
+	// The OpenAPI document is public, and dev mode adds a Swagger UI page to try the API
+	mux.Handle("GET /api/openapi.json", apiSpecJSON(spec, logger))
+	if cfg.devMode {
+		mux.Handle("GET /api/docs/{$}", apiDocs())
+	}
+}
+
+// newAPISpec creates the OpenAPI document of the API, with its ways to authenticate
+func newAPISpec() *openapi.Document {
+	spec := openapi.New("gowebstart API", vcs.Version())
+	spec.Info.Description = "Versioned JSON API. Errors are JSON objects with an error message."
+	spec.AddSecurityScheme("bearerAuth", openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "An API key from the -api-keys flag, or an API token from /account/tokens/",
+	})
+	spec.AddSecurityScheme("apiKeyHeader", openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-API-Key",
+		Description: "An API key from the -api-keys flag",
+	})
+	spec.AddSecurityScheme("sessionCookie", openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "cookie",
+		Name:        "session",
+		Description: "The session cookie of a logged in browser",
+	})
+	return spec
+}
+
+// apiSpecJSON serves the OpenAPI document
+func apiSpecJSON(spec *openapi.Document, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if err := render.JSON(w, r, http.StatusOK, spec); err != nil {
+			apiServerError(w, r, err, logger)
+		}
+	}
+}
+
+// swaggerUIVersion is the swagger-ui-dist release the API docs page loads
+const swaggerUIVersion = "5.18.2"
+
+// swaggerUIOrigin is the CDN the API docs page loads Swagger UI from
+const swaggerUIOrigin = "https://unpkg.com"
+
+// apiDocsPage is a Swagger UI page for the OpenAPI document. It loads Swagger UI from a
+// CDN, so it's only served in dev mode. The script nonce is formatted in per request.
+var apiDocsPage = fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>API docs</title>
+<link rel="stylesheet" href="%[2]s/swagger-ui-dist@%[1]s/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="%[2]s/swagger-ui-dist@%[1]s/swagger-ui-bundle.js" crossorigin></script>
+<script nonce="%%[1]s">
+window.onload = () => { window.ui = SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"}); };
+</script>
+</body>
+</html>
+`, swaggerUIVersion, swaggerUIOrigin)
+
+// apiDocs serves the Swagger UI page
+func apiDocs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nonce := cspNonce(r)
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy(nonce, swaggerUIOrigin))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, apiDocsPage, nonce)
+	}
+}
+
+//=============================================================================
+//	API middleware
+//=============================================================================
+
+const (
+	// apiKeyContextKey is set to true for requests authenticated with an API key
+	apiKeyContextKey = contextKey("apiKey")
+
+	// apiTokenContextKey is the ID of the API token that authenticated a request
+	apiTokenContextKey = contextKey("apiToken")
+)
+
+// apiKeyAuthMW authenticates requests with an API key in an "Authorization: Bearer" or
+// X-API-Key header as the user with email, or with the API token of a user from
+// tokenStore. Requests without a key keep their session authentication.
+func apiKeyAuthMW(
+	keys []string,
+	email string,
+	tokenStore apitokens.Store,
+	userStore users.Store,
+	logger *slog.Logger,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				key = bearer
+			}
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// API tokens authenticate as the user that created them
+			if strings.HasPrefix(key, apitokens.Prefix) {
+				user, token, err := apiTokenUser(r.Context(), tokenStore, userStore, key)
+				if errors.Is(err, apitokens.ErrNotFound) || errors.Is(err, users.ErrNotFound) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+					apiError(w, r, http.StatusUnauthorized, "invalid API token")
+					return
+				}
+				if err != nil {
+					apiServerError(w, r, err, logger)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+				ctx = context.WithValue(ctx, userEmailContextKey, user.Email)
+				ctx = context.WithValue(ctx, userIDContextKey, user.ID)
+				ctx = context.WithValue(ctx, isVerifiedContextKey, user.Verified())
+				ctx = context.WithValue(ctx, roleContextKey, user.Role)
+				ctx = context.WithValue(ctx, apiTokenContextKey, token.ID)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// A wrong key fails the request, even when there's a session
+			if !validAPIKey(keys, key) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				apiError(w, r, http.StatusUnauthorized, "invalid API key")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, userEmailContextKey, email)
+			ctx = context.WithValue(ctx, roleContextKey, users.RoleAdmin)
+			ctx = context.WithValue(ctx, apiKeyContextKey, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiTokenUser returns the API token of a bearer token and the user it belongs to
+func apiTokenUser(ctx context.Context, tokenStore apitokens.Store, userStore users.Store, key string) (*users.User, *apitokens.Token, error) {
+	token, err := apitokens.Lookup(ctx, tokenStore, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := userStore.Get(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, token, nil
+}
+
+// validAPIKey reports whether key is one of keys, in constant time for every key
+func validAPIKey(keys []string, key string) bool {
+	valid := 0
+	for _, k := range keys {
+		valid |= subtle.ConstantTimeCompare([]byte(k), []byte(key))
+	}
+	return valid == 1
+}
+
+// apiRequireAuthMW returns a 401 JSON error for requests without an API key or login.
+func apiRequireAuthMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAuthenticated(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			apiError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiRateLimitMW limits the requests of every user, or of every client IP for anonymous
+// requests, and returns a 429 JSON error with a Retry-After header over the limit.
+// Anonymous requests with an unknown client IP aren't limited, see clientIP.
+func apiRateLimitMW(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "user:" + authenticatedEmail(r)
+			if !isAuthenticated(r) {
+				ip := clientIP(r)
+				if ip == "" {
+					next.ServeHTTP(w, r)
+					return
+				}
+				key = "ip:" + ip
+			}
+
+			if ok, wait := limiter.Allow(key); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				apiError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//=============================================================================
+//	API helpers
+//=============================================================================
+
+// apiErrorBody is the JSON body of every API error
+type apiErrorBody struct {
+	Error  string                 `json:"error"`
+	Fields map[string]string      `json:"fields,omitempty"` // Messages of the invalid fields
+	Errors []validator.FieldError `json:"errors,omitempty"` // Invalid fields with their codes, sorted by field
+}
+
+// apiError writes a JSON error response, like {"error": "not found"}
+func apiError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	render.JSON(w, r, status, apiErrorBody{Error: message})
+}
+
+// apiValidationError writes a 422 JSON error with every invalid field of a form, so
+// the forms of the HTML pages can validate the API input too:
+//
+//	{"error": "invalid fields", "fields": {"Title": "Title is required."},
+//	 "errors": [{"field": "Title", "code": "required", "message": "Title is required."}]}
+func apiValidationError(w http.ResponseWriter, r *http.Request, v validator.Validator) {
+	render.JSON(w, r, http.StatusUnprocessableEntity, apiErrorBody{
+		Error:  "invalid fields",
+		Fields: v.Errors,
+		Errors: v.FieldErrors(),
+	})
+}
+
+// apiServerError logs an error and writes a 500 JSON error that doesn't leak its details
+func apiServerError(w http.ResponseWriter, r *http.Request, err error, logger *slog.Logger) {
+	logger.Error("api server error", "status", http.StatusInternalServerError, "error", err)
+	apiError(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+}
+
+// readJSON decodes a JSON request body into dst. Requiring a JSON content type also
+// keeps the session authenticated API safe without CSRF tokens: browsers can't send a
+// cross-site JSON request without a CORS preflight, which the API doesn't allow.
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return errors.New("the Content-Type header must be application/json")
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, apiMaxBodyBytes)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return fmt.Errorf("body must be less than %d bytes", maxBytesErr.Limit)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		default:
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+	}
+	if decoder.More() {
+		return errors.New("body must only contain one JSON value")
+	}
+	return nil
+}
+
+//=============================================================================
+//	API resources
+//=============================================================================
+
+// apiUser is the JSON representation of the authenticated user
+type apiUser struct {
+	Email string `json:"email"`
+	Auth  string `json:"auth"` // How the request was authenticated: "api_key", "api_token", or "session"
+}
+
+// apiMe returns the authenticated user
+func apiMe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := apiUser{Email: authenticatedEmail(r), Auth: "session"}
+		if apiKey, _ := r.Context().Value(apiKeyContextKey).(bool); apiKey {
+			user.Auth = "api_key"
+		}
+		if _, apiToken := r.Context().Value(apiTokenContextKey).(int64); apiToken {
+			user.Auth = "api_token"
+		}
+		render.JSON(w, r, http.StatusOK, user)
+	}
+}
+
+// apiTokenRevoke revokes the API token that authenticated the request, so a client can
+// log out
+func apiTokenRevoke(logger *slog.Logger, store apitokens.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := r.Context().Value(apiTokenContextKey).(int64)
+		if !ok {
+			apiError(w, r, http.StatusBadRequest, "not authenticated with an API token")
+			return
+		}
+
+		err := store.Delete(r.Context(), authenticatedUserID(r), id)
+		if err != nil && !errors.Is(err, apitokens.ErrNotFound) {
+			apiServerError(w, r, err, logger)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// apiCSRF is the JSON representation of a CSRF token
+type apiCSRF struct {
+	Token  string `json:"token"`
+	Header string `json:"header"` // Request header to send the token in
+}
+
+// apiCSRFToken returns a CSRF token for JavaScript clients. They send it in the
+// X-CSRF-Token header of unsafe requests to routes with CSRF protection.
+func apiCSRFToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		render.JSON(w, r, http.StatusOK, apiCSRF{Token: nosurf.Token(r), Header: nosurf.HeaderName})
+	}
+}
+
+// apiNote is the JSON representation of a note
+type apiNote struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// newAPINote converts a note to its JSON representation
+func newAPINote(note *notes.Note) apiNote {
+	return apiNote{
+		ID:        note.ID,
+		Title:     note.Title,
+		Body:      note.Body,
+		CreatedAt: note.CreatedAt,
+		UpdatedAt: note.UpdatedAt,
+	}
+}
+
+// apiNoteList is a page of notes
+type apiNoteList struct {
+	Notes      []apiNote `json:"notes"`
+	Page       int       `json:"page"`
+	PerPage    int       `json:"per_page"`
+	Total      int       `json:"total"`
+	TotalPages int       `json:"total_pages"`
+}
+
+// apiNoteInput is the JSON request body to create or update a note
+type apiNoteInput struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// form validates the input with the same rules as the notes form
+func (in apiNoteInput) form() noteForm {
+	form := noteForm{Title: in.Title, Body: in.Body}
+	form.check()
+	return form
+}
+
+// apiOwnedNote returns the logged in user's note in the request path, or writes an
+// error response and returns nil
+func apiOwnedNote(w http.ResponseWriter, r *http.Request, store notes.Store, logger *slog.Logger) *notes.Note {
+	note, err := ownedNote(r, store)
+	switch {
+	case errors.Is(err, notes.ErrNotFound):
+		apiError(w, r, http.StatusNotFound, "note not found")
+		return nil
+	case err != nil:
+		apiServerError(w, r, err, logger)
+		return nil
+	}
+	return note
+}
+
+// apiNotesList returns a page of the logged in user's notes
+func apiNotesList(logger *slog.Logger, store notes.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page := pagination.FromRequest(r)
+		perPage := pagination.PerPageFromRequest(r, notesPerPage, apiMaxPerPage)
+
+		list, total, err := store.List(r.Context(), authenticatedEmail(r), perPage, (page-1)*perPage)
+		if err != nil {
+			apiServerError(w, r, err, logger)
+			return
+		}
+
+		data := make([]apiNote, len(list))
+		for i := range list {
+			data[i] = newAPINote(&list[i])
+		}
+
+		pages := pagination.New(page, perPage, total)
+		render.JSON(w, r, http.StatusOK, apiNoteList{
+			Notes:      data,
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: pages.TotalPages(),
+		})
+	}
+}
+
+// apiNoteCreate creates a note for the logged in user
+func apiNoteCreate(logger *slog.Logger, store notes.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input apiNoteInput
+		if err := readJSON(w, r, &input); err != nil {
+			apiError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		form := input.form()
+		if !form.Valid() {
+			apiValidationError(w, r, form.Validator)
+			return
+		}
+
+		note := &notes.Note{Owner: authenticatedEmail(r), Title: form.Title, Body: form.Body}
+		if err := store.Insert(r.Context(), note); err != nil {
+			apiServerError(w, r, err, logger)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/notes/%d/", note.ID))
+		render.JSON(w, r, http.StatusCreated, newAPINote(note))
+	}
+}
+
+// apiNoteGet returns one of the logged in user's notes
+func apiNoteGet(logger *slog.Logger, store notes.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		note := apiOwnedNote(w, r, store, logger)
+		if note == nil {
+			return
+		}
+		render.JSON(w, r, http.StatusOK, newAPINote(note))
+	}
+}
+
+// apiNoteUpdate replaces the title and body of one of the logged in user's notes
+func apiNoteUpdate(logger *slog.Logger, store notes.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		note := apiOwnedNote(w, r, store, logger)
+		if note == nil {
+			return
+		}
+
+		var input apiNoteInput
+		if err := readJSON(w, r, &input); err != nil {
+			apiError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		form := input.form()
+		if !form.Valid() {
+			apiValidationError(w, r, form.Validator)
+			return
+		}
+
+		note.Title, note.Body = form.Title, form.Body
+		if err := store.Update(r.Context(), note); err != nil {
+			apiServerError(w, r, err, logger)
+			return
+		}
+		render.JSON(w, r, http.StatusOK, newAPINote(note))
+	}
+}
+
+// apiNoteDelete deletes one of the logged in user's notes
+func apiNoteDelete(logger *slog.Logger, store notes.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		note := apiOwnedNote(w, r, store, logger)
+		if note == nil {
+			return
+		}
+
+		if err := store.Delete(r.Context(), note.ID); err != nil {
+			apiServerError(w, r, err, logger)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/apitokens"
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/notes"
+	"github.com/sglmr/gowebstart/internal/openapi"
+	"github.com/sglmr/gowebstart/internal/ratelimit"
+)
+
+// apiRequest sends an API request with an optional API key and JSON body, and decodes
+// the JSON response into a map
+func (ts *testServer) apiRequest(t *testing.T, method, path, apiKey string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		assert.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, ts.URL+path, reader)
+	assert.NoError(t, err)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	response, err := ts.Client().Do(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+
+	var data map[string]any
+	if response.StatusCode != http.StatusNoContent {
+		assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(&data))
+	}
+	return response.StatusCode, data
+}
+
+func TestAPIAuth(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Anonymous requests get a JSON error
+	status, data := ts.apiRequest(t, http.MethodGet, "/api/v1/me/", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "authentication required", data["error"])
+
+	// Wrong API keys are rejected
+	status, data = ts.apiRequest(t, http.MethodGet, "/api/v1/me/", "wrong", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid API key", data["error"])
+
+	// API keys authenticate as the auth email user
+	status, data = ts.apiRequest(t, http.MethodGet, "/api/v1/me/", testAPIKey, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, testEmail, data["email"])
+	assert.Equal(t, "api_key", data["auth"])
+
+	// Unknown paths get a JSON 404
+	status, data = ts.apiRequest(t, http.MethodGet, "/api/v1/nothing/", testAPIKey, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "not found", data["error"])
+
+	// Logged in sessions work too, and don't need a CSRF token
+	ts.loginAs(t, testEmail)
+	status, data = ts.apiRequest(t, http.MethodGet, "/api/v1/me/", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "session", data["auth"])
+
+	status, _ = ts.apiRequest(t, http.MethodPost, "/api/v1/notes/", "", map[string]string{"title": "From the session"})
+	assert.Equal(t, http.StatusCreated, status)
+}
+
+func TestAPITokens(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	tokenPattern := regexp.MustCompile(apitokens.Prefix + `[A-Z0-9]+`)
+
+	// Users create tokens on their account page, which shows a new token once
+	ts.loginAs(t, "client@example.com")
+	response := ts.get(t, "/account/tokens/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	form := response.form(t, "/account/tokens/")
+	response = ts.submit(t, form)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+
+	form.values.Set("name", "Deploy script")
+	response = ts.submit(t, form)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "no-store", response.header.Get("Cache-Control"))
+	assert.StringIn(t, "Deploy script", response.body)
+	token := tokenPattern.FindString(response.body)
+	if token == "" {
+		t.Fatal("the page doesn't show the new token")
+	}
+	response = ts.get(t, "/account/tokens/")
+	assert.StringNotIn(t, token, response.body)
+
+	// Tokens authenticate as their user without a session or CSRF token
+	ts.logout(t)
+	status, data := ts.apiRequest(t, http.MethodGet, "/api/v1/me/", token, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "client@example.com", data["email"])
+	assert.Equal(t, "api_token", data["auth"])
+
+	status, _ = ts.apiRequest(t, http.MethodPost, "/api/v1/notes/", token, map[string]string{"title": "From a token"})
+	assert.Equal(t, http.StatusCreated, status)
+	_, total, err := ts.noteStore.List(context.Background(), "client@example.com", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	// Unknown tokens are rejected
+	status, data = ts.apiRequest(t, http.MethodGet, "/api/v1/me/", apitokens.Prefix+"WRONG", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid API token", data["error"])
+
+	// Clients revoke the token they use, and API keys have no token to revoke
+	status, _ = ts.apiRequest(t, http.MethodDelete, "/api/v1/tokens/current/", testAPIKey, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = ts.apiRequest(t, http.MethodDelete, "/api/v1/tokens/current/", token, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = ts.apiRequest(t, http.MethodGet, "/api/v1/me/", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Users revoke tokens on the account page, but not the tokens of other users
+	ts.loginAs(t, "client@example.com")
+	form = ts.get(t, "/account/tokens/").form(t, "/account/tokens/")
+	form.values.Set("name", "Backup")
+	token = tokenPattern.FindString(ts.submit(t, form).body)
+	client, err := ts.userStore.GetByEmail(context.Background(), "client@example.com")
+	assert.NoError(t, err)
+	tokens, err := ts.tokenStore.List(context.Background(), client.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tokens))
+	deletePath := fmt.Sprintf("/account/tokens/%d/delete/", tokens[0].ID)
+
+	ts.loginAs(t, "other@example.com")
+	form = ts.get(t, "/account/tokens/").form(t, "/account/tokens/")
+	response = ts.post(t, deletePath, url.Values{"csrf_token": {form.values.Get("csrf_token")}})
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	ts.loginAs(t, "client@example.com")
+	response = ts.submit(t, ts.get(t, "/account/tokens/").form(t, deletePath))
+	assert.RedirectsTo(t, response.Result(), "/account/tokens/")
+	response = ts.get(t, "/account/tokens/")
+	assert.StringIn(t, "API token revoked.", response.body)
+	status, _ = ts.apiRequest(t, http.MethodGet, "/api/v1/me/", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestAPINotes(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Invalid notes get the field errors
+	status, data := ts.apiRequest(t, http.MethodPost, "/api/v1/notes/", testAPIKey, map[string]string{"body": "Milk"})
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "Title is required.", data["fields"].(map[string]any)["Title"])
+	fieldErr := data["errors"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Title", fieldErr["field"])
+	assert.Equal(t, "required", fieldErr["code"])
+	assert.Equal(t, "Title is required.", fieldErr["message"])
+
+	// Unknown fields are rejected
+	status, _ = ts.apiRequest(t, http.MethodPost, "/api/v1/notes/", testAPIKey, map[string]string{"title": "Groceries", "color": "red"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Create a note
+	status, data = ts.apiRequest(t, http.MethodPost, "/api/v1/notes/", testAPIKey, map[string]string{"title": "Groceries", "body": "Milk"})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "Groceries", data["title"])
+	id := int64(data["id"].(float64))
+	path := fmt.Sprintf("/api/v1/notes/%d/", id)
+
+	// List and get the note
+	status, data = ts.apiRequest(t, http.MethodGet, "/api/v1/notes/", testAPIKey, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, any(float64(1)), data["total"])
+	assert.Equal(t, 1, len(data["notes"].([]any)))
+
+	// The page size is capped
+	status, data = ts.apiRequest(t, http.MethodGet, "/api/v1/notes/?per_page=1000", testAPIKey, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, any(float64(apiMaxPerPage)), data["per_page"])
+
+	status, data = ts.apiRequest(t, http.MethodGet, path, testAPIKey, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Milk", data["body"])
+
+	// Update the note
+	status, data = ts.apiRequest(t, http.MethodPut, path, testAPIKey, map[string]string{"title": "Shopping", "body": "Eggs"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Shopping", data["title"])
+
+	// Notes of other users aren't found
+	other := &notes.Note{Owner: "other@example.com", Title: "Secret"}
+	assert.NoError(t, ts.noteStore.Insert(context.Background(), other))
+	status, _ = ts.apiRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/notes/%d/", other.ID), testAPIKey, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// Delete the note
+	status, _ = ts.apiRequest(t, http.MethodDelete, path, testAPIKey, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	_, err := ts.noteStore.Get(context.Background(), id)
+	assert.Equal(t, notes.ErrNotFound, err)
+}
+
+func TestAPIRateLimit(t *testing.T) {
+	t.Parallel()
+
+	handler := apiRateLimitMW(ratelimit.PerMinute(2))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for range 2 {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/me/", nil))
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/me/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+	assert.StringIn(t, `"error":"rate limit exceeded"`, rr.Body.String())
+
+	// Anonymous requests with an unknown client IP aren't limited
+	for range 3 {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/me/", nil)
+		r.RemoteAddr = "@"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	}
+}
+
+func TestAPISpec(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// The OpenAPI document is public and describes every API route
+	response := ts.get(t, "/api/openapi.json")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+
+	var spec openapi.Document
+	assert.NoError(t, json.Unmarshal([]byte(response.body), &spec))
+	assert.Equal(t, openapi.Version, spec.OpenAPI)
+	assert.Equal(t, 4, len(spec.Paths))
+	assert.Equal(t, "createNote", spec.Paths["/api/v1/notes/"]["post"].OperationID)
+	assert.Equal(t, "id", spec.Paths["/api/v1/notes/{id}/"]["delete"].Parameters[0].Name)
+	assert.Equal(t, "#/components/schemas/Error", spec.Paths["/api/v1/me/"]["get"].Responses["401"].Content["application/json"].Schema.Ref)
+	assert.EqualSlices(t, []string{"email", "auth"}, spec.Components.Schemas["User"].Required)
+
+	// The Swagger UI page is only served in dev mode
+	response = ts.get(t, "/api/docs/")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+}
+
+func TestAPICSRFToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.loginAs(t, testEmail)
+
+	status, data := ts.apiRequest(t, http.MethodGet, "/api/csrf/", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "X-CSRF-Token", data["header"])
+	token, _ := data["token"].(string)
+	assert.NotEqual(t, "", token)
+
+	// Pages with CSRF protection have the token in a meta tag too
+	assert.StringIn(t, `<meta name="csrf-token" content="`, ts.get(t, "/contact/").body)
+
+	logout := func(token string) (int, string) {
+		request, err := http.NewRequest(http.MethodPost, ts.URL+"/logout/", http.NoBody)
+		assert.NoError(t, err)
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("X-CSRF-Token", token)
+		response, err := ts.Client().Do(request)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		return response.StatusCode, string(body)
+	}
+
+	// JavaScript clients get a JSON error without a valid token
+	status, body := logout("wrong")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.StringIn(t, `"error":"invalid CSRF token`, body)
+
+	// The token works in the X-CSRF-Token header, without a form field
+	status, _ = logout(token)
+	assert.Equal(t, http.StatusSeeOther, status)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assetvendor"
+)
+
+// runAssets runs the "assets" subcommands, like "web assets vendor".
+func runAssets(ctx context.Context, w io.Writer, args []string) error {
+	if len(args) < 2 || args[1] != "vendor" {
+		return errors.New("usage: web assets vendor [-manifest file] [-dir dir] [-pin]")
+	}
+
+	fs := flag.NewFlagSet("assets vendor", flag.ExitOnError)
+	manifestFile := fs.String("manifest", "assets/vendor.json", "Manifest of front-end dependencies to vendor")
+	dir := fs.String("dir", "assets/static/vendor", "Directory to download the files into")
+	pin := fs.Bool("pin", false, "Record the checksums of files that don't have one in the manifest")
+
+	err := fs.Parse(args[2:])
+	if err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	manifest, err := assetvendor.Load(*manifestFile)
+	if err != nil {
+		return fmt.Errorf("error loading manifest: %w", err)
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	err = assetvendor.Vendor(ctx, client, manifest, *dir, *pin, w)
+	if err != nil {
+		return fmt.Errorf("error vendoring assets: %w", err)
+	}
+
+	// Save the pinned checksums
+	if *pin {
+		return manifest.Save(*manifestFile)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/assetvendor"
+)
+
+func TestRunAssetsVendor(t *testing.T) {
+	t.Parallel()
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "htmx")
+	}))
+	defer cdn.Close()
+
+	dir := t.TempDir()
+	manifestFile := filepath.Join(dir, "vendor.json")
+	manifest := &assetvendor.Manifest{Files: []assetvendor.File{{Name: "htmx", URL: cdn.URL, Path: "htmx/htmx.min.js"}}}
+	assert.NoError(t, manifest.Save(manifestFile))
+
+	// Pinning records the checksum in the manifest
+	args := []string{"assets", "vendor", "-manifest", manifestFile, "-dir", filepath.Join(dir, "vendor"), "-pin"}
+	err := runAssets(context.Background(), io.Discard, args)
+	assert.NoError(t, err)
+
+	manifest, err = assetvendor.Load(manifestFile)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "", manifest.Files[0].SHA256)
+
+	data, err := os.ReadFile(filepath.Join(dir, "vendor", "htmx", "htmx.min.js"))
+	assert.NoError(t, err)
+	assert.Equal(t, "htmx", string(data))
+
+	// Unknown subcommands print the usage
+	err = runAssets(context.Background(), io.Discard, []string{"assets", "other"})
+	assert.StringIn(t, "usage:", err.Error())
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/email"
+)
+
+// emailPreviewTabs are the parts of a rendered email on the /dev/emails/ preview page
+var emailPreviewTabs = []string{"html", "plain", "subject"}
+
+// emailSamples are the sample data of the email templates on the /dev/emails/ preview
+// pages, like the data the app sends them with. Templates without sample data are
+// rendered with an empty map.
+var emailSamples = map[string]any{
+	"error-notification.tmpl": map[string]any{
+		"BaseURL":       "https://example.com",
+		"Message":       "runtime error: invalid memory address or nil pointer dereference",
+		"RequestMethod": http.MethodGet,
+		"RequestURL":    "/notes/",
+		"Trace":         "goroutine 1 [running]:\nmain.main()\n\t/app/cmd/web/main.go:42 +0x1d",
+	},
+	"example.tmpl":        map[string]any{"Name": "Person"},
+	"login-link.tmpl":     map[string]any{"URL": "https://example.com/login/link/sample-token", "Minutes": 15},
+	"notification.tmpl":   map[string]any{"Title": "Export ready", "Body": "Your notes export is ready to download."},
+	"password-reset.tmpl": map[string]any{"URL": "https://example.com/reset-password/sample-token", "Minutes": 60},
+	"verify-email.tmpl":   map[string]any{"URL": "https://example.com/verify-email/sample-token", "Hours": 48},
+}
+
+// emailTemplateNames returns the names of the email templates in the emails folder of
+// fsys, like "login-link.tmpl"
+func emailTemplateNames(fsys fs.FS) ([]string, error) {
+	files, err := fs.Glob(fsys, "emails/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = path.Base(file)
+	}
+	return names, nil
+}
+
+// emailSample returns the sample data of an email template
+func emailSample(name string) any {
+	if data, ok := emailSamples[name]; ok {
+		return data
+	}
+	return map[string]any{}
+}
+
+// devEmails handles the dev mode page that lists the email templates to preview
+func devEmails(
+	logger *slog.Logger,
+	showTrace bool,
+	templates fs.FS,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := emailTemplateNames(templates)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Templates"] = names
+
+		if err := renderPage(w, r, http.StatusOK, data, "dev-emails.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// devEmailPreview handles the dev mode page that renders an email template with its
+// sample data, with a tab for the HTML body, the plain body, and the subject. Templates
+// are rendered again for every request, so edits show up with a reload.
+func devEmailPreview(
+	logger *slog.Logger,
+	showTrace bool,
+	templates fs.FS,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		names, err := emailTemplateNames(templates)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		if !slices.Contains(names, name) {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		tab := r.URL.Query().Get("tab")
+		if !slices.Contains(emailPreviewTabs, tab) {
+			tab = emailPreviewTabs[0]
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Name"] = name
+		data["Tab"] = tab
+		data["Tabs"] = emailPreviewTabs
+
+		// Template errors are shown on the page, so a broken edit can be fixed and reloaded
+		content, err := email.RenderFS(templates, emailSample(name), name)
+		if err != nil {
+			data["Error"] = err.Error()
+		} else {
+			data["Content"] = content
+		}
+
+		if err := renderPage(w, r, http.StatusOK, data, "dev-email.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// devEmailHTML handles the HTML body of an email template with its sample data, for the
+// frame of the preview page. The page frames it from the same origin, and the sandbox
+// keeps its scripts from running like in an email client.
+func devEmailHTML(
+	logger *slog.Logger,
+	showTrace bool,
+	templates fs.FS,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		names, err := emailTemplateNames(templates)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		if !slices.Contains(names, name) {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		content, err := email.RenderFS(templates, emailSample(name), name)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "sandbox; frame-ancestors 'self'")
+		w.Header().Set("X-Frame-Options", "sameorigin")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(content.HTMLBody))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestDevEmails(t *testing.T) {
+	t.Parallel()
+
+	// The previews are only in dev mode
+	ts := newTestServer(t)
+	defer ts.Close()
+	response := ts.get(t, "/dev/emails/")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	ts = newTestServer(t, withConfig(func(cfg *config) { cfg.devMode = true }))
+	defer ts.Close()
+
+	// Every email template is listed
+	response = ts.get(t, "/dev/emails/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	for name := range emailSamples {
+		assert.StringIn(t, `<a href="/dev/emails/`+name+`">`, response.body)
+	}
+
+	// The HTML tab frames the HTML body, and the other tabs show the text
+	response = ts.get(t, "/dev/emails/login-link.tmpl")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, `<iframe src="/dev/emails/login-link.tmpl/html"`, response.body)
+	assert.StringIn(t, `<a href="?tab=plain">plain</a>`, response.body)
+
+	response = ts.get(t, "/dev/emails/login-link.tmpl?tab=plain")
+	assert.StringIn(t, "https://example.com/login/link/sample-token", response.body)
+	assert.StringIn(t, "for 15 minutes", response.body)
+
+	response = ts.get(t, "/dev/emails/login-link.tmpl?tab=subject")
+	assert.StringIn(t, "<strong>Your login link</strong>", response.body)
+
+	// Plain text templates don't have an HTML body to frame
+	response = ts.get(t, "/dev/emails/error-notification.tmpl")
+	assert.StringIn(t, "doesn't have an HTML body", response.body)
+
+	// The framed HTML body is sandboxed
+	response = ts.get(t, "/dev/emails/login-link.tmpl/html")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, `<a href="https://example.com/login/link/sample-token">Log in</a>`, response.body)
+	assert.Equal(t, "sandbox; frame-ancestors 'self'", response.header.Get("Content-Security-Policy"))
+	assert.Equal(t, "sameorigin", response.header.Get("X-Frame-Options"))
+
+	// Only email templates can be previewed
+	response = ts.get(t, "/dev/emails/missing.tmpl")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+	response = ts.get(t, "/dev/emails/missing.tmpl/html")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+}
+
+func TestDevEmailsTemplateError(t *testing.T) {
+	t.Parallel()
+
+	// Templates are read from cfg.emailTemplates, and errors are shown on the page
+	templates := fstest.MapFS{
+		"emails/draft.tmpl": {Data: []byte(`{{define "subject"}}{{template "header" .}}{{end}}{{define "plainBody"}}Draft{{end}}`)},
+	}
+	ts := newTestServer(t, withConfig(func(cfg *config) {
+		cfg.devMode = true
+		cfg.emailTemplates = templates
+	}))
+	defer ts.Close()
+
+	response := ts.get(t, "/dev/emails/")
+	assert.StringIn(t, `<a href="/dev/emails/draft.tmpl">`, response.body)
+	assert.StringNotIn(t, "login-link.tmpl", response.body)
+
+	response = ts.get(t, "/dev/emails/draft.tmpl")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, `<pre style="color:red;">`, response.body)
+	assert.StringIn(t, `template &#34;header&#34; not defined`, response.body)
+}
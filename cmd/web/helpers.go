@@ -1,13 +1,28 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/justinas/nosurf"
+	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/htmx"
+	"github.com/sglmr/gowebstart/internal/livereload"
+	"github.com/sglmr/gowebstart/internal/render"
+	"github.com/sglmr/gowebstart/internal/reporting"
+	"github.com/sglmr/gowebstart/internal/tenant"
+	"github.com/sglmr/gowebstart/internal/users"
 	"github.com/sglmr/gowebstart/internal/vcs"
 )
 
@@ -19,25 +34,108 @@ type contextKey string
 
 // newTemplateData constructs a map of data to pass into templates
 func newTemplateData(r *http.Request, sessionManager *scs.SessionManager) map[string]any {
-	messages, ok := sessionManager.Pop(r.Context(), "messages").([]FlashMessage)
-	if !ok {
+	// Sticky messages stay in the session until they're dismissed, and come first
+	sticky, _ := sessionManager.Get(r.Context(), stickyMessageKey).([]FlashMessage)
+	popped, _ := sessionManager.Pop(r.Context(), flashMessageKey).([]FlashMessage)
+	messages := append(slices.Clone(sticky), popped...)
+	if messages == nil {
 		messages = []FlashMessage{}
 	}
 
-	return map[string]any{
-		"CSRFToken":       nosurf.Token(r),
-		"IsAuthenticated": isAuthenticated(r),
-		"Messages":        messages,
-		"UrlPath":         r.URL.Path,
-		"Version":         vcs.Version(),
+	data := requestTemplateData(r)
+	data["Messages"] = messages
+	return data
+}
+
+// requestTemplateData constructs the template data that comes from the request context.
+// It leaves out the flash messages of the session, which newTemplateData adds, so error
+// pages can be rendered without the session manager and without using up the messages.
+func requestTemplateData(r *http.Request) map[string]any {
+	data := map[string]any{
+		"CSPNonce":            cspNonce(r),
+		"CSRFToken":           nosurf.Token(r),
+		"IsAuthenticated":     isAuthenticated(r),
+		"HasRole":             func(role string) bool { return hasRole(r, role) },
+		"Locale":              requestLocale(r),
+		"Locales":             assets.Locales().Locales(),
+		"Messages":            []FlashMessage{},
+		"RequestURL":          r.URL,
+		"Settings":            siteSettings(r),
+		"Tenant":              tenant.FromContext(r.Context()),
+		"UnreadNotifications": unreadNotifications(r),
+		"UrlPath":             r.URL.Path,
+		"Version":             vcs.Version(),
+	}
+
+	// Include the live reload script in dev mode
+	if liveReload, _ := r.Context().Value(liveReloadContextKey).(bool); liveReload {
+		data["LiveReloadScript"] = template.JS(livereload.Script)
+	}
+
+	return data
+}
+
+// errNoTemplates is returned by renderPage outside of templatesMW
+var errNoTemplates = errors.New("no page templates in the request context")
+
+// renderPage renders a full template page, or only its "page:main" block for htmx requests
+// that swap the page content. The templates come from templatesMW.
+func renderPage(w http.ResponseWriter, r *http.Request, status int, data any, pageName string) error {
+	templates, ok := r.Context().Value(templatesContextKey).(*render.Cache)
+	if !ok {
+		return errNoTemplates
+	}
+	return templates.Partial(w, r, status, data, pageName, "page:main")
+}
+
+// redirect sends a redirect that htmx follows with a full page load. A plain redirect
+// response would be followed by the htmx ajax request and swapped into the page.
+func redirect(w http.ResponseWriter, r *http.Request, url string, status int) {
+	if htmx.IsRequest(r) {
+		htmx.Redirect(w, url)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, url, status)
+}
+
+//=============================================================================
+//	Translation helpers
+//=============================================================================
+
+// requestLocale returns the locale of the request. The function checks the request
+// context for a localeContextKey value
+func requestLocale(r *http.Request) string {
+	locale, ok := r.Context().Value(localeContextKey).(string)
+	if !ok {
+		return assets.DefaultLocale
+	}
+	return locale
+}
+
+// translate returns the translation of a message for the locale of the request, like
+// the t template function. Messages with args are fmt format strings.
+func translate(r *http.Request, message string, args ...any) string {
+	return assets.Locales().Translate(requestLocale(r), message, args...)
+}
+
+// localRedirectPath returns path when it's a path on this site, or "/". It keeps
+// redirects to a page from a form value from going to another site.
+func localRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
 	}
+	return path
 }
 
 //=============================================================================
 //	Flash Message functions
 //=============================================================================
 
-const flashMessageKey = "messages"
+const (
+	flashMessageKey  = "messages"
+	stickyMessageKey = "stickyMessages"
+)
 
 type flashLevel string
 
@@ -49,28 +147,127 @@ const (
 	flashError   flashLevel = "error"
 )
 
+// FlashMessage is a message shown on the next rendered page. Messages are shown in the
+// order they were added. Sticky messages from putStickyFlash are shown on every page
+// instead, until they're dismissed.
 type FlashMessage struct {
+	ID      string // ID of a sticky message, empty for messages shown once
 	Level   flashLevel
+	Title   string // Optional heading of the message
 	Message string
+
+	// Dismissable shows a button that hides the message
+	Dismissable bool
+
+	// TTL hides the message after it's been shown for this long. Zero keeps it on the page.
+	TTL time.Duration
+}
+
+// flashLock returns the lock of the flash messages of a request from flashLockMW. It
+// makes adding a flash message one step, so goroutines of a request that add messages
+// at once don't lose any or change their order. Every request has its own copy of the
+// session data, so requests don't share a lock. Outside of flashLockMW, the lock isn't
+// shared with anything.
+func flashLock(r *http.Request) *sync.Mutex {
+	if mu, ok := r.Context().Value(flashLockContextKey).(*sync.Mutex); ok {
+		return mu
+	}
+	return new(sync.Mutex)
+}
+
+// putFlash adds a flash message into the session manager, after the messages added before
+func putFlash(r *http.Request, message FlashMessage, sessionManager *scs.SessionManager) {
+	mu := flashLock(r)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Copy the messages of the session, so the stored slice isn't changed in place
+	messages, _ := sessionManager.Get(r.Context(), flashMessageKey).([]FlashMessage)
+	messages = append(slices.Clip(messages), message)
+	sessionManager.Put(r.Context(), flashMessageKey, messages)
 }
 
-// putFlashMessage adds a flash message into the session manager
-func putFlashMessage(r *http.Request, level flashLevel, message string, sessionManager *scs.SessionManager) {
-	newMessage := FlashMessage{
-		Level:   level,
-		Message: message,
+// putStickyFlash adds a sticky flash message into the session manager, which is shown on
+// every page until the user dismisses it or it's removed with removeStickyFlash, like
+// a reminder to verify the email. It replaces the sticky message with the same id.
+func putStickyFlash(r *http.Request, id string, message FlashMessage, sessionManager *scs.SessionManager) {
+	mu := flashLock(r)
+	mu.Lock()
+	defer mu.Unlock()
+
+	message.ID = id
+	messages, _ := sessionManager.Get(r.Context(), stickyMessageKey).([]FlashMessage)
+	messages = slices.Clone(messages)
+	if i := slices.IndexFunc(messages, func(m FlashMessage) bool { return m.ID == id }); i >= 0 {
+		messages[i] = message
+	} else {
+		messages = append(messages, message)
 	}
+	sessionManager.Put(r.Context(), stickyMessageKey, messages)
+}
+
+// removeStickyFlash removes the sticky flash message with an id from the session manager
+func removeStickyFlash(r *http.Request, id string, sessionManager *scs.SessionManager) {
+	mu := flashLock(r)
+	mu.Lock()
+	defer mu.Unlock()
 
-	// Create a new flashMessageKey context key if one doesn't exist and add the message
-	messages, ok := sessionManager.Get(r.Context(), flashMessageKey).([]FlashMessage)
+	messages, ok := sessionManager.Get(r.Context(), stickyMessageKey).([]FlashMessage)
 	if !ok {
-		sessionManager.Put(r.Context(), flashMessageKey, []FlashMessage{newMessage})
 		return
 	}
+	messages = slices.DeleteFunc(slices.Clone(messages), func(m FlashMessage) bool { return m.ID == id })
+	if len(messages) == 0 {
+		sessionManager.Remove(r.Context(), stickyMessageKey)
+		return
+	}
+	sessionManager.Put(r.Context(), stickyMessageKey, messages)
+}
 
-	// Add a flash message to an existing flashMessageKey context key
-	messages = append(messages, newMessage)
-	sessionManager.Put(r.Context(), flashMessageKey, messages)
+// putFlashInfo adds an info flash message into the session manager
+func putFlashInfo(r *http.Request, message string, sessionManager *scs.SessionManager) {
+	putFlash(r, FlashMessage{Level: flashInfo, Message: message}, sessionManager)
+}
+
+// putFlashSuccess adds a success flash message into the session manager
+func putFlashSuccess(r *http.Request, message string, sessionManager *scs.SessionManager) {
+	putFlash(r, FlashMessage{Level: flashSuccess, Message: message}, sessionManager)
+}
+
+// putFlashWarning adds a warning flash message into the session manager
+func putFlashWarning(r *http.Request, message string, sessionManager *scs.SessionManager) {
+	putFlash(r, FlashMessage{Level: flashWarning, Message: message}, sessionManager)
+}
+
+// putFlashError adds an error flash message into the session manager
+func putFlashError(r *http.Request, message string, sessionManager *scs.SessionManager) {
+	putFlash(r, FlashMessage{Level: flashError, Message: message}, sessionManager)
+}
+
+//=============================================================================
+//	Request Helper functions
+//=============================================================================
+
+// baseURL returns the scheme and host of the request, like "https://example.com". It
+// trusts the X-Forwarded-Proto header because the app is expected to run behind a
+// reverse proxy that handles HTTPS.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// absoluteURL returns the URL of path on the site for links in emails. It uses base, the
+// -base-url flag, because the Host header of a request can be set by anyone. Without it,
+// it falls back to baseURL. Links for a tenant go to its subdomain of base, where its
+// users can log in.
+func absoluteURL(r *http.Request, base, path string) string {
+	if base == "" {
+		return baseURL(r) + path
+	}
+	return tenant.URL(r.Context(), base) + path
 }
 
 //=============================================================================
@@ -79,10 +276,15 @@ func putFlashMessage(r *http.Request, level flashLevel, message string, sessionM
 
 // serverError handles server error http responses.
 func serverError(w http.ResponseWriter, r *http.Request, err error, logger *slog.Logger, showTrace bool) {
-	// TODO: find some way of reporting the server error
-	// app.reportserverError(r, err)
+	// Send the error to the error tracker of errorReporterMW
+	errorReporter(r).Report(r.Context(), err, r)
 
-	message := "The server encountered a problem and could not process your request"
+	// Display a diagnostic page for template errors if env is development is on
+	var renderErr *render.Error
+	if showTrace && errors.As(err, &renderErr) {
+		templateError(w, r, renderErr)
+		return
+	}
 
 	// Display the stack trace on the web page if env is development is on
 	if showTrace {
@@ -90,13 +292,79 @@ func serverError(w http.ResponseWriter, r *http.Request, err error, logger *slog
 		http.Error(w, body, http.StatusInternalServerError)
 		return
 	}
-	logger.Error("server error", "status", http.StatusInternalServerError, "error", err)
+	logger.Error("server error", "status", http.StatusInternalServerError, "error", err, "request_id", requestID(r))
+
+	// The request ID lets users point out the error in the logs
+	data := requestTemplateData(r)
+	data["RequestID"] = requestID(r)
+	if renderPage(w, r, http.StatusInternalServerError, data, "500.tmpl") == nil {
+		return
+	}
 
+	// Fall back to plain text when the error page is broken too
+	message := "The server encountered a problem and could not process your request"
+	if id := requestID(r); id != "" {
+		message = fmt.Sprintf("%s (request ID %s)", message, id)
+	}
 	http.Error(w, message, http.StatusInternalServerError)
 }
 
-// clientError returns a user/client error response
-func clientError(w http.ResponseWriter, status int) {
+// templateErrorPage is the development mode diagnostic page for template errors. It is
+// self-contained so it still renders when the site templates are broken.
+var templateErrorPage = template.Must(template.New("templateError").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Template error: {{.Err.Template}}</title>
+<style nonce="{{.CSPNonce}}">
+body { font-family: ui-sans-serif, system-ui, sans-serif; margin: 2rem; color: #1f2937; }
+h1 { color: #b91c1c; font-size: 1.5rem; }
+dt { font-weight: bold; margin-top: 0.75rem; }
+code, pre { font-family: ui-monospace, monospace; }
+pre { background: #f3f4f6; padding: 1rem; overflow-x: auto; }
+.error-line { background: #fecaca; display: block; }
+</style>
+</head>
+<body>
+<h1>Template error</h1>
+<p><code>{{.Err.Message}}</code></p>
+<dl>
+{{with .Err.Template}}<dt>Template</dt><dd><code>{{.}}</code></dd>{{end}}
+{{with .Err.Line}}<dt>Line</dt><dd>{{.}}{{with $.Err.Column}}, column {{.}}{{end}}</dd>{{end}}
+{{with .Err.Definition}}<dt>Executing</dt><dd><code>{{.}}</code></dd>{{end}}
+{{with .Err.Expression}}<dt>Expression</dt><dd><code>{{.}}</code></dd>{{end}}
+<dt>Data keys</dt><dd>{{range .Err.DataKeys}}<code>.{{.}}</code> {{else}}none{{end}}</dd>
+</dl>
+{{with .Err.Source}}<pre>{{range .}}<span{{if .IsError}} class="error-line"{{end}}>{{printf "%4d" .Number}}  {{.Text}}</span>
+{{end}}</pre>{{end}}
+<pre>{{.Err.Err}}</pre>
+{{with .LiveReloadScript}}<script nonce="{{$.CSPNonce}}">{{.}}</script>{{end}}
+</body>
+</html>
+`))
+
+// templateError writes the development mode diagnostic page for a template error.
+func templateError(w http.ResponseWriter, r *http.Request, err *render.Error) {
+	data := map[string]any{"Err": err, "CSPNonce": cspNonce(r)}
+
+	// Reload the page when the broken template is fixed
+	if liveReload, _ := r.Context().Value(liveReloadContextKey).(bool); liveReload {
+		data["LiveReloadScript"] = template.JS(livereload.Script)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	templateErrorPage.Execute(w, data)
+}
+
+// clientError returns a user/client error response. Not found errors get the 404.tmpl
+// page, and other errors the status text.
+func clientError(w http.ResponseWriter, r *http.Request, status int) {
+	if status == http.StatusNotFound && renderPage(w, r, status, requestTemplateData(r), "404.tmpl") == nil {
+		return
+	}
+
+	// Fall back to plain text when the error page is broken
 	http.Error(w, http.StatusText(status), status)
 }
 
@@ -105,10 +373,45 @@ func clientError(w http.ResponseWriter, status int) {
 //=============================================================================
 
 const (
+	liveReloadContextKey      = contextKey("liveReload")
+	localeContextKey          = contextKey("locale")
 	isAuthenticatedContextKey = contextKey("isAuthenticated")
 	isAnonyousContextKey      = contextKey("isAnonymous")
+	userEmailContextKey       = contextKey("userEmail")
+	userIDContextKey          = contextKey("userID")
+	isVerifiedContextKey      = contextKey("isVerified")
+	roleContextKey            = contextKey("role")
+	requestIDContextKey       = contextKey("requestID")
+	cspNonceContextKey        = contextKey("cspNonce")
+	errorReporterContextKey   = contextKey("errorReporter")
+	templatesContextKey       = contextKey("templates")
+	flashLockContextKey       = contextKey("flashLock")
+	clientIPContextKey        = contextKey("clientIP")
 )
 
+// errorReporter returns the error reporter of a request from errorReporterMW, or one
+// that drops errors outside of it
+func errorReporter(r *http.Request) reporting.ErrorReporter {
+	reporter, ok := r.Context().Value(errorReporterContextKey).(reporting.ErrorReporter)
+	if !ok {
+		return reporting.Nop{}
+	}
+	return reporter
+}
+
+// cspNonce returns the Content-Security-Policy nonce of a request from secureHeadersMW
+// for the nonce attribute of <script> and <style> elements
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey).(string)
+	return nonce
+}
+
+// requestID returns the ID of a request from requestIDMW, or "" outside of it
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
 // isAuthenticated returns true when a user is authenticated. The function checks the
 // request context for a isAuthenticatedContextKey value
 func isAuthenticated(r *http.Request) bool {
@@ -118,3 +421,96 @@ func isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// authenticatedEmail returns the email of the authenticated user, or "" for anonymous
+// users. The function checks the request context for a userEmailContextKey value
+func authenticatedEmail(r *http.Request) string {
+	email, _ := r.Context().Value(userEmailContextKey).(string)
+	return email
+}
+
+// authenticatedUserID returns the ID of the authenticated user, or 0 for anonymous users
+// and API keys. The function checks the request context for a userIDContextKey value
+func authenticatedUserID(r *http.Request) int64 {
+	id, _ := r.Context().Value(userIDContextKey).(int64)
+	return id
+}
+
+// startSession logs a user in: it renews the session token, so the session ID changes,
+// and saves the keys that authenticateMW reads
+func startSession(r *http.Request, sessionManager *scs.SessionManager, user *users.User) error {
+	err := sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+	sessionManager.Put(r.Context(), "authenticated", true)
+	sessionManager.Put(r.Context(), "userID", user.ID)
+	sessionManager.Put(r.Context(), "tenant", tenant.ID(r.Context()))
+	return nil
+}
+
+// isVerified returns true when the authenticated user verified their email. The function
+// checks the request context for a isVerifiedContextKey value
+func isVerified(r *http.Request) bool {
+	verified, _ := r.Context().Value(isVerifiedContextKey).(bool)
+	return verified
+}
+
+// hasRole returns true when the authenticated user has the permissions of role, see
+// users.HasRole. The function checks the request context for a roleContextKey value
+func hasRole(r *http.Request, role string) bool {
+	userRole, _ := r.Context().Value(roleContextKey).(string)
+	return users.HasRole(userRole, role)
+}
+
+// clientIP returns the IP address of the client of a request from clientIPMW, or ""
+// when it isn't known, like behind a proxy that doesn't send it. Outside of clientIPMW,
+// it's the peer address of the connection.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return resolveClientIP(r, nil)
+}
+
+// resolveClientIP returns the IP address of the client of a request. The peer of the
+// connection is the client, unless it's one of the trustedProxies or a unix socket, which
+// only a local proxy can connect to. The client of a proxy is the last address of the
+// X-Forwarded-For header that isn't a trusted proxy, or the X-Real-IP header. It returns
+// "" when a proxy doesn't send a valid client address.
+func resolveClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	trusted := func(ip netip.Addr) bool {
+		return slices.ContainsFunc(trustedProxies, func(p netip.Prefix) bool { return p.Contains(ip) })
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err == nil && !trusted(peer.Unmap()) {
+		return peer.Unmap().String()
+	}
+
+	// Walk the proxies from the closest one back, since clients can send any addresses
+	// in front of the ones the proxies added
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for _, address := range slices.Backward(forwarded) {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		ip, err := netip.ParseAddr(address)
+		if err != nil {
+			return ""
+		}
+		if !trusted(ip.Unmap()) {
+			return ip.Unmap().String()
+		}
+	}
+
+	if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return ip.Unmap().String()
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/render"
+)
+
+func TestServerErrorTemplate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	err := &render.Error{
+		Template:   "home.tmpl",
+		Line:       12,
+		Expression: ".Form.Name",
+		Message:    "nil pointer evaluating *main.contactForm.Name",
+		DataKeys:   []string{"CSRFToken", "Form"},
+		Err:        errors.New("ExecuteTemplate: template: home.tmpl:12:5: ..."),
+	}
+
+	// Dev mode shows the diagnostic page
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	serverError(rr, r, err, logger, true)
+	assert.Status(t, rr.Result(), http.StatusInternalServerError)
+	assert.Header(t, rr.Result(), "Content-Type", "text/html")
+	assert.StringIn(t, "<code>home.tmpl</code>", rr.Body.String())
+	assert.StringIn(t, "<code>.Form.Name</code>", rr.Body.String())
+	assert.StringIn(t, "<code>.CSRFToken</code>", rr.Body.String())
+
+	// Production hides the details
+	rr = httptest.NewRecorder()
+	serverError(rr, r, err, logger, false)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.StringNotIn(t, "home.tmpl", rr.Body.String())
+}
+
+func TestServerErrorPage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The 500 page shows the request ID
+	rr := httptest.NewRecorder()
+	r := withTemplates(httptest.NewRequest(http.MethodGet, "/", nil))
+	r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey, "abc123"))
+	serverError(rr, r, errors.New("database is down"), logger, false)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.StringIn(t, "<title>Server error", rr.Body.String())
+	assert.StringIn(t, "<code>abc123</code>", rr.Body.String())
+	assert.StringNotIn(t, "database is down", rr.Body.String())
+}
+
+func TestClientError(t *testing.T) {
+	t.Parallel()
+
+	// Not found errors get the 404 page
+	rr := httptest.NewRecorder()
+	r := withTemplates(httptest.NewRequest(http.MethodGet, "/missing/", nil))
+	clientError(rr, r, http.StatusNotFound)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.StringIn(t, "<title>Page not found", rr.Body.String())
+
+	// Other errors get the status text
+	rr = httptest.NewRecorder()
+	clientError(rr, r, http.StatusBadRequest)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "Bad Request\n", rr.Body.String())
+}
+
+func TestLocalRedirectPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/notes/?page=2", "/notes/?page=2"},
+		{"", "/"},
+		{"https://example.com/", "/"},
+		{"//example.com/", "/"},
+		{`/\example.com/`, "/"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, localRedirectPath(tt.path))
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", "203.0.113.1:1234", nil, "203.0.113.1"},
+		{"direct ignores headers", "203.0.113.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"}, "203.0.113.1"},
+		{"direct IPv6", "[2001:db8::1]:1234", nil, "2001:db8::1"},
+		{"IPv4 mapped", "[::ffff:203.0.113.1]:1234", nil, "203.0.113.1"},
+		{"proxy forwarded", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"proxy skips spoofed", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.0.2.1, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "[::1]:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"proxy real IP", "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"proxy invalid", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "unknown, 10.0.0.2"}, ""},
+		{"proxy without headers", "10.0.0.1:1234", nil, ""},
+		{"unix socket forwarded", "@", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"unix socket without headers", "@", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.want, resolveClientIP(r, trusted))
+		})
+	}
+
+	// Without trusted proxies, the peer is the client
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	assert.Equal(t, "10.0.0.1", resolveClientIP(r, nil))
+}
+
+func TestFlashMessages(t *testing.T) {
+	t.Parallel()
+
+	sessionManager := scs.New()
+	ctx, err := sessionManager.Load(context.Background(), "")
+	assert.NoError(t, err)
+	r := withTemplates(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	// Messages are shown in the order they were added
+	putFlashInfo(r, "First", sessionManager)
+	putFlashSuccess(r, "Second", sessionManager)
+	putFlash(r, FlashMessage{Level: flashWarning, Title: "Heads up", Message: "Third", Dismissable: true, TTL: 5 * time.Second}, sessionManager)
+	putFlashError(r, "Fourth", sessionManager)
+
+	data := newTemplateData(r, sessionManager)
+	messages := data["Messages"].([]FlashMessage)
+	assert.Equal(t, 4, len(messages))
+	assert.Equal(t, FlashMessage{Level: flashInfo, Message: "First"}, messages[0])
+	assert.Equal(t, FlashMessage{Level: flashSuccess, Message: "Second"}, messages[1])
+	assert.Equal(t, FlashMessage{Level: flashWarning, Title: "Heads up", Message: "Third", Dismissable: true, TTL: 5 * time.Second}, messages[2])
+	assert.Equal(t, FlashMessage{Level: flashError, Message: "Fourth"}, messages[3])
+
+	// The title, dismiss button, and expiry are rendered
+	rr := httptest.NewRecorder()
+	assert.NoError(t, renderPage(rr, r, http.StatusOK, data, "home.tmpl"))
+	assert.StringIn(t, "<strong>Heads up</strong>", rr.Body.String())
+	assert.StringIn(t, `data-flash-ttl="5000"`, rr.Body.String())
+	assert.StringIn(t, `<button type="button" data-flash-dismiss aria-label="Dismiss">`, rr.Body.String())
+	assert.Equal(t, 1, strings.Count(rr.Body.String(), "data-flash-dismiss aria-label"))
+
+	// Showing the messages uses them up
+	data = newTemplateData(r, sessionManager)
+	assert.Equal(t, 0, len(data["Messages"].([]FlashMessage)))
+
+	// Messages added at once by goroutines of a request are all kept
+	flashLockMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				putFlashInfo(r, strconv.Itoa(i), sessionManager)
+			}()
+		}
+		wg.Wait()
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	data = newTemplateData(r, sessionManager)
+	assert.Equal(t, 20, len(data["Messages"].([]FlashMessage)))
+}
+
+func TestStickyFlashMessages(t *testing.T) {
+	t.Parallel()
+
+	sessionManager := scs.New()
+	ctx, err := sessionManager.Load(context.Background(), "")
+	assert.NoError(t, err)
+	r := withTemplates(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	// A sticky message with the same ID replaces the one before
+	putStickyFlash(r, "reminder", FlashMessage{Level: flashInfo, Message: "Old"}, sessionManager)
+	putStickyFlash(r, "reminder", FlashMessage{Level: flashWarning, Message: "New"}, sessionManager)
+	putFlashSuccess(r, "Once", sessionManager)
+
+	// Sticky messages come first, and are shown again on the next page
+	messages := newTemplateData(r, sessionManager)["Messages"].([]FlashMessage)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, FlashMessage{ID: "reminder", Level: flashWarning, Message: "New"}, messages[0])
+	assert.Equal(t, "Once", messages[1].Message)
+
+	messages = newTemplateData(r, sessionManager)["Messages"].([]FlashMessage)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, "reminder", messages[0].ID)
+
+	// Sticky messages have a dismiss form
+	rr := httptest.NewRecorder()
+	assert.NoError(t, renderPage(rr, r, http.StatusOK, newTemplateData(r, sessionManager), "home.tmpl"))
+	assert.StringIn(t, `<input type="hidden" name="id" value="reminder">`, rr.Body.String())
+
+	// Removed messages aren't shown anymore
+	removeStickyFlash(r, "reminder", sessionManager)
+	messages = newTemplateData(r, sessionManager)["Messages"].([]FlashMessage)
+	assert.Equal(t, 0, len(messages))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sglmr/gowebstart/internal/email"
+	"github.com/sglmr/gowebstart/internal/jobs"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+)
+
+// Job kinds run by the job queue
+const (
+	jobSendEmail      = "send_email"
+	jobDeliverWebhook = "deliver_webhook"
+)
+
+// emailJob is the payload of a jobSendEmail job, like email.Message. One job sends one
+// email to every To, Cc, and Bcc recipient.
+type emailJob struct {
+	To        []string
+	Cc        []string
+	Bcc       []string
+	ReplyTo   string
+	Headers   map[string]string
+	Data      map[string]any
+	Templates []string
+
+	// Attachments are saved with the job, so keep them small
+	Attachments []email.Attachment
+
+	// Recipient is the To address of jobs queued before emails had a list of recipients
+	Recipient string
+}
+
+// webhookJob is the payload of a jobDeliverWebhook job
+type webhookJob struct {
+	EndpointID int64
+	Event      webhooks.Event
+}
+
+// registerJobs registers the handlers for every job kind the application enqueues.
+func registerJobs(jobQueue *jobs.Queue, mailer email.MailerInterface, dispatcher *webhooks.Dispatcher) {
+	jobQueue.Register(jobSendEmail, func(ctx context.Context, job *jobs.Job) error {
+		var p emailJob
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		if p.Recipient != "" {
+			p.To = append(p.To, p.Recipient)
+		}
+		return mailer.Send(ctx, email.Message{
+			To:          p.To,
+			Cc:          p.Cc,
+			Bcc:         p.Bcc,
+			ReplyTo:     p.ReplyTo,
+			Headers:     p.Headers,
+			Data:        p.Data,
+			Templates:   p.Templates,
+			Attachments: p.Attachments,
+		})
+	})
+
+	jobQueue.Register(jobDeliverWebhook, func(ctx context.Context, job *jobs.Job) error {
+		var p webhookJob
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		return dispatcher.Deliver(ctx, p.EndpointID, p.Event)
+	})
+}
+
+// emitWebhook queues a delivery job of an event for every endpoint subscribed to its type.
+// Every endpoint gets its own job, so a failing endpoint is retried on its own.
+func emitWebhook(ctx context.Context, jobQueue *jobs.Queue, store webhooks.Store, eventType string, data any) error {
+	endpoints, err := webhooks.Subscribers(ctx, store, eventType)
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+
+	event, err := webhooks.NewEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		err := jobQueue.Enqueue(ctx, jobDeliverWebhook, webhookJob{EndpointID: endpoint.ID, Event: event})
+		if err != nil {
+			return fmt.Errorf("queueing %s webhook: %w", eventType, err)
+		}
+	}
+	return nil
+}
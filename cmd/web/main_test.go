@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestNewListenerUnix(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "web.sock")
+
+	// Leave a stale socket behind to check that it gets replaced
+	stale, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := newListener("unix:"+path, 0o600)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// Check the listener network and socket permissions
+	assert.Equal(t, "unix", listener.Addr().Network())
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Check that the socket accepts connections
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	conn.Close()
+}
+
+func TestNewListenerUnixNotSocket(t *testing.T) {
+	t.Parallel()
+
+	// Any other file at the path is an error, and it's left alone
+	path := filepath.Join(t.TempDir(), "web.sock")
+	err := os.WriteFile(path, []byte("data"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = newListener("unix:"+path, 0o600)
+	assert.StringIn(t, "isn't a unix socket", err.Error())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestNewListenerTCP(t *testing.T) {
+	t.Parallel()
+
+	listener, err := newListener("127.0.0.1:0", 0o660)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	assert.Equal(t, "tcp", listener.Addr().Network())
+}
+
+func TestSystemdListenersNotActivated(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"no environment", map[string]string{}},
+		{"other pid", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}},
+		{"no fds", map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string {
+				return tt.env[key]
+			}
+
+			listeners, err := systemdListeners(getenv)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, len(listeners))
+		})
+	}
+}
+
+func TestServerProtocolsH2C(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		h2c       bool
+		wantProto string
+	}{
+		{"h2c disabled", false, "HTTP/1.1"},
+		{"h2c enabled", true, "HTTP/2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Start a server that responds with the request protocol
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			}))
+			ts.Config.Protocols = serverProtocols(tt.h2c)
+			ts.Start()
+			defer ts.Close()
+
+			// Create a client that prefers unencrypted HTTP/2 with a HTTP/1 fallback
+			protocols := &http.Protocols{}
+			protocols.SetHTTP1(!tt.h2c)
+			protocols.SetUnencryptedHTTP2(tt.h2c)
+			client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+			response, err := client.Get(ts.URL)
+			assert.NoError(t, err)
+			defer response.Body.Close()
+
+			body, err := io.ReadAll(response.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantProto, string(body))
+		})
+	}
+}
+
+func TestRunAppInvalidEnv(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(string) string { return "" }
+	err := runApp(context.Background(), io.Discard, []string{"web", "-dev", "-env", "qa"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for an invalid env")
+	}
+	assert.StringIn(t, `invalid env "qa"`, err.Error())
+}
+
+func TestRunAppInvalidBaseURL(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(string) string { return "" }
+	err := runApp(context.Background(), io.Discard, []string{"web", "-dev", "-base-url", "example.com"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for a base URL without a scheme")
+	}
+	assert.StringIn(t, `invalid -base-url "example.com"`, err.Error())
+}
+
+func TestRunAppInvalidErrorReportURL(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(string) string { return "" }
+	err := runApp(context.Background(), io.Discard, []string{"web", "-dev", "-error-report-url", "errors.example.com"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for an error report URL without a scheme")
+	}
+	assert.StringIn(t, `invalid -error-report-url "errors.example.com"`, err.Error())
+}
+
+func TestRunAppInvalidLogFormat(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(string) string { return "" }
+	err := runApp(context.Background(), io.Discard, []string{"web", "-dev", "-log-format", "xml"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for an invalid log format")
+	}
+	assert.StringIn(t, `invalid -log-format "xml"`, err.Error())
+}
+
+func TestRunAppInvalidMailProvider(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(string) string { return "" }
+	err := runApp(context.Background(), io.Discard, []string{"web", "-dev", "-mail-provider", "postmark"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for an invalid mail provider")
+	}
+	assert.StringIn(t, `invalid -mail-provider "postmark", must be one of smtp, sendgrid, mailgun, ses`, err.Error())
+
+	// An API provider needs its settings
+	err = runApp(context.Background(), io.Discard, []string{"web", "-dev", "-send-email", "-mail-provider", "sendgrid"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for a mail provider without an API key")
+	}
+	assert.StringIn(t, "sendgrid mailer setup failed: email: sendgrid needs an API key and a sender", err.Error())
+}
+
+func TestRunAppInvalidEmailRetries(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(string) string { return "" }
+	err := runApp(context.Background(), io.Discard, []string{"web", "-dev", "-email-max-attempts", "0"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for no email attempts")
+	}
+	assert.StringIn(t, "invalid -email-max-attempts 0, must be at least 1", err.Error())
+
+	err = runApp(context.Background(), io.Discard, []string{"web", "-dev", "-email-backoff-jitter", "1.5"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for a jitter above 1")
+	}
+	assert.StringIn(t, "invalid -email-backoff-jitter 1.5, must be between 0 and 1", err.Error())
+
+	err = runApp(context.Background(), io.Discard, []string{"web", "-dev", "-email-workers", "0"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for no email workers")
+	}
+	assert.StringIn(t, "invalid -email-workers 0", err.Error())
+}
+
+func TestNewDKIMSigner(t *testing.T) {
+	t.Parallel()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	assert.NoError(t, err)
+
+	// The domain comes from the sender
+	_, err = newDKIMSigner("", "mail", keyFile, "Example <no-reply@example.com>")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		domain   string
+		selector string
+		keyFile  string
+		from     string
+		wantErr  string
+	}{
+		{"no key file", "", "mail", "", "no-reply@example.com", "need both -dkim-selector and -dkim-key-file"},
+		{"no selector", "", "", keyFile, "no-reply@example.com", "need both -dkim-selector and -dkim-key-file"},
+		{"bad sender", "", "mail", keyFile, "no-reply", `invalid -smtp-from "no-reply"`},
+		{"missing key file", "example.com", "mail", keyFile + ".missing", "", "error reading -dkim-key-file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newDKIMSigner(tt.domain, tt.selector, tt.keyFile, tt.from)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			assert.StringIn(t, tt.wantErr, err.Error())
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	// JSON records have the common attributes as fields
+	var buf bytes.Buffer
+	logger := newLogger(&buf, "json", slog.LevelInfo, "web", "v1.2.3", "staging")
+	logger.Debug("hidden")
+	logger.Info("hello", "status", 200)
+
+	var record map[string]any
+	err := json.Unmarshal(buf.Bytes(), &record)
+	assert.NoError(t, err)
+	assert.Equal[any](t, "hello", record["msg"])
+	assert.Equal[any](t, "web", record["service"])
+	assert.Equal[any](t, "v1.2.3", record["version"])
+	assert.Equal[any](t, "staging", record["env"])
+	assert.Equal[any](t, float64(200), record["status"])
+
+	// Text records have them too
+	buf.Reset()
+	logger = newLogger(&buf, "text", slog.LevelInfo, "web", "v1.2.3", "staging")
+	logger.Info("hello")
+	assert.StringIn(t, "msg=hello service=web version=v1.2.3 env=staging", buf.String())
+}
+
+func TestRunAppInvalidSessionStore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-session-store", "files"}, `invalid -session-store "files"`},
+		{[]string{"-session-store", "redis"}, "-session-store=redis requires -redis-url"},
+		{[]string{"-session-store", "postgres"}, "-session-store=postgres requires -db-dsn"},
+	}
+	for _, tt := range tests {
+		getenv := func(string) string { return "" }
+		err := runApp(context.Background(), io.Discard, append([]string{"web", "-dev"}, tt.args...), getenv)
+		if err == nil {
+			t.Fatalf("expected an error for %v", tt.args)
+		}
+		assert.StringIn(t, tt.want, err.Error())
+	}
+}
+
+func TestRunAppDatabaseUnreachable(t *testing.T) {
+	t.Parallel()
+
+	// A database that can't be reached fails at startup instead of keeping data in memory
+	getenv := func(key string) string {
+		if key == "DB_DSN" {
+			return "postgres://app@127.0.0.1:1/app?connect_timeout=1"
+		}
+		return ""
+	}
+	err := runApp(context.Background(), io.Discard, []string{"web", "-dev"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for an unreachable database")
+	}
+	assert.StringIn(t, "database:", err.Error())
+}
+
+func TestParseCSRFConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := parseCSRFConfig("https://Partner.example.com/, http://localhost:3000", "/api/, /webhooks/", "none", true)
+	assert.NoError(t, err)
+	assert.EqualSlices(t, []string{"https://partner.example.com", "http://localhost:3000"}, cfg.trustedOrigins)
+	assert.EqualSlices(t, []string{"/api/", "/webhooks/"}, cfg.exemptPaths)
+	assert.Equal(t, http.SameSiteNoneMode, cfg.sameSite)
+	assert.Equal(t, false, cfg.insecureCookie)
+
+	tests := []struct {
+		name           string
+		trustedOrigins string
+		exemptPaths    string
+		sameSite       string
+		secure         bool
+		want           string
+	}{
+		{"origin without scheme", "partner.example.com", "", "lax", true, "invalid CSRF trusted origin"},
+		{"origin with path", "https://partner.example.com/embed", "", "lax", true, "invalid CSRF trusted origin"},
+		{"relative exempt path", "", "api/", "lax", true, "invalid CSRF exempt path"},
+		{"unknown same site", "", "", "sometimes", true, "invalid CSRF SameSite mode"},
+		{"insecure same site none", "", "", "none", false, "requires -csrf-cookie-secure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCSRFConfig(tt.trustedOrigins, tt.exemptPaths, tt.sameSite, tt.secure)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			assert.StringIn(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestHTTPSPort(t *testing.T) {
+	listener := &net.TCPAddr{IP: net.IPv4zero, Port: 8443}
+
+	// The public port of the base URL comes first, since it can be mapped to another port
+	assert.Equal(t, "", httpsPort("https://example.com", listener))
+	assert.Equal(t, "9443", httpsPort("https://example.com:9443", listener))
+
+	// Otherwise it's the port of the listener
+	assert.Equal(t, "8443", httpsPort("", listener))
+	assert.Equal(t, "8443", httpsPort("http://localhost:8000", listener))
+	assert.Equal(t, "", httpsPort("", &net.UnixAddr{Name: "/run/web.sock", Net: "unix"}))
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies(" 10.0.0.0/8, 192.168.1.1,::1 ,")
+	assert.NoError(t, err)
+	assert.Equal(t, "[10.0.0.0/8 192.168.1.1/32 ::1/128]", fmt.Sprint(proxies))
+
+	proxies, err = parseTrustedProxies("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(proxies))
+
+	_, err = parseTrustedProxies("10.0.0.0/8,proxy.example.com")
+	assert.Equal(t, `invalid -trusted-proxies "proxy.example.com", must be an IP or CIDR`, err.Error())
+}
+
+func TestParseSessionConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := parseSessionConfig(12*time.Hour, time.Hour, "__Host-session", " example.com ", "Strict", true)
+	assert.NoError(t, err)
+	sessionManager := scs.New()
+	cfg.apply(sessionManager)
+	assert.Equal(t, 12*time.Hour, sessionManager.Lifetime)
+	assert.Equal(t, time.Hour, sessionManager.IdleTimeout)
+	assert.Equal(t, "__Host-session", sessionManager.Cookie.Name)
+	assert.Equal(t, "example.com", sessionManager.Cookie.Domain)
+	assert.Equal(t, true, sessionManager.Cookie.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, sessionManager.Cookie.SameSite)
+
+	tests := []struct {
+		name        string
+		lifetime    time.Duration
+		idleTimeout time.Duration
+		cookieName  string
+		domain      string
+		sameSite    string
+		secure      bool
+		want        string
+	}{
+		{"no lifetime", 0, 0, "session", "", "lax", true, "invalid -session-lifetime"},
+		{"idle timeout over lifetime", time.Hour, 2 * time.Hour, "session", "", "lax", true, "invalid -session-idle-timeout"},
+		{"blank cookie name", time.Hour, 0, "", "", "lax", true, "invalid -session-cookie-name"},
+		{"cookie name with a semicolon", time.Hour, 0, "a;b", "", "lax", true, "invalid -session-cookie-name"},
+		{"domain with a scheme", time.Hour, 0, "session", "https://example.com", "lax", true, "invalid -session-cookie-domain"},
+		{"unknown same site", time.Hour, 0, "session", "", "sometimes", true, "invalid session SameSite mode"},
+		{"insecure same site none", time.Hour, 0, "session", "", "none", false, "requires -session-cookie-secure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSessionConfig(tt.lifetime, tt.idleTimeout, tt.cookieName, tt.domain, tt.sameSite, tt.secure)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			assert.StringIn(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestHSTSHeader(t *testing.T) {
+	t.Parallel()
+
+	const year = 365 * 24 * time.Hour
+	tests := []struct {
+		name              string
+		maxAge            time.Duration
+		includeSubdomains bool
+		preload           bool
+		want              string
+		wantErr           string
+	}{
+		{"max age", time.Hour, false, false, "max-age=3600", ""},
+		{"subdomains", year, true, false, "max-age=31536000; includeSubDomains", ""},
+		{"preload", 2 * year, true, true, "max-age=63072000; includeSubDomains; preload", ""},
+		{"no max age", 0, false, false, "", "invalid -hsts-max-age"},
+		{"preload without subdomains", year, false, true, "", "-hsts-preload requires"},
+		{"preload under a year", time.Hour, true, true, "", "-hsts-preload requires"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hstsHeader(tt.maxAge, tt.includeSubdomains, tt.preload)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				assert.StringIn(t, tt.wantErr, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	t.Parallel()
+
+	getenv := func(string) string { return "" }
+
+	err := runMigrate(context.Background(), io.Discard, []string{"migrate"}, getenv)
+	assert.Equal(t, migrateUsage, err.Error())
+
+	err = runMigrate(context.Background(), io.Discard, []string{"migrate", "sideways"}, getenv)
+	assert.Equal(t, migrateUsage, err.Error())
+
+	err = runMigrate(context.Background(), io.Discard, []string{"migrate", "up"}, getenv)
+	assert.Equal(t, "migrate needs a database, set -db-dsn or DB_DSN", err.Error())
+
+	err = runMigrate(context.Background(), io.Discard, []string{"migrate", "status", "-db-dsn", "postgres://app@127.0.0.1:1/app?connect_timeout=1"}, getenv)
+	if err == nil {
+		t.Fatal("expected an error for an unreachable database")
+	}
+	assert.StringIn(t, "database:", err.Error())
+}
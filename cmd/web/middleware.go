@@ -1,18 +1,42 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
+	"math"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/justinas/nosurf"
 	"github.com/sglmr/gowebstart/internal/argon2id"
+	"github.com/sglmr/gowebstart/internal/cookies"
+	"github.com/sglmr/gowebstart/internal/fingerprint"
+	"github.com/sglmr/gowebstart/internal/i18n"
+	"github.com/sglmr/gowebstart/internal/metrics"
+	"github.com/sglmr/gowebstart/internal/password"
+	"github.com/sglmr/gowebstart/internal/ratelimit"
+	"github.com/sglmr/gowebstart/internal/render"
+	"github.com/sglmr/gowebstart/internal/reporting"
+	"github.com/sglmr/gowebstart/internal/signing"
+	"github.com/sglmr/gowebstart/internal/tenant"
+	"github.com/sglmr/gowebstart/internal/users"
 )
 
 //=============================================================================
@@ -22,6 +46,10 @@ import (
 // staticFileSystem is a custom type that embeds the standard http.FileSystem for serving static files
 type staticFileSystem struct {
 	fs fs.FS
+
+	// modTime replaces the zero modification times of embedded files, so that
+	// responses have a Last-Modified header for conditional requests
+	modTime time.Time
 }
 
 // Open is a method on the staticFileSystem to only serve files in the
@@ -56,19 +84,212 @@ func (sfs staticFileSystem) Open(path string) (fs.File, error) {
 		}
 	}
 
+	// Embedded files don't have a modification time
+	if s.ModTime().IsZero() && !sfs.modTime.IsZero() {
+		return modTimeFile{File: f, modTime: sfs.modTime}, nil
+	}
+
 	return f, nil
 }
 
-// cacheControlMW sets the Cache-Control header
-func cacheControlMW(age string) func(http.Handler) http.Handler {
+// modTimeFile is a file with a replacement modification time
+type modTimeFile struct {
+	fs.File
+	modTime time.Time
+}
+
+// Stat returns the file info with the replacement modification time
+func (f modTimeFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return modTimeFileInfo{FileInfo: info, modTime: f.modTime}, nil
+}
+
+// Seek passes through to the file so http.FileServer can serve ranges and detect content types
+func (f modTimeFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("seek: not supported")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// ReadDir passes through to the file for directories
+func (f modTimeFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, fmt.Errorf("readdir: not a directory")
+	}
+	return dir.ReadDir(n)
+}
+
+// modTimeFileInfo is file info with a replacement modification time
+type modTimeFileInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+// ModTime returns the replacement modification time
+func (fi modTimeFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+
+// staticCacheMW sets the Cache-Control header for static files from a policy of file
+// extensions to max ages. The "" key is the max age for any other extension.
+func staticCacheMW(policy map[string]time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			maxAge, ok := policy[strings.ToLower(path.Ext(r.URL.Path))]
+			if !ok {
+				maxAge = policy[""]
+			}
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// fingerprintMW serves fingerprinted static file paths, like "/static/css/main.1a2b3c4d.css",
+// as the original file from the manifest. Fingerprinted files are cached as immutable when
+// immutable is true because their contents can never change without changing the path.
+func fingerprintMW(manifest *fingerprint.Manifest, immutable bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logicalPath, ok := manifest.Resolve(r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if immutable {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			}
+
+			// Serve a copy of the request for the logical file path
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = logicalPath
+			r2.URL.RawPath = ""
+
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// etagMW sets the ETag of static files from the content hashes of the manifest, so
+// http.FileServer answers If-None-Match requests for unchanged files with a 304. Use it
+// after fingerprintMW, which maps fingerprinted paths to the file paths of the manifest.
+// A nil manifest sets no ETags.
+func etagMW(manifest *fingerprint.Manifest) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%s", age))
+			if manifest != nil {
+				if etag := manifest.ETag(r.URL.Path); etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// liveReloadMW sets a context liveReloadContextKey to true so that pages include the
+// live reload script
+func liveReloadMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), liveReloadContextKey, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDMW gives every request an ID, so the log lines of a request can be found
+// together. The ID of an X-Request-ID header from a proxy is kept when it's valid, so
+// the proxy logs use the same ID. The ID is saved in the request context for requestID
+// and sent back in the X-Request-ID response header.
+func requestIDMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = rand.Text()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether a request ID from a header is safe to log and echo: up
+// to 128 letters, digits, and the punctuation of UUIDs and trace IDs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.ContainsRune("-_.:", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// errorReporterMW sets the reporter that serverError sends server errors to, including
+// the panics from recoverPanicMW. A nil reporter drops them.
+func errorReporterMW(reporter reporting.ErrorReporter) func(http.Handler) http.Handler {
+	if reporter == nil {
+		reporter = reporting.Nop{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), errorReporterContextKey, reporter)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// templatesMW adds the page templates to the request context for renderPage
+func templatesMW(templates *render.Cache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), templatesContextKey, templates)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// clientIPMW adds the IP address of the client to the request context for clientIP,
+// with the forwarded headers of the trustedProxies, see resolveClientIP.
+func clientIPMW(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPContextKey, resolveClientIP(r, trustedProxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// flashLockMW adds the lock of the flash messages to the request context, see flashLock
+func flashLockMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), flashLockContextKey, new(sync.Mutex))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// jsonIndentMW indents the JSON responses so they're easier to read, for dev mode
+func jsonIndentMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(render.WithJSONIndent(r.Context())))
+	})
+}
+
 // recoverPanicMW recovers from panics to avoid crashing the whole server
 func recoverPanicMW(next http.Handler, logger *slog.Logger, showTrace bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -83,47 +304,307 @@ func recoverPanicMW(next http.Handler, logger *slog.Logger, showTrace bool) http
 	})
 }
 
-// secureHeadersMW sets security headers for the whole application
-func secureHeadersMW(next http.Handler) http.Handler {
+// secureHeadersMW sets security headers for the whole application. The
+// Content-Security-Policy only runs scripts and <style> elements with the nonce of the
+// request from cspNonce, so injected markup can't run scripts. origins are other sites
+// that pages load scripts, styles, and frames from, like a CAPTCHA widget. A non-empty
+// hsts is sent as the Strict-Transport-Security header.
+func secureHeadersMW(next http.Handler, hsts string, origins ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := rand.Text()
+
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy(nonce, origins...))
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "deny")
 		w.Header().Set("X-XSS-Protection", "0")
+		if hsts != "" {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
+
+		ctx := context.WithValue(r.Context(), cspNonceContextKey, nonce)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// contentSecurityPolicy returns the Content-Security-Policy for a request nonce. Style
+// attributes stay allowed because templates use them for small tweaks, and they can't
+// run scripts.
+func contentSecurityPolicy(nonce string, origins ...string) string {
+	sources := strings.Join(append([]string{"'self'"}, origins...), " ")
+	return strings.Join([]string{
+		"default-src 'self'",
+		fmt.Sprintf("script-src %s 'nonce-%s'", sources, nonce),
+		fmt.Sprintf("style-src %s 'nonce-%s'", sources, nonce),
+		"style-src-attr 'unsafe-inline'",
+		"img-src 'self' data:",
+		"frame-src " + sources,
+		"connect-src " + sources,
+		"object-src 'none'",
+		"base-uri 'self'",
+		"frame-ancestors 'none'",
+	}, "; ")
+}
 
+// localeMW sets a context localeContextKey to the locale of the request, from the
+// ?lang= query parameter, the signed lang cookie, or the Accept-Language header.
+func localeMW(bundle *i18n.Bundle, codec *cookies.Codec) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Missing and invalid cookies fall back to the Accept-Language header
+			saved, _ := codec.ReadSigned(r, i18n.CookieName)
+			locale := bundle.Detect(r, saved)
+
+			w.Header().Set("Content-Language", locale)
+			w.Header().Add("Vary", "Accept-Language")
+
+			ctx := context.WithValue(r.Context(), localeContextKey, locale)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// tenantMW adds the tenant of the request to the context, or responds with 404 Not Found
+// for a tenant that doesn't exist. Requests without a tenant are for the main site.
+func tenantMW(resolver *tenant.Resolver, logger *slog.Logger, showTrace bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, err := resolver.Resolve(r)
+			switch {
+			case errors.Is(err, tenant.ErrUnknown):
+				clientError(w, r, http.StatusNotFound)
+				return
+			case err != nil:
+				serverError(w, r, err, logger, showTrace)
+				return
+			case t == nil:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), t)))
+		})
+	}
+}
+
+// mainSiteMW responds with 404 Not Found to requests for a tenant, for pages of the whole
+// site that only the main site can use, like the admin pages of shared settings
+func mainSiteMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenant.ID(r.Context()) != "" {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// logRequestMW logs the http request
-func logRequestMW(logger *slog.Logger) func(http.Handler) http.Handler {
+// noIndexMW asks search engines not to index or follow links on any response, like for
+// staging sites that shouldn't show up in search results
+func noIndexMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// accessLogMW logs every request after it's handled, with the status code and size of
+// the response and how long it took
+func accessLogMW(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var (
+				start  = time.Now()
 				ip     = r.RemoteAddr
 				proto  = r.Proto
 				method = r.Method
 				uri    = r.URL.RequestURI()
 			)
-			logger.Info("request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+
+			rw := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+
+			logger.Info("request",
+				"ip", ip,
+				"proto", proto,
+				"method", method,
+				"uri", uri,
+				"status", cmp.Or(rw.status, http.StatusOK),
+				"size", rw.size,
+				"duration", time.Since(start),
+				"request_id", requestID(r),
+			)
+		})
+	}
+}
+
+// metricsMethods are the request methods with their own label in metricsMW
+var metricsMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// metricsMW counts requests by method, route, and status code, and records the requests
+// in flight and their latency. Routes are the patterns of mux, like "/notes/{id}/edit/{$}",
+// so the number of time series stays small whatever paths clients request.
+func metricsMW(m *metrics.HTTP, mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			m.InFlight.Inc()
+			defer m.InFlight.Dec()
+
+			// The method has its own label
+			_, pattern := mux.Handler(r)
+			route := pattern
+			if _, path, ok := strings.Cut(pattern, " "); ok {
+				route = path
+			}
+			if route == "" {
+				route = "unmatched"
+			}
+
+			rw := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+
+			// Clients can send any method, so the uncommon ones share a label
+			method := r.Method
+			if !slices.Contains(metricsMethods, method) {
+				method = "OTHER"
+			}
+
+			status := strconv.Itoa(cmp.Or(rw.status, http.StatusOK))
+			m.Requests.Inc(method, route, status)
+			m.Duration.Observe(time.Since(start).Seconds(), method, route)
+		})
+	}
+}
+
+// responseRecorder records the status code and size of a response for accessLogMW and
+// metricsMW.
+// Unwrap lets http.ResponseController flush and hijack the underlying writer, like for
+// server-sent events and WebSockets.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	// Informational responses, like 103 Early Hints, come before the final status
+	if rw.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// csrfConfig configures csrfMW. The zero value checks every path with a secure cookie
+// and the browser's default SameSite mode.
+type csrfConfig struct {
+	// trustedOrigins can send unsafe requests from another site, like an embedded form
+	// on https://partner.example.com. Same origin requests are always trusted.
+	trustedOrigins []string
+
+	// exemptPaths are path prefixes without CSRF checks, like /api/ and /webhooks/
+	exemptPaths []string
+
+	// sameSite is the SameSite attribute of the CSRF cookie. Cross-site embeds need
+	// http.SameSiteNoneMode.
+	sameSite http.SameSite
+
+	// insecureCookie sends the CSRF cookie over plain HTTP too
+	insecureCookie bool
+}
+
+// csrfMW protects specific routes against CSRF. Unsafe requests need a valid token,
+// and an Origin header, when browsers send one, from the site itself or a trusted origin.
+// Requests that fail the checks are handled by failureHandler.
+func csrfMW(cfg csrfConfig, failureHandler http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		// The Origin check runs after nosurf, so the failure handler has a new token
+		var csrfHandler *nosurf.CSRFHandler
+		csrfHandler = nosurf.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				if !csrfHandler.IsExempt(r) && !trustedOrigin(r, cfg.trustedOrigins) {
+					failureHandler.ServeHTTP(w, r)
+					return
+				}
+			}
 			next.ServeHTTP(w, r)
+		}))
+		csrfHandler.SetFailureHandler(failureHandler)
+		csrfHandler.SetBaseCookie(http.Cookie{
+			HttpOnly: true,
+			Path:     "/",
+			Secure:   !cfg.insecureCookie,
+			SameSite: cfg.sameSite,
+		})
+		csrfHandler.ExemptFunc(func(r *http.Request) bool {
+			for _, prefix := range cfg.exemptPaths {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					return true
+				}
+			}
+			return false
 		})
+		return csrfHandler
 	}
 }
 
-// csrfMW protects specific routes against CSRF.
-func csrfMW(next http.Handler) http.Handler {
-	csrfHandler := nosurf.New(next)
-	csrfHandler.SetBaseCookie(http.Cookie{
-		HttpOnly: true,
-		Path:     "/",
-		Secure:   true,
-	})
-	return csrfHandler
+// trustedOrigin reports whether the Origin header of a request is missing, from the
+// requested host, or one of the trusted origins
+func trustedOrigin(r *http.Request, trusted []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return slices.Contains(trusted, strings.ToLower(u.Scheme+"://"+u.Host))
 }
 
-// BasicAuthMW restricts routes for basic authentication
-func basicAuthMW(username, passwordHash string, logger *slog.Logger) func(http.Handler) http.Handler {
+// signedURLMW only serves requests to a signed URL for purpose, like links in emails that
+// work without a login. Expired links get 410 Gone, and all others 403 Forbidden.
+func signedURLMW(signer *signing.Signer, purpose string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch err := signer.Verify(r.URL, purpose); {
+			case errors.Is(err, signing.ErrExpired):
+				clientError(w, r, http.StatusGone)
+				return
+			case err != nil:
+				clientError(w, r, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BasicAuthMW restricts routes for basic authentication. The password hash is verified
+// with the peppers of argon2Params.
+func basicAuthMW(username, passwordHash string, argon2Params *argon2id.Params, logger *slog.Logger) func(http.Handler) http.Handler {
 	authError := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 
@@ -146,9 +627,13 @@ func basicAuthMW(username, passwordHash string, logger *slog.Logger) func(http.H
 				return
 			}
 
-			match, err := argon2id.ComparePasswordAndHash(requestPassword, passwordHash)
-			if err != nil {
-				logger.Error("ComparePasswordAndHash error", "error", err)
+			match, _, err := password.Verify(requestPassword, passwordHash, argon2Params)
+			if errors.Is(err, argon2id.ErrUnknownPepper) {
+				logger.Error("basic auth password hash has an unknown pepper, check -password-peppers", "error", err)
+				authError(w, r)
+				return
+			} else if err != nil {
+				logger.Error("password verify error", "error", err)
 				authError(w, r)
 				return
 			} else if !match {
@@ -162,13 +647,20 @@ func basicAuthMW(username, passwordHash string, logger *slog.Logger) func(http.H
 }
 
 // requireLoginMW checks if a user is authenticated, and if not, redirects them to the login page.
-func requireLoginMW() func(http.Handler) http.Handler {
+// With requireVerified, users who haven't verified their email are redirected to the
+// page that asks them to.
+func requireLoginMW(requireVerified bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Redirect to login if the user isn't authenticated
 			if !isAuthenticated(r) {
 				redirectURL := "/login/?next=" + url.QueryEscape(r.RequestURI)
-				http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+				redirect(w, r, redirectURL, http.StatusSeeOther)
+				return
+			}
+
+			if requireVerified && !isVerified(r) {
+				redirect(w, r, "/verify-email/", http.StatusSeeOther)
 				return
 			}
 
@@ -181,9 +673,158 @@ func requireLoginMW() func(http.Handler) http.Handler {
 	}
 }
 
+// rateLimitMW limits the requests of every client IP with a token bucket, ahead of the
+// sessions and the router. Requests over the limit get a 429 with a Retry-After header,
+// and a JSON error for the API. Health checks aren't limited, since load balancers send
+// them from a few IPs, and neither are unknown client IPs, see clientIP.
+func rateLimitMW(limiter *ratelimit.Limiter, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			if ip == "" || strings.HasPrefix(r.URL.Path, "/health/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, wait := limiter.Allow(ip)
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			seconds := int(math.Ceil(wait.Seconds()))
+			logger.Warn("rate limited", "ip", ip, "method", r.Method, "uri", r.URL.RequestURI())
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				apiError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, "Too many requests. Please try again in %d seconds.\n", seconds)
+		})
+	}
+}
+
+// timeoutMW cancels the request context of handlers that run longer than d, and shows a
+// 503 timeout page instead of their response. Responses are buffered until the handler
+// returns, so don't use it on streaming routes, like server-sent events. The timeout
+// should be shorter than the WriteTimeout of the server, or the page can't be sent.
+func timeoutMW(d time.Duration, logger *slog.Logger, showTrace bool, sessionManager *scs.SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{ctx: ctx, header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						panicked <- err
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			finished := false
+			select {
+			case err := <-panicked:
+				// Panic again in the goroutine of the request for recoverPanicMW
+				panic(err)
+			case <-done:
+				finished = true
+			case <-ctx.Done():
+			}
+
+			// Send the response of a handler that finished without writing after the timeout
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			if finished && !tw.timedOut {
+				header := w.Header()
+				clear(header)
+				maps.Copy(header, tw.header)
+				w.WriteHeader(cmp.Or(tw.status, http.StatusOK))
+				w.Write(tw.body.Bytes())
+				return
+			}
+			tw.timedOut = true
+
+			// Nobody is waiting for the response of a request the client canceled
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+
+			logger.Warn("request timed out", "method", r.Method, "uri", r.URL.RequestURI(), "timeout", d, "request_id", requestID(r))
+			data := newTemplateData(r, sessionManager)
+			if err := renderPage(w, r, http.StatusServiceUnavailable, data, "timeout.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response of a timeoutMW handler. Writes after the timeout
+// fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	ctx      context.Context
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.ctx.Err() != nil {
+		tw.timedOut = true
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.ctx.Err() != nil {
+		tw.timedOut = true
+	}
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+// requireRoleMW responds with 403 Forbidden unless the authenticated user has the
+// permissions of role, like requireRoleMW(users.RoleAdmin). Use it after requireLoginMW.
+func requireRoleMW(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasRole(r, role) {
+				clientError(w, r, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // authenticateMW sets a context isAuthenticatedContextKey to true if a user is authenticated
 // This middleware can also add user attributes to the request context to reduce queries for user or session data to the database.
-func authenticateMW(sessionManager *scs.SessionManager) func(http.Handler) http.Handler {
+func authenticateMW(sessionManager *scs.SessionManager, userStore users.Store, logger *slog.Logger, showTrace bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authenticated := sessionManager.GetBool(r.Context(), "authenticated")
@@ -192,13 +833,32 @@ func authenticateMW(sessionManager *scs.SessionManager) func(http.Handler) http.
 				return
 			}
 
-			// Check that user exists in the database
-			// TODO with database: Not applicable without a users table
+			// Sessions only authenticate the tenant they logged in to. Cookies are for
+			// a host, but a tenant header can change on the same host.
+			if sessionManager.GetString(r.Context(), "tenant") != tenant.ID(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Check that user still exists
+			user, err := userStore.Get(r.Context(), sessionManager.GetInt64(r.Context(), "userID"))
+			if errors.Is(err, users.ErrNotFound) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
 
 			// If the user exists then create a new copy of the request
 			// with the isAuthenticatedContextKey set to true
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
 			ctx = context.WithValue(ctx, isAnonyousContextKey, true)
+			ctx = context.WithValue(ctx, userEmailContextKey, user.Email)
+			ctx = context.WithValue(ctx, userIDContextKey, user.ID)
+			ctx = context.WithValue(ctx, isVerifiedContextKey, user.Verified())
+			ctx = context.WithValue(ctx, roleContextKey, user.Role)
 			r = r.WithContext(ctx)
 
 			// Call the next handler
@@ -2,13 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
-
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/justinas/nosurf"
+	"github.com/sglmr/gowebstart/internal/password"
+	"github.com/sglmr/gowebstart/internal/ratelimit"
+	"github.com/sglmr/gowebstart/internal/render"
+	"github.com/sglmr/gowebstart/internal/signing"
+	"github.com/sglmr/gowebstart/internal/tenant"
+	"github.com/sglmr/gowebstart/internal/users"
 	"gotest.tools/assert"
 )
 
@@ -25,19 +37,31 @@ func TestSecureHeadersMW(t *testing.T) {
 
 	// Create a mock HTTP handler that we can pass to our SecureHeadersMW
 	// middleware, which writes a 200 status code and an "OK" response body.
+	var nonce string
 	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = cspNonce(r)
 		w.Write([]byte("OK"))
 	})
 
 	// Pass the mock HTTP handler to the SecureHeadersMW middleware.
 	// Call ServeHTTP to execute it.
-	secureHeadersMW(next).ServeHTTP(rr, r)
+	secureHeadersMW(next, "max-age=60", "https://captcha.example.com").ServeHTTP(rr, r)
 
 	// Get the results of the test
 	rs := rr.Result()
 
+	// Check that the Content-Security-Policy allows scripts with the nonce of the
+	// request and from the extra origins
+	assert.Assert(t, nonce != "")
+	csp := rs.Header.Get("Content-Security-Policy")
+	assert.Assert(t, strings.Contains(csp, "script-src 'self' https://captcha.example.com 'nonce-"+nonce+"'"), csp)
+	assert.Assert(t, strings.Contains(csp, "frame-ancestors 'none'"), csp)
+
 	// Check that the middleware has correctly set the Referrer-Policy
 	// header on the response.
+	// Check that the middleware has set the Strict-Transport-Security header
+	assert.Equal(t, rs.Header.Get("Strict-Transport-Security"), "max-age=60")
+
 	want := "origin-when-cross-origin"
 	assert.Equal(t, rs.Header.Get("Referrer-Policy"), want)
 
@@ -93,7 +117,7 @@ func TestRecoverPanicMW(t *testing.T) {
 
 	// Pass the mock HTTP handler to the RecoverPanicMW middleware.
 	// Call ServeHTTP to execute it.
-	recoverPanicMW(next, testLogger, false).ServeHTTP(rr, r)
+	recoverPanicMW(next, testLogger, false).ServeHTTP(rr, withTemplates(r))
 
 	// Get the results of the test
 	rs := rr.Result()
@@ -107,10 +131,10 @@ func TestRecoverPanicMW(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	body = bytes.TrimSpace(body)
 
-	want := "The server encountered a problem and could not process your request"
-	assert.Equal(t, string(body), want)
+	// The 500.tmpl page is rendered
+	want := "The server encountered a problem and could not process your request."
+	assert.Check(t, strings.Contains(string(body), want))
 
 	// Check the log message
 	logMsg := logBuffer.String()
@@ -143,7 +167,7 @@ func TestBasicAuthMWUnauthorized(t *testing.T) {
 	// Pass the mock HTTP handler to the BasicAuthMW middleware.
 	// Call ServeHTTP to execute it.
 	// Hashed password is 'password'
-	mw := basicAuthMW(testEmail, testPasswordHash, testLogger)
+	mw := basicAuthMW(testEmail, testPasswordHash, testArgon2Params, testLogger)
 	mw(next).ServeHTTP(rr, r)
 
 	// Get the results of the test
@@ -159,6 +183,31 @@ func TestBasicAuthMWUnauthorized(t *testing.T) {
 	assert.Equal(t, rs.Header.Get("WWW-Authenticate"), want)
 }
 
+func TestBasicAuthMWUnknownPepper(t *testing.T) {
+	t.Parallel()
+
+	// A hash with a pepper that was removed from the configuration
+	peppered := *testArgon2Params
+	peppered.KeyID = "1"
+	peppered.Peppers = map[string][]byte{"1": []byte("old-secret")}
+	hash, err := password.Hash(testPassword, &peppered)
+	assert.NilError(t, err)
+
+	logBuffer := bytes.Buffer{}
+	testLogger := slog.New(slog.NewTextHandler(&logBuffer, nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth(testEmail, testPassword)
+	basicAuthMW(testEmail, hash, testArgon2Params, testLogger)(next).ServeHTTP(rr, r)
+
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+	assert.Check(t, strings.Contains(logBuffer.String(), "check -password-peppers"))
+}
+
 func TestBasicAuthMWOK(t *testing.T) {
 	t.Parallel()
 
@@ -185,7 +234,7 @@ func TestBasicAuthMWOK(t *testing.T) {
 	// Pass the mock HTTP handler to the BasicAuthMW middleware.
 	// Call ServeHTTP to execute it.
 	// Hashed password is 'password'
-	mw := basicAuthMW(testEmail, testPasswordHash, testLogger)
+	mw := basicAuthMW(testEmail, testPasswordHash, testArgon2Params, testLogger)
 	mw(next).ServeHTTP(rr, r)
 
 	// Get the results of the test
@@ -195,3 +244,467 @@ func TestBasicAuthMWOK(t *testing.T) {
 	// and the response status code and body are as expected.
 	assert.Equal(t, rs.StatusCode, http.StatusOK)
 }
+
+func TestStaticCacheMW(t *testing.T) {
+	t.Parallel()
+
+	policy := map[string]time.Duration{
+		".png": 24 * time.Hour,
+		"":     time.Minute,
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/static/images/logo.png", "public, max-age=86400"},
+		{"/static/images/LOGO.PNG", "public, max-age=86400"},
+		{"/static/css/main.css", "public, max-age=60"},
+		{"/static/LICENSE", "public, max-age=60"},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			staticCacheMW(policy)(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Header().Get("Cache-Control"), tt.want)
+		})
+	}
+}
+
+func TestNoIndexMW(t *testing.T) {
+	t.Parallel()
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	noIndexMW(next).ServeHTTP(rr, r)
+
+	assert.Equal(t, rr.Header().Get("X-Robots-Tag"), "noindex, nofollow")
+	assert.Equal(t, rr.Body.String(), "OK")
+}
+
+func TestJSONIndentMW(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, http.StatusOK, render.Envelope{"ok": true})
+	})
+
+	// JSON responses are indented behind the middleware only
+	rr := httptest.NewRecorder()
+	jsonIndentMW(next).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, rr.Body.String(), "{\n  \"ok\": true\n}\n")
+
+	rr = httptest.NewRecorder()
+	next.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, rr.Body.String(), `{"ok":true}`+"\n")
+}
+
+func TestRateLimitMW(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := rateLimitMW(ratelimit.New(1, 2), logger)(next)
+
+	request := func(path, ip string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = ip + ":1234"
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// The burst is allowed, then the client IP has to wait
+	assert.Equal(t, request("/", "10.0.0.1").Code, http.StatusOK)
+	assert.Equal(t, request("/notes/", "10.0.0.1").Code, http.StatusOK)
+	rr := request("/", "10.0.0.1")
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests)
+	assert.Equal(t, rr.Header().Get("Retry-After"), "1")
+	assert.Equal(t, rr.Body.String(), "Too many requests. Please try again in 1 seconds.\n")
+
+	// API requests get a JSON error
+	rr = request("/api/v1/me/", "10.0.0.1")
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "application/json")
+
+	// Health checks and other client IPs aren't limited
+	assert.Equal(t, request("/health/ready", "10.0.0.1").Code, http.StatusOK)
+	assert.Equal(t, request("/", "10.0.0.2").Code, http.StatusOK)
+}
+
+func TestRateLimitMWProxy(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}
+	handler := clientIPMW(trusted)(rateLimitMW(ratelimit.New(1, 1), logger)(next))
+
+	request := func(forwardedFor string) int {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	// Every client behind the proxy is limited on its own
+	assert.Equal(t, request("203.0.113.1"), http.StatusOK)
+	assert.Equal(t, request("203.0.113.1"), http.StatusTooManyRequests)
+	assert.Equal(t, request("203.0.113.2"), http.StatusOK)
+
+	// Unknown clients aren't limited, instead of sharing the limit of the proxy
+	assert.Equal(t, request(""), http.StatusOK)
+	assert.Equal(t, request(""), http.StatusOK)
+}
+
+func TestLocaleMW(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Pages are in English by default
+	response := ts.get(t, "/contact/")
+	assert.Equal(t, response.header.Get("Content-Language"), "en")
+	assert.Check(t, strings.Contains(response.body, "<h1>Contact Us</h1>"))
+
+	// The ?lang= query parameter picks the locale
+	response = ts.get(t, "/contact/?lang=es")
+	assert.Equal(t, response.header.Get("Content-Language"), "es")
+	assert.Check(t, strings.Contains(response.body, "<html lang='es'>"))
+	assert.Check(t, strings.Contains(response.body, "<h1>Contáctenos</h1>"))
+	assert.Check(t, strings.Contains(response.body, `<a href="/">Inicio</a>`))
+
+	// So does the Accept-Language header
+	request, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+	assert.NilError(t, err)
+	request.Header.Set("Accept-Language", "es-MX,es;q=0.9,en;q=0.8")
+	res, err := ts.Client().Do(request)
+	assert.NilError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(body), "Esta es una página de ejemplo."))
+
+	// Flash messages are translated too
+	assert.Check(t, strings.Contains(string(body), "¡Bienvenido!"))
+}
+
+func TestTenantMW(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	getTenant := func(path, tenantID string) (int, string) {
+		request, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		assert.NilError(t, err)
+		request.Header.Set("X-Tenant-ID", tenantID)
+		res, err := ts.Client().Do(request)
+		assert.NilError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		assert.NilError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	// Requests for a tenant show its name, and unknown tenants don't exist
+	status, body := getTenant("/", testTenant)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Check(t, strings.Contains(body, "<span>Acme Inc</span>"))
+
+	status, _ = getTenant("/", "globex")
+	assert.Equal(t, status, http.StatusNotFound)
+
+	// A session logged in to the main site isn't logged in to a tenant
+	ts.loginAs(t, testEmail)
+	assert.Equal(t, ts.get(t, "/notes/").statusCode, http.StatusOK)
+
+	status, _ = getTenant("/notes/", testTenant)
+	assert.Equal(t, status, http.StatusSeeOther)
+
+	// Users belong to a tenant, so a session of the tenant with the ID of a main site user
+	// isn't logged in either
+	mainUser, err := ts.userStore.GetByEmail(context.Background(), testEmail)
+	assert.NilError(t, err)
+	ts.putSession(t, map[string]any{"authenticated": true, "userID": mainUser.ID, "tenant": testTenant})
+	status, _ = getTenant("/notes/", testTenant)
+	assert.Equal(t, status, http.StatusSeeOther)
+
+	acmeUser := &users.User{Email: testEmail, PasswordHash: testPasswordHash, Role: users.RoleAdmin}
+	assert.NilError(t, ts.userStore.Insert(tenant.WithTenant(context.Background(), &tenant.Tenant{ID: testTenant}), acmeUser))
+	ts.putSession(t, map[string]any{"authenticated": true, "userID": acmeUser.ID, "tenant": testTenant})
+	status, body = getTenant("/notes/", testTenant)
+	assert.Equal(t, status, http.StatusOK)
+
+	// The admins of a tenant can't use the admin pages of the settings shared by all tenants
+	assert.Check(t, !strings.Contains(body, "/admin/settings/"))
+	for _, path := range []string{"/admin/settings/", "/admin/webhooks/", "/admin/send-email/", "/events/"} {
+		status, _ = getTenant(path, testTenant)
+		assert.Equal(t, status, http.StatusNotFound, path)
+	}
+}
+
+func TestCSRFMW(t *testing.T) {
+	t.Parallel()
+
+	cfg := csrfConfig{
+		trustedOrigins: []string{"https://partner.example.com"},
+		exemptPaths:    []string{"/webhooks/"},
+		sameSite:       http.SameSiteNoneMode,
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(nosurf.Token(r)))
+	})
+	failure := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "CSRF", http.StatusBadRequest)
+	})
+	handler := csrfMW(cfg, failure)(next)
+
+	// GET requests set the CSRF cookie with the configured attributes. httptest requests
+	// are for the example.com host.
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/contact/", nil))
+	assert.Equal(t, rr.Code, http.StatusOK)
+	cookies := rr.Result().Cookies()
+	assert.Equal(t, len(cookies), 1)
+	assert.Equal(t, cookies[0].SameSite, http.SameSiteNoneMode)
+	assert.Check(t, cookies[0].Secure)
+	assert.Check(t, cookies[0].HttpOnly)
+	token := rr.Body.String()
+
+	tests := []struct {
+		name   string
+		path   string
+		origin string
+		token  string
+		want   int
+	}{
+		{"exempt path", "/webhooks/github/", "https://github.com", "", http.StatusOK},
+		{"missing token", "/contact/", "", "", http.StatusBadRequest},
+		{"no origin", "/contact/", "", token, http.StatusOK},
+		{"same origin", "/contact/", "https://example.com", token, http.StatusOK},
+		{"trusted origin", "/contact/", "https://partner.example.com", token, http.StatusOK},
+		{"untrusted origin", "/contact/", "https://evil.example.com", token, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			r.AddCookie(cookies[0])
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.token != "" {
+				r.Header.Set(nosurf.HeaderName, tt.token)
+			}
+			handler.ServeHTTP(rr, r)
+			assert.Equal(t, rr.Code, tt.want)
+		})
+	}
+}
+
+func TestSignedURLMW(t *testing.T) {
+	t.Parallel()
+
+	signer := signing.New([]byte("secret"))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := signedURLMW(signer, "unsubscribe")(next)
+
+	valid, err := signer.Sign("/unsubscribe/?email=test%40example.com", "unsubscribe", time.Hour)
+	assert.NilError(t, err)
+	expired, err := signer.Sign("/unsubscribe/?email=test%40example.com", "unsubscribe", -time.Hour)
+	assert.NilError(t, err)
+	otherPurpose, err := signer.Sign("/unsubscribe/?email=test%40example.com", "download", time.Hour)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"valid", valid, http.StatusOK},
+		{"unsigned", "/unsubscribe/?email=test%40example.com", http.StatusForbidden},
+		{"other purpose", otherPurpose, http.StatusForbidden},
+		{"expired", expired, http.StatusGone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, rr.Code, tt.want)
+		})
+	}
+}
+
+func TestRequestIDMW(t *testing.T) {
+	t.Parallel()
+
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = requestID(r)
+	})
+	handler := requestIDMW(next)
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"missing", "", false},
+		{"valid", "b9e1f0a2-7c4d-4e5f-9a1b-2c3d4e5f6a7b", true},
+		{"invalid characters", "abc\ndef", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			handler.ServeHTTP(rr, r)
+
+			assert.Assert(t, got != "")
+			assert.Equal(t, rr.Header().Get("X-Request-ID"), got)
+			assert.Equal(t, got == tt.header, tt.keep)
+		})
+	}
+}
+
+func TestTimeoutMW(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessionManager := scs.New()
+	timeout := func(next http.Handler) http.Handler {
+		return templatesMW(testTemplates())(sessionManager.LoadAndSave(timeoutMW(50*time.Millisecond, logger, false, sessionManager)(next)))
+	}
+
+	// Fast handlers send their response as is
+	fast := timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("OK"))
+	}))
+	rr := httptest.NewRecorder()
+	fast.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, rr.Header().Get("X-Test"), "yes")
+	assert.Equal(t, rr.Body.String(), "OK")
+
+	// Slow handlers have their context canceled and get the timeout page
+	canceled := make(chan error, 1)
+	slow := timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		_, err := w.Write([]byte("too late"))
+		canceled <- err
+	}))
+	rr = httptest.NewRecorder()
+	slow.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, rr.Code, http.StatusServiceUnavailable)
+	assert.Assert(t, strings.Contains(rr.Body.String(), "Request timed out"))
+	assert.Assert(t, !strings.Contains(rr.Body.String(), "too late"))
+	assert.Equal(t, <-canceled, http.ErrHandlerTimeout)
+
+	// Panics reach recoverPanicMW
+	panics := recoverPanicMW(timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("Help!")
+	})), logger, false)
+	rr = httptest.NewRecorder()
+	panics.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+}
+
+func TestAccessLogMW(t *testing.T) {
+	t.Parallel()
+
+	logBuffer := bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(&logBuffer, nil))
+
+	handler := accessLogMW(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Hello"))
+
+		// Streaming handlers can still flush the response
+		assert.NilError(t, http.NewResponseController(w).Flush())
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/notes/?page=2", nil))
+
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Assert(t, rr.Flushed)
+	logMsg := logBuffer.String()
+	for _, want := range []string{"msg=request", "method=POST", "uri=\"/notes/?page=2\"", "status=201", "size=5", "duration="} {
+		assert.Assert(t, strings.Contains(logMsg, want), logMsg)
+	}
+
+	// Responses without a status code are logged as 200 OK
+	logBuffer.Reset()
+	handler = accessLogMW(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Assert(t, strings.Contains(logBuffer.String(), "status=200 size=0"), logBuffer.String())
+}
+
+// fakeReporter records the errors of errorReporterMW
+type fakeReporter struct {
+	errs []error
+}
+
+func (fr *fakeReporter) Report(ctx context.Context, err error, r *http.Request) {
+	fr.errs = append(fr.errs, err)
+}
+
+func TestErrorReporterMW(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reporter := &fakeReporter{}
+
+	// Panics and server errors are reported
+	handler := errorReporterMW(reporter)(recoverPanicMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("Help!")
+		}
+		serverError(w, r, errors.New("database is down"), logger, false)
+	}), logger, false))
+
+	for _, path := range []string{"/panic", "/error"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, rr.Code, http.StatusInternalServerError)
+	}
+	assert.Equal(t, len(reporter.errs), 2)
+	assert.Equal(t, reporter.errs[0].Error(), "Help!")
+	assert.Equal(t, reporter.errs[1].Error(), "database is down")
+
+	// Without a reporter, errors are only logged
+	handler = errorReporterMW(nil)(recoverPanicMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("Help!")
+	}), logger, false))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/notes"
+	"github.com/sglmr/gowebstart/internal/pagination"
+	"github.com/sglmr/gowebstart/internal/validator"
+)
+
+// notesPerPage is the number of notes on a page of the notes list
+const notesPerPage = 10
+
+// noteForm is the create and edit form for a note
+type noteForm struct {
+	Title string `validate:"required,max=100"`
+	Body  string `validate:"max=10000"`
+	validator.Validator
+}
+
+// check validates the form fields
+func (f *noteForm) check() {
+	f.ValidateStruct(f)
+}
+
+// ownedNote returns the note in the request path when it belongs to the logged in user.
+// Notes of other users are reported as not found, so their IDs don't leak.
+func ownedNote(r *http.Request, store notes.Store) (*notes.Note, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, notes.ErrNotFound
+	}
+
+	note, err := store.Get(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if note.Owner != authenticatedEmail(r) {
+		return nil, notes.ErrNotFound
+	}
+	return note, nil
+}
+
+// notesList handles the list of the logged in user's notes
+func notesList(
+	logger *slog.Logger,
+	showTrace bool,
+	store notes.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner := authenticatedEmail(r)
+		page := pagination.FromRequest(r)
+
+		list, total, err := store.List(r.Context(), owner, notesPerPage, (page-1)*notesPerPage)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		// Show the last page when the requested page is past the end
+		pages := pagination.New(page, notesPerPage, total)
+		if pages.Page != page {
+			list, _, err = store.List(r.Context(), owner, notesPerPage, pages.Offset())
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Notes"] = list
+		data["Pagination"] = pages
+
+		if err := renderPage(w, r, http.StatusOK, data, "notes.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// noteCreate handles the form for a new note
+func noteCreate(
+	logger *slog.Logger,
+	showTrace bool,
+	store notes.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := newTemplateData(r, sessionManager)
+		data["Form"] = noteForm{}
+
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				clientError(w, r, http.StatusBadRequest)
+				return
+			}
+
+			form := noteForm{
+				Title: r.FormValue("title"),
+				Body:  r.FormValue("body"),
+			}
+			form.check()
+
+			if form.Valid() {
+				note := &notes.Note{Owner: authenticatedEmail(r), Title: form.Title, Body: form.Body}
+				if err := store.Insert(r.Context(), note); err != nil {
+					serverError(w, r, err, logger, showTrace)
+					return
+				}
+
+				putFlashSuccess(r, translate(r, "Note created."), sessionManager)
+				redirect(w, r, "/notes/", http.StatusSeeOther)
+				return
+			}
+
+			// Update the template data form so the page errors will render
+			data["Form"] = form
+			if err := renderPage(w, r, http.StatusUnprocessableEntity, data, "note-form.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+			return
+		}
+
+		if err := renderPage(w, r, http.StatusOK, data, "note-form.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// noteEdit handles the form to edit a note
+func noteEdit(
+	logger *slog.Logger,
+	showTrace bool,
+	store notes.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		note, err := ownedNote(r, store)
+		switch {
+		case errors.Is(err, notes.ErrNotFound):
+			clientError(w, r, http.StatusNotFound)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Note"] = note
+		data["Form"] = noteForm{Title: note.Title, Body: note.Body}
+
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				clientError(w, r, http.StatusBadRequest)
+				return
+			}
+
+			form := noteForm{
+				Title: r.FormValue("title"),
+				Body:  r.FormValue("body"),
+			}
+			form.check()
+
+			if form.Valid() {
+				note.Title, note.Body = form.Title, form.Body
+				if err := store.Update(r.Context(), note); err != nil {
+					serverError(w, r, err, logger, showTrace)
+					return
+				}
+
+				putFlashSuccess(r, translate(r, "Note saved."), sessionManager)
+				redirect(w, r, "/notes/", http.StatusSeeOther)
+				return
+			}
+
+			// Update the template data form so the page errors will render
+			data["Form"] = form
+			if err := renderPage(w, r, http.StatusUnprocessableEntity, data, "note-form.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+			return
+		}
+
+		if err := renderPage(w, r, http.StatusOK, data, "note-form.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// noteDelete handles deleting a note
+func noteDelete(
+	logger *slog.Logger,
+	showTrace bool,
+	store notes.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		note, err := ownedNote(r, store)
+		switch {
+		case errors.Is(err, notes.ErrNotFound):
+			clientError(w, r, http.StatusNotFound)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		if err := store.Delete(r.Context(), note.ID); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		putFlashSuccess(r, translate(r, "Deleted %q.", note.Title), sessionManager)
+		redirect(w, r, "/notes/", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/notes"
+)
+
+func TestNotes(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Notes require login
+	response := ts.get(t, "/notes/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	ts.loginAs(t, testEmail)
+
+	response = ts.get(t, "/notes/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "You don&#39;t have any notes yet.", response.body)
+
+	// Invalid notes show the form errors
+	response = ts.get(t, "/notes/new/")
+	data := url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	response = ts.post(t, "/notes/new/", data)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+	assert.StringIn(t, "Title is required.", response.body)
+
+	// Valid notes are saved for the logged in user
+	data.Set("title", "Groceries")
+	data.Set("body", "Milk")
+	response = ts.post(t, "/notes/new/", data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	list, total, err := ts.noteStore.List(context.Background(), testEmail, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	id := list[0].ID
+
+	response = ts.get(t, "/notes/")
+	assert.StringIn(t, "Groceries", response.body)
+	assert.StringIn(t, "Note created.", response.body)
+
+	// Edit the note
+	editURL := fmt.Sprintf("/notes/%d/edit/", id)
+	response = ts.get(t, editURL)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, `value="Groceries"`, response.body)
+
+	data.Set("title", "Shopping")
+	response = ts.post(t, editURL, data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+	note, err := ts.noteStore.Get(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Shopping", note.Title)
+
+	// Notes of other users can't be seen, edited, or deleted
+	other := &notes.Note{Owner: "other@example.com", Title: "Private"}
+	assert.NoError(t, ts.noteStore.Insert(context.Background(), other))
+
+	response = ts.get(t, "/notes/")
+	assert.StringNotIn(t, "Private", response.body)
+	response = ts.get(t, fmt.Sprintf("/notes/%d/edit/", other.ID))
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+	response = ts.post(t, fmt.Sprintf("/notes/%d/delete/", other.ID), data)
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	// Delete the note
+	response = ts.post(t, fmt.Sprintf("/notes/%d/delete/", id), data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+	_, err = ts.noteStore.Get(context.Background(), id)
+	assert.Equal(t, notes.ErrNotFound, err)
+}
+
+func TestNotesPagination(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.loginAs(t, testEmail)
+
+	for i := range notesPerPage + 1 {
+		note := &notes.Note{Owner: testEmail, Title: fmt.Sprintf("Note %d", i)}
+		assert.NoError(t, ts.noteStore.Insert(context.Background(), note))
+	}
+
+	// The newest notes are on the first page
+	response := ts.get(t, "/notes/")
+	assert.StringIn(t, "Page 1 of 2", response.body)
+	assert.StringIn(t, fmt.Sprintf("Note %d", notesPerPage), response.body)
+	assert.StringNotIn(t, "Note 0<", response.body)
+	assert.StringIn(t, `href="/notes/?page=2"`, response.body)
+
+	// Pages past the end show the last page
+	response = ts.get(t, "/notes/?page=9")
+	assert.StringIn(t, "Page 2 of 2", response.body)
+	assert.StringIn(t, "Note 0<", response.body)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/jobs"
+	"github.com/sglmr/gowebstart/internal/notifications"
+	"github.com/sglmr/gowebstart/internal/pagination"
+)
+
+// notificationsPerPage is the number of notifications on a page of the notifications list
+const notificationsPerPage = 20
+
+// unreadNotificationsContextKey is the number of unread notifications of the logged in user
+const unreadNotificationsContextKey = contextKey("unreadNotifications")
+
+// notify saves an in-app notification for a user, and also emails it to them when
+// sendEmail is true. The email is sent by a background job, so it's retried on errors.
+func notify(
+	ctx context.Context,
+	store notifications.Store,
+	jobQueue *jobs.Queue,
+	n *notifications.Notification,
+	sendEmail bool,
+) error {
+	if err := store.Insert(ctx, n); err != nil {
+		return err
+	}
+	if !sendEmail {
+		return nil
+	}
+	return jobQueue.Enqueue(ctx, jobSendEmail, emailJob{
+		To:        []string{n.Recipient},
+		Data:      map[string]any{"Title": n.Title, "Body": n.Body},
+		Templates: []string{"notification.tmpl"},
+	})
+}
+
+// notificationsMW loads the number of unread notifications of the logged in user into the
+// request context, so every page can show it.
+func notificationsMW(store notifications.Store, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isAuthenticated(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Pages still work without the count, so only log the error
+			unread, err := store.Unread(r.Context(), authenticatedEmail(r))
+			if err != nil {
+				logger.Error("notifications error", "error", err)
+			}
+
+			ctx := context.WithValue(r.Context(), unreadNotificationsContextKey, unread)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// unreadNotifications returns the number of unread notifications of the logged in user
+func unreadNotifications(r *http.Request) int {
+	unread, _ := r.Context().Value(unreadNotificationsContextKey).(int)
+	return unread
+}
+
+// notificationsList handles the list of the logged in user's notifications
+func notificationsList(
+	logger *slog.Logger,
+	showTrace bool,
+	store notifications.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recipient := authenticatedEmail(r)
+		page := pagination.FromRequest(r)
+
+		list, total, err := store.List(r.Context(), recipient, notificationsPerPage, (page-1)*notificationsPerPage)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		// Show the last page when the requested page is past the end
+		pages := pagination.New(page, notificationsPerPage, total)
+		if pages.Page != page {
+			list, _, err = store.List(r.Context(), recipient, notificationsPerPage, pages.Offset())
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Notifications"] = list
+		data["Pagination"] = pages
+
+		if err := renderPage(w, r, http.StatusOK, data, "notifications.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// notificationRead handles marking a notification as read, then redirects to the local
+// path in the "next" form value, like the page the notification is about.
+func notificationRead(
+	logger *slog.Logger,
+	showTrace bool,
+	store notifications.Store,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		err = store.MarkRead(r.Context(), authenticatedEmail(r), id)
+		switch {
+		case errors.Is(err, notifications.ErrNotFound):
+			clientError(w, r, http.StatusNotFound)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		next := "/notifications/"
+		if path := r.PostFormValue("next"); path != "" {
+			next = localRedirectPath(path)
+		}
+		redirect(w, r, next, http.StatusSeeOther)
+	}
+}
+
+// notificationsReadAll handles marking all of the logged in user's notifications as read
+func notificationsReadAll(
+	logger *slog.Logger,
+	showTrace bool,
+	store notifications.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := store.MarkAllRead(r.Context(), authenticatedEmail(r)); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		putFlashSuccess(r, translate(r, "All notifications are marked as read."), sessionManager)
+		redirect(w, r, "/notifications/", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/notifications"
+)
+
+func TestNotifications(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Notifications require login
+	response := ts.get(t, "/notifications/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	ts.loginAs(t, testEmail)
+
+	response = ts.get(t, "/notifications/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "You don&#39;t have any notifications.", response.body)
+
+	// Contact messages alert the admin, and pages show the unread count
+	ctx := context.Background()
+	assert.NoError(t, notify(ctx, ts.notificationStore, nil, &notifications.Notification{
+		Recipient: testEmail,
+		Title:     "Mentioned",
+		URL:       "/notes/",
+	}, false))
+	response = ts.get(t, "/contact/")
+	data := url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set("form_token", response.formToken(t))
+	data.Set("name", "Bob")
+	data.Set("email", "bob@example.com")
+	data.Set("message", "Hello")
+	ts.post(t, "/contact/", data)
+
+	response = ts.get(t, "/notifications/")
+	assert.StringIn(t, `Notifications (2)</a>`, response.body)
+	assert.StringIn(t, "New contact message from Bob", response.body)
+	assert.StringIn(t, "Mentioned", response.body)
+
+	// Opening a notification marks it as read and redirects to its page
+	list, _, err := ts.notificationStore.List(ctx, testEmail, 10, 0)
+	assert.NoError(t, err)
+	mention := list[1]
+	data = url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set("next", mention.URL)
+	response = ts.post(t, fmt.Sprintf("/notifications/%d/read/", mention.ID), data)
+	assert.RedirectsTo(t, response.Result(), "/notes/")
+
+	unread, err := ts.notificationStore.Unread(ctx, testEmail)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, unread)
+
+	// Notifications of other users don't exist
+	other := &notifications.Notification{Recipient: "other@example.com", Title: "Private"}
+	assert.NoError(t, ts.notificationStore.Insert(ctx, other))
+	response = ts.post(t, fmt.Sprintf("/notifications/%d/read/", other.ID), data)
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	// Mark all of them as read
+	response = ts.post(t, "/notifications/read/", data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+	unread, _ = ts.notificationStore.Unread(ctx, testEmail)
+	assert.Equal(t, 0, unread)
+
+	response = ts.get(t, "/notifications/")
+	assert.StringIn(t, "All notifications are marked as read.", response.body)
+	assert.StringNotIn(t, `Notifications (`, response.body)
+}
@@ -1,62 +1,306 @@
 package main
 
 import (
-	"crypto/subtle"
+	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/justinas/nosurf"
 	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/antispam"
+	"github.com/sglmr/gowebstart/internal/apitokens"
 	"github.com/sglmr/gowebstart/internal/argon2id"
+	"github.com/sglmr/gowebstart/internal/captcha"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/cookies"
 	"github.com/sglmr/gowebstart/internal/email"
+	"github.com/sglmr/gowebstart/internal/fingerprint"
+	"github.com/sglmr/gowebstart/internal/health"
+	"github.com/sglmr/gowebstart/internal/i18n"
+	"github.com/sglmr/gowebstart/internal/imaging"
+	"github.com/sglmr/gowebstart/internal/jobs"
+	"github.com/sglmr/gowebstart/internal/livereload"
+	"github.com/sglmr/gowebstart/internal/logins"
+	"github.com/sglmr/gowebstart/internal/notes"
+	"github.com/sglmr/gowebstart/internal/notifications"
+	"github.com/sglmr/gowebstart/internal/password"
+	"github.com/sglmr/gowebstart/internal/pwned"
+	"github.com/sglmr/gowebstart/internal/ratelimit"
 	"github.com/sglmr/gowebstart/internal/render"
+	"github.com/sglmr/gowebstart/internal/settings"
+	"github.com/sglmr/gowebstart/internal/signing"
+	"github.com/sglmr/gowebstart/internal/sitemap"
+	"github.com/sglmr/gowebstart/internal/sse"
+	"github.com/sglmr/gowebstart/internal/storage"
+	"github.com/sglmr/gowebstart/internal/tasks"
+	"github.com/sglmr/gowebstart/internal/tenant"
+	"github.com/sglmr/gowebstart/internal/users"
 	"github.com/sglmr/gowebstart/internal/validator"
 	"github.com/sglmr/gowebstart/internal/vcs"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+	"github.com/sglmr/gowebstart/internal/websocket"
 )
 
 // addRoutes adds all the routes to the mux
 func addRoutes(
 	mux *http.ServeMux,
 	logger *slog.Logger,
-	devMode bool,
+	cfg config,
 	mailer email.MailerInterface,
-	authEmail, passwordHash string,
-	wg *sync.WaitGroup,
+	taskManager *tasks.Manager,
+	jobQueue *jobs.Queue,
+	events *sse.Broker,
+	hub *websocket.Hub,
+	db *sql.DB,
+	noteStore notes.Store,
+	notificationStore notifications.Store,
+	loginStore logins.Store,
+	userStore users.Store,
+	tokenStore apitokens.Store,
+	webhookStore webhooks.Store,
+	siteSettings *settings.Settings,
 	sessionManager *scs.SessionManager,
+	healthChecker *health.Checker,
+	fileStore storage.Backend,
+	reloader *livereload.Reloader,
 ) {
-	// Set up file server for embedded static files
-	fileServer := http.FileServer(http.FS(staticFileSystem{assets.EmbeddedFiles}))
-	mux.Handle("GET /static/", cacheControlMW("31536000")(fileServer))
+	devMode := cfg.devMode
+	authEmail, passwordHash := cfg.authEmail, cfg.passwordHash
+
+	// Set up file server for embedded static files. Fingerprinted file paths from the
+	// asset template function are cached forever, other static files by the cache policy.
+	// Their ETags are the content hashes of the manifest, so revalidating unchanged files
+	// gets a 304. Dev mode serves the files from disk so that CSS/JS edits show up without
+	// rebuilding, and the hashes of the embedded files don't apply.
+	var staticFiles fs.FS = assets.EmbeddedFiles
+	etags := assets.StaticManifest()
+	if devMode {
+		staticFiles = os.DirFS("assets")
+		etags = nil
+	}
+	staticFS := staticFileSystem{fs: staticFiles, modTime: cfg.staticModTime}
+	fileServer := etagMW(etags)(http.FileServer(http.FS(staticFS)))
+	fileServer = fingerprintMW(assets.StaticManifest(), !devMode)(fileServer)
+	mux.Handle("GET /static/", staticCacheMW(cfg.staticCache)(fileServer))
+
+	// Icons and the web app manifest that browsers request from the site root
+	rootFiles := staticCacheMW(cfg.staticCache)
+	mux.Handle("GET /favicon.ico", rootFiles(rootFile(staticFS, etags, "static/images/favicon.ico", "image/x-icon")))
+	mux.Handle("GET /apple-touch-icon.png", rootFiles(rootFile(staticFS, etags, "static/images/apple-touch-icon.png", "image/png")))
+	mux.Handle("GET /apple-touch-icon-precomposed.png", rootFiles(rootFile(staticFS, etags, "static/images/apple-touch-icon.png", "image/png")))
+	mux.Handle("GET /site.webmanifest", rootFiles(rootFile(staticFS, etags, "static/site.webmanifest", "application/manifest+json")))
+
+	// Register the public pages for the sitemap. Modules with their own
+	// content can register a sitemap.Source with siteMap.AddSource.
+	siteMap := sitemap.New(sitemap.MaxURLs)
+	siteMap.Add(
+		sitemap.URL{Loc: "/", ChangeFreq: "weekly", Priority: 1.0},
+		sitemap.URL{Loc: "/contact/", ChangeFreq: "yearly", Priority: 0.5},
+	)
 
 	// Routes that don't require login or csrf
 	mux.Handle("GET /", home(logger, devMode, sessionManager))
-	mux.Handle("GET /health/", health(devMode))
-	mux.Handle("GET /send-mail/", sendEmail(mailer, logger, wg))
+	mux.Handle("GET /health/", healthStatus(devMode))
+	mux.Handle("GET /health/live", healthLive())
+	mux.Handle("GET /health/ready", healthReady(healthChecker, logger))
+	mux.Handle("GET /robots.txt", robotsTxt(!cfg.production, cfg.baseURL))
+	mux.Handle("GET /sitemap.xml", sitemapXML(siteMap, cfg.baseURL, logger, devMode))
+	mux.Handle("GET /.well-known/security.txt", securityTxt(cfg.securityContact, cfg.clock))
+
+	// The language switcher skips CSRF so it works on every page, including the ones
+	// without a CSRF token. It only sets the language cookie.
+	mux.Handle("POST /locale/", setLocale(logger, devMode, assets.Locales(), cfg.cookies))
+
+	// Links that work without a login, like download links, are signed URLs
+	signer := signing.New([]byte(cfg.signingSecret))
+	signer.Clock = cfg.clock
+
+	// User uploaded files from the storage backend. Files under "public/" are open to
+	// everyone, and the files of a user under userFileKey to that user. All other files
+	// require a signed download link. Images can be served as resized variants.
+	canAccessFile := func(r *http.Request, key string) bool {
+		switch {
+		case strings.HasPrefix(key, "public/"):
+			return true
+		case authenticatedUserID(r) != 0 && strings.HasPrefix(key, userFileKey(authenticatedUserID(r), "")+"/"):
+			return true
+		default:
+			return signer.Verify(r.URL, purposeDownload) == nil
+		}
+	}
+	images := imaging.NewProcessor(fileStore,
+		imaging.Variant{Name: "thumb", Width: 150, Height: 150},
+		imaging.Variant{Name: "medium", Width: 800, Height: 800},
+	)
+	mux.Handle("GET /files/{key...}", userFile(fileStore, images, canAccessFile, logger, devMode))
+
+	// Public forms are protected against spam with a honeypot field and a time trap
+	spamGuard := antispam.New([]byte(cfg.formSecret), cfg.formMinDelay, 24*time.Hour)
+
+	// Limit contact messages, so the mailer can't be used to send spam
+	var contactLimiter *ratelimit.Limiter
+	if cfg.contactRateLimit > 0 {
+		contactLimiter = ratelimit.PerHour(cfg.contactRateLimit)
+		contactLimiter.Clock = cfg.clock
+	}
 
 	// These routes need CSRF
+	csrfFailureHandler := csrfFailure(logger, devMode, sessionManager)
 	dynamic := func(next http.Handler) http.Handler {
-		return csrfMW(next)
+		return csrfMW(cfg.csrf, csrfFailureHandler)(next)
+	}
+	mux.Handle("GET /api/csrf/{$}", dynamic(apiCSRFToken()))
+	// Sticky flash messages are dismissed with a form on every page
+	mux.Handle("POST /flash/dismiss/{$}", dynamic(dismissFlash(sessionManager)))
+	mux.Handle("GET /contact/", dynamic(contact(logger, devMode, authEmail, spamGuard, cfg.captcha, contactLimiter, jobQueue, events, webhookStore, notificationStore, sessionManager)))
+	// Sending the contact form waits on the CAPTCHA provider, so give up on it in time to
+	// show a timeout page before the server's WriteTimeout
+	contactTimeout := timeoutMW(8*time.Second, logger, devMode, sessionManager)
+	mux.Handle("POST /contact/", dynamic(contactTimeout(contact(logger, devMode, authEmail, spamGuard, cfg.captcha, contactLimiter, jobQueue, events, webhookStore, notificationStore, sessionManager))))
+	// Lock out emails and client IPs after repeated failed logins
+	var loginLockout *ratelimit.Lockout
+	if cfg.loginMaxFailures > 0 {
+		loginLockout = ratelimit.NewLockout(cfg.loginMaxFailures, cfg.loginLockout, loginLockoutMax)
+		loginLockout.Clock = cfg.clock
+	}
+	mux.Handle("GET /login/", dynamic(login(logger, sessionManager, devMode, userStore, cfg.argon2Params, cfg.pwnedPasswords, loginStore, loginLockout, cfg.magicLinkTTL > 0)))
+	mux.Handle("POST /login/", dynamic(login(logger, sessionManager, devMode, userStore, cfg.argon2Params, cfg.pwnedPasswords, loginStore, loginLockout, cfg.magicLinkTTL > 0)))
+	if cfg.magicLinkTTL > 0 {
+		mux.Handle("GET /login/link/{$}", dynamic(magicLinkRequest(logger, devMode, userStore, loginStore, signer, cfg.magicLinkTTL, cfg.baseURL, jobQueue, sessionManager)))
+		mux.Handle("POST /login/link/{$}", dynamic(magicLinkRequest(logger, devMode, userStore, loginStore, signer, cfg.magicLinkTTL, cfg.baseURL, jobQueue, sessionManager)))
+		mux.Handle("GET /login/link/{token}", dynamic(magicLinkLogin(logger, devMode, userStore, loginStore, signer, cfg.clock, sessionManager)))
+		mux.Handle("POST /login/link/{token}", dynamic(magicLinkLogin(logger, devMode, userStore, loginStore, signer, cfg.clock, sessionManager)))
 	}
-	mux.Handle("GET /contact/", dynamic(contact(logger, devMode, wg, mailer, sessionManager)))
-	mux.Handle("POST /contact/", dynamic(contact(logger, devMode, wg, mailer, sessionManager)))
-	mux.Handle("GET /login/", dynamic(login(logger, sessionManager, devMode, authEmail, passwordHash)))
-	mux.Handle("POST /login/", dynamic(login(logger, sessionManager, devMode, authEmail, passwordHash)))
+	mux.Handle("GET /signup/", dynamic(signup(logger, sessionManager, devMode, userStore, cfg.argon2Params, cfg.pwnedPasswords, signer, cfg.baseURL, spamGuard, cfg.captcha, jobQueue, webhookStore)))
+	mux.Handle("POST /signup/", dynamic(signup(logger, sessionManager, devMode, userStore, cfg.argon2Params, cfg.pwnedPasswords, signer, cfg.baseURL, spamGuard, cfg.captcha, jobQueue, webhookStore)))
+	mux.Handle("GET /verify-email/{token}", dynamic(verifyEmail(logger, devMode, userStore, signer, cfg.clock, sessionManager)))
+	mux.Handle("GET /forgot-password/", dynamic(forgotPassword(logger, devMode, userStore, signer, cfg.baseURL, jobQueue, sessionManager)))
+	mux.Handle("POST /forgot-password/", dynamic(forgotPassword(logger, devMode, userStore, signer, cfg.baseURL, jobQueue, sessionManager)))
+	mux.Handle("GET /reset-password/{token}", dynamic(resetPassword(logger, devMode, userStore, signer, cfg.argon2Params, cfg.pwnedPasswords, sessionManager)))
+	mux.Handle("POST /reset-password/{token}", dynamic(resetPassword(logger, devMode, userStore, signer, cfg.argon2Params, cfg.pwnedPasswords, sessionManager)))
 
 	// This route requires basi authentication
 	basicAuthRequired := func(next http.Handler) http.Handler {
-		return basicAuthMW(authEmail, passwordHash, logger)(dynamic(next))
+		return basicAuthMW(authEmail, passwordHash, cfg.argon2Params, logger)(dynamic(next))
 	}
 	mux.Handle("GET /basic-auth-required/", basicAuthRequired(basicAuthDemo()))
 
-	// This route requires login
+	// These routes require login, but not a verified email, like the page that asks users
+	// to verify it
+	unverifiedAllowed := func(next http.Handler) http.Handler {
+		return requireLoginMW(false)(dynamic(next))
+	}
+	mux.Handle("GET /verify-email/{$}", unverifiedAllowed(verifyEmailPending(logger, devMode, signer, cfg.baseURL, jobQueue, sessionManager)))
+	mux.Handle("POST /verify-email/{$}", unverifiedAllowed(verifyEmailPending(logger, devMode, signer, cfg.baseURL, jobQueue, sessionManager)))
+	mux.Handle("GET /logout/", unverifiedAllowed(logout(logger, sessionManager, devMode)))
+	mux.Handle("POST /logout/", unverifiedAllowed(logout(logger, sessionManager, devMode)))
+
+	// This route requires login, and with -require-verified-email a verified email
 	loginRequired := func(next http.Handler) http.Handler {
-		return requireLoginMW()(dynamic(next))
+		return requireLoginMW(cfg.requireVerifiedEmail)(dynamic(next))
 	}
 	mux.Handle("GET /login-required/", loginRequired(loginRequiredDemo()))
-	mux.Handle("GET /logout/", loginRequired(logout(logger, sessionManager, devMode)))
-	mux.Handle("POST /logout/", loginRequired(logout(logger, sessionManager, devMode)))
+
+	// Example notes module. Users can only see and change their own notes.
+	mux.Handle("GET /notes/{$}", loginRequired(notesList(logger, devMode, noteStore, sessionManager)))
+	mux.Handle("GET /notes/new/{$}", loginRequired(noteCreate(logger, devMode, noteStore, sessionManager)))
+	mux.Handle("POST /notes/new/{$}", loginRequired(noteCreate(logger, devMode, noteStore, sessionManager)))
+	mux.Handle("GET /notes/{id}/edit/{$}", loginRequired(noteEdit(logger, devMode, noteStore, sessionManager)))
+	mux.Handle("POST /notes/{id}/edit/{$}", loginRequired(noteEdit(logger, devMode, noteStore, sessionManager)))
+	mux.Handle("POST /notes/{id}/delete/{$}", loginRequired(noteDelete(logger, devMode, noteStore, sessionManager)))
+
+	// In-app notifications of the logged in user
+	mux.Handle("GET /notifications/{$}", loginRequired(notificationsList(logger, devMode, notificationStore, sessionManager)))
+	mux.Handle("POST /notifications/read/{$}", loginRequired(notificationsReadAll(logger, devMode, notificationStore, sessionManager)))
+	mux.Handle("POST /notifications/{id}/read/{$}", loginRequired(notificationRead(logger, devMode, notificationStore)))
+	mux.Handle("GET /account/logins/{$}", loginRequired(accountLogins(logger, devMode, loginStore, sessionManager)))
+
+	// API tokens of the logged in user, for programmatic clients of the JSON API
+	mux.Handle("GET /account/tokens/{$}", loginRequired(accountTokens(logger, devMode, tokenStore, sessionManager)))
+	mux.Handle("POST /account/tokens/{$}", loginRequired(accountTokens(logger, devMode, tokenStore, sessionManager)))
+	mux.Handle("POST /account/tokens/{id}/delete/{$}", loginRequired(accountTokenDelete(logger, devMode, tokenStore, sessionManager)))
+
+	// Admin pages require the login of a user with the admin role. Webhooks, settings,
+	// test emails, and events are shared by all tenants, so only the admins of the main
+	// site can use them.
+	adminRequired := func(next http.Handler) http.Handler {
+		return mainSiteMW(requireLoginMW(cfg.requireVerifiedEmail)(requireRoleMW(users.RoleAdmin)(dynamic(next))))
+	}
+
+	// Admin page for the outgoing webhook endpoints and the delivery log
+	mux.Handle("GET /admin/webhooks/{$}", adminRequired(webhooksAdmin(logger, devMode, webhookStore, sessionManager)))
+	mux.Handle("POST /admin/webhooks/{$}", adminRequired(webhooksAdmin(logger, devMode, webhookStore, sessionManager)))
+	mux.Handle("POST /admin/webhooks/{id}/delete/{$}", adminRequired(webhookDelete(logger, devMode, webhookStore, sessionManager)))
+
+	// Admin page that sends a test email to the configured recipient
+	mux.Handle("GET /admin/send-email/{$}", adminRequired(sendTestEmail(logger, devMode, cfg.testEmailRecipient, jobQueue, sessionManager)))
+	mux.Handle("POST /admin/send-email/{$}", adminRequired(sendTestEmail(logger, devMode, cfg.testEmailRecipient, jobQueue, sessionManager)))
+
+	// Admin page for the application settings
+	mux.Handle("GET /admin/settings/{$}", adminRequired(settingsAdmin(logger, devMode, siteSettings, sessionManager)))
+	mux.Handle("POST /admin/settings/{$}", adminRequired(settingsAdmin(logger, devMode, siteSettings, sessionManager)))
+
+	// Server-sent event stream of application notifications, like new contact messages
+	mux.Handle("GET /events/", adminRequired(events))
+
+	// WebSocket that sends every message to all the open connections
+	mux.Handle("GET /ws/", loginRequired(websocketEcho(hub, sessionManager, logger)))
+
+	// Versioned JSON API with its own middleware stack
+	addAPIRoutes(mux, logger, cfg, noteStore, tokenStore, userStore)
+
+	// Live reload events for the browser in dev mode
+	if reloader != nil {
+		mux.Handle("GET /dev/livereload", reloader)
+	}
+
+	// Previews of the email templates with sample data in dev mode
+	if devMode {
+		emailTemplates := cfg.emailTemplates
+		if emailTemplates == nil {
+			emailTemplates = assets.EmbeddedFiles
+		}
+		mux.Handle("GET /dev/emails/{$}", dynamic(devEmails(logger, devMode, emailTemplates, sessionManager)))
+		mux.Handle("GET /dev/emails/{name}", dynamic(devEmailPreview(logger, devMode, emailTemplates, sessionManager)))
+		mux.Handle("GET /dev/emails/{name}/html", devEmailHTML(logger, devMode, emailTemplates))
+	}
+
+	// Profiling routes require basic authentication. They skip CSRF because the
+	// pprof tools POST to the symbol endpoint.
+	if cfg.pprofEnabled {
+		pprofAuth := basicAuthMW(authEmail, passwordHash, cfg.argon2Params, logger)
+		mux.Handle("GET /debug/pprof/", pprofAuth(http.HandlerFunc(pprof.Index)))
+		mux.Handle("GET /debug/pprof/cmdline", pprofAuth(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("GET /debug/pprof/profile", pprofAuth(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("GET /debug/pprof/symbol", pprofAuth(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("POST /debug/pprof/symbol", pprofAuth(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("GET /debug/pprof/trace", pprofAuth(http.HandlerFunc(pprof.Trace)))
+	}
+
+	// Prometheus scrapes the request metrics with basic authentication
+	if cfg.metrics != nil {
+		mux.Handle("GET /metrics", basicAuthMW(authEmail, passwordHash, cfg.argon2Params, logger)(cfg.metrics.Handler()))
+	}
 }
 
 //=============================================================================
@@ -73,15 +317,15 @@ func home(
 		// Redirect non-root paths to root
 		// TODO: write a test for this someday
 		if r.URL.Path != "/" {
-			clientError(w, http.StatusNotFound)
+			clientError(w, r, http.StatusNotFound)
 			return
 		}
-		putFlashMessage(r, flashSuccess, "Welcome!", sessionManager)
-		putFlashMessage(r, flashSuccess, "You made it!", sessionManager)
+		putFlashSuccess(r, translate(r, "Welcome!"), sessionManager)
+		putFlashSuccess(r, translate(r, "You made it!"), sessionManager)
 
 		data := newTemplateData(r, sessionManager)
 
-		if err := render.Page(w, http.StatusOK, data, "home.tmpl"); err != nil {
+		if err := renderPage(w, r, http.StatusOK, data, "home.tmpl"); err != nil {
 			serverError(w, r, err, logger, showTrace)
 			return
 		}
@@ -92,50 +336,124 @@ func home(
 func contact(
 	logger *slog.Logger,
 	showTrace bool,
-	wg *sync.WaitGroup,
-	mailer email.MailerInterface,
+	adminEmail string,
+	spamGuard *antispam.Guard,
+	captchaVerifier *captcha.Verifier,
+	limiter *ratelimit.Limiter,
+	jobQueue *jobs.Queue,
+	events *sse.Broker,
+	webhookStore webhooks.Store,
+	notificationStore notifications.Store,
 	sessionManager *scs.SessionManager,
 ) http.HandlerFunc {
 	type contactForm struct {
-		Name    string
-		Email   string
-		Message string
+		Name    string `validate:"required,max=100"`
+		Email   string `validate:"required,email"`
+		Message string `validate:"required,max=1000"`
 		validator.Validator
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		data := newTemplateData(r, sessionManager)
 		data["Form"] = contactForm{}
+		data["AntiSpam"] = spamGuard.Fields()
+		data["Captcha"] = captchaVerifier.Widget()
 
 		if r.Method == http.MethodPost {
 			if err := r.ParseForm(); err != nil {
-				clientError(w, http.StatusBadRequest)
+				clientError(w, r, http.StatusBadRequest)
 				return
 			}
 
 			form := contactForm{}
 
+			// Pretend that messages from bots were sent, so they don't try again. People
+			// who submit too fast or with an expired form can submit it again.
+			err := spamGuard.Check(r)
+			switch {
+			case errors.Is(err, antispam.ErrHoneypot):
+				logger.Info("contact spam blocked", "ip", r.RemoteAddr, "reason", err)
+				if err := renderPage(w, r, http.StatusFound, data, "contact-success.tmpl"); err != nil {
+					serverError(w, r, err, logger, showTrace)
+				}
+				return
+			case err != nil:
+				logger.Info("contact spam blocked", "ip", r.RemoteAddr, "reason", err)
+				form.AddError("Form", "Your message couldn't be sent. Please wait a moment and submit it again.")
+			}
+
+			// Ask for the CAPTCHA again when it fails, or when the provider can't be reached
+			if err := captchaVerifier.Verify(r, clientIP(r)); err != nil {
+				logger.Info("contact captcha failed", "ip", r.RemoteAddr, "error", err)
+				form.AddError("Captcha", "Please complete the CAPTCHA.")
+			}
+
 			// Populate the form data
 			form.Name = r.FormValue("name")
 			form.Email = r.FormValue("email")
 			form.Message = r.FormValue("message")
 
 			// Validate the form
-			form.Check("Name", validator.NotBlank(form.Name), "Name is required.")
-			form.Check("Name", validator.MaxRunes(form.Name, 100), "Name must be less than 100 characters.")
-
-			form.Check("Email", validator.NotBlank(form.Email), "Email is required.")
-			form.Check("Email", validator.IsEmail(form.Email), "Email must be a valid email address.")
-
-			form.Check("Message", validator.NotBlank(form.Message), "Message is required.")
-			form.Check("Message", validator.MaxRunes(form.Message, 1000), "Message must be less than 1,000 characters.")
+			form.ValidateStruct(form)
 
 			if form.Valid() {
+				// Both the client IP and the sender email have to be under the limit. An unknown
+				// client IP behind a proxy isn't limited, since it would be everyone behind it.
+				if limiter != nil {
+					ipOK, ipWait := true, time.Duration(0)
+					if ip := clientIP(r); ip != "" {
+						ipOK, ipWait = limiter.Allow("ip:" + ip)
+					}
+					emailOK, emailWait := limiter.Allow("email:" + strings.ToLower(form.Email))
+					if !ipOK || !emailOK {
+						minutes := int(math.Ceil(max(ipWait, emailWait).Minutes()))
+						logger.Info("contact rate limited", "ip", clientIP(r), "email", form.Email)
+						putFlashWarning(r, translate(r, "You've sent too many messages. Please try again in %d minutes.", minutes), sessionManager)
+						redirect(w, r, "/contact/", http.StatusSeeOther)
+						return
+					}
+				}
+
 				// Email the form message
-				backgroundTask(wg, logger, func() error {
-					return mailer.Send("Recipient <recipient@example.com>", "Reply-To <reply-to@example.com>", form, "example.tmpl")
+				err := jobQueue.Enqueue(r.Context(), jobSendEmail, emailJob{
+					To:        []string{siteSetting(r, settingContactRecipient)},
+					ReplyTo:   "Reply-To <reply-to@example.com>",
+					Data:      map[string]any{"Name": form.Name, "Email": form.Email, "Message": form.Message},
+					Templates: []string{"example.tmpl"},
+				})
+				if err != nil {
+					serverError(w, r, err, logger, showTrace)
+					return
+				}
+
+				// Send the message to the webhook endpoints
+				err = emitWebhook(r.Context(), jobQueue, webhookStore, webhooks.EventContactSubmitted, map[string]string{
+					"name":    form.Name,
+					"email":   form.Email,
+					"message": form.Message,
 				})
+				if err != nil {
+					serverError(w, r, err, logger, showTrace)
+					return
+				}
+
+				// Alert the admin inside the application too
+				if adminEmail != "" {
+					err = notify(r.Context(), notificationStore, jobQueue, &notifications.Notification{
+						Recipient: adminEmail,
+						Title:     translate(r, "New contact message from %s", form.Name),
+						Body:      form.Message,
+					}, false)
+					if err != nil {
+						serverError(w, r, err, logger, showTrace)
+						return
+					}
+				}
+
+				// Notify the logged in users watching the event stream
+				events.Publish(sse.Event{Name: "contact", Data: form.Name})
+
 				// Render the contact success page
-				err := render.Page(w, http.StatusFound, data, "contact-success.tmpl")
+				err = renderPage(w, r, http.StatusFound, data, "contact-success.tmpl")
 				if err != nil {
 					serverError(w, r, err, logger, showTrace)
 					return
@@ -149,7 +467,7 @@ func contact(
 		}
 
 		// Render the contact.tmpl page
-		err := render.Page(w, http.StatusOK, data, "contact.tmpl")
+		err := renderPage(w, r, http.StatusOK, data, "contact.tmpl")
 		if err != nil {
 			serverError(w, r, err, logger, showTrace)
 			return
@@ -157,24 +475,107 @@ func contact(
 	}
 }
 
-// sendEmail sends out a background email task
-func sendEmail(mailer email.MailerInterface, logger *slog.Logger, wg *sync.WaitGroup) http.HandlerFunc {
+// sendTestEmail handles the admin page that queues an example email job to the test email
+// recipient, to check the mailer configuration
+func sendTestEmail(
+	logger *slog.Logger,
+	showTrace bool,
+	recipient string,
+	jobQueue *jobs.Queue,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprint(w, "Email queued")
-		emailData := map[string]any{
-			"Name": "Person",
-		}
-		backgroundTask(
-			wg, logger,
-			func() error {
-				return mailer.Send("Recipient <recipient@example.com>", "Reply-To <reply-to@example.com>", emailData, "example.tmpl")
+		if r.Method == http.MethodPost {
+			if recipient == "" {
+				putFlashError(r, translate(r, "There's no test email recipient."), sessionManager)
+				redirect(w, r, "/admin/send-email/", http.StatusSeeOther)
+				return
+			}
+
+			err := jobQueue.Enqueue(r.Context(), jobSendEmail, emailJob{
+				To:        []string{recipient},
+				Data:      map[string]any{"Name": authenticatedEmail(r)},
+				Templates: []string{"example.tmpl"},
 			})
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+
+			putFlashSuccess(r, translate(r, "Test email queued for %s.", recipient), sessionManager)
+			redirect(w, r, "/admin/send-email/", http.StatusSeeOther)
+			return
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Recipient"] = recipient
+
+		if err := renderPage(w, r, http.StatusOK, data, "admin-send-email.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// websocketCheckInterval is how often an open WebSocket checks that its session is
+// still logged in, and pings the client to keep the connection alive
+const websocketCheckInterval = 30 * time.Second
+
+// websocketEcho upgrades to a WebSocket that sends every message it receives to all the
+// open connections of the tenant. The connection is closed when its session logs out.
+func websocketEcho(hub *websocket.Hub, sessionManager *scs.SessionManager, logger *slog.Logger) http.HandlerFunc {
+	upgrader := websocket.Upgrader{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			logger.Warn("websocket upgrade", "error", err)
+			return
+		}
+		defer conn.Close()
+
+		// Register the connection under its tenant and session, so messages stay in the
+		// tenant and hub.SendTo can reach one browser
+		tenantID := tenant.ID(r.Context())
+		token := sessionManager.Token(r.Context())
+		if err := hub.Add(conn, tenantID, token); err != nil {
+			conn.CloseWithStatus(websocket.CloseGoingAway, "")
+			return
+		}
+		defer hub.Remove(conn)
+
+		// Logging out renews the session token, so the old token disappears from the store
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(websocketCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					_, found, err := sessionManager.Store.Find(token)
+					if err == nil && !found {
+						conn.CloseWithStatus(websocket.ClosePolicyViolation, "session ended")
+						return
+					}
+					conn.Ping()
+				}
+			}
+		}()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			hub.BroadcastGroup(tenantID, messageType, message)
+		}
 	}
 }
 
-// health handles a healthcheck response "OK"
-func health(devMode bool) http.HandlerFunc {
+// healthStatus handles a healthcheck response "OK"
+func healthStatus(devMode bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		fmt.Fprintln(w, "status: OK")
@@ -183,6 +584,274 @@ func health(devMode bool) http.HandlerFunc {
 	}
 }
 
+// healthLive handles the liveness probe. It only reports that the process is up.
+func healthLive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, "status: OK")
+	}
+}
+
+// healthReady handles the readiness probe. It runs the registered dependency checks
+// and responds with a JSON breakdown, with a 503 status when any check fails. The
+// probe doesn't need a login, so the errors of failed checks are logged instead of
+// sent, since they can have hostnames or other details of the dependencies.
+func healthReady(healthChecker *health.Checker, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := healthChecker.Run(r.Context())
+
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		for i, check := range report.Checks {
+			if check.Status != health.StatusOK {
+				logger.Warn("readiness check failed", "check", check.Name, "error", check.Error)
+			}
+			report.Checks[i].Error = ""
+		}
+
+		headers := http.Header{"Cache-Control": {"no-store"}}
+		if err := render.JSONWithHeaders(w, r, status, report, headers); err != nil {
+			logger.Error("health report encoding error", "error", err)
+		}
+	}
+}
+
+// rootFile handles a single file from fsys with the given content type, for files
+// like favicon.ico that need to be served from the site root. The ETag comes from etags
+// when it isn't nil.
+func rootFile(fsys fs.FS, etags *fingerprint.Manifest, name, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if etags != nil {
+			if etag := etags.ETag(name); etag != "" {
+				w.Header().Set("ETag", etag)
+			}
+		}
+		http.ServeFileFS(w, r, fsys, name)
+	}
+}
+
+// userFileKey returns the storage key of a private file of a user, like
+// "users/42/avatar.png". The user is the owner of the files under their key, and user
+// IDs are unique across tenants, so other users and tenants need a signed download link.
+func userFileKey(userID int64, name string) string {
+	return path.Join("users", strconv.FormatInt(userID, 10), name)
+}
+
+// inlineContentTypes are the sniffed content type prefixes of user uploaded files that are
+// safe to display in the browser. Other files, like HTML, are always downloaded.
+var inlineContentTypes = []string{"image/", "audio/", "video/", "application/pdf", "text/plain"}
+
+// userFile handles a user uploaded file from the storage backend. Files are only served
+// when canAccess allows it. Forbidden and missing files both respond with a 404 so the
+// response doesn't reveal which files exist. http.ServeContent handles range and
+// conditional requests.
+//
+// Images can be requested as a resized variant, like ?variant=thumb. The original is
+// served until the variants are made with images.Process after the upload.
+func userFile(
+	fileStore storage.Backend,
+	images *imaging.Processor,
+	canAccess func(r *http.Request, key string) bool,
+	logger *slog.Logger,
+	showTrace bool,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		if !canAccess(r, key) {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		var f storage.File
+		var err error
+		if name := r.URL.Query().Get("variant"); name != "" {
+			if _, ok := images.Variant(name); !ok {
+				clientError(w, r, http.StatusNotFound)
+				return
+			}
+
+			f, err = fileStore.Open(images.VariantKey(key, name))
+		}
+		if f == nil {
+			f, err = fileStore.Open(key)
+		}
+		switch {
+		case errors.Is(err, fs.ErrNotExist), errors.Is(err, storage.ErrInvalidKey):
+			clientError(w, r, http.StatusNotFound)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		// Sniff the content type from the file contents instead of trusting the uploaded file name
+		buf := make([]byte, 512)
+		n, err := io.ReadFull(f, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		contentType := http.DetectContentType(buf[:n])
+
+		// Uploaded files can't run scripts, and files that aren't safe to display are downloaded
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		inline := slices.ContainsFunc(inlineContentTypes, func(prefix string) bool {
+			return strings.HasPrefix(contentType, prefix)
+		})
+		if !inline {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+		}
+
+		http.ServeContent(w, r, path.Base(key), info.ModTime(), f)
+	}
+}
+
+// robotsTxt handles the robots.txt file. Crawlers are disallowed from the
+// whole site when disallowAll is true, like outside of production. It links to the
+// sitemap at base, the -base-url flag, and leaves the link out without it.
+func robotsTxt(disallowAll bool, base string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "User-agent: *")
+		if disallowAll {
+			fmt.Fprintln(w, "Disallow: /")
+			return
+		}
+		fmt.Fprintln(w, "Allow: /")
+		if base != "" {
+			fmt.Fprintf(w, "Sitemap: %s/sitemap.xml\n", tenant.URL(r.Context(), base))
+		}
+	}
+}
+
+// sitemapXML handles the sitemap.xml file with the registered sitemap URLs. When there
+// are more URLs than fit in one sitemap, it responds with a sitemap index that links to
+// each page at /sitemap.xml?page=N. The URLs start with base, the -base-url flag, since
+// the Host header of a request can be set by anyone. It responds 404 without base.
+func sitemapXML(siteMap *sitemap.Registry, base string, logger *slog.Logger, showTrace bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if base == "" {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		urls, err := siteMap.URLs(r.Context())
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		base := tenant.URL(r.Context(), base)
+		buf := new(bytes.Buffer)
+		pages := siteMap.Pages(len(urls))
+		pageParam := r.URL.Query().Get("page")
+
+		switch {
+		case pageParam == "" && pages > 1:
+			// Link to each page from a sitemap index
+			locs := make([]string, pages)
+			for i := range locs {
+				locs[i] = fmt.Sprintf("/sitemap.xml?page=%d", i+1)
+			}
+			err = sitemap.WriteIndex(buf, base, locs)
+		case pageParam == "":
+			err = sitemap.WriteURLSet(buf, base, urls)
+		default:
+			page, convErr := strconv.Atoi(pageParam)
+			pageURLs, ok := siteMap.Page(urls, page)
+			if convErr != nil || !ok {
+				clientError(w, r, http.StatusNotFound)
+				return
+			}
+			err = sitemap.WriteURLSet(buf, base, pageURLs)
+		}
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
+
+// securityTxt handles the RFC 9116 security.txt file with the contact for reporting
+// security issues. It responds 404 when there's no contact.
+func securityTxt(contact string, clock clock.Clock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contact == "" {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		// The file must expire, so keep it valid for a year from today
+		expires := clock.Now().UTC().Truncate(24*time.Hour).AddDate(1, 0, 0)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Contact: %s\n", contact)
+		fmt.Fprintf(w, "Expires: %s\n", expires.Format(time.RFC3339))
+		fmt.Fprintln(w, "Preferred-Languages: en")
+	}
+}
+
+// httpsRedirect handles the plain HTTP listener. It serves ACME http-01 challenge files
+// from challengeDir (when set) and permanently redirects everything else to HTTPS.
+func httpsRedirect(httpsPort, challengeDir string) http.Handler {
+	mux := http.NewServeMux()
+
+	if challengeDir != "" {
+		mux.HandleFunc("GET /.well-known/acme-challenge/{token}", func(w http.ResponseWriter, r *http.Request) {
+			// Only serve plain file names from the challenge directory
+			token := r.PathValue("token")
+			if token != filepath.Base(token) || strings.HasPrefix(token, ".") {
+				clientError(w, r, http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			http.ServeFile(w, r, filepath.Join(challengeDir, token))
+		})
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// Strip any port from the request host
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		// Only include the port in the url when it's not the https default
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+
+	return mux
+}
+
 // basicAuthDemo handles a page protected by basic authentication.
 func basicAuthDemo() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -199,12 +868,31 @@ func loginRequiredDemo() http.HandlerFunc {
 	}
 }
 
-// login handles logins
+// Purposes of signed URLs, so a link for one purpose can't be used for another
+const (
+	purposeDownload      = "download"
+	purposePasswordReset = "password-reset"
+	purposeVerifyEmail   = "verify-email"
+	purposeMagicLink     = "magic-link"
+)
+
+// loginLockoutMax is the longest lockout after failed logins
+const loginLockoutMax = time.Hour
+
+// login handles logins of the users in userStore. bcrypt password hashes, and argon2id
+// hashes with parameters weaker than argon2Params, are rehashed with argon2Params after a
+// successful login. With a lockout, failed logins lock out the email and the client IP,
+// so they can't keep guessing passwords.
 func login(
 	logger *slog.Logger,
 	sessionManager *scs.SessionManager,
 	showTrace bool,
-	authEmail, passwordHash string,
+	userStore users.Store,
+	argon2Params *argon2id.Params,
+	pwnedPasswords pwned.Checker,
+	loginStore logins.Store,
+	lockout *ratelimit.Lockout,
+	magicLinks bool,
 ) http.HandlerFunc {
 	// Login form object
 	type loginForm struct {
@@ -212,7 +900,24 @@ func login(
 		Password string
 		validator.Validator
 	}
+
+	// A hash with the same parameters as the hashes of users, checked for unknown emails
+	// so they take as long to refuse as a wrong password, and don't reveal which emails
+	// have an account
+	dummyHash := sync.OnceValues(func() (string, error) {
+		return password.Hash("dummy password", argon2Params)
+	})
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Template data for the login page, with a link to the login link form when
+		// magic links are on
+		loginData := func(form loginForm) map[string]any {
+			data := newTemplateData(r, sessionManager)
+			data["Form"] = form
+			data["MagicLinks"] = magicLinks
+			return data
+		}
+
 		// Get the "next" url parameter for the page to redirect to on successful login
 		nextURL := r.URL.Query().Get("next")
 		logger.Debug("login next", "next", nextURL)
@@ -223,11 +928,10 @@ func login(
 
 		// Render form for a GET request
 		if r.Method == http.MethodGet {
-			data := newTemplateData(r, sessionManager)
-			data["Form"] = loginForm{}
+			data := loginData(loginForm{})
 
 			// Render the login page
-			if err := render.Page(w, http.StatusOK, data, "login.tmpl"); err != nil {
+			if err := renderPage(w, r, http.StatusOK, data, "login.tmpl"); err != nil {
 				serverError(w, r, err, logger, showTrace)
 				return
 			}
@@ -237,7 +941,7 @@ func login(
 		// Parse the form data
 		err := r.ParseForm()
 		if err != nil {
-			clientError(w, http.StatusBadRequest)
+			clientError(w, r, http.StatusBadRequest)
 			return
 		}
 
@@ -256,66 +960,148 @@ func login(
 
 		// Return form errors if the form is not valid
 		if form.HasErrors() {
-			putFlashMessage(r, flashError, "please correct the form errors", sessionManager)
-			data := newTemplateData(r, sessionManager)
-			data["Form"] = form
+			putFlashError(r, translate(r, "please correct the form errors"), sessionManager)
+			data := loginData(form)
 
 			// Render the login page
-			if err := render.Page(w, http.StatusUnprocessableEntity, data, "login.tmpl"); err != nil {
+			if err := renderPage(w, r, http.StatusUnprocessableEntity, data, "login.tmpl"); err != nil {
 				serverError(w, r, err, logger, showTrace)
 				return
 			}
 			return
 		}
 
-		// Check if the email matches and if not, send back to the login page
-		if subtle.ConstantTimeCompare([]byte(authEmail), []byte(form.Email)) == 0 {
-			putFlashMessage(r, flashError, "Email or password is incorrect", sessionManager)
+		// lockedOut sends back to the login page with when to try again
+		lockedOut := func(wait time.Duration) {
+			minutes := int(math.Ceil(wait.Minutes()))
+			putFlashError(r, translate(r, "Too many failed logins. Please try again in %d minutes.", minutes), sessionManager)
+			if err := renderPage(w, r, http.StatusTooManyRequests, loginData(form), "login.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+		}
 
-			data := newTemplateData(r, sessionManager)
-			data["Form"] = form
+		// Refuse locked out emails and client IPs before the slow password check. An unknown
+		// client IP isn't locked out, since it would lock out everyone behind the same proxy.
+		emailKey := "email:" + users.NormalizeEmail(form.Email)
+		lockoutKeys := []string{emailKey}
+		if ip := clientIP(r); ip != "" {
+			lockoutKeys = append(lockoutKeys, "ip:"+ip)
+		}
+		if lockout != nil {
+			var locked bool
+			var wait time.Duration
+			for _, key := range lockoutKeys {
+				keyLocked, keyWait := lockout.Locked(key)
+				locked = locked || keyLocked
+				wait = max(wait, keyWait)
+			}
+			if locked {
+				logger.Info("login locked out", "email", form.Email, "ip", clientIP(r))
+				lockedOut(wait)
+				return
+			}
+		}
+
+		// loginFailed counts a failed login for the lockout and sends back to the login page
+		loginFailed := func() {
+			if lockout != nil {
+				var wait time.Duration
+				for _, key := range lockoutKeys {
+					wait = max(wait, lockout.Fail(key))
+				}
+				if wait > 0 {
+					logger.Warn("login lockout started", "email", form.Email, "ip", clientIP(r), "duration", wait)
+					lockedOut(wait)
+					return
+				}
+			}
+
+			putFlashError(r, translate(r, "Email or password is incorrect"), sessionManager)
+			data := loginData(form)
 
 			// re-render the login page
-			if err := render.Page(w, http.StatusUnprocessableEntity, data, "login.tmpl"); err != nil {
+			if err := renderPage(w, r, http.StatusUnprocessableEntity, data, "login.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+		}
+
+		// Find the user, and if there's none, send back to the login page
+		user, err := userStore.GetByEmail(r.Context(), form.Email)
+		switch {
+		case errors.Is(err, users.ErrNotFound):
+			hash, err := dummyHash()
+			if err != nil {
 				serverError(w, r, err, logger, showTrace)
 				return
 			}
+			password.Verify(form.Password, hash, argon2Params)
+			loginFailed()
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
 			return
 		}
 
 		// Check whether the hashed pasword for the user and the plain text password provided match
-		match, err := argon2id.ComparePasswordAndHash(form.Password, passwordHash)
+		match, rehash, err := password.Verify(form.Password, user.PasswordHash, argon2Params)
 		switch {
+		case errors.Is(err, argon2id.ErrUnknownPepper):
+			// The pepper of the hash isn't configured, so the password can't match
+			logger.Error("password hash has an unknown pepper, check -password-peppers", "user", user.ID, "error", err)
+			loginFailed()
+			return
 		case err != nil:
 			serverError(w, r, err, logger, showTrace)
 			return
 		case !match:
-			putFlashMessage(r, flashError, "Email or password is incorrect", sessionManager)
+			loginFailed()
+			return
+		}
 
-			data := newTemplateData(r, sessionManager)
-			data["Form"] = form
+		// Forget the failed logins of the email. The client IP keeps them, so a login to
+		// an attacker's own account doesn't reset the guesses at other accounts.
+		if lockout != nil {
+			lockout.Reset(emailKey)
+		}
 
-			// re-render the login page
-			if err := render.Page(w, http.StatusUnprocessableEntity, data, "login.tmpl"); err != nil {
+		// Save the password hashed with the current parameters
+		if rehash {
+			format := password.Format(user.PasswordHash)
+			hash, err := password.Hash(form.Password, argon2Params)
+			if err != nil {
+				serverError(w, r, err, logger, showTrace)
+				return
+			}
+			err = userStore.SetPasswordHash(r.Context(), user.ID, hash)
+			if err != nil {
 				serverError(w, r, err, logger, showTrace)
 				return
 			}
+			logger.Info("password rehashed with the current argon2id parameters", "user", user.ID, "format", format)
+		}
+
+		// Log the user in with a new session token
+		err = startSession(r, sessionManager, user)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
 			return
 		}
+		putFlashSuccess(r, translate(r, "You are in!"), sessionManager)
 
-		// Renew token after login to change the session ID
-		err = sessionManager.RenewToken(r.Context())
+		err = recordLogin(r, loginStore, sessionManager, user.Email)
 		if err != nil {
 			serverError(w, r, err, logger, showTrace)
 			return
 		}
 
-		// Set the authenticated session key
-		sessionManager.Put(r.Context(), "authenticated", true)
-		putFlashMessage(r, flashSuccess, "You are in!", sessionManager)
+		// Warn users whose password appeared in a data breach
+		if !validator.NotPwned(r.Context(), pwnedPasswords, form.Password) {
+			putFlashWarning(r, translate(r, "Your password appeared in a data breach. Please change it."), sessionManager)
+		}
 
 		// Redirect to the next page.
-		http.Redirect(w, r, nextURL, http.StatusSeeOther)
+		redirect(w, r, nextURL, http.StatusSeeOther)
 	}
 }
 
@@ -339,7 +1125,7 @@ func logout(
 			data := newTemplateData(r, sessionManager)
 
 			// Render the login page
-			if err := render.Page(w, http.StatusOK, data, "logout.tmpl"); err != nil {
+			if err := renderPage(w, r, http.StatusOK, data, "logout.tmpl"); err != nil {
 				serverError(w, r, err, logger, showTrace)
 				return
 			}
@@ -355,9 +1141,117 @@ func logout(
 
 		// Remove the authenticated session key
 		sessionManager.Remove(r.Context(), "authenticated")
-		putFlashMessage(r, flashSuccess, "You've been logged out!", sessionManager)
+		sessionManager.Remove(r.Context(), "userID")
+		sessionManager.Remove(r.Context(), "tenant")
+		putFlashSuccess(r, translate(r, "You've been logged out!"), sessionManager)
 
 		// Redirect to the next page.
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// csrfField is a form value to resubmit from the CSRF failure page
+type csrfField struct {
+	Name  string
+	Value string
+}
+
+// csrfFailure renders the page for requests that failed the CSRF check, usually a form
+// that was open longer than the session or one sent from another site. Requests from
+// the site itself get a button that resends their form values with a new token.
+// Passwords and files can't be resent and have to be entered again.
+func csrfFailure(
+	logger *slog.Logger,
+	showTrace bool,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.Warn("csrf check failed", "reason", nosurf.Reason(r), "origin", r.Header.Get("Origin"), "method", r.Method, "uri", r.URL.RequestURI())
+
+		// JavaScript clients get a JSON error
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			apiError(w, r, nosurf.FailureCode, "invalid CSRF token, get a new one from /api/csrf/")
+			return
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["BackURL"] = "/"
+
+		// Only offer to resend forms from this site, or another site could get them
+		// sent with a click on the page
+		if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && referer.Host == r.Host && trustedOrigin(r, nil) {
+			data["BackURL"] = localRedirectPath(referer.RequestURI())
+			data["RetryURL"] = r.URL.RequestURI()
+
+			// Multipart forms were already parsed by the CSRF check
+			_ = r.ParseForm()
+			var fields []csrfField
+			var dropped bool
+			for _, name := range slices.Sorted(maps.Keys(r.PostForm)) {
+				if name == nosurf.FormFieldName {
+					continue
+				}
+				if strings.Contains(strings.ToLower(name), "password") {
+					dropped = true
+					continue
+				}
+				for _, value := range r.PostForm[name] {
+					fields = append(fields, csrfField{Name: name, Value: value})
+				}
+			}
+			data["Fields"] = fields
+			data["FieldsDropped"] = dropped || (r.MultipartForm != nil && len(r.MultipartForm.File) > 0)
+		}
+
+		if err := renderPage(w, r, nosurf.FailureCode, data, "csrf-failure.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// setLocale handles the language switcher. It saves a supported locale in the signed
+// lang cookie, which localeMW reads on the next requests, and redirects back to the page.
+func setLocale(logger *slog.Logger, showTrace bool, bundle *i18n.Bundle, codec *cookies.Codec) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		locale := r.PostForm.Get("locale")
+		if !bundle.Supported(locale) {
+			clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		err := codec.WriteSigned(w, http.Cookie{
+			Name:     i18n.CookieName,
+			Value:    locale,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		redirect(w, r, localRedirectPath(r.PostForm.Get("next")), http.StatusSeeOther)
+	}
+}
+
+// dismissFlash removes a sticky flash message from the session and redirects back to the
+// page it was dismissed on
+func dismissFlash(sessionManager *scs.SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		removeStickyFlash(r, r.PostForm.Get("id"), sessionManager)
+		redirect(w, r, localRedirectPath(r.PostForm.Get("next")), http.StatusSeeOther)
 	}
 }
@@ -1,12 +1,58 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/antispam"
+	"github.com/sglmr/gowebstart/internal/apitokens"
+	"github.com/sglmr/gowebstart/internal/argon2id"
 	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/captcha"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/email"
+	"github.com/sglmr/gowebstart/internal/health"
+	"github.com/sglmr/gowebstart/internal/imaging"
+	"github.com/sglmr/gowebstart/internal/jobs"
+	"github.com/sglmr/gowebstart/internal/livereload"
+	"github.com/sglmr/gowebstart/internal/logins"
+	"github.com/sglmr/gowebstart/internal/metrics"
+	"github.com/sglmr/gowebstart/internal/notes"
+	"github.com/sglmr/gowebstart/internal/notifications"
+	"github.com/sglmr/gowebstart/internal/password"
+	"github.com/sglmr/gowebstart/internal/pwned"
+	"github.com/sglmr/gowebstart/internal/ratelimit"
+	"github.com/sglmr/gowebstart/internal/settings"
+	"github.com/sglmr/gowebstart/internal/signing"
+	"github.com/sglmr/gowebstart/internal/sitemap"
+	"github.com/sglmr/gowebstart/internal/sse"
+	"github.com/sglmr/gowebstart/internal/storage"
+	"github.com/sglmr/gowebstart/internal/tasks"
+	"github.com/sglmr/gowebstart/internal/users"
 	"github.com/sglmr/gowebstart/internal/vcs"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+	"github.com/sglmr/gowebstart/internal/websocket"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHealth(t *testing.T) {
@@ -28,6 +74,144 @@ func TestHealth(t *testing.T) {
 	assert.StringIn(t, vcs.Version(), response.body)
 }
 
+func TestHealthLive(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	response := ts.get(t, "/health/live")
+
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "status: OK", response.body)
+}
+
+func TestHealthReady(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// All checks pass
+	ts.healthChecker.Register("db", func(ctx context.Context) error { return nil })
+	response := ts.get(t, "/health/ready")
+
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "application/json", response.header.Get("Content-Type"))
+	assert.StringIn(t, `"status":"ok"`, response.body)
+	assert.StringIn(t, `"name":"db"`, response.body)
+
+	// A failing check makes the app unavailable
+	ts.healthChecker.Register("smtp", func(ctx context.Context) error { return errors.New("dial failed") })
+	response = ts.get(t, "/health/ready")
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.statusCode)
+	assert.StringIn(t, `"name":"smtp","status":"error"`, response.body)
+
+	// The errors of the checks are logged, but not sent to the caller
+	assert.StringNotIn(t, "dial failed", response.body)
+}
+
+func TestRobotsTxt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		disallowAll bool
+		base        string
+		want        string
+	}{
+		{"production", false, "https://example.com", "User-agent: *\nAllow: /\nSitemap: https://example.com/sitemap.xml\n"},
+		{"no base URL", false, "", "User-agent: *\nAllow: /\n"},
+		{"non-production", true, "https://example.com", "User-agent: *\nDisallow: /\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+
+			// The Host header of the request isn't used
+			r.Host = "attacker.example"
+			robotsTxt(tt.disallowAll, tt.base).ServeHTTP(rr, r)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.want, rr.Body.String())
+		})
+	}
+}
+
+func TestSitemapXML(t *testing.T) {
+	t.Parallel()
+
+	// There's no sitemap without a base URL for its links
+	ts := newTestServer(t)
+	response := ts.get(t, "/sitemap.xml")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+	ts.Close()
+
+	ts = newTestServer(t, withConfig(func(cfg *config) { cfg.baseURL = "https://example.com" }))
+	defer ts.Close()
+
+	response = ts.get(t, "/sitemap.xml")
+
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "application/xml; charset=utf-8", response.header.Get("Content-Type"))
+	assert.StringIn(t, "<urlset", response.body)
+	assert.StringIn(t, "<loc>https://example.com/contact/</loc>", response.body)
+}
+
+func TestSitemapXMLIndex(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Two URLs per page makes three pages
+	siteMap := sitemap.New(2)
+	siteMap.Add(sitemap.URL{Loc: "/1"}, sitemap.URL{Loc: "/2"}, sitemap.URL{Loc: "/3"}, sitemap.URL{Loc: "/4"}, sitemap.URL{Loc: "/5"})
+	handler := sitemapXML(siteMap, "http://example.com", logger, false)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/sitemap.xml", http.StatusOK, "<loc>http://example.com/sitemap.xml?page=3</loc>"},
+		{"/sitemap.xml?page=3", http.StatusOK, "<loc>http://example.com/5</loc>"},
+		{"/sitemap.xml?page=4", http.StatusNotFound, ""},
+		{"/sitemap.xml?page=abc", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.StringIn(t, tt.wantBody, rr.Body.String())
+		})
+	}
+}
+
+func TestSecurityTxt(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t, withClock(clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))))
+	defer ts.Close()
+
+	response := ts.get(t, "/.well-known/security.txt")
+
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", response.header.Get("Content-Type"))
+	assert.StringIn(t, "Contact: mailto:security@example.com", response.body)
+	assert.StringIn(t, "Expires: 2026-03-01T00:00:00Z", response.body)
+
+	// Without a contact there's no security.txt
+	rr := httptest.NewRecorder()
+	securityTxt("", clock.System).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/security.txt", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
 func TestContactE2E(t *testing.T) {
 	t.Parallel()
 
@@ -38,7 +222,6 @@ func TestContactE2E(t *testing.T) {
 	// ------- Test GET Method ---------
 
 	response := ts.get(t, "/contact/")
-	token := response.csrfToken(t)
 
 	// Check the status of the request
 	assert.Equal(t, response.statusCode, http.StatusOK)
@@ -46,28 +229,162 @@ func TestContactE2E(t *testing.T) {
 	// Check that the body contains the word "contact"
 	assert.StringIn(t, "Contact", response.body)
 
-	// -------- Test Post without CSRF --------------------
+	// The form has the hidden fields, and the empty honeypot
+	form := response.form(t, "/contact/")
+	assert.Equal(t, http.MethodPost, form.method)
+	assert.NotEqual(t, "", form.values.Get("csrf_token"))
+	assert.NotEqual(t, "", form.values.Get(antispam.TokenField))
+	assert.EqualSlices(t, []string{""}, form.values["message"])
 
-	data := url.Values{}
-	data.Add("name", "joe")
-	data.Add("email", "joe@example.com")
-	data.Add("message", "some message")
+	form.values.Set("name", "joe")
+	form.values.Set("email", "joe@example.com")
+	form.values.Set("message", "some message")
 
-	// Create a new http POST request.
-	response = ts.post(t, "/contact/", data)
+	// -------- Test Post without CSRF --------------------
+
+	token := form.values.Get("csrf_token")
+	form.values.Del("csrf_token")
 
 	// Bad request because
+	response = ts.submit(t, form)
 	assert.Equal(t, response.statusCode, http.StatusBadRequest)
 
 	// --------- Test POST with CSRF -----------------
 
-	// Add the csrf_token to the request
-	data.Add("csrf_token", token)
+	form.values.Set("csrf_token", token)
+	response = ts.submit(t, form)
+
+	assert.Equal(t, response.statusCode, http.StatusFound)
+}
+
+func TestContactSpam(t *testing.T) {
+	t.Parallel()
 
-	// Create a new http POST request.
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	response := ts.get(t, "/contact/")
+	assert.StringIn(t, `name="website"`, response.body)
+
+	data := url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set("name", "joe")
+	data.Set("email", "joe@example.com")
+	data.Set("message", "some message")
+
+	// Forms without a valid token can be submitted again
+	data.Set("form_token", "123.forged")
 	response = ts.post(t, "/contact/", data)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "Please wait a moment and submit it again.", response.body)
 
-	assert.Equal(t, response.statusCode, http.StatusFound)
+	// Bots that fill in the honeypot think the message was sent, but it wasn't
+	data.Set("form_token", response.formToken(t))
+	data.Set("website", "http://spam.example.com")
+	response = ts.post(t, "/contact/", data)
+	assert.Equal(t, http.StatusFound, response.statusCode)
+	assert.StringIn(t, "Thank you for your message.", response.body)
+
+	unread, err := ts.notificationStore.Unread(context.Background(), testEmail)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, unread)
+}
+
+func TestContactCaptcha(t *testing.T) {
+	t.Parallel()
+
+	// A fake CAPTCHA provider that only accepts the "human" response
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Write([]byte(`{"success": ` + strconv.FormatBool(r.FormValue("response") == "human") + `}`))
+	}))
+	defer api.Close()
+
+	verifier, err := captcha.New("hcaptcha", "site-key", "secret", time.Second)
+	assert.NoError(t, err)
+	verifier.Provider.VerifyURL = api.URL
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	jobQueue := jobs.New(jobs.NewMemoryStore(), logger, 1)
+	registerJobs(jobQueue, email.NewLogMailer(logger), nil)
+	spamGuard := antispam.New(nil, 0, time.Hour)
+	sessionManager := scs.New()
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(contact(logger, false, "", spamGuard, verifier, nil, jobQueue, sse.New(time.Second, 1), webhooks.NewMemoryStore(10), notifications.NewMemoryStore(), sessionManager)))
+
+	post := func(response string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"name":               {"joe"},
+			"email":              {"joe@example.com"},
+			"message":            {"some message"},
+			antispam.TokenField:  {spamGuard.Token()},
+			"h-captcha-response": {response},
+		}
+		r := httptest.NewRequest(http.MethodPost, "/contact/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// The form shows the widget
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/contact/", nil))
+	assert.StringIn(t, `<div class="h-captcha" data-sitekey="site-key"></div>`, rr.Body.String())
+
+	rr = post("robot")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.StringIn(t, "Please complete the CAPTCHA.", rr.Body.String())
+
+	rr = post("human")
+	assert.Equal(t, http.StatusFound, rr.Code)
+}
+
+func TestContactRateLimit(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	jobQueue := jobs.New(jobs.NewMemoryStore(), logger, 1)
+	registerJobs(jobQueue, email.NewLogMailer(logger), nil)
+	spamGuard := antispam.New(nil, 0, time.Hour)
+	sessionManager := scs.New()
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(contact(logger, false, "", spamGuard, nil, ratelimit.PerHour(2), jobQueue, sse.New(time.Second, 1), webhooks.NewMemoryStore(10), notifications.NewMemoryStore(), sessionManager)))
+
+	post := func(ip, sender string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"name":              {"joe"},
+			"email":             {sender},
+			"message":           {"some message"},
+			antispam.TokenField: {spamGuard.Token()},
+		}
+		r := httptest.NewRequest(http.MethodPost, "/contact/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = ip + ":1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusFound, post("192.0.2.1", "a@example.com").Code)
+	assert.Equal(t, http.StatusFound, post("192.0.2.1", "b@example.com").Code)
+
+	// The third message from the IP is redirected back with a flash message
+	rr := post("192.0.2.1", "c@example.com")
+	assert.RedirectsTo(t, rr.Result(), "/contact/")
+
+	r := httptest.NewRequest(http.MethodGet, "/contact/", nil)
+	r.Header.Set("Cookie", rr.Header().Get("Set-Cookie"))
+	page := httptest.NewRecorder()
+	handler.ServeHTTP(page, r)
+	assert.StringIn(t, "You&#39;ve sent too many messages. Please try again in 30 minutes.", page.Body.String())
+
+	// So is the third message from the same sender on another IP
+	assert.Equal(t, http.StatusFound, post("192.0.2.2", "a@example.com").Code)
+	assert.Equal(t, http.StatusSeeOther, post("192.0.2.3", "A@example.com").Code)
+
+	// Unknown client IPs of a proxy on a unix socket only have the sender limit
+	assert.Equal(t, http.StatusFound, post("@", "d@example.com").Code)
+	assert.Equal(t, http.StatusFound, post("@", "e@example.com").Code)
+	assert.Equal(t, http.StatusFound, post("@", "f@example.com").Code)
 }
 
 func TestHome(t *testing.T) {
@@ -80,6 +397,189 @@ func TestHome(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, response.statusCode)
 	assert.StringIn(t, "Example", response.body)
+	assert.StringNotIn(t, "/dev/livereload", response.body)
+	assert.StringIn(t, `integrity="sha384-`, response.body)
+	assert.Equal(t, "", response.header.Get("X-Robots-Tag"))
+
+	// Inline scripts carry the Content-Security-Policy nonce of the request
+	assert.StringNotIn(t, "onchange=", response.body)
+	csp := response.header.Get("Content-Security-Policy")
+	_, nonce, ok := strings.Cut(csp, "'nonce-")
+	assert.Equal(t, true, ok)
+	nonce, _, _ = strings.Cut(nonce, "'")
+	assert.StringIn(t, `<script nonce="`+nonce+`">`, response.body)
+}
+
+func TestLoginPwnedPassword(t *testing.T) {
+	t.Parallel()
+
+	// testPassword is "password", which is in every data breach
+	list, err := pwned.ReadList(strings.NewReader("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:52256179\n"))
+	assert.NoError(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessionManager := scs.New()
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(login(logger, sessionManager, false, newUserStore(t, testPasswordHash), nil, list, logins.NewMemoryStore(), nil, false)))
+
+	form := url.Values{"email": {testEmail}, "password": {testPassword}}
+	r := httptest.NewRequest(http.MethodPost, "/login/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+
+	// The login works, with a warning to change the password
+	r = httptest.NewRequest(http.MethodGet, "/login/", nil)
+	r.Header.Set("Cookie", rr.Header().Get("Set-Cookie"))
+	page := httptest.NewRecorder()
+	handler.ServeHTTP(page, r)
+	assert.StringIn(t, "You are in!", page.Body.String())
+	assert.StringIn(t, "Your password appeared in a data breach. Please change it.", page.Body.String())
+}
+
+func TestLoginLockout(t *testing.T) {
+	t.Parallel()
+
+	userStore := newUserStore(t, testPasswordHash)
+	_, err := users.Ensure(context.Background(), userStore, clock.System, "other@example.com", testPasswordHash, users.RoleViewer)
+	assert.NoError(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessionManager := scs.New()
+	lockout := ratelimit.NewLockout(2, time.Minute, time.Hour)
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(login(logger, sessionManager, false, userStore, testArgon2Params, nil, logins.NewMemoryStore(), lockout, false)))
+
+	login := func(email, password, ip string) *httptest.ResponseRecorder {
+		form := url.Values{"email": {email}, "password": {password}}
+		r := httptest.NewRequest(http.MethodPost, "/login/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = ip + ":1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// A successful login forgets the failed logins of the email
+	assert.Equal(t, http.StatusUnprocessableEntity, login(testEmail, "wrong", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusSeeOther, login(testEmail, testPassword, "10.0.0.2").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, login(testEmail, "wrong", "10.0.0.3").Code)
+
+	// The email is locked out after the free failures, even with the right password
+	rr := login(testEmail, "wrong", "10.0.0.4")
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	rr = login(testEmail, "wrong", "10.0.0.5")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.StringIn(t, "Too many failed logins. Please try again in 1 minutes.", rr.Body.String())
+	assert.Equal(t, http.StatusTooManyRequests, login(testEmail, testPassword, "10.0.0.6").Code)
+	assert.Equal(t, http.StatusSeeOther, login("other@example.com", testPassword, "10.0.0.6").Code)
+
+	// So is a client IP that guesses the passwords of several emails, unknown ones too
+	assert.Equal(t, http.StatusUnprocessableEntity, login("other@example.com", "wrong", "10.0.0.7").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, login("nobody@example.com", "wrong", "10.0.0.7").Code)
+	assert.Equal(t, http.StatusTooManyRequests, login("someone@example.com", "wrong", "10.0.0.7").Code)
+	assert.Equal(t, http.StatusTooManyRequests, login("other@example.com", testPassword, "10.0.0.7").Code)
+
+	// But not the unknown client IPs of a proxy on a unix socket, which are everyone behind it
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		assert.Equal(t, http.StatusUnprocessableEntity, login(email, "wrong", "@").Code)
+	}
+}
+
+func TestLoginRehash(t *testing.T) {
+	t.Parallel()
+
+	// testPasswordHash has 1 iteration
+	params := &argon2id.Params{Memory: 64 * 1024, Iterations: 2, Parallelism: 8, SaltLength: 16, KeyLength: 32}
+	userStore := newUserStore(t, testPasswordHash)
+	passwordHash := func() string {
+		user, err := userStore.GetByEmail(context.Background(), testEmail)
+		assert.NoError(t, err)
+		return user.PasswordHash
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessionManager := scs.New()
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(login(logger, sessionManager, false, userStore, params, nil, logins.NewMemoryStore(), nil, false)))
+
+	login := func() int {
+		form := url.Values{"email": {testEmail}, "password": {testPassword}}
+		r := httptest.NewRequest(http.MethodPost, "/login/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	// The login rehashes the password with the stronger parameters
+	assert.Equal(t, http.StatusSeeOther, login())
+	assert.NotEqual(t, testPasswordHash, passwordHash())
+	hashParams, _, _, err := argon2id.DecodeHash(passwordHash())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), hashParams.Iterations)
+
+	// The new hash works, and isn't rehashed again
+	rehashed := passwordHash()
+	assert.Equal(t, http.StatusSeeOther, login())
+	assert.Equal(t, rehashed, passwordHash())
+}
+
+func TestLoginUnknownPepper(t *testing.T) {
+	t.Parallel()
+
+	// A hash with a pepper that was removed from the configuration
+	peppered := *testArgon2Params
+	peppered.KeyID = "1"
+	peppered.Peppers = map[string][]byte{"1": []byte("old-secret")}
+	hash, err := password.Hash(testPassword, &peppered)
+	assert.NoError(t, err)
+
+	logs := new(bytes.Buffer)
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	sessionManager := scs.New()
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(login(logger, sessionManager, false, newUserStore(t, hash), testArgon2Params, nil, logins.NewMemoryStore(), nil, false)))
+
+	// The login fails like a wrong password, and the configuration error is logged
+	form := url.Values{"email": {testEmail}, "password": {testPassword}}
+	r := httptest.NewRequest(http.MethodPost, "/login/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.StringIn(t, "check -password-peppers", logs.String())
+}
+
+func TestLoginBcrypt(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	assert.NoError(t, err)
+	userStore := newUserStore(t, string(hash))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessionManager := scs.New()
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(login(logger, sessionManager, false, userStore, argon2id.DefaultParams, nil, logins.NewMemoryStore(), nil, false)))
+
+	form := url.Values{"email": {testEmail}, "password": {testPassword}}
+	r := httptest.NewRequest(http.MethodPost, "/login/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	// The bcrypt hash logs in and is replaced with an argon2id hash
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	user, err := userStore.GetByEmail(context.Background(), testEmail)
+	assert.NoError(t, err)
+	assert.Equal(t, password.FormatArgon2id, password.Format(user.PasswordHash))
+}
+
+// newUserStore returns a user store with the testEmail user and a password hash
+func newUserStore(t *testing.T, hash string) *users.MemoryStore {
+	t.Helper()
+
+	store := users.NewMemoryStore()
+	_, err := users.Ensure(context.Background(), store, clock.System, testEmail, hash, users.RoleAdmin)
+	assert.NoError(t, err)
+	return store
 }
 
 func TestLoginLogout(t *testing.T) {
@@ -141,3 +641,736 @@ func TestLoginLogout(t *testing.T) {
 	response = ts.get(t, "/logout/")
 	assert.Equal(t, http.StatusSeeOther, response.statusCode)
 }
+
+func TestLoginValidationErrors(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	response := ts.get(t, "/login/?lang=es")
+
+	// Field errors are shown in the language of the request
+	data := url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set("email", "not-an-email")
+	response = ts.post(t, "/login/?lang=es", data)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+	assert.StringIn(t, "El correo electrónico debe ser válido.", response.body)
+	assert.StringIn(t, "Este campo no puede estar vacío.", response.body)
+}
+
+func TestLoginNextRedirect(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Protected pages redirect to the login page, which remembers the page
+	response, chain := ts.getFollow(t, "/account/logins/")
+	assert.Equal(t, 1, len(chain))
+	assert.RedirectsTo(t, chain[0].Result(), "/login/?next=%2Faccount%2Flogins%2F")
+	assert.Status(t, response.Result(), http.StatusOK)
+	assert.StringIn(t, `<input type="password" id="password" name="password"`, response.body)
+
+	// Logging in goes back to the page, with the flash message
+	data := url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set("email", testEmail)
+	data.Set("password", testPassword)
+	response, chain = ts.follow(t, ts.post(t, "/login/?next=%2Faccount%2Flogins%2F", data))
+	assert.Equal(t, 1, len(chain))
+	assert.RedirectsTo(t, chain[0].Result(), "/account/logins/")
+	assert.Status(t, response.Result(), http.StatusOK)
+	assert.StringIn(t, "<h1>Login History</h1>", response.body)
+	assert.StringIn(t, "You are in!", response.body)
+
+	// Pages without redirects have no chain
+	response, chain = ts.getFollow(t, "/")
+	assert.Equal(t, 0, len(chain))
+	assert.Status(t, response.Result(), http.StatusOK)
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	t.Parallel()
+
+	// Create an ACME challenge file to serve
+	challengeDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(challengeDir, "some-token"), []byte("some-token.key"), 0o644)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		httpsPort    string
+		target       string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{"default port", "443", "http://example.com/contact/?a=b", http.StatusPermanentRedirect, "https://example.com/contact/?a=b", ""},
+		{"custom port", "8443", "http://example.com:8080/", http.StatusPermanentRedirect, "https://example.com:8443/", ""},
+		{"acme challenge", "443", "http://example.com/.well-known/acme-challenge/some-token", http.StatusOK, "", "some-token.key"},
+		{"missing challenge", "443", "http://example.com/.well-known/acme-challenge/other-token", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+
+			httpsRedirect(tt.httpsPort, challengeDir).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantLocation, rr.Header().Get("Location"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPprof(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		pprofEnabled bool
+		basicAuth    bool
+		wantStatus   int
+	}{
+		{"disabled", false, true, http.StatusNotFound},
+		{"no credentials", true, false, http.StatusUnauthorized},
+		{"with credentials", true, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, withConfig(func(cfg *config) { cfg.pprofEnabled = tt.pprofEnabled }))
+			defer ts.Close()
+
+			request, err := http.NewRequest(http.MethodGet, ts.URL+"/debug/pprof/cmdline", nil)
+			assert.NoError(t, err)
+			if tt.basicAuth {
+				request.SetBasicAuth(testEmail, testPassword)
+			}
+
+			assert.Status(t, ts.do(t, request).Result(), tt.wantStatus)
+		})
+	}
+}
+
+func TestPprofLongProfile(t *testing.T) {
+	t.Parallel()
+
+	// pprof extends the write deadline of profiles that take longer than the server's
+	// WriteTimeout, which needs every middleware writer to unwrap to the connection
+	ts := newTestServer(t, withWriteTimeout(200*time.Millisecond), withConfig(func(cfg *config) {
+		cfg.pprofEnabled = true
+		cfg.metrics = metrics.NewRegistry()
+	}))
+	defer ts.Close()
+
+	request, err := http.NewRequest(http.MethodGet, ts.URL+"/debug/pprof/trace?seconds=0.5", nil)
+	assert.NoError(t, err)
+	request.SetBasicAuth(testEmail, testPassword)
+
+	response := ts.do(t, request)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "go 1.", response.body)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	// Metrics are off by default
+	ts := newTestServer(t)
+	response := ts.get(t, "/metrics")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+	ts.Close()
+
+	ts = newTestServer(t, withConfig(func(cfg *config) { cfg.metrics = metrics.NewRegistry() }))
+	defer ts.Close()
+
+	// Scrapes require basic authentication
+	response = ts.get(t, "/metrics")
+	assert.Equal(t, http.StatusUnauthorized, response.statusCode)
+
+	ts.get(t, "/contact/")
+	ts.get(t, "/notes/12345/edit/")
+	ts.get(t, "/missing-page/")
+
+	request, err := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+	assert.NoError(t, err)
+	request.SetBasicAuth(testEmail, testPassword)
+	response = ts.do(t, request)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+
+	// Requests are counted by route pattern, not by path
+	body := response.body
+	assert.StringIn(t, `http_requests_total{method="GET",route="/contact/",status="200"} 1`, body)
+	assert.StringIn(t, `http_requests_total{method="GET",route="/notes/{id}/edit/{$}",status="303"} 1`, body)
+	assert.StringIn(t, `http_request_duration_seconds_count{method="GET",route="/contact/"} 1`, body)
+	assert.StringIn(t, "http_requests_in_flight 1", body)
+	assert.StringIn(t, "# TYPE tasks_failed_total counter\ntasks_failed_total 0\n", body)
+	assert.StringIn(t, "tasks_queued 0\n", body)
+	assert.StringNotIn(t, "12345", body)
+	assert.StringNotIn(t, "missing-page", body)
+}
+
+func TestStaticFingerprint(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// The page links to the fingerprinted stylesheet
+	hashedPath := assets.StaticManifest().Path("/static/css/main.css")
+	assert.NotEqual(t, "/static/css/main.css", hashedPath)
+
+	response := ts.get(t, "/")
+	assert.StringIn(t, hashedPath, response.body)
+
+	// Fingerprinted files are cached forever
+	response = ts.get(t, hashedPath)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "public, max-age=31536000, immutable", response.header.Get("Cache-Control"))
+	assert.StringIn(t, "text/css", response.header.Get("Content-Type"))
+
+	// The original file path is still served with the cache policy max age
+	response = ts.get(t, "/static/css/main.css")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "public, max-age=3600", response.header.Get("Cache-Control"))
+
+	// Images are cached longer
+	response = ts.get(t, "/static/images/favicon.ico")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "public, max-age=2592000", response.header.Get("Cache-Control"))
+}
+
+func TestRootFiles(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	tests := []struct {
+		path             string
+		wantContentType  string
+		wantCacheControl string
+	}{
+		{"/favicon.ico", "image/x-icon", "public, max-age=2592000"},
+		{"/apple-touch-icon.png", "image/png", "public, max-age=2592000"},
+		{"/apple-touch-icon-precomposed.png", "image/png", "public, max-age=2592000"},
+		{"/site.webmanifest", "application/manifest+json", "public, max-age=86400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			response := ts.get(t, tt.path)
+
+			assert.Equal(t, http.StatusOK, response.statusCode)
+			assert.Equal(t, tt.wantContentType, response.header.Get("Content-Type"))
+			assert.Equal(t, tt.wantCacheControl, response.header.Get("Cache-Control"))
+		})
+	}
+}
+
+func TestStaticLastModified(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Embedded files use the build time for Last-Modified
+	response := ts.get(t, "/static/css/main.css")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, testBuildTime.Format(http.TimeFormat), response.header.Get("Last-Modified"))
+
+	response = ts.get(t, "/favicon.ico")
+	assert.Equal(t, testBuildTime.Format(http.TimeFormat), response.header.Get("Last-Modified"))
+
+	// Conditional requests are answered with 304 Not Modified
+	request, err := http.NewRequest(http.MethodGet, ts.URL+"/static/css/main.css", nil)
+	assert.NoError(t, err)
+	request.Header.Set("If-Modified-Since", testBuildTime.Format(http.TimeFormat))
+
+	rs, err := ts.Client().Do(request)
+	assert.NoError(t, err)
+	rs.Body.Close()
+	assert.Equal(t, http.StatusNotModified, rs.StatusCode)
+}
+
+func TestStaticETag(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Static files have the content hash of the manifest as ETag, also for fingerprinted
+	// and root paths
+	etag := assets.StaticManifest().ETag("/static/css/main.css")
+	assert.NotEqual(t, "", etag)
+	response := ts.get(t, "/static/css/main.css")
+	assert.Equal(t, etag, response.header.Get("ETag"))
+	response = ts.get(t, assets.StaticManifest().Path("/static/css/main.css"))
+	assert.Equal(t, etag, response.header.Get("ETag"))
+	response = ts.get(t, "/favicon.ico")
+	assert.Equal(t, assets.StaticManifest().ETag("/static/images/favicon.ico"), response.header.Get("ETag"))
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"matching", etag, http.StatusNotModified},
+		{"one of several", `"other", ` + etag, http.StatusNotModified},
+		{"changed file", `"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, ts.URL+"/static/css/main.css", nil)
+			assert.NoError(t, err)
+			request.Header.Set("If-None-Match", tt.ifNoneMatch)
+
+			rs, err := ts.Client().Do(request)
+			assert.NoError(t, err)
+			rs.Body.Close()
+			assert.Equal(t, tt.want, rs.StatusCode)
+		})
+	}
+}
+
+func TestLiveReload(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config{clock: clock.System, devMode: true, staticCache: map[string]time.Duration{"": 0}}
+	reloader := livereload.New(time.Hour, t.TempDir())
+
+	handler, err := newServer(logger, cfg, email.NewLogMailer(logger), tasks.New(logger, 1, 1), jobs.New(jobs.NewMemoryStore(), logger, 1), sse.New(time.Second, 1), websocket.NewHub(time.Second), nil, notes.NewMemoryStore(), notifications.NewMemoryStore(), logins.NewMemoryStore(), users.NewMemoryStore(), apitokens.NewMemoryStore(), webhooks.NewMemoryStore(10), settings.New(settings.NewMemoryStore(), time.Second, settingDefinitions...), scs.New(), health.New(time.Second), storage.NewLocal(t.TempDir()), reloader)
+	assert.NoError(t, err)
+
+	// Pages include the live reload script
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.StringIn(t, `new EventSource("/dev/livereload")`, rr.Body.String())
+
+	// The reload events are streamed from the server
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/dev/livereload", nil)
+	assert.NoError(t, err)
+
+	response, err := ts.Client().Do(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+}
+
+func TestUserFile(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	ts := newTestServer(t, withClock(fakeClock))
+	defer ts.Close()
+
+	// Store some uploaded files
+	files := map[string]string{
+		"public/readme.txt": "Hello, world!",
+		"private/notes.txt": "secret notes",
+		"private/page.html": "<html><script>alert(1)</script></html>",
+		"private/image.jpg": "\x89PNG\r\n\x1a\n not really a jpeg",
+	}
+	for key, data := range files {
+		assert.NoError(t, ts.fileStore.Save(key, strings.NewReader(data)))
+	}
+
+	// Public files are served to everyone
+	response := ts.get(t, "/files/public/readme.txt")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "Hello, world!", response.body)
+	assert.Equal(t, "text/plain; charset=utf-8", response.header.Get("Content-Type"))
+	assert.Equal(t, "sandbox", response.header.Get("Content-Security-Policy"))
+	assert.Equal(t, "", response.header.Get("Content-Disposition"))
+
+	// Private files look like they don't exist without login
+	response = ts.get(t, "/files/private/notes.txt")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	// Signed download links work without login until they expire
+	signer := signing.New([]byte(testSigningKey))
+	signer.Clock = fakeClock
+	link, err := signer.Sign("/files/private/notes.txt", purposeDownload, time.Hour)
+	assert.NoError(t, err)
+	response = ts.get(t, link)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "secret notes", response.body)
+
+	other, err := signer.Sign("/files/private/notes.txt", "unsubscribe", time.Hour)
+	assert.NoError(t, err)
+	response = ts.get(t, other)
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	fakeClock.Add(time.Hour + time.Second)
+	response = ts.get(t, link)
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	// Missing files and directories are not found
+	response = ts.get(t, "/files/public/missing.txt")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+	response = ts.get(t, "/files/public/")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	// Logged in users can open their own files, but not other files without a signed link
+	owner, err := users.Ensure(context.Background(), ts.userStore, ts.clock, "owner@example.com", testPasswordHash, users.RoleViewer)
+	assert.NoError(t, err)
+	for name, data := range files {
+		assert.NoError(t, ts.fileStore.Save(userFileKey(owner.ID, path.Base(name)), strings.NewReader(data)))
+	}
+	ownerFile := "/files/" + userFileKey(owner.ID, "notes.txt")
+
+	ts.loginAs(t, testEmail)
+	response = ts.get(t, "/files/private/notes.txt")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+	response = ts.get(t, ownerFile)
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	ts.loginAs(t, "owner@example.com")
+	response = ts.get(t, ownerFile)
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "secret notes", response.body)
+	response = ts.get(t, "/files/private/notes.txt")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	// The content type is sniffed from the contents, not the file name
+	response = ts.get(t, "/files/"+userFileKey(owner.ID, "image.jpg"))
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "image/png", response.header.Get("Content-Type"))
+
+	// HTML files are downloaded instead of displayed
+	response = ts.get(t, "/files/"+userFileKey(owner.ID, "page.html"))
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "text/html; charset=utf-8", response.header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=page.html`, response.header.Get("Content-Disposition"))
+
+	// Range requests get part of the file
+	request, err := http.NewRequest(http.MethodGet, ts.URL+ownerFile, http.NoBody)
+	assert.NoError(t, err)
+	request.Header.Set("Range", "bytes=7-11")
+	rs, err := ts.Client().Do(request)
+	assert.NoError(t, err)
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, rs.StatusCode)
+	assert.Equal(t, "notes", string(body))
+}
+
+func TestUserFileVariant(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Store a 400x200 image
+	buf := new(bytes.Buffer)
+	err := png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, 400, 200)))
+	assert.NoError(t, err)
+	original := buf.String()
+	assert.NoError(t, ts.fileStore.Save("public/banner.png", buf))
+
+	// Unknown variants aren't found
+	response := ts.get(t, "/files/public/banner.png?variant=huge")
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+
+	// The original is served until the variants are made, and requests don't make them
+	response = ts.get(t, "/files/public/banner.png?variant=thumb")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.Equal(t, "image/png", response.header.Get("Content-Type"))
+	assert.Equal(t, original, response.body)
+	_, err = ts.fileStore.Open("variants/thumb/public/banner.png")
+	assert.Equal(t, true, errors.Is(err, fs.ErrNotExist))
+
+	images := imaging.NewProcessor(ts.fileStore, imaging.Variant{Name: "thumb", Width: 150, Height: 150})
+	assert.NoError(t, images.Process(context.Background(), "public/banner.png"))
+
+	response = ts.get(t, "/files/public/banner.png?variant=thumb")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.NotEqual(t, original, response.body)
+	cfg, err := png.DecodeConfig(strings.NewReader(response.body))
+	assert.NoError(t, err)
+	assert.Equal(t, 150, cfg.Width)
+	assert.Equal(t, 75, cfg.Height)
+}
+
+// recordMailer records the recipients of sent emails
+type recordMailer struct {
+	email.LogMailer
+	sent chan string
+}
+
+func (m *recordMailer) Send(ctx context.Context, msg email.Message) error {
+	m.sent <- strings.Join(msg.To, ",")
+	return nil
+}
+
+func TestSendEmailJob(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mailer := &recordMailer{sent: make(chan string, 1)}
+
+	webhookStore := webhooks.NewMemoryStore(10)
+	jobQueue := jobs.New(jobs.NewMemoryStore(), logger, 1)
+	registerJobs(jobQueue, mailer, webhooks.NewDispatcher(webhookStore, time.Second))
+	jobQueue.Start()
+	defer jobQueue.Shutdown(context.Background())
+
+	// The handler queues the email and the job sends it
+	sessionManager := scs.New()
+	handler := templatesMW(testTemplates())(sessionManager.LoadAndSave(sendTestEmail(logger, false, "admin@example.com", jobQueue, sessionManager)))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/send-email/", nil))
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+
+	select {
+	case recipient := <-mailer.sent:
+		assert.Equal(t, "admin@example.com", recipient)
+	case <-time.After(5 * time.Second):
+		t.Fatal("email job didn't run")
+	}
+}
+
+func TestSendTestEmail(t *testing.T) {
+	t.Parallel()
+
+	mailer := &recordMailer{sent: make(chan string, 1)}
+	ts := newTestServer(t, withMailer(mailer))
+	defer ts.Close()
+
+	// The old public endpoint is gone, and the admin page requires login
+	assert.Equal(t, http.StatusNotFound, ts.get(t, "/send-mail/").statusCode)
+	assert.Equal(t, http.StatusSeeOther, ts.get(t, "/admin/send-email/").statusCode)
+
+	ts.loginAs(t, testEmail)
+
+	response := ts.get(t, "/admin/send-email/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, testEmail, response.body)
+
+	// Sending needs a CSRF token
+	response = ts.post(t, "/admin/send-email/", url.Values{})
+	assert.Equal(t, http.StatusBadRequest, response.statusCode)
+
+	data := url.Values{}
+	data.Set("csrf_token", ts.get(t, "/admin/send-email/").csrfToken(t))
+	response = ts.post(t, "/admin/send-email/", data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	response = ts.get(t, "/admin/send-email/")
+	assert.StringIn(t, "Test email queued for "+testEmail+".", response.body)
+
+	// The job queue sends it with the server's mailer
+	select {
+	case recipient := <-mailer.sent:
+		assert.Equal(t, testEmail, recipient)
+	case <-time.After(5 * time.Second):
+		t.Fatal("email job didn't run")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// The event stream requires login
+	response := ts.get(t, "/events/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	ts.loginAs(t, testEmail)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events/", nil)
+	assert.NoError(t, err)
+
+	rs, err := ts.Client().Do(request)
+	assert.NoError(t, err)
+	defer rs.Body.Close()
+	assert.Equal(t, "text/event-stream", rs.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(rs.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+	reader.ReadString('\n')
+
+	// A contact message is streamed to the logged in user
+	response = ts.get(t, "/contact/")
+	data := url.Values{}
+	data.Add("csrf_token", response.csrfToken(t))
+	data.Add("form_token", response.formToken(t))
+	data.Add("name", "joe")
+	data.Add("email", "joe@example.com")
+	data.Add("message", "some message")
+	response = ts.post(t, "/contact/", data)
+	assert.Equal(t, http.StatusFound, response.statusCode)
+
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: contact\n", line)
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: joe\n", line)
+}
+
+func TestWebsocket(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// The WebSocket requires login
+	response := ts.get(t, "/ws/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	ts.loginAs(t, testEmail)
+
+	request, err := http.NewRequest(http.MethodGet, ts.URL+"/ws/", nil)
+	assert.NoError(t, err)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	rs, err := ts.Client().Do(request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, rs.StatusCode)
+	conn := rs.Body.(io.ReadWriteCloser)
+	defer conn.Close()
+
+	// Send a masked text frame, which is sent back to every connection
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x81, 0x80 | 2}, mask...)
+	for i, b := range []byte("hi") {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err = conn.Write(frame)
+	assert.NoError(t, err)
+
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "\x81\x02hi", string(reply))
+}
+
+func TestHtmxFragments(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Full page loads get the base template
+	response := ts.get(t, "/contact/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "<html", response.body)
+	assert.StringIn(t, `hx-headers='{"X-CSRF-Token": "`, response.body)
+	assert.Equal(t, true, slices.Contains(response.header.Values("Vary"), "HX-Request"))
+
+	// htmx requests only get the page content
+	request, err := http.NewRequest(http.MethodGet, ts.URL+"/contact/", nil)
+	assert.NoError(t, err)
+	request.Header.Set("HX-Request", "true")
+	rs, err := ts.Client().Do(request)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(rs.Body)
+	rs.Body.Close()
+	assert.NoError(t, err)
+	assert.StringNotIn(t, "<html", string(body))
+	assert.StringIn(t, "<h1>Contact Us</h1>", string(body))
+
+	// Boosted requests swap the whole body, so they get the full page
+	request.Header.Set("HX-Boosted", "true")
+	rs, err = ts.Client().Do(request)
+	assert.NoError(t, err)
+	body, err = io.ReadAll(rs.Body)
+	rs.Body.Close()
+	assert.NoError(t, err)
+	assert.StringIn(t, "<html", string(body))
+
+	// Redirects for htmx requests are full page loads
+	request, err = http.NewRequest(http.MethodGet, ts.URL+"/login-required/", nil)
+	assert.NoError(t, err)
+	request.Header.Set("HX-Request", "true")
+	rs, err = ts.Client().Do(request)
+	assert.NoError(t, err)
+	rs.Body.Close()
+	assert.Equal(t, http.StatusNoContent, rs.StatusCode)
+	assert.Equal(t, "/login/?next=%2Flogin-required%2F", rs.Header.Get("HX-Redirect"))
+}
+
+func TestSetLocale(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Pages have the language switcher, with the current locale selected
+	response := ts.get(t, "/contact/")
+	assert.StringIn(t, `<option value="es">español</option>`, response.body)
+	form := response.form(t, "/locale/")
+	assert.Equal(t, "en", form.values.Get("locale"))
+	assert.Equal(t, "/contact/", form.values.Get("next"))
+
+	// Unsupported locales are rejected
+	response = ts.post(t, "/locale/", url.Values{"locale": {"xx"}, "next": {"/contact/"}})
+	assert.Status(t, response.Result(), http.StatusBadRequest)
+
+	// The locale is saved in a cookie and the user goes back to the page
+	response = ts.post(t, "/locale/", url.Values{"locale": {"es"}, "next": {"/contact/"}})
+	assert.RedirectsTo(t, response.Result(), "/contact/")
+	assert.HasCookie(t, response.Result(), "lang")
+	assert.StringNotIn(t, "lang=es;", response.header.Get("Set-Cookie"))
+
+	response = ts.get(t, "/contact/")
+	assert.StringIn(t, "<h1>Contáctenos</h1>", response.body)
+	assert.Equal(t, "es", response.form(t, "/locale/").values.Get("locale"))
+
+	// Redirects only go to this site
+	response = ts.post(t, "/locale/", url.Values{"locale": {"en"}, "next": {"https://example.com/"}})
+	assert.RedirectsTo(t, response.Result(), "/")
+}
+
+func TestCSRFFailure(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	postLogin := func(referer, origin string) testResponse {
+		form := url.Values{"csrf_token": {"expired"}, "email": {testEmail}, "password": {testPassword}}
+		request, err := http.NewRequest(http.MethodPost, ts.URL+"/login/", strings.NewReader(form.Encode()))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Referer", referer)
+		request.Header.Set("Origin", origin)
+		response, err := ts.Client().Do(request)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		return testResponse{statusCode: response.StatusCode, header: response.Header, body: string(body)}
+	}
+
+	// Forms from the site can be sent again with a new token, without the password
+	response := postLogin(ts.URL+"/login/?next=/notes/", ts.URL)
+	assert.Equal(t, http.StatusBadRequest, response.statusCode)
+	assert.StringIn(t, "<h1>Form expired</h1>", response.body)
+	assert.StringIn(t, `<form method="POST" action="/login/">`, response.body)
+	assert.StringIn(t, `<input type="hidden" name="email" value="`+testEmail+`">`, response.body)
+	assert.StringNotIn(t, `name="password"`, response.body)
+	assert.StringNotIn(t, `value="expired"`, response.body)
+	assert.StringIn(t, "Passwords and files aren&#39;t sent again.", response.body)
+	assert.StringIn(t, `<a href="/login/?next=/notes/">Go back</a>`, response.body)
+
+	// Forms from other sites only get a link home
+	response = postLogin("https://evil.example.com/", "https://evil.example.com")
+	assert.Equal(t, http.StatusBadRequest, response.statusCode)
+	assert.StringIn(t, "<h1>Form expired</h1>", response.body)
+	assert.StringNotIn(t, `<form method="POST" action="/login/">`, response.body)
+	assert.StringIn(t, `<a href="/">Go back</a>`, response.body)
+}
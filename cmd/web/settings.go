@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/settings"
+	"github.com/sglmr/gowebstart/internal/validator"
+)
+
+// Keys of the application settings
+const (
+	settingSiteName         = "site_name"
+	settingContactRecipient = "contact_recipient"
+	settingFooterText       = "footer_text"
+)
+
+// settingDefinitions are the settings edited on the /admin/settings/ page
+var settingDefinitions = []settings.Definition{
+	{
+		Key:     settingSiteName,
+		Label:   "Site name",
+		Help:    "Shown in the navigation bar and page titles.",
+		Type:    settings.TypeString,
+		Default: "Some Site",
+	},
+	{
+		Key:     settingContactRecipient,
+		Label:   "Contact recipient",
+		Help:    "Email address that gets the contact form messages.",
+		Type:    settings.TypeEmail,
+		Default: "Recipient <recipient@example.com>",
+	},
+	{
+		Key:     settingFooterText,
+		Label:   "Footer text",
+		Help:    "Shown after the copyright years in the footer.",
+		Type:    settings.TypeString,
+		Default: "Stephen Gilmore",
+	},
+}
+
+// settingsContextKey holds the values of the application settings for the request
+const settingsContextKey = contextKey("settings")
+
+// settingsMW loads the values of the application settings into the request context, so
+// handlers and templates read the same values for the whole request.
+func settingsMW(siteSettings *settings.Settings, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The defaults are still usable when the store fails, so only log the error
+			values, err := siteSettings.Values(r.Context())
+			if err != nil {
+				logger.Error("settings error", "error", err)
+			}
+
+			ctx := context.WithValue(r.Context(), settingsContextKey, values)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// siteSettings returns the values of the application settings for the request
+func siteSettings(r *http.Request) map[string]string {
+	values, ok := r.Context().Value(settingsContextKey).(map[string]string)
+	if !ok {
+		return map[string]string{}
+	}
+	return values
+}
+
+// siteSetting returns the value of an application setting for the request
+func siteSetting(r *http.Request, key string) string {
+	return siteSettings(r)[key]
+}
+
+// settingField is a setting with its value on the settings form
+type settingField struct {
+	settings.Definition
+	Value string
+}
+
+// settingsForm is the form of the settings admin page
+type settingsForm struct {
+	Fields []settingField
+	validator.Validator
+}
+
+// newSettingsForm returns the form with a field for every setting
+func newSettingsForm(definitions []settings.Definition, values map[string]string) settingsForm {
+	form := settingsForm{}
+	for _, d := range definitions {
+		form.Fields = append(form.Fields, settingField{Definition: d, Value: values[d.Key]})
+	}
+	return form
+}
+
+// settingsAdmin handles the admin page to edit the application settings
+func settingsAdmin(
+	logger *slog.Logger,
+	showTrace bool,
+	siteSettings *settings.Settings,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := siteSettings.Values(r.Context())
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Form"] = newSettingsForm(siteSettings.Definitions(), values)
+
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				clientError(w, r, http.StatusBadRequest)
+				return
+			}
+
+			// Read every setting from the form. Unchecked boxes aren't sent, so bool
+			// settings are true when their field is there.
+			posted := map[string]string{}
+			for _, d := range siteSettings.Definitions() {
+				posted[d.Key] = strings.TrimSpace(r.PostForm.Get(d.Key))
+				if d.Type == settings.TypeBool {
+					posted[d.Key] = strconv.FormatBool(r.PostForm.Has(d.Key))
+				}
+			}
+
+			// Validate every setting before saving any of them
+			form := newSettingsForm(siteSettings.Definitions(), posted)
+			for _, f := range form.Fields {
+				if err := f.Validate(f.Value); err != nil {
+					form.AddError(f.Key, fmt.Sprintf("%s %s.", f.Label, err))
+				}
+			}
+
+			if form.Valid() {
+				for _, f := range form.Fields {
+					if f.Value == values[f.Key] {
+						continue
+					}
+					if err := siteSettings.Set(r.Context(), f.Key, f.Value); err != nil {
+						serverError(w, r, err, logger, showTrace)
+						return
+					}
+				}
+
+				putFlashSuccess(r, translate(r, "Settings saved."), sessionManager)
+				redirect(w, r, "/admin/settings/", http.StatusSeeOther)
+				return
+			}
+
+			// Update the template data form so the page errors will render
+			data["Form"] = form
+			if err := renderPage(w, r, http.StatusUnprocessableEntity, data, "admin-settings.tmpl"); err != nil {
+				serverError(w, r, err, logger, showTrace)
+			}
+			return
+		}
+
+		if err := renderPage(w, r, http.StatusOK, data, "admin-settings.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestSettingsAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	// Pages show the default settings
+	response := ts.get(t, "/")
+	assert.StringIn(t, "<strong>Some Site</strong>", response.body)
+	assert.StringIn(t, "<title>Example page - Some Site</title>", response.body)
+
+	// The admin page requires login
+	response = ts.get(t, "/admin/settings/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	ts.loginAs(t, testEmail)
+	response = ts.get(t, "/admin/settings/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, `value="Recipient &lt;recipient@example.com&gt;"`, response.body)
+
+	// Invalid settings show the form errors, and nothing is saved
+	data := url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set(settingSiteName, "My Site")
+	data.Set(settingContactRecipient, "not an email")
+	data.Set(settingFooterText, "My Company")
+	response = ts.post(t, "/admin/settings/", data)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+	assert.StringIn(t, "Contact recipient must be a valid email address.", response.body)
+	assert.Equal(t, "Some Site", ts.siteSettings.String(context.Background(), settingSiteName))
+
+	// Valid settings are saved and show up on the pages
+	data.Set(settingContactRecipient, "owner@example.com")
+	response = ts.post(t, "/admin/settings/", data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+	assert.Equal(t, "owner@example.com", ts.siteSettings.String(context.Background(), settingContactRecipient))
+
+	response = ts.get(t, "/")
+	assert.StringIn(t, "<strong>My Site</strong>", response.body)
+	assert.StringIn(t, "My Company", response.body)
+}
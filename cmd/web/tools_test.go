@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/xml"
 	"html"
 	"io"
 	"log/slog"
@@ -13,30 +15,138 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/apitokens"
+	"github.com/sglmr/gowebstart/internal/argon2id"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/cookies"
 	"github.com/sglmr/gowebstart/internal/email"
+	"github.com/sglmr/gowebstart/internal/funcs"
+	"github.com/sglmr/gowebstart/internal/health"
+	"github.com/sglmr/gowebstart/internal/jobs"
+	"github.com/sglmr/gowebstart/internal/logins"
+	"github.com/sglmr/gowebstart/internal/notes"
+	"github.com/sglmr/gowebstart/internal/notifications"
+	"github.com/sglmr/gowebstart/internal/render"
+	"github.com/sglmr/gowebstart/internal/settings"
+	"github.com/sglmr/gowebstart/internal/sse"
+	"github.com/sglmr/gowebstart/internal/storage"
+	"github.com/sglmr/gowebstart/internal/tasks"
+	"github.com/sglmr/gowebstart/internal/tenant"
+	"github.com/sglmr/gowebstart/internal/users"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+	"github.com/sglmr/gowebstart/internal/websocket"
 )
 
 const (
 	testEmail        = "test@example.com"
 	testPassword     = "password"
 	testPasswordHash = `$argon2id$v=19$m=65536,t=1,p=8$j0Xx+SUxc9IkZxdAdjH8nQ$YSluZBv02f56eOEMEWZUjJumVi/Z4TB+jd31YiQvxBY`
+	testAPIKey       = "test-api-key"
+	testTenant       = "acme"
+	testSigningKey   = "test-signing-secret"
 )
 
+// testBuildTime is the build time used for static file Last-Modified headers
+var testBuildTime = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testArgon2Params are the parameters of testPasswordHash, so logins don't rehash it
+var testArgon2Params = &argon2id.Params{Memory: 64 * 1024, Iterations: 1, Parallelism: 8, SaltLength: 16, KeyLength: 32}
+
 //=============================================================================
 //	testServer for end to end tests
 //=============================================================================
 
 type testServer struct {
 	*httptest.Server
+	healthChecker     *health.Checker
+	fileStore         *storage.Local
+	noteStore         *notes.MemoryStore
+	notificationStore *notifications.MemoryStore
+	loginStore        *logins.MemoryStore
+	userStore         *users.MemoryStore
+	tokenStore        *apitokens.MemoryStore
+	webhookStore      *webhooks.MemoryStore
+	siteSettings      *settings.Settings
+	sessionManager    *scs.SessionManager
+	clock             clock.Clock
+}
+
+// testServerOptions are the dependencies newTestServer doesn't build itself
+type testServerOptions struct {
+	logger *slog.Logger
+	mailer email.MailerInterface
+	clock  clock.Clock
+	config []func(*config)
+
+	// writeTimeout is the WriteTimeout of the test server, like the 10 seconds of the
+	// real server. Zero means no timeout.
+	writeTimeout time.Duration
+}
+
+// testServerOption changes a dependency of newTestServer
+type testServerOption func(*testServerOptions)
+
+// withLogger logs to logger instead of io.Discard
+func withLogger(logger *slog.Logger) testServerOption {
+	return func(o *testServerOptions) { o.logger = logger }
+}
+
+// withMailer sends emails with mailer instead of a LogMailer, like to capture them
+func withMailer(mailer email.MailerInterface) testServerOption {
+	return func(o *testServerOptions) { o.mailer = mailer }
+}
+
+// withClock tells the time with c, like a clock.Fake for tests of expiry times and job
+// delays
+func withClock(c clock.Clock) testServerOption {
+	return func(o *testServerOptions) { o.clock = c }
+}
+
+// withWriteTimeout gives the test server a WriteTimeout, like to test handlers that
+// extend their write deadline
+func withWriteTimeout(d time.Duration) testServerOption {
+	return func(o *testServerOptions) { o.writeTimeout = d }
+}
+
+// withConfig changes the test config with fn, like to enable dev mode:
+//
+//	newTestServer(t, withConfig(func(cfg *config) { cfg.devMode = true }))
+func withConfig(fn func(cfg *config)) testServerOption {
+	return func(o *testServerOptions) { o.config = append(o.config, fn) }
 }
 
-// newTestServer creates a test server for integration tests.
-func newTestServer(t *testing.T) *testServer {
+// testTemplates are the embedded page templates, parsed once for the tests of handlers
+// and helpers that render pages without a test server
+var testTemplates = sync.OnceValue(func() *render.Cache {
+	templates, err := render.NewCache(assets.EmbeddedFiles, funcs.New(clock.System, true), false)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+})
+
+// withTemplates adds the embedded page templates to the context of r, like templatesMW
+func withTemplates(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), templatesContextKey, testTemplates()))
+}
+
+// newTestServer creates a test server for integration tests. Options replace its
+// dependencies.
+func newTestServer(t *testing.T, options ...testServerOption) *testServer {
 	// Create an io.Discard logger for testing
-	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	opts := testServerOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})),
+		clock:  clock.System,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+	logger := opts.logger
 
 	// Initialize a new session manager with the cleanup goroutine disabled
 	sessionManager := scs.New()
@@ -44,13 +154,90 @@ func newTestServer(t *testing.T) *testServer {
 	sessionManager.Cookie.Secure = true
 
 	// Create a test mailer (io.Discard)
-	mailer := email.NewLogMailer(logger)
+	mailer := opts.mailer
+	if mailer == nil {
+		mailer = email.NewLogMailer(logger)
+	}
+
+	// Create a task manager for background tasks
+	taskManager := tasks.New(logger, 1, 10)
+	t.Cleanup(func() { taskManager.Shutdown(context.Background()) })
+
+	// Create a job queue for durable background jobs
+	webhookStore := webhooks.NewMemoryStore(10)
+	webhookStore.Clock = opts.clock
+	siteSettings := settings.New(settings.NewMemoryStore(), time.Second, settingDefinitions...)
+	jobStore := jobs.NewMemoryStore()
+	jobStore.Clock = opts.clock
+	jobQueue := jobs.New(jobStore, logger, 1)
+	jobQueue.Clock = opts.clock
+	webhookDispatcher := webhooks.NewDispatcher(webhookStore, time.Second)
+	webhookDispatcher.Clock = opts.clock
+	registerJobs(jobQueue, mailer, webhookDispatcher)
+	jobQueue.Start()
+	t.Cleanup(func() { jobQueue.Shutdown(context.Background()) })
+
+	// Create a broker for server-sent events
+	events := sse.New(time.Second, 10)
+	t.Cleanup(events.Close)
+
+	// Create a hub for WebSocket connections
+	hub := websocket.NewHub(time.Second)
+	t.Cleanup(func() { hub.Shutdown(context.Background()) })
+
+	// Store notes in memory
+	noteStore := notes.NewMemoryStore()
+	noteStore.Clock = opts.clock
+	notificationStore := notifications.NewMemoryStore()
+	notificationStore.Clock = opts.clock
+	loginStore := logins.NewMemoryStore()
+	loginStore.Clock = opts.clock
+
+	tokenStore := apitokens.NewMemoryStore()
+	tokenStore.Clock = opts.clock
+
+	// Create the admin user
+	userStore := users.NewMemoryStore()
+	userStore.Clock = opts.clock
+	if _, err := users.Ensure(context.Background(), userStore, opts.clock, testEmail, testPasswordHash, users.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create an empty health checker that tests can register checks with
+	healthChecker := health.New(time.Second)
+
+	// Store uploaded files in a temporary directory
+	fileStore := storage.NewLocal(t.TempDir())
 
 	// Create a new handler/server
-	handler := newServer(logger, false, mailer, testEmail, testPasswordHash, &sync.WaitGroup{}, sessionManager)
+	cfg := config{
+		clock:              opts.clock,
+		production:         true,
+		authEmail:          testEmail,
+		passwordHash:       testPasswordHash,
+		argon2Params:       testArgon2Params,
+		securityContact:    "mailto:security@example.com",
+		testEmailRecipient: testEmail,
+		signingSecret:      testSigningKey,
+		cookies:            cookies.New(nil),
+		apiKeys:            []string{testAPIKey},
+		tenants:            []tenant.Tenant{{ID: testTenant, Name: "Acme Inc"}},
+		tenantHeader:       "X-Tenant-ID",
+		staticCache:        defaultStaticCache(),
+		staticModTime:      testBuildTime,
+	}
+	for _, fn := range opts.config {
+		fn(&cfg)
+	}
+	handler, err := newServer(logger, cfg, mailer, taskManager, jobQueue, events, hub, nil, noteStore, notificationStore, loginStore, userStore, tokenStore, webhookStore, siteSettings, sessionManager, healthChecker, fileStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Initialize a new test server
-	ts := httptest.NewTLSServer(handler)
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config.WriteTimeout = opts.writeTimeout
+	ts.StartTLS()
 
 	// Create and assign a cookiejar to the test server
 	jar, err := cookiejar.New(nil)
@@ -59,14 +246,14 @@ func newTestServer(t *testing.T) *testServer {
 	}
 	ts.Client().Jar = jar
 
-	// Disable redirect-following with a custom CheckRedirect function.
+	// Disable redirect-following with a custom CheckRedirect function, so tests see the
+	// redirect responses. Use follow or getFollow to follow them.
 	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		// http.ErrUseLastResponse error forces the client to return to the received response.
 		return http.ErrUseLastResponse
 	}
-	// TODO: come up with some way of getting the last response and the redirected to response
 
-	return &testServer{ts}
+	return &testServer{ts, healthChecker, fileStore, noteStore, notificationStore, loginStore, userStore, tokenStore, webhookStore, siteSettings, sessionManager, opts.clock}
 }
 
 //=============================================================================
@@ -77,6 +264,18 @@ type testResponse struct {
 	statusCode int
 	header     http.Header
 	body       string
+	// url is the path and query the response was requested from
+	url string
+}
+
+// Result returns the response as an *http.Response for the assert helpers, like
+// httptest.ResponseRecorder.Result
+func (tr testResponse) Result() *http.Response {
+	return &http.Response{
+		StatusCode: tr.statusCode,
+		Header:     tr.header,
+		Body:       io.NopCloser(strings.NewReader(tr.body)),
+	}
 }
 
 // csrfToken extracts and returns the csrfToken from a testResponse html body
@@ -103,35 +302,170 @@ func (tr testResponse) csrfToken(t *testing.T) string {
 	return ""
 }
 
-// get issues a GET request and returns a testResponse object
-//   - 'path' is the relative url path, like "/about/"
-func (ts *testServer) get(t *testing.T, path string) testResponse {
-	// Create a new http request
-	request, err := http.NewRequest(http.MethodGet, ts.URL+path, http.NoBody)
-	if err != nil {
-		t.Fatal(err)
+// testForm is a form parsed from a testResponse html body
+type testForm struct {
+	action string
+	method string
+	values url.Values
+}
+
+// form parses the html body and returns the first form whose id, name, or action is
+// selector, with the values a browser would submit without changes: hidden fields like
+// csrf_token, other inputs and textareas, checked checkboxes and radios, and selected
+// options. A form without an action posts to the page, so the page path selects it.
+func (tr testResponse) form(t *testing.T, selector string) testForm {
+	t.Helper()
+
+	decoder := xml.NewDecoder(strings.NewReader(tr.body))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var (
+		form *testForm
+		// name is the name of the open textarea or select, and text the text of the open
+		// textarea or option
+		name, text string
+		// options are the values of the open select, and selected the first selected one
+		options  []string
+		selected int
+		// optionValue is the value attribute of the open option, if it has one
+		optionValue *string
+	)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("parsing html: %v", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			attrs := map[string]string{}
+			for _, attr := range token.Attr {
+				attrs[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			_, checked := attrs["checked"]
+			_, disabled := attrs["disabled"]
+
+			if token.Name.Local == "form" && form == nil {
+				action := attrs["action"]
+				if action == "" {
+					action = tr.url
+				}
+				if selector == attrs["id"] || selector == attrs["name"] || selector == action {
+					method := strings.ToUpper(attrs["method"])
+					if method == "" {
+						method = http.MethodGet
+					}
+					form = &testForm{action: action, method: method, values: url.Values{}}
+				}
+				continue
+			}
+			if form == nil || disabled {
+				continue
+			}
+
+			switch token.Name.Local {
+			case "input":
+				switch strings.ToLower(attrs["type"]) {
+				case "submit", "button", "image", "reset", "file":
+				case "checkbox", "radio":
+					if value, ok := attrs["value"]; checked && ok {
+						form.values.Add(attrs["name"], value)
+					} else if checked {
+						form.values.Add(attrs["name"], "on")
+					}
+				default:
+					form.values.Add(attrs["name"], attrs["value"])
+				}
+			case "textarea":
+				name, text = attrs["name"], ""
+			case "select":
+				name, options, selected = attrs["name"], nil, -1
+			case "option":
+				text, optionValue = "", nil
+				if value, ok := attrs["value"]; ok {
+					optionValue = &value
+				}
+				if _, ok := attrs["selected"]; ok && selected == -1 {
+					selected = len(options)
+				}
+			}
+
+		case xml.CharData:
+			text += string(token)
+
+		case xml.EndElement:
+			if form == nil {
+				continue
+			}
+			switch token.Name.Local {
+			case "form":
+				// Fields without a name aren't submitted
+				form.values.Del("")
+				return *form
+			case "textarea":
+				// Browsers drop a newline after the opening tag
+				form.values.Add(name, strings.TrimPrefix(text, "\n"))
+			case "option":
+				if optionValue != nil {
+					options = append(options, *optionValue)
+				} else {
+					options = append(options, strings.TrimSpace(text))
+				}
+			case "select":
+				// Without a selected option, browsers select the first one
+				if len(options) > 0 {
+					form.values.Add(name, options[max(selected, 0)])
+				}
+			}
+		}
 	}
 
-	// Send Http Request
-	response, err := ts.Client().Do(request)
+	t.Fatalf("no form %q found in body", selector)
+	return testForm{}
+}
+
+// submit sends the values of a form to its action with its method
+func (ts *testServer) submit(t *testing.T, form testForm) testResponse {
+	t.Helper()
+
+	if form.method == http.MethodPost {
+		return ts.post(t, form.action, form.values)
+	}
+
+	request, err := http.NewRequest(form.method, ts.URL+form.action, http.NoBody)
 	if err != nil {
 		t.Fatal(err)
 	}
+	request.URL.RawQuery = form.values.Encode()
+	return ts.do(t, request)
+}
 
-	// Read the body of the http response
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+// formToken extracts and returns the anti-spam form token from a testResponse html body
+func (tr testResponse) formToken(t *testing.T) string {
+	t.Helper()
+
+	matches := regexp.MustCompile(`<input type="hidden" name="form_token" value="(.+)">`).FindStringSubmatch(tr.body)
+	if len(matches) < 2 {
+		t.Fatal("no form token found in body")
+	}
+	return matches[1]
+}
+
+// get issues a GET request and returns a testResponse object
+//   - 'path' is the relative url path, like "/about/"
+func (ts *testServer) get(t *testing.T, path string) testResponse {
+	// Create a new http request
+	request, err := http.NewRequest(http.MethodGet, ts.URL+path, http.NoBody)
 	if err != nil {
 		t.Fatal(err)
 	}
-	body = bytes.TrimSpace(body)
 
-	// Return a testResponse object
-	return testResponse{
-		statusCode: response.StatusCode,
-		header:     response.Header,
-		body:       string(body),
-	}
+	return ts.do(t, request)
 }
 
 // post issues a POST request and returns a testResponse object
@@ -144,13 +478,20 @@ func (ts *testServer) post(t *testing.T, path string, data url.Values) testRespo
 	}
 	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	// Send the POST request.
+	return ts.do(t, request)
+}
+
+// do sends a request and returns a testResponse object
+func (ts *testServer) do(t *testing.T, request *http.Request) testResponse {
+	t.Helper()
+
+	// Send Http Request
 	response, err := ts.Client().Do(request)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Read the response body from the request.
+	// Read the body of the http response
 	defer response.Body.Close()
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -163,7 +504,52 @@ func (ts *testServer) post(t *testing.T, path string, data url.Values) testRespo
 		statusCode: response.StatusCode,
 		header:     response.Header,
 		body:       string(body),
+		url:        request.URL.RequestURI(),
+	}
+}
+
+// maxRedirects is the number of redirects follow gives up after, like http.Client
+const maxRedirects = 10
+
+// getFollow issues a GET request and follows its redirects, see follow
+func (ts *testServer) getFollow(t *testing.T, path string) (testResponse, []testResponse) {
+	t.Helper()
+	return ts.follow(t, ts.get(t, path))
+}
+
+// follow follows the redirects of a response with GET requests, like a browser does after
+// a POST/Redirect/GET, and returns the final response and the chain of redirect
+// responses before it. Redirects to other sites aren't followed, so they end the chain.
+func (ts *testServer) follow(t *testing.T, response testResponse) (testResponse, []testResponse) {
+	t.Helper()
+
+	base, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chain []testResponse
+	for response.statusCode >= 300 && response.statusCode <= 399 && response.header.Get("Location") != "" {
+		location, err := base.Parse(response.header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.Host != base.Host {
+			break
+		}
+		if len(chain) == maxRedirects {
+			t.Fatalf("stopped after %d redirects", maxRedirects)
+		}
+		chain = append(chain, response)
+		base = location
+
+		request, err := http.NewRequest(http.MethodGet, location.String(), http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response = ts.do(t, request)
 	}
+	return response, chain
 }
 
 // login will log a user in for testing
@@ -174,19 +560,58 @@ func (ts *testServer) login(t *testing.T) {
 		t.Fatal("could not get login page")
 	}
 
-	// Set up the form data to post to the login page
-	data := url.Values{}
-	data.Set("csrf_token", response.csrfToken(t))
-	data.Set("email", testEmail)
-	data.Set("password", testPassword)
-
-	// Post a login request
-	response = ts.post(t, "/login/", data)
+	// Fill in the login form and submit it
+	form := response.form(t, "/login/")
+	form.values.Set("email", testEmail)
+	form.values.Set("password", testPassword)
+	response = ts.submit(t, form)
 	if response.statusCode != http.StatusSeeOther {
 		t.Fatal("could not log in")
 	}
 }
 
+// loginAs logs in as the user with email on the main site by saving an authenticated
+// session in the session store and giving its cookie to the client, without the requests
+// of login. The user is created with testPassword and the viewer role when it doesn't
+// exist. Use login for tests of the login form itself.
+func (ts *testServer) loginAs(t *testing.T, email string) {
+	t.Helper()
+
+	// Create the user, unless it exists
+	user, err := users.Ensure(context.Background(), ts.userStore, ts.clock, email, testPasswordHash, users.RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Save a session with the keys of the login handler
+	ts.putSession(t, map[string]any{"authenticated": true, "userID": user.ID, "tenant": ""})
+}
+
+// putSession saves a new session with values in the session store and gives its cookie
+// to the client
+func (ts *testServer) putSession(t *testing.T, values map[string]any) {
+	t.Helper()
+
+	ctx, err := ts.sessionManager.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range values {
+		ts.sessionManager.Put(ctx, key, value)
+	}
+	token, _, err := ts.sessionManager.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the session cookie of the client
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar.SetCookies(u, []*http.Cookie{{Name: ts.sessionManager.Cookie.Name, Value: token, Path: "/"}})
+}
+
 // logout will log a user out for testing
 func (ts *testServer) logout(t *testing.T) {
 	// Get the logout page form to capture the csrf token
@@ -195,12 +620,8 @@ func (ts *testServer) logout(t *testing.T) {
 		t.Fatal("could not get logout page")
 	}
 
-	// Set up the form data to post to the login page
-	data := url.Values{}
-	data.Set("csrf_token", response.csrfToken(t))
-
-	// Post a logout request
-	response = ts.post(t, "/logout/", data)
+	// Submit the logout form
+	response = ts.submit(t, response.form(t, "/logout/"))
 	if response.statusCode != http.StatusSeeOther {
 		t.Fatal("could not log out")
 	}
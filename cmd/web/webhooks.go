@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/validator"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+)
+
+// webhookEventTypes are the event types endpoints can subscribe to
+var webhookEventTypes = []string{webhooks.EventContactSubmitted, webhooks.EventUserRegistered}
+
+// webhooksAdmin handles the admin page that lists the webhook endpoints and the latest
+// deliveries, and adds new endpoints
+func webhooksAdmin(
+	logger *slog.Logger,
+	showTrace bool,
+	store webhooks.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	type endpointForm struct {
+		URL    string
+		Secret string
+		Events []string
+		validator.Validator
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		form := endpointForm{}
+
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				clientError(w, r, http.StatusBadRequest)
+				return
+			}
+
+			form.URL = strings.TrimSpace(r.FormValue("url"))
+			form.Secret = strings.TrimSpace(r.FormValue("secret"))
+			form.Events = r.Form["events"]
+
+			form.Check("URL", validator.NotBlank(form.URL), "URL is required.")
+			form.Check("URL", validator.IsURL(form.URL), "URL must be a valid URL.")
+			form.Check("Events", validator.AllIn(form.Events, webhookEventTypes...), "Unknown event type.")
+
+			if form.Valid() {
+				// Generate a secret when the form doesn't have one
+				if form.Secret == "" {
+					form.Secret = webhooks.NewSecret()
+				}
+
+				endpoint := &webhooks.Endpoint{URL: form.URL, Secret: form.Secret, Events: form.Events}
+				if err := store.AddEndpoint(r.Context(), endpoint); err != nil {
+					serverError(w, r, err, logger, showTrace)
+					return
+				}
+
+				putFlashSuccess(r, translate(r, "Webhook endpoint added."), sessionManager)
+				redirect(w, r, "/admin/webhooks/", http.StatusSeeOther)
+				return
+			}
+			status = http.StatusUnprocessableEntity
+		}
+
+		endpoints, err := store.Endpoints(r.Context())
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+		deliveries, err := store.Deliveries(r.Context(), 50)
+		if err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		data := newTemplateData(r, sessionManager)
+		data["Form"] = form
+		data["Endpoints"] = endpoints
+		data["Deliveries"] = deliveries
+		data["EventTypes"] = webhookEventTypes
+
+		if err := renderPage(w, r, status, data, "admin-webhooks.tmpl"); err != nil {
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+	}
+}
+
+// webhookDelete handles deleting a webhook endpoint
+func webhookDelete(
+	logger *slog.Logger,
+	showTrace bool,
+	store webhooks.Store,
+	sessionManager *scs.SessionManager,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			clientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		err = store.DeleteEndpoint(r.Context(), id)
+		switch {
+		case errors.Is(err, webhooks.ErrNotFound):
+			clientError(w, r, http.StatusNotFound)
+			return
+		case err != nil:
+			serverError(w, r, err, logger, showTrace)
+			return
+		}
+
+		putFlashSuccess(r, translate(r, "Webhook endpoint deleted."), sessionManager)
+		redirect(w, r, "/admin/webhooks/", http.StatusSeeOther)
+	}
+}
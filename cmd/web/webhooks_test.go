@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/webhooks"
+)
+
+func TestWebhooks(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	received := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Webhook-Event")
+	}))
+	defer receiver.Close()
+
+	// The admin page requires login
+	response := ts.get(t, "/admin/webhooks/")
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	ts.loginAs(t, testEmail)
+	response = ts.get(t, "/admin/webhooks/")
+	assert.Equal(t, http.StatusOK, response.statusCode)
+	assert.StringIn(t, "No endpoints yet.", response.body)
+
+	// Invalid endpoints show the form errors
+	data := url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set("url", "not a url")
+	response = ts.post(t, "/admin/webhooks/", data)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.statusCode)
+	assert.StringIn(t, "URL must be a valid URL.", response.body)
+
+	// Add an endpoint for contact messages, with a generated secret
+	data.Set("url", receiver.URL)
+	data.Set("events", webhooks.EventContactSubmitted)
+	response = ts.post(t, "/admin/webhooks/", data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+
+	endpoints, err := ts.webhookStore.Endpoints(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(endpoints))
+	assert.StringIn(t, "whsec_", endpoints[0].Secret)
+
+	// Contact messages are delivered to the endpoint in the background
+	response = ts.get(t, "/contact/")
+	data = url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	data.Set("form_token", response.formToken(t))
+	data.Set("name", "joe")
+	data.Set("email", "joe@example.com")
+	data.Set("message", "some message")
+	response = ts.post(t, "/contact/", data)
+	assert.Equal(t, http.StatusFound, response.statusCode)
+
+	select {
+	case event := <-received:
+		assert.Equal(t, webhooks.EventContactSubmitted, event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't delivered")
+	}
+
+	// The delivery shows up in the log
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		response = ts.get(t, "/admin/webhooks/")
+		if !strings.Contains(response.body, "No deliveries yet.") || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.StringIn(t, "<td>200</td>", response.body)
+
+	// Delete the endpoint
+	data = url.Values{}
+	data.Set("csrf_token", response.csrfToken(t))
+	response = ts.post(t, "/admin/webhooks/1/delete/", data)
+	assert.Equal(t, http.StatusSeeOther, response.statusCode)
+	response = ts.post(t, "/admin/webhooks/1/delete/", data)
+	assert.Equal(t, http.StatusNotFound, response.statusCode)
+}
@@ -1,20 +1,27 @@
 module github.com/sglmr/gowebstart
 
-go 1.23.7
+go 1.24.0
 
 require (
 	github.com/alexedwards/scs/v2 v2.8.0
+	github.com/gomodule/redigo v1.9.2
+	github.com/jackc/pgx/v5 v5.8.0
 	github.com/justinas/nosurf v1.1.1
 	github.com/wneessen/go-mail v0.6.2
 	golang.org/x/crypto v0.36.0
 	golang.org/x/exp v0.0.0-20250305212735-054e65f0b394
+	golang.org/x/image v0.25.0
 	golang.org/x/term v0.30.0
-	golang.org/x/text v0.23.0
+	golang.org/x/text v0.29.0
 	gotest.tools v2.2.0+incompatible
 )
 
 require (
 	github.com/google/go-cmp v0.7.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 )
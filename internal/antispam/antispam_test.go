@@ -0,0 +1,46 @@
+package antispam
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	guard := New([]byte("secret"), 3*time.Second, time.Hour)
+	guard.now = func() time.Time { return now }
+	token := guard.Token()
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		elapsed time.Duration
+		want    error
+	}{
+		{"valid", url.Values{TokenField: {token}}, 5 * time.Second, nil},
+		{"honeypot", url.Values{TokenField: {token}, HoneypotField: {"http://spam"}}, 5 * time.Second, ErrHoneypot},
+		{"missing token", url.Values{}, 5 * time.Second, ErrInvalidToken},
+		{"forged token", url.Values{TokenField: {"1740830400.abc"}}, 5 * time.Second, ErrInvalidToken},
+		{"other secret", url.Values{TokenField: {New([]byte("other"), 0, 0).Token()}}, 5 * time.Second, ErrInvalidToken},
+		{"too fast", url.Values{TokenField: {token}}, time.Second, ErrTooFast},
+		{"expired", url.Values{TokenField: {token}}, 2 * time.Hour, ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			g := *guard
+			g.now = func() time.Time { return now.Add(tt.elapsed) }
+			assert.Equal(t, tt.want, g.Check(r))
+		})
+	}
+}
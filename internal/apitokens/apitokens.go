@@ -0,0 +1,74 @@
+// Package apitokens stores the API tokens that users create for programmatic clients.
+// A client sends its token in an "Authorization: Bearer" header instead of a session
+// cookie, so it doesn't need a login or a CSRF token.
+//
+// Only the SHA-256 hash of a token is saved, so tokens can't be read back from the
+// store. Like sessions, tokens belong to the tenant in the request context (see
+// tenant.ID) and only authenticate requests of that tenant.
+package apitokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for a token that doesn't exist.
+var ErrNotFound = errors.New("apitokens: token not found")
+
+// Prefix starts every token, so tokens are easy to recognize, for example by secret
+// scanners.
+const Prefix = "gws_"
+
+// Token is an API token of a user.
+type Token struct {
+	ID        int64
+	Tenant    string // ID of the tenant of the token, or "" for the main site
+	UserID    int64
+	Name      string // Name the user gave the token, like the client that uses it
+	Hash      string // SHA-256 hash of the token, see Hash
+	CreatedAt time.Time
+}
+
+// Store saves tokens. Implementations have to be safe for concurrent use.
+type Store interface {
+	// Insert saves a new token and sets its ID, Tenant, and CreatedAt.
+	Insert(ctx context.Context, t *Token) error
+
+	// GetByHash returns the token with the hash, or ErrNotFound for a token of another
+	// tenant.
+	GetByHash(ctx context.Context, hash string) (*Token, error)
+
+	// List returns the user's tokens in the tenant, newest first.
+	List(ctx context.Context, userID int64) ([]Token, error)
+
+	// Delete revokes a token of the user, or returns ErrNotFound for the token of
+	// another user.
+	Delete(ctx context.Context, userID, id int64) error
+}
+
+// New returns a random token and its hash. Give the token to the user once and save the
+// hash in a Token.
+func New() (token, hash string) {
+	token = Prefix + rand.Text()
+	return token, Hash(token)
+}
+
+// Hash returns the SHA-256 hash of a token, in hex.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the token of a bearer token from a request, or ErrNotFound. Strings
+// without the Prefix are never looked up.
+func Lookup(ctx context.Context, store Store, token string) (*Token, error) {
+	if !strings.HasPrefix(token, Prefix) {
+		return nil, ErrNotFound
+	}
+	return store.GetByHash(ctx, Hash(token))
+}
@@ -0,0 +1,86 @@
+package apitokens
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// MemoryStore is a Store that keeps tokens in memory. Tokens are lost when the
+// application stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	tokens []Token // Oldest first
+
+	// Clock tells the time of CreatedAt, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{Clock: clock.System}
+}
+
+// Insert saves a new token and sets its ID, Tenant, and CreatedAt.
+func (s *MemoryStore) Insert(ctx context.Context, t *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	t.ID = s.nextID
+	t.Tenant = tenant.ID(ctx)
+	t.CreatedAt = s.Clock.Now()
+	s.tokens = append(s.tokens, *t)
+	return nil
+}
+
+// GetByHash returns the token with the hash, or ErrNotFound for a token of another
+// tenant.
+func (s *MemoryStore) GetByHash(ctx context.Context, hash string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	for _, t := range s.tokens {
+		if t.Tenant == tenantID && t.Hash == hash {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// List returns the user's tokens in the tenant, newest first.
+func (s *MemoryStore) List(ctx context.Context, userID int64) ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	var list []Token
+	for _, t := range slices.Backward(s.tokens) {
+		if t.Tenant == tenantID && t.UserID == userID {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+// Delete revokes a token of the user, or returns ErrNotFound for the token of another
+// user.
+func (s *MemoryStore) Delete(ctx context.Context, userID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	i := slices.IndexFunc(s.tokens, func(t Token) bool {
+		return t.ID == id && t.Tenant == tenantID && t.UserID == userID
+	})
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.tokens = slices.Delete(s.tokens, i, i+1)
+	return nil
+}
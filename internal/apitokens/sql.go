@@ -0,0 +1,92 @@
+package apitokens
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// SQLStore is a Store that saves tokens in the api_tokens table of a PostgreSQL
+// database. The table is created by the assets/migrations/011_create_api_tokens.sql
+// migration.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore for the api_tokens table in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Insert saves a new token and sets its ID, Tenant, and CreatedAt.
+func (s *SQLStore) Insert(ctx context.Context, t *Token) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (tenant_id, user_id, name, hash) VALUES ($1, $2, $3, $4)
+		RETURNING id, tenant_id, created_at`,
+		tenant.ID(ctx), t.UserID, t.Name, t.Hash,
+	).Scan(&t.ID, &t.Tenant, &t.CreatedAt)
+}
+
+// GetByHash returns the token with the hash, or ErrNotFound for a token of another
+// tenant.
+func (s *SQLStore) GetByHash(ctx context.Context, hash string) (*Token, error) {
+	var t Token
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, tenant_id, user_id, name, hash, created_at FROM api_tokens
+		WHERE tenant_id = $1 AND hash = $2`,
+		tenant.ID(ctx), hash,
+	).Scan(&t.ID, &t.Tenant, &t.UserID, &t.Name, &t.Hash, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// List returns the user's tokens in the tenant, newest first.
+func (s *SQLStore) List(ctx context.Context, userID int64) ([]Token, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, tenant_id, user_id, name, hash, created_at FROM api_tokens
+		WHERE tenant_id = $1 AND user_id = $2
+		ORDER BY id DESC`,
+		tenant.ID(ctx), userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Token
+	for rows.Next() {
+		var t Token
+		if err := rows.Scan(&t.ID, &t.Tenant, &t.UserID, &t.Name, &t.Hash, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// Delete revokes a token of the user, or returns ErrNotFound for the token of another
+// user.
+func (s *SQLStore) Delete(ctx context.Context, userID, id int64) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM api_tokens WHERE id = $1 AND tenant_id = $2 AND user_id = $3`,
+		id, tenant.ID(ctx), userID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package apitokens
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewMemoryStore())
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	token, hash := New()
+	assert.Equal(t, true, strings.HasPrefix(token, Prefix))
+	assert.Equal(t, Hash(token), hash)
+	assert.Equal(t, 64, len(hash))
+
+	other, _ := New()
+	assert.Equal(t, false, token == other)
+}
+
+// testStore tests the behavior every Store has
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	token, hash := New()
+	first := &Token{UserID: 1, Name: "first", Hash: hash}
+	assert.NoError(t, store.Insert(ctx, first))
+	_, otherHash := New()
+	assert.NoError(t, store.Insert(ctx, &Token{UserID: 1, Name: "second", Hash: otherHash}))
+	_, thirdHash := New()
+	assert.NoError(t, store.Insert(ctx, &Token{UserID: 2, Name: "other user", Hash: thirdHash}))
+
+	// Tokens are found by the hash of the token
+	got, err := Lookup(ctx, store, token)
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, got.ID)
+	assert.Equal(t, int64(1), got.UserID)
+	assert.Equal(t, "first", got.Name)
+
+	_, err = Lookup(ctx, store, "gws_unknown")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = Lookup(ctx, store, hash)
+	assert.Equal(t, ErrNotFound, err)
+
+	// Lists only have the user's tokens, newest first
+	list, err := store.List(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "second", list[0].Name)
+	assert.Equal(t, "first", list[1].Name)
+
+	// Users can only delete their own tokens
+	assert.Equal(t, ErrNotFound, store.Delete(ctx, 2, first.ID))
+	assert.NoError(t, store.Delete(ctx, 1, first.ID))
+	assert.Equal(t, ErrNotFound, store.Delete(ctx, 1, first.ID))
+	_, err = Lookup(ctx, store, token)
+	assert.Equal(t, ErrNotFound, err)
+
+	// Tokens of other tenants can't be used or seen
+	acme := tenant.WithTenant(ctx, &tenant.Tenant{ID: "acme"})
+	_, err = store.GetByHash(acme, otherHash)
+	assert.Equal(t, ErrNotFound, err)
+	list, err = store.List(acme, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(list))
+}
@@ -10,11 +10,14 @@
 package argon2id
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"regexp"
 	"runtime"
 	"strings"
 
@@ -34,6 +37,10 @@ var (
 	// ErrIncompatibleVersion is returned by ComparePasswordAndHash if the
 	// provided hash was created using a different version of Argon2.
 	ErrIncompatibleVersion = errors.New("argon2id: incompatible version of argon2")
+
+	// ErrUnknownPepper is returned by ComparePasswordAndHash and CreateHash for a
+	// pepper key ID that isn't in the peppers.
+	ErrUnknownPepper = errors.New("argon2id: unknown pepper key ID")
 )
 
 // DefaultParams provides some sane default parameters for hashing passwords.
@@ -82,6 +89,69 @@ type Params struct {
 
 	// Length of the generated key. 16 bytes or more is recommended.
 	KeyLength uint32
+
+	// ID of the pepper mixed into the password, see ParsePeppers. Empty for no pepper.
+	// It's saved in the hash as the keyid parameter.
+	KeyID string
+
+	// The pepper secrets by key ID, from ParsePeppers. They aren't saved in the hash.
+	Peppers map[string][]byte
+}
+
+//=============================================================================
+//	Peppers
+//=============================================================================
+
+// A pepper is a server-side secret mixed into every password before hashing. Unlike
+// the salt it isn't saved in the hash, so a leak of the hashes alone can't be cracked.
+// Peppers have key IDs so they can be rotated: new hashes use the current pepper, and
+// old hashes are verified with the pepper of their key ID until they're rehashed.
+
+// rxKeyID matches pepper key IDs
+var rxKeyID = regexp.MustCompile(`^[A-Za-z0-9]{1,16}$`)
+
+// ParsePeppers parses a comma separated list of peppers, like "2:new-secret,1:old-secret".
+// The first pepper is the current one, which new hashes should use as Params.KeyID, and
+// the secrets are the Params.Peppers.
+func ParsePeppers(list string) (current string, secrets map[string][]byte, err error) {
+	secrets = map[string][]byte{}
+	for item := range strings.SplitSeq(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(item, ":")
+		if !ok {
+			return "", nil, fmt.Errorf("argon2id: pepper %q must be key-id:secret", id)
+		}
+		if !rxKeyID.MatchString(id) {
+			return "", nil, fmt.Errorf("argon2id: invalid pepper key ID %q, use up to 16 letters and digits", id)
+		}
+		if secret == "" {
+			return "", nil, fmt.Errorf("argon2id: empty pepper for key ID %q", id)
+		}
+		if current == "" {
+			current = id
+		}
+		secrets[id] = []byte(secret)
+	}
+	return current, secrets, nil
+}
+
+// pepper mixes the pepper with a key ID into a password
+func pepper(password, keyID string, peppers map[string][]byte) ([]byte, error) {
+	if keyID == "" {
+		return []byte(password), nil
+	}
+
+	secret, ok := peppers[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPepper, keyID)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+	return mac.Sum(nil), nil
 }
 
 // CreateHash returns an Argon2id hash of a plain-text password using the
@@ -90,40 +160,55 @@ type Params struct {
 // derived key prefixed by the salt and parameters. It looks like this:
 //
 //	$argon2id$v=19$m=65536,t=3,p=2$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG
+//
+// Hashes with a pepper have its key ID in the parameters, like "m=65536,t=3,p=2,keyid=1".
 func CreateHash(password string, params *Params) (hash string, err error) {
 	salt, err := generateRandomBytes(params.SaltLength)
 	if err != nil {
 		return "", err
 	}
 
-	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	input, err := pepper(password, params.KeyID, params.Peppers)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(input, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
 
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Key := base64.RawStdEncoding.EncodeToString(key)
 
-	hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Iterations, params.Parallelism, b64Salt, b64Key)
+	encodedParams := fmt.Sprintf("m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism)
+	if params.KeyID != "" {
+		encodedParams += ",keyid=" + params.KeyID
+	}
+
+	hash = fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, encodedParams, b64Salt, b64Key)
 	return hash, nil
 }
 
 // ComparePasswordAndHash performs a constant-time comparison between a
 // plain-text password and Argon2id hash, using the parameters and salt
-// contained in the hash. It returns true if they match, otherwise it returns
-// false.
-func ComparePasswordAndHash(password, hash string) (match bool, err error) {
-	match, _, err = CheckHash(password, hash)
+// contained in the hash, and the pepper of its key ID from peppers. It returns true if
+// they match, otherwise it returns false.
+func ComparePasswordAndHash(password, hash string, peppers map[string][]byte) (match bool, err error) {
+	match, _, err = CheckHash(password, hash, peppers)
 	return match, err
 }
 
 // CheckHash is like ComparePasswordAndHash, except it also returns the params that the hash was
 // created with. This can be useful if you want to update your hash params over time (which you
-// should).
-func CheckHash(password, hash string) (match bool, params *Params, err error) {
+// should). The returned params don't have the peppers.
+func CheckHash(password, hash string, peppers map[string][]byte) (match bool, params *Params, err error) {
 	params, salt, key, err := DecodeHash(hash)
 	if err != nil {
 		return false, nil, err
 	}
 
-	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	input, err := pepper(password, params.KeyID, peppers)
+	if err != nil {
+		return false, nil, err
+	}
+	otherKey := argon2.IDKey(input, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
 
 	keyLen := int32(len(key))
 	otherKeyLen := int32(len(otherKey))
@@ -137,6 +222,19 @@ func CheckHash(password, hash string) (match bool, params *Params, err error) {
 	return false, params, nil
 }
 
+// NeedsRehash reports whether a hash created with the current params is weaker than the
+// target params, so it should be replaced with a new hash of the password after the
+// next successful CheckHash. Parallelism doesn't change the strength of a hash, so it's
+// ignored. Hashes with another pepper than the target KeyID are rehashed too, so old
+// peppers can be retired.
+func NeedsRehash(current, target *Params) bool {
+	return current.KeyID != target.KeyID ||
+		current.Memory < target.Memory ||
+		current.Iterations < target.Iterations ||
+		current.SaltLength < target.SaltLength ||
+		current.KeyLength < target.KeyLength
+}
+
 func generateRandomBytes(n uint32) ([]byte, error) {
 	b := make([]byte, n)
 	_, err := rand.Read(b)
@@ -169,10 +267,17 @@ func DecodeHash(hash string) (params *Params, salt, key []byte, err error) {
 	}
 
 	params = &Params{}
-	_, err = fmt.Sscanf(vals[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	encodedParams, keyID, hasKeyID := strings.Cut(vals[3], ",keyid=")
+	_, err = fmt.Sscanf(encodedParams, "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	if hasKeyID {
+		if !rxKeyID.MatchString(keyID) {
+			return nil, nil, nil, ErrInvalidHash
+		}
+		params.KeyID = keyID
+	}
 
 	salt, err = base64.RawStdEncoding.Strict().DecodeString(vals[4])
 	if err != nil {
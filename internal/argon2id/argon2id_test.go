@@ -0,0 +1,87 @@
+package argon2id
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNeedsRehash(t *testing.T) {
+	t.Parallel()
+
+	params := &Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hash, err := CreateHash("password", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, hashParams, err := CheckHash("password", hash, nil)
+	if err != nil || !match {
+		t.Fatalf("CheckHash() = %v, %v", match, err)
+	}
+
+	tests := []struct {
+		name   string
+		target Params
+		want   bool
+	}{
+		{"same", *params, false},
+		{"more parallelism", Params{Memory: 1024, Iterations: 1, Parallelism: 4, SaltLength: 16, KeyLength: 32}, false},
+		{"weaker", Params{Memory: 512, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, false},
+		{"more memory", Params{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, true},
+		{"more iterations", Params{Memory: 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}, true},
+		{"longer key", Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 64}, true},
+	}
+	for _, tt := range tests {
+		if got := NeedsRehash(hashParams, &tt.target); got != tt.want {
+			t.Errorf("%s: NeedsRehash() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPeppers(t *testing.T) {
+	t.Parallel()
+
+	current, secrets, err := ParsePeppers("2:new-secret, 1:old-secret")
+	if err != nil || current != "2" || string(secrets["1"]) != "old-secret" {
+		t.Fatalf("ParsePeppers() = %q, %q, %v", current, secrets, err)
+	}
+
+	params := &Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32, KeyID: "1", Peppers: secrets}
+	oldHash, err := CreateHash("password", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(oldHash, "$m=1024,t=1,p=1,keyid=1$") {
+		t.Fatalf("hash %q doesn't have the pepper key ID", oldHash)
+	}
+
+	// Old hashes are verified with their pepper, and need a rehash with the current one
+	match, hashParams, err := CheckHash("password", oldHash, secrets)
+	if err != nil || !match {
+		t.Fatalf("CheckHash() = %v, %v", match, err)
+	}
+	target := *params
+	target.KeyID = current
+	if !NeedsRehash(hashParams, &target) {
+		t.Error("NeedsRehash() = false for an old pepper")
+	}
+
+	// The pepper is part of the hash, so the hash can't be verified without it
+	if match, _ := ComparePasswordAndHash("password", oldHash, map[string][]byte{"1": []byte("other-secret")}); match {
+		t.Error("ComparePasswordAndHash() matched with the wrong pepper")
+	}
+	if _, err := ComparePasswordAndHash("password", oldHash, nil); !errors.Is(err, ErrUnknownPepper) {
+		t.Errorf("ComparePasswordAndHash() error = %v, want ErrUnknownPepper", err)
+	}
+}
+
+func TestParsePeppersInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, list := range []string{"no-key-id", "bad id:secret", "1:"} {
+		if _, _, err := ParsePeppers(list); err == nil {
+			t.Errorf("ParsePeppers(%q) didn't return an error", list)
+		}
+	}
+}
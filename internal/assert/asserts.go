@@ -1,12 +1,21 @@
 package assert
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 )
 
+// update rewrites golden files with the output of the tests, as in `go test ./... -update`
+var update = flag.Bool("update", false, "update the golden files of MatchesGolden")
+
 // Equal compares two values
 func Equal[T comparable](t *testing.T, want, got T) {
 	t.Helper()
@@ -84,3 +93,142 @@ func EqualTime(t *testing.T, want, got time.Time, allowedDiff time.Duration) {
 		t.Errorf("wanted %v; not %v; off by %v seconds", want, got, dif.Seconds())
 	}
 }
+
+// Panics tests that fn panics
+func Panics(t *testing.T, fn func()) {
+	t.Helper()
+
+	if panicked, _ := catchPanic(fn); !panicked {
+		t.Errorf("wanted a panic; got none")
+	}
+}
+
+// PanicsWith tests that fn panics with a value containing the want message
+func PanicsWith(t *testing.T, want string, fn func()) {
+	t.Helper()
+
+	panicked, message := catchPanic(fn)
+	switch {
+	case !panicked:
+		t.Errorf("wanted a panic with %q; got none", want)
+	case !strings.Contains(message, want):
+		t.Errorf("wanted a panic with %q; got: %q", want, message)
+	}
+}
+
+// NotPanics tests that fn doesn't panic
+func NotPanics(t *testing.T, fn func()) {
+	t.Helper()
+
+	if panicked, message := catchPanic(fn); panicked {
+		t.Errorf("wanted no panic; got: %q", message)
+	}
+}
+
+// catchPanic runs fn and returns whether it panicked, and the panic value as a string
+func catchPanic(fn func()) (panicked bool, message string) {
+	defer func() {
+		if p := recover(); p != nil {
+			panicked = true
+			message = fmt.Sprint(p)
+		}
+	}()
+
+	fn()
+	return false, ""
+}
+
+// Status tests that a response has the want status code
+func Status(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+
+	if resp.StatusCode != want {
+		t.Errorf("wanted status %d; got: %d", want, resp.StatusCode)
+	}
+}
+
+// Header tests that a response header contains the want value, so "text/html" matches
+// "text/html; charset=utf-8"
+func Header(t *testing.T, resp *http.Response, key, want string) {
+	t.Helper()
+
+	if got := resp.Header.Get(key); !strings.Contains(got, want) {
+		t.Errorf("wanted %s header %q; got: %q", key, want, got)
+	}
+}
+
+// HasCookie tests that a response sets a cookie with the name
+func HasCookie(t *testing.T, resp *http.Response, name string) {
+	t.Helper()
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name {
+			return
+		}
+	}
+	t.Errorf("wanted cookie %q; got: %q", name, resp.Header.Values("Set-Cookie"))
+}
+
+// RedirectsTo tests that a response is a redirect to the want location
+func RedirectsTo(t *testing.T, resp *http.Response, want string) {
+	t.Helper()
+
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		t.Errorf("wanted a redirect to %q; got status: %d", want, resp.StatusCode)
+		return
+	}
+	if got := resp.Header.Get("Location"); got != want {
+		t.Errorf("wanted a redirect to %q; got: %q", want, got)
+	}
+}
+
+// MatchesGolden tests that got equals the content of the golden file at path. Run the
+// tests with -update to write got to the file instead.
+func MatchesGolden(t *testing.T, got, path string) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("creating golden file directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("updating golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("golden file %s doesn't exist; run the tests with -update to create it", path)
+	}
+	if err != nil {
+		t.Fatalf("reading golden file: %v", err)
+	}
+
+	if string(want) != got {
+		line, wantLine, gotLine := firstDiff(string(want), got)
+		t.Errorf("output doesn't match %s at line %d (run the tests with -update to accept it)\nwanted: %q\ngot:    %q", path, line, wantLine, gotLine)
+	}
+}
+
+// firstDiff returns the number and content of the first line that differs between want
+// and got
+func firstDiff(want, got string) (line int, wantLine, gotLine string) {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; ; i++ {
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		} else {
+			wantLine = ""
+		}
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		} else {
+			gotLine = ""
+		}
+		if wantLine != gotLine || i >= len(wantLines) || i >= len(gotLines) {
+			return i + 1, wantLine, gotLine
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package assetvendor downloads pinned front-end dependencies, like htmx, into the
+// static files so the site doesn't depend on a CDN at runtime.
+package assetvendor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxFileSize is the largest file that will be downloaded
+const maxFileSize = 10 << 20
+
+// File is a vendored file in the manifest.
+type File struct {
+	// Name of the dependency, like "htmx"
+	Name string `json:"name"`
+	// URL to download the pinned version from
+	URL string `json:"url"`
+	// Path of the file in the vendor directory, like "htmx/htmx.min.js"
+	Path string `json:"path"`
+	// SHA256 is the hex encoded checksum of the file contents
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the vendored files.
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+// ErrChecksum is returned when a downloaded file doesn't match its pinned checksum.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// Load reads a manifest from a JSON file.
+func Load(name string) (*Manifest, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+
+	for _, f := range m.Files {
+		if f.URL == "" || !fs.ValidPath(f.Path) || f.Path == "." {
+			return nil, fmt.Errorf("%s: file %q needs a url and a relative path", name, f.Name)
+		}
+	}
+
+	return m, nil
+}
+
+// Save writes the manifest to a JSON file.
+func (m *Manifest) Save(name string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0o644)
+}
+
+// Vendor downloads each file in the manifest into dir and checks it against the pinned
+// checksum. Files already in dir with the right checksum aren't downloaded again.
+//
+// Files without a checksum are an error, unless pin is true. Then the checksum of the
+// downloaded file is recorded in the manifest, and the caller should save it.
+func Vendor(ctx context.Context, client *http.Client, m *Manifest, dir string, pin bool, w io.Writer) error {
+	for i := range m.Files {
+		f := &m.Files[i]
+		name := filepath.Join(dir, filepath.FromSlash(f.Path))
+
+		// Skip files that are already vendored
+		if existing, err := os.ReadFile(name); err == nil && f.SHA256 != "" && checksum(existing) == f.SHA256 {
+			fmt.Fprintf(w, "%s: up to date\n", f.Path)
+			continue
+		}
+
+		data, err := download(ctx, client, f.URL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+
+		sum := checksum(data)
+		switch {
+		case f.SHA256 == "" && pin:
+			f.SHA256 = sum
+			fmt.Fprintf(w, "%s: pinned sha256 %s\n", f.Path, sum)
+		case f.SHA256 == "":
+			return fmt.Errorf("%s: no pinned sha256 in the manifest, the downloaded file has %s", f.Path, sum)
+		case f.SHA256 != sum:
+			return fmt.Errorf("%s: %w: want %s, got %s", f.Path, ErrChecksum, f.SHA256, sum)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s: downloaded %s\n", f.Path, f.URL)
+	}
+
+	return nil
+}
+
+// download gets the contents of url
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := io.Copy(buf, io.LimitReader(resp.Body, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFileSize {
+		return nil, fmt.Errorf("downloading %s: file is larger than %d bytes", url, maxFileSize)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checksum returns the hex encoded sha256 of data
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package assetvendor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+// wrongSum is a checksum that doesn't match the test file
+const wrongSum = "e7f3f8c8e1f7f9b5bbd2ca6bf0d60d6dd9cd9ec1c2c0a4bdb4ac7a4bd9c1ad0a"
+
+func newTestCDN(t *testing.T, downloads *int) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*downloads++
+		switch r.URL.Path {
+		case "/lib.js":
+			io.WriteString(w, "console.log(1)")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestVendor(t *testing.T) {
+	var downloads int
+	cdn := newTestCDN(t, &downloads)
+	dir := t.TempDir()
+
+	m := &Manifest{Files: []File{{Name: "lib", URL: cdn.URL + "/lib.js", Path: "lib/lib.min.js", SHA256: checksum([]byte("console.log(1)"))}}}
+
+	err := Vendor(context.Background(), cdn.Client(), m, dir, false, io.Discard)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, "lib", "lib.min.js"))
+	assert.NoError(t, err)
+	assert.Equal(t, "console.log(1)", string(data))
+	assert.Equal(t, 1, downloads)
+
+	// Files that are already vendored aren't downloaded again
+	err = Vendor(context.Background(), cdn.Client(), m, dir, false, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, downloads)
+}
+
+func TestVendorChecksumMismatch(t *testing.T) {
+	var downloads int
+	cdn := newTestCDN(t, &downloads)
+	dir := t.TempDir()
+
+	m := &Manifest{Files: []File{{Name: "lib", URL: cdn.URL + "/lib.js", Path: "lib.js", SHA256: wrongSum}}}
+
+	err := Vendor(context.Background(), cdn.Client(), m, dir, false, io.Discard)
+	assert.Equal(t, true, errors.Is(err, ErrChecksum))
+
+	// The mismatched file isn't written
+	_, err = os.Stat(filepath.Join(dir, "lib.js"))
+	assert.Equal(t, true, errors.Is(err, os.ErrNotExist))
+}
+
+func TestVendorPin(t *testing.T) {
+	var downloads int
+	cdn := newTestCDN(t, &downloads)
+	dir := t.TempDir()
+
+	m := &Manifest{Files: []File{{Name: "lib", URL: cdn.URL + "/lib.js", Path: "lib.js"}}}
+
+	// Files without a checksum are an error unless pinning
+	err := Vendor(context.Background(), cdn.Client(), m, dir, false, io.Discard)
+	if err == nil {
+		t.Fatal("expected an error for a missing checksum")
+	}
+
+	err = Vendor(context.Background(), cdn.Client(), m, dir, true, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, checksum([]byte("console.log(1)")), m.Files[0].SHA256)
+
+	// Missing files are an error
+	m.Files[0].URL = cdn.URL + "/missing.js"
+	m.Files[0].Path = "missing.js"
+	err = Vendor(context.Background(), cdn.Client(), m, dir, true, io.Discard)
+	if err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "vendor.json")
+
+	m := &Manifest{Files: []File{{Name: "lib", URL: "https://example.com/lib.js", Path: "lib.js", SHA256: wrongSum}}}
+	assert.NoError(t, m.Save(name))
+
+	loaded, err := Load(name)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Files[0], loaded.Files[0])
+
+	// Paths can't leave the vendor directory
+	m.Files[0].Path = "../lib.js"
+	assert.NoError(t, m.Save(name))
+	_, err = Load(name)
+	if err == nil {
+		t.Fatal("expected an error for an invalid path")
+	}
+}
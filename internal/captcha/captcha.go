@@ -0,0 +1,155 @@
+// Package captcha verifies the CAPTCHA widgets of forms with Cloudflare Turnstile or
+// hCaptcha. Forms show the widget of the provider, which adds a response token to the
+// form, and the server verifies the token with the provider's siteverify API.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissing is returned by Verify for a form without a response token.
+	ErrMissing = errors.New("captcha: missing response")
+
+	// ErrFailed is returned by Verify for a response the provider rejected.
+	ErrFailed = errors.New("captcha: verification failed")
+)
+
+// Provider is a CAPTCHA service.
+type Provider struct {
+	Name          string
+	ScriptURL     string // JavaScript of the widget
+	Class         string // CSS class of the widget element
+	ResponseField string // Form field of the response token
+	VerifyURL     string // Siteverify API
+
+	// Origins are the sites the widget loads scripts, styles, and frames from, for
+	// the Content-Security-Policy of pages with the widget
+	Origins []string
+}
+
+// Providers are the supported CAPTCHA services by name.
+var Providers = map[string]Provider{
+	"turnstile": {
+		Name:          "turnstile",
+		ScriptURL:     "https://challenges.cloudflare.com/turnstile/v0/api.js",
+		Class:         "cf-turnstile",
+		ResponseField: "cf-turnstile-response",
+		VerifyURL:     "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+		Origins:       []string{"https://challenges.cloudflare.com"},
+	},
+	"hcaptcha": {
+		Name:          "hcaptcha",
+		ScriptURL:     "https://js.hcaptcha.com/1/api.js",
+		Class:         "h-captcha",
+		ResponseField: "h-captcha-response",
+		VerifyURL:     "https://api.hcaptcha.com/siteverify",
+		Origins:       []string{"https://hcaptcha.com", "https://*.hcaptcha.com"},
+	},
+}
+
+// Verifier verifies CAPTCHA responses with a provider. A nil *Verifier is turned off:
+// it has no widget and accepts every form.
+type Verifier struct {
+	Provider Provider
+	siteKey  string
+	secret   string
+	client   *http.Client
+}
+
+// New creates a Verifier for the provider with a name from Providers. Verification
+// requests time out after timeout.
+func New(provider, siteKey, secret string, timeout time.Duration) (*Verifier, error) {
+	p, ok := Providers[provider]
+	if !ok {
+		return nil, fmt.Errorf("captcha: unknown provider %q, use turnstile or hcaptcha", provider)
+	}
+	if siteKey == "" || secret == "" {
+		return nil, fmt.Errorf("captcha: %s needs a site key and a secret", provider)
+	}
+	return &Verifier{
+		Provider: p,
+		siteKey:  siteKey,
+		secret:   secret,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Widget is the template data for the "partial:captcha" template.
+type Widget struct {
+	ScriptURL string
+	Class     string
+	SiteKey   string
+}
+
+// Widget returns the template data for the widget, or nil when v is turned off.
+func (v *Verifier) Widget() *Widget {
+	if v == nil {
+		return nil
+	}
+	return &Widget{ScriptURL: v.Provider.ScriptURL, Class: v.Provider.Class, SiteKey: v.siteKey}
+}
+
+// Origins returns the sites the widget loads from, or nil when v is turned off.
+func (v *Verifier) Origins() []string {
+	if v == nil {
+		return nil
+	}
+	return v.Provider.Origins
+}
+
+// Verify verifies the response token in the submitted form of r with the provider. Call
+// it after r.ParseForm. It returns nil when v is turned off.
+func (v *Verifier) Verify(r *http.Request, remoteIP string) error {
+	if v == nil {
+		return nil
+	}
+
+	response := r.PostFormValue(v.Provider.ResponseField)
+	if response == "" {
+		return ErrMissing
+	}
+	return v.verify(r.Context(), response, remoteIP)
+}
+
+// verify asks the provider whether a response token is valid
+func (v *Verifier) verify(ctx context.Context, response, remoteIP string) error {
+	form := url.Values{"secret": {v.secret}, "response": {response}, "sitekey": {v.siteKey}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.Provider.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha: verify request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha: verify request: %s", res.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha: verify response: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package captcha
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.FormValue("secret") == "secret" && r.FormValue("response") == "good" && r.FormValue("remoteip") == "192.0.2.1" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer api.Close()
+
+	verifier, err := New("turnstile", "site-key", "secret", time.Second)
+	assert.NoError(t, err)
+	verifier.Provider.VerifyURL = api.URL
+
+	verify := func(response string) error {
+		form := url.Values{}
+		if response != "" {
+			form.Set("cf-turnstile-response", response)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return verifier.Verify(r, "192.0.2.1")
+	}
+
+	assert.NoError(t, verify("good"))
+	assert.Equal(t, true, errors.Is(verify("bad"), ErrFailed))
+	assert.Equal(t, ErrMissing, verify(""))
+
+	// Unreachable providers are errors too
+	verifier.Provider.VerifyURL = "http://127.0.0.1:1"
+	assert.Equal(t, true, verify("good") != nil)
+
+	assert.Equal(t, "site-key", verifier.Widget().SiteKey)
+	assert.Equal(t, "cf-turnstile", verifier.Widget().Class)
+}
+
+func TestOff(t *testing.T) {
+	t.Parallel()
+
+	var verifier *Verifier
+	assert.Equal(t, true, verifier.Widget() == nil)
+	assert.NoError(t, verifier.Verify(httptest.NewRequest(http.MethodPost, "/", nil), ""))
+
+	_, err := New("recaptcha", "site-key", "secret", time.Second)
+	assert.Equal(t, true, err != nil)
+	_, err = New("hcaptcha", "", "", time.Second)
+	assert.Equal(t, true, err != nil)
+}
@@ -0,0 +1,27 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	var c Clock = NewFake(start)
+	assert.Equal(t, start, c.Now())
+
+	c.(*Fake).Add(time.Hour)
+	assert.Equal(t, start.Add(time.Hour), c.Now())
+
+	c.(*Fake).Set(start)
+	assert.Equal(t, start, c.Now())
+}
+
+func TestSystem(t *testing.T) {
+	t.Parallel()
+	assert.EqualTime(t, time.Now(), System.Now(), time.Second)
+}
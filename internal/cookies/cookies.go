@@ -0,0 +1,143 @@
+// Package cookies writes and reads signed and encrypted cookies, for small values that
+// shouldn't live in the server-side session, like the locale of a user. Signed cookies
+// can be read but not changed by the browser, and encrypted cookies can't be read
+// either. The signature and encryption cover the cookie name, so a value can't be moved
+// to another cookie.
+package cookies
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// maxCookieSize is the size browsers are guaranteed to keep for a cookie
+const maxCookieSize = 4096
+
+var (
+	// ErrValueTooLong is returned by Write functions for cookies over 4096 bytes.
+	ErrValueTooLong = errors.New("cookies: cookie value too long")
+
+	// ErrInvalidValue is returned by Read functions for a forged or damaged cookie.
+	ErrInvalidValue = errors.New("cookies: invalid cookie value")
+)
+
+// Codec signs and encrypts cookies with keys derived from a secret.
+type Codec struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// New creates a Codec with secret. An empty secret is replaced with a random one, so
+// cookies don't survive a restart.
+func New(secret []byte) *Codec {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+
+	block, err := aes.NewCipher(deriveKey(secret, "encryption"))
+	if err != nil {
+		// AES always accepts the 32 byte keys of deriveKey
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Codec{hashKey: deriveKey(secret, "signing"), aead: aead}
+}
+
+// WriteSigned sets cookie with a signed value.
+func (c *Codec) WriteSigned(w http.ResponseWriter, cookie http.Cookie) error {
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write([]byte(cookie.Name + ":" + cookie.Value))
+	cookie.Value = string(mac.Sum(nil)) + cookie.Value
+	return write(w, cookie)
+}
+
+// ReadSigned returns the value of a signed cookie. It returns http.ErrNoCookie for a
+// missing cookie, and ErrInvalidValue for a cookie with a wrong signature.
+func (c *Codec) ReadSigned(r *http.Request, name string) (string, error) {
+	data, err := read(r, name)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < sha256.Size {
+		return "", ErrInvalidValue
+	}
+
+	signature, value := data[:sha256.Size], data[sha256.Size:]
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write([]byte(name + ":" + value))
+	if !hmac.Equal([]byte(signature), mac.Sum(nil)) {
+		return "", ErrInvalidValue
+	}
+	return value, nil
+}
+
+// WriteEncrypted sets cookie with an encrypted value.
+func (c *Codec) WriteEncrypted(w http.ResponseWriter, cookie http.Cookie) error {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	cookie.Value = string(c.aead.Seal(nonce, nonce, []byte(cookie.Value), []byte(cookie.Name)))
+	return write(w, cookie)
+}
+
+// ReadEncrypted returns the value of an encrypted cookie. It returns http.ErrNoCookie
+// for a missing cookie, and ErrInvalidValue for a cookie that can't be decrypted.
+func (c *Codec) ReadEncrypted(r *http.Request, name string) (string, error) {
+	data, err := read(r, name)
+	if err != nil {
+		return "", err
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", ErrInvalidValue
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	value, err := c.aead.Open(nil, []byte(nonce), []byte(ciphertext), []byte(name))
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	return string(value), nil
+}
+
+// write base64 encodes the value of a cookie, which may have any bytes, and sets it
+func write(w http.ResponseWriter, cookie http.Cookie) error {
+	cookie.Value = base64.RawURLEncoding.EncodeToString([]byte(cookie.Value))
+	if len(cookie.String()) > maxCookieSize {
+		return ErrValueTooLong
+	}
+	http.SetCookie(w, &cookie)
+	return nil
+}
+
+// read returns the base64 decoded value of a cookie
+func read(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	return string(value), nil
+}
+
+// deriveKey returns a 32 byte key for one use of the secret
+func deriveKey(secret []byte, use string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("cookies " + use))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,93 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+// roundTrip writes a cookie with write and returns a request that sends it back
+func roundTrip(t *testing.T, write func(http.ResponseWriter, http.Cookie) error, cookie http.Cookie) *http.Request {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	assert.NoError(t, write(rr, cookie))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestSigned(t *testing.T) {
+	t.Parallel()
+
+	codec := New([]byte("secret"))
+	r := roundTrip(t, codec.WriteSigned, http.Cookie{Name: "lang", Value: "es; not escaped"})
+
+	value, err := codec.ReadSigned(r, "lang")
+	assert.NoError(t, err)
+	assert.Equal(t, "es; not escaped", value)
+
+	// Other secrets and cookie names don't have the same signature
+	_, err = New([]byte("other")).ReadSigned(r, "lang")
+	assert.Equal(t, ErrInvalidValue, err)
+
+	cookie, err := r.Cookie("lang")
+	assert.NoError(t, err)
+	moved := httptest.NewRequest(http.MethodGet, "/", nil)
+	moved.AddCookie(&http.Cookie{Name: "theme", Value: cookie.Value})
+	_, err = codec.ReadSigned(moved, "theme")
+	assert.Equal(t, ErrInvalidValue, err)
+
+	// Changed values are rejected
+	changed := httptest.NewRequest(http.MethodGet, "/", nil)
+	changed.AddCookie(&http.Cookie{Name: "lang", Value: cookie.Value[:len(cookie.Value)-2] + "AA"})
+	_, err = codec.ReadSigned(changed, "lang")
+	assert.Equal(t, ErrInvalidValue, err)
+
+	// Missing cookies are reported like by r.Cookie
+	_, err = codec.ReadSigned(httptest.NewRequest(http.MethodGet, "/", nil), "lang")
+	assert.Equal(t, http.ErrNoCookie, err)
+}
+
+func TestEncrypted(t *testing.T) {
+	t.Parallel()
+
+	codec := New(nil)
+	r := roundTrip(t, codec.WriteEncrypted, http.Cookie{Name: "remember", Value: "user=42"})
+
+	// The value can't be read from the cookie
+	cookie, err := r.Cookie("remember")
+	assert.NoError(t, err)
+	assert.StringNotIn(t, "user=42", cookie.Value)
+
+	value, err := codec.ReadEncrypted(r, "remember")
+	assert.NoError(t, err)
+	assert.Equal(t, "user=42", value)
+
+	// Other secrets can't decrypt it, and signed cookies aren't encrypted ones
+	_, err = New([]byte("other")).ReadEncrypted(r, "remember")
+	assert.Equal(t, ErrInvalidValue, err)
+
+	signed := roundTrip(t, codec.WriteSigned, http.Cookie{Name: "remember", Value: "user=42"})
+	_, err = codec.ReadEncrypted(signed, "remember")
+	assert.Equal(t, ErrInvalidValue, err)
+
+	garbage := httptest.NewRequest(http.MethodGet, "/", nil)
+	garbage.AddCookie(&http.Cookie{Name: "remember", Value: "not base64!"})
+	_, err = codec.ReadEncrypted(garbage, "remember")
+	assert.Equal(t, ErrInvalidValue, err)
+}
+
+func TestValueTooLong(t *testing.T) {
+	t.Parallel()
+
+	codec := New(nil)
+	err := codec.WriteEncrypted(httptest.NewRecorder(), http.Cookie{Name: "big", Value: strings.Repeat("x", 4000)})
+	assert.Equal(t, true, errors.Is(err, ErrValueTooLong))
+}
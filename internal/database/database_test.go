@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestDriverRegistered(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, true, slices.Contains(sql.Drivers(), DriverName))
+}
+
+func TestOpenUnreachable(t *testing.T) {
+	t.Parallel()
+
+	// Nothing listens on port 1, so the ping fails and the pool isn't returned
+	db, err := Open(context.Background(), Config{DSN: "postgres://app@127.0.0.1:1/app?connect_timeout=1"})
+	if err == nil {
+		db.Close()
+		t.Fatal("expected an error for an unreachable database")
+	}
+	assert.StringIn(t, "database:", err.Error())
+}
+
+func TestOpenInvalidDSN(t *testing.T) {
+	t.Parallel()
+
+	_, err := Open(context.Background(), Config{DSN: "postgres://app@localhost:notaport/app"})
+	if err == nil {
+		t.Fatal("expected an error for an invalid DSN")
+	}
+}
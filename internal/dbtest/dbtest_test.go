@@ -0,0 +1,27 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestWithSearchPath(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "postgres://app@localhost/app_test?search_path=test_1&sslmode=disable",
+		withSearchPath("postgres://app@localhost/app_test?sslmode=disable", "test_1"))
+	assert.Equal(t, "host=localhost dbname=app_test search_path=test_1",
+		withSearchPath("host=localhost dbname=app_test", "test_1"))
+}
+
+func TestNewSkipsWithoutDatabase(t *testing.T) {
+	t.Setenv(EnvURL, "")
+
+	skipped := false
+	t.Run("store", func(t *testing.T) {
+		defer func() { skipped = t.Skipped() }()
+		New(t)
+	})
+	assert.Equal(t, true, skipped)
+}
@@ -0,0 +1,328 @@
+package email
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	netmail "net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+//=============================================================================
+//	API Mailer
+//=============================================================================
+
+// APIProviders are the email services an APIMailer can send through.
+var APIProviders = []string{"sendgrid", "mailgun", "ses"}
+
+// APIConfig are the settings of an APIMailer. Every provider needs an API key and a
+// sender, and some need more:
+//   - sendgrid: APIKey
+//   - mailgun: APIKey and Domain. Region "eu" uses the EU region of Mailgun.
+//   - ses: KeyID, APIKey (the secret access key), and Region, like us-east-1
+type APIConfig struct {
+	APIKey  string
+	KeyID   string
+	Domain  string
+	Region  string
+	From    string
+	Timeout time.Duration // Timeout of a request to the API, 10 seconds by default
+}
+
+// APIMailer sends emails through the HTTP API of an email service, like SendGrid, for
+// deployments without SMTP.
+type APIMailer struct {
+	// Clock tells the time for signed requests, clock.System by default.
+	Clock clock.Clock
+
+	provider string
+	cfg      APIConfig
+	client   *http.Client
+
+	// baseURL is the URL of the API, replaced by tests
+	baseURL string
+
+	// newRequest creates the API request of a rendered message for the provider
+	newRequest func(m *APIMailer, message *Message, content *Content) (*http.Request, error)
+}
+
+// NewAPIMailer creates an APIMailer for the provider with a name from APIProviders.
+func NewAPIMailer(provider string, cfg APIConfig) (*APIMailer, error) {
+	m := &APIMailer{
+		Clock:    clock.System,
+		provider: provider,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cmp.Or(cfg.Timeout, defaultTimeout)},
+	}
+
+	var missing []string
+	switch provider {
+	case "sendgrid":
+		m.baseURL = "https://api.sendgrid.com"
+		m.newRequest = (*APIMailer).sendGridRequest
+	case "mailgun":
+		m.baseURL = "https://api.mailgun.net"
+		if strings.EqualFold(cfg.Region, "eu") {
+			m.baseURL = "https://api.eu.mailgun.net"
+		}
+		m.newRequest = (*APIMailer).mailgunRequest
+		if cfg.Domain == "" {
+			missing = append(missing, "a domain")
+		}
+	case "ses":
+		m.baseURL = "https://email." + cfg.Region + ".amazonaws.com"
+		m.newRequest = (*APIMailer).sesRequest
+		if cfg.KeyID == "" {
+			missing = append(missing, "an access key ID")
+		}
+		if cfg.Region == "" {
+			missing = append(missing, "a region")
+		}
+	default:
+		return nil, fmt.Errorf("email: unknown provider %q, use %s", provider, strings.Join(APIProviders, ", "))
+	}
+
+	if cfg.APIKey == "" {
+		missing = slices.Insert(missing, 0, "an API key")
+	}
+	if cfg.From == "" {
+		missing = append(missing, "a sender")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("email: %s needs %s", provider, strings.Join(missing, " and "))
+	}
+
+	return m, nil
+}
+
+// Send renders a message and sends it to every recipient with one request to the API
+// of the provider. Cancelling ctx aborts the request. A failed send isn't retried, so
+// send emails with a job to retry them.
+func (m *APIMailer) Send(ctx context.Context, message Message) error {
+	if err := message.validate(); err != nil {
+		return err
+	}
+
+	content, err := Render(message.Data, message.Templates...)
+	if err != nil {
+		return err
+	}
+
+	req, err := m.newRequest(m, &message, content)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("email: %s request: %w", m.provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("email: %s returned %s: %s", m.provider, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+//=============================================================================
+//	SendGrid
+//=============================================================================
+
+// sendGridAddress is an email address of the SendGrid v3 API
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// newSendGridAddress parses an address, like "Name <name@example.com>"
+func newSendGridAddress(address string) (sendGridAddress, error) {
+	a, err := netmail.ParseAddress(address)
+	if err != nil {
+		return sendGridAddress{}, err
+	}
+	return sendGridAddress{Email: a.Address, Name: a.Name}, nil
+}
+
+// newSendGridAddresses parses a list of addresses
+func newSendGridAddresses(addresses []string) ([]sendGridAddress, error) {
+	var list []sendGridAddress
+	for _, address := range addresses {
+		a, err := newSendGridAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+// sendGridRequest creates a request of the SendGrid v3 mail send API
+func (m *APIMailer) sendGridRequest(message *Message, rendered *Content) (*http.Request, error) {
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	type attachment struct {
+		Content     string `json:"content"`
+		Filename    string `json:"filename"`
+		Type        string `json:"type"`
+		Disposition string `json:"disposition"`
+		ContentID   string `json:"content_id,omitempty"`
+	}
+	type personalization struct {
+		To  []sendGridAddress `json:"to,omitempty"`
+		Cc  []sendGridAddress `json:"cc,omitempty"`
+		Bcc []sendGridAddress `json:"bcc,omitempty"`
+	}
+	var body struct {
+		Personalizations []personalization `json:"personalizations"`
+		From             sendGridAddress   `json:"from"`
+		ReplyTo          *sendGridAddress  `json:"reply_to,omitempty"`
+		Subject          string            `json:"subject"`
+		Content          []content         `json:"content"`
+		Headers          map[string]string `json:"headers,omitempty"`
+		Attachments      []attachment      `json:"attachments,omitempty"`
+	}
+
+	// Every recipient of one personalization gets the same email
+	var p personalization
+	var err error
+	if p.To, err = newSendGridAddresses(message.To); err != nil {
+		return nil, err
+	}
+	if p.Cc, err = newSendGridAddresses(message.Cc); err != nil {
+		return nil, err
+	}
+	if p.Bcc, err = newSendGridAddresses(message.Bcc); err != nil {
+		return nil, err
+	}
+	body.Personalizations = []personalization{p}
+
+	body.From, err = newSendGridAddress(m.cfg.From)
+	if err != nil {
+		return nil, err
+	}
+	if message.ReplyTo != "" {
+		replyTo, err := newSendGridAddress(message.ReplyTo)
+		if err != nil {
+			return nil, err
+		}
+		body.ReplyTo = &replyTo
+	}
+
+	body.Subject = rendered.Subject
+	body.Content = []content{{Type: "text/plain", Value: rendered.PlainBody}}
+	if rendered.HTMLBody != "" {
+		body.Content = append(body.Content, content{Type: "text/html", Value: rendered.HTMLBody})
+	}
+	body.Headers = message.Headers
+	for _, a := range message.Attachments {
+		disposition := "attachment"
+		if a.Inline() {
+			disposition = "inline"
+		}
+		body.Attachments = append(body.Attachments, attachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Data),
+			Filename:    a.Filename,
+			Type:        a.contentType(),
+			Disposition: disposition,
+			ContentID:   a.ContentID,
+		})
+	}
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.baseURL+"/v3/mail/send", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+//=============================================================================
+//	Mailgun
+//=============================================================================
+
+// mailgunRequest creates a request of the Mailgun messages API
+func (m *APIMailer) mailgunRequest(message *Message, content *Content) (*http.Request, error) {
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+
+	fields := [][2]string{
+		{"from", m.cfg.From},
+		{"subject", content.Subject},
+		{"text", content.PlainBody},
+	}
+	for _, address := range message.To {
+		fields = append(fields, [2]string{"to", address})
+	}
+	for _, address := range message.Cc {
+		fields = append(fields, [2]string{"cc", address})
+	}
+	for _, address := range message.Bcc {
+		fields = append(fields, [2]string{"bcc", address})
+	}
+	if content.HTMLBody != "" {
+		fields = append(fields, [2]string{"html", content.HTMLBody})
+	}
+	if message.ReplyTo != "" {
+		fields = append(fields, [2]string{"h:Reply-To", message.ReplyTo})
+	}
+	for name, value := range message.Headers {
+		fields = append(fields, [2]string{"h:" + name, value})
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Mailgun uses the filename of an inline image as its content ID
+	for _, a := range message.Attachments {
+		field, filename := "attachment", a.Filename
+		if a.Inline() {
+			field, filename = "inline", a.ContentID
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": field, "filename": filename}))
+		header.Set("Content-Type", a.contentType())
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(a.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.baseURL+"/v3/"+m.cfg.Domain+"/messages", body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("api", m.cfg.APIKey)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req, nil
+}
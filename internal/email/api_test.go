@@ -0,0 +1,255 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+var notificationData = map[string]string{"Title": "Export ready", "Body": "Your export is ready."}
+
+// testAttachments are a file and an inline image
+var testAttachments = []Attachment{
+	{Filename: "notes.csv", Data: []byte("title\nMilk")},
+	{Filename: "logo.png", Data: []byte("\x89PNG\r\n\x1a\n"), ContentID: "logo"},
+}
+
+// TestAPIMailerImplementsInterface ensures that APIMailer correctly implements MailerInterface
+func TestAPIMailerImplementsInterface(t *testing.T) {
+	t.Parallel()
+	var _ MailerInterface = (*APIMailer)(nil)
+}
+
+func TestNewAPIMailer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		provider string
+		cfg      APIConfig
+		wantErr  string
+	}{
+		{"sendgrid", APIConfig{APIKey: "key", From: "app@example.com"}, ""},
+		{"mailgun", APIConfig{APIKey: "key", Domain: "mg.example.com", From: "app@example.com"}, ""},
+		{"ses", APIConfig{APIKey: "secret", KeyID: "id", Region: "us-east-1", From: "app@example.com"}, ""},
+		{"postmark", APIConfig{APIKey: "key", From: "app@example.com"}, `email: unknown provider "postmark", use sendgrid, mailgun, ses`},
+		{"sendgrid", APIConfig{From: "app@example.com"}, "email: sendgrid needs an API key"},
+		{"mailgun", APIConfig{APIKey: "key"}, "email: mailgun needs a domain and a sender"},
+		{"ses", APIConfig{From: "app@example.com"}, "email: ses needs an API key and an access key ID and a region"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider+" "+tt.wantErr, func(t *testing.T) {
+			_, err := NewAPIMailer(tt.provider, tt.cfg)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error %q", tt.wantErr)
+			}
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+
+	// Mailgun has an EU region
+	m, err := NewAPIMailer("mailgun", APIConfig{APIKey: "key", Domain: "mg.example.com", Region: "eu", From: "app@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.eu.mailgun.net", m.baseURL)
+}
+
+// newTestAPIMailer creates an APIMailer that sends its requests to handler
+func newTestAPIMailer(t *testing.T, provider string, cfg APIConfig, handler http.HandlerFunc) *APIMailer {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	m, err := NewAPIMailer(provider, cfg)
+	assert.NoError(t, err)
+	m.baseURL = ts.URL
+	return m
+}
+
+func TestAPIMailerSendGrid(t *testing.T) {
+	t.Parallel()
+
+	var got struct {
+		Personalizations []struct {
+			To, Cc, Bcc []sendGridAddress
+		} `json:"personalizations"`
+		From        sendGridAddress  `json:"from"`
+		ReplyTo     *sendGridAddress `json:"reply_to"`
+		Subject     string           `json:"subject"`
+		Headers     map[string]string
+		Content     []struct{ Type, Value string }
+		Attachments []struct {
+			Content, Filename, Type, Disposition string
+			ContentID                            string `json:"content_id"`
+		}
+	}
+	m := newTestAPIMailer(t, "sendgrid", APIConfig{APIKey: "sg-key", From: "App <app@example.com>"}, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/mail/send", r.URL.Path)
+		assert.Equal(t, "Bearer sg-key", r.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	err := m.Send(context.Background(), Message{
+		To:          []string{"ana@example.com", "Bo <bo@example.com>"},
+		Cc:          []string{"cy@example.com"},
+		Bcc:         []string{"audit@example.com"},
+		ReplyTo:     "reply@example.com",
+		Headers:     map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe>"},
+		Data:        notificationData,
+		Templates:   []string{"notification.tmpl"},
+		Attachments: testAttachments,
+	})
+	assert.NoError(t, err)
+
+	// Every recipient is in one personalization, so they get one email
+	assert.Equal(t, 1, len(got.Personalizations))
+	assert.Equal(t, "ana@example.com", got.Personalizations[0].To[0].Email)
+	assert.Equal(t, sendGridAddress{Email: "bo@example.com", Name: "Bo"}, got.Personalizations[0].To[1])
+	assert.Equal(t, "cy@example.com", got.Personalizations[0].Cc[0].Email)
+	assert.Equal(t, "audit@example.com", got.Personalizations[0].Bcc[0].Email)
+	assert.Equal(t, "<https://example.com/unsubscribe>", got.Headers["List-Unsubscribe"])
+	assert.Equal(t, sendGridAddress{Email: "app@example.com", Name: "App"}, got.From)
+	assert.Equal(t, "reply@example.com", got.ReplyTo.Email)
+	assert.Equal(t, "Export ready", got.Subject)
+	assert.Equal(t, 2, len(got.Content))
+	assert.Equal(t, "text/plain", got.Content[0].Type)
+	assert.Equal(t, "text/html", got.Content[1].Type)
+	assert.Equal(t, 2, len(got.Attachments))
+	assert.Equal(t, "notes.csv", got.Attachments[0].Filename)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("title\nMilk")), got.Attachments[0].Content)
+	assert.Equal(t, "text/csv; charset=utf-8", got.Attachments[0].Type)
+	assert.Equal(t, "attachment", got.Attachments[0].Disposition)
+	assert.Equal(t, "image/png", got.Attachments[1].Type)
+	assert.Equal(t, "inline", got.Attachments[1].Disposition)
+	assert.Equal(t, "logo", got.Attachments[1].ContentID)
+}
+
+func TestAPIMailerMailgun(t *testing.T) {
+	t.Parallel()
+
+	m := newTestAPIMailer(t, "mailgun", APIConfig{APIKey: "mg-key", Domain: "mg.example.com", From: "app@example.com"}, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/mg.example.com/messages", r.URL.Path)
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "api", user)
+		assert.Equal(t, "mg-key", password)
+
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "app@example.com", r.FormValue("from"))
+		assert.EqualSlices(t, []string{"ana@example.com", "bo@example.com"}, r.MultipartForm.Value["to"])
+		assert.Equal(t, "cy@example.com", r.FormValue("cc"))
+		assert.Equal(t, "audit@example.com", r.FormValue("bcc"))
+		assert.Equal(t, "42", r.FormValue("h:X-Note-ID"))
+		assert.Equal(t, "Export ready", r.FormValue("subject"))
+		assert.StringIn(t, "Your export is ready.", r.FormValue("text"))
+		assert.StringIn(t, "Your export is ready.", r.FormValue("html"))
+		assert.Equal(t, "", r.FormValue("h:Reply-To"))
+
+		file, header, err := r.FormFile("attachment")
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "notes.csv", header.Filename)
+		assert.Equal(t, "title\nMilk", string(data))
+
+		// Inline images are named after their content ID
+		_, header, err = r.FormFile("inline")
+		assert.NoError(t, err)
+		assert.Equal(t, "logo", header.Filename)
+		assert.Equal(t, "image/png", header.Header.Get("Content-Type"))
+	})
+
+	err := m.Send(context.Background(), Message{
+		To:          []string{"ana@example.com", "bo@example.com"},
+		Cc:          []string{"cy@example.com"},
+		Bcc:         []string{"audit@example.com"},
+		Headers:     map[string]string{"X-Note-ID": "42"},
+		Data:        notificationData,
+		Templates:   []string{"notification.tmpl"},
+		Attachments: testAttachments,
+	})
+	assert.NoError(t, err)
+}
+
+func TestAPIMailerSES(t *testing.T) {
+	t.Parallel()
+
+	var raw []byte
+	var destination map[string][]string
+	m := newTestAPIMailer(t, "ses", APIConfig{APIKey: "secret", KeyID: "AKIDEXAMPLE", Region: "eu-west-1", From: "app@example.com"}, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/email/outbound-emails", r.URL.Path)
+		assert.Equal(t, "20250102T030405Z", r.Header.Get("X-Amz-Date"))
+		assert.StringIn(t, "Credential=AKIDEXAMPLE/20250102/eu-west-1/ses/aws4_request", r.Header.Get("Authorization"))
+		assert.StringIn(t, "SignedHeaders=content-type;host;x-amz-date", r.Header.Get("Authorization"))
+
+		var body struct {
+			Destination map[string][]string
+			Content     struct{ Raw struct{ Data []byte } }
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		raw = body.Content.Raw.Data
+		destination = body.Destination
+	})
+	m.Clock = clock.NewFake(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	err := m.Send(context.Background(), Message{
+		To:          []string{"ana@example.com"},
+		Bcc:         []string{"audit@example.com"},
+		ReplyTo:     "reply@example.com",
+		Data:        notificationData,
+		Templates:   []string{"notification.tmpl"},
+		Attachments: testAttachments,
+	})
+	assert.NoError(t, err)
+
+	// Bcc recipients are only in the destination
+	assert.EqualSlices(t, []string{"ana@example.com"}, destination["ToAddresses"])
+	assert.EqualSlices(t, []string{"audit@example.com"}, destination["BccAddresses"])
+	assert.StringNotIn(t, "audit@example.com", string(raw))
+
+	// The email is a raw MIME message
+	assert.StringIn(t, "To: <ana@example.com>", string(raw))
+	assert.StringIn(t, "Reply-To: <reply@example.com>", string(raw))
+	assert.StringIn(t, "Subject: Export ready", string(raw))
+	assert.StringIn(t, `filename="notes.csv"`, string(raw))
+	assert.StringIn(t, "Content-Id: <logo>", string(raw))
+}
+
+func TestAPIMailerError(t *testing.T) {
+	t.Parallel()
+
+	m := newTestAPIMailer(t, "sendgrid", APIConfig{APIKey: "bad-key", From: "app@example.com"}, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":[{"message":"invalid key"}]}`, http.StatusUnauthorized)
+	})
+
+	err := m.Send(context.Background(), Message{To: []string{"ana@example.com"}, Data: notificationData, Templates: []string{"notification.tmpl"}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assert.Equal(t, `email: sendgrid returned 401 Unauthorized: {"errors":[{"message":"invalid key"}]}`, err.Error())
+}
+
+func TestSignV4(t *testing.T) {
+	t.Parallel()
+
+	// The get-vanilla example of the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	assert.NoError(t, err)
+	signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	assert.Equal(t, want, req.Header.Get("Authorization"))
+}
@@ -0,0 +1,233 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/wneessen/go-mail"
+)
+
+//=============================================================================
+//	DKIM
+//=============================================================================
+
+// dkimHeaders are the headers signed by a DKIMSigner when the email has them
+var dkimHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding", "List-Unsubscribe",
+}
+
+// DKIMSigner signs emails with DomainKeys Identified Mail (RFC 6376), so receivers can
+// check that they come from the domain of the From address and DMARC passes. The public
+// key is published in a TXT record at {Selector}._domainkey.{Domain}.
+//
+// It's a go-mail middleware, which adds a DKIM-Signature header when a message is
+// written. Signatures use relaxed canonicalization for the headers and the body.
+type DKIMSigner struct {
+	// Clock tells the time of the signatures, clock.System by default.
+	Clock clock.Clock
+
+	domain    string
+	selector  string
+	key       crypto.Signer
+	algorithm string
+}
+
+// NewDKIMSigner creates a DKIMSigner for a domain and selector with a PEM encoded RSA
+// or Ed25519 private key, in the PKCS #1 or PKCS #8 format.
+func NewDKIMSigner(domain, selector string, pemKey []byte) (*DKIMSigner, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("email: DKIM needs a domain and a selector")
+	}
+
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("email: DKIM private key isn't PEM encoded")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("email: unsupported DKIM private key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("email: parsing DKIM private key: %w", err)
+	}
+
+	s := &DKIMSigner{Clock: clock.System, domain: domain, selector: selector}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		s.key, s.algorithm = key, "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.key, s.algorithm = key, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("email: unsupported DKIM private key %T, use RSA or Ed25519", key)
+	}
+	return s, nil
+}
+
+// Type returns the go-mail middleware type of the signer
+func (s *DKIMSigner) Type() mail.MiddlewareType {
+	return "dkim"
+}
+
+// Handle adds the DKIM-Signature header to msg. go-mail keeps the generated headers
+// and boundaries of a message, so it's written the same way again after signing.
+func (s *DKIMSigner) Handle(msg *mail.Msg) *mail.Msg {
+	buf := new(bytes.Buffer)
+	if _, err := msg.WriteToSkipMiddleware(buf, s.Type()); err != nil {
+		// Sending fails with the same error when the message is written again
+		return msg
+	}
+
+	signature, err := s.Sign(buf.Bytes())
+	if err != nil {
+		// An unsigned email is still delivered, it only fails DMARC where it's enforced
+		return msg
+	}
+	msg.SetGenHeaderPreformatted("DKIM-Signature", signature)
+	return msg
+}
+
+// Sign returns the value of the DKIM-Signature header for an email with CRLF line
+// endings.
+func (s *DKIMSigner) Sign(email []byte) (string, error) {
+	header, body, _ := bytes.Cut(email, []byte("\r\n\r\n"))
+	bodyHash := sha256.Sum256(dkimRelaxedBody(body))
+
+	// Sign the last instance of every header the email has, in the order of the h= tag
+	fields := dkimHeaderFields(header)
+	var names []string
+	var signed bytes.Buffer
+	for _, name := range dkimHeaders {
+		key := strings.ToLower(name)
+		for i := len(fields) - 1; i >= 0; i-- {
+			if fields[i].key == key {
+				names = append(names, key)
+				signed.WriteString(dkimRelaxedHeader(fields[i].name, fields[i].value))
+				break
+			}
+		}
+	}
+	if len(names) == 0 || names[0] != "from" {
+		return "", errors.New("email: DKIM needs a From header")
+	}
+
+	// The signature covers its own header with an empty b= tag, without the CRLF
+	value := "v=1; a=" + s.algorithm + "; c=relaxed/relaxed; d=" + s.domain + "; s=" + s.selector + ";\r\n" +
+		"\tt=" + strconv.FormatInt(s.Clock.Now().Unix(), 10) + "; h=" + strings.Join(names, ":") + ";\r\n" +
+		"\tbh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n" +
+		"\tb="
+	signed.WriteString(strings.TrimSuffix(dkimRelaxedHeader("DKIM-Signature", value), "\r\n"))
+	hash := sha256.Sum256(signed.Bytes())
+
+	var sig []byte
+	var err error
+	switch s.algorithm {
+	case "ed25519-sha256":
+		// Ed25519 signs the SHA-256 hash, see RFC 8463
+		sig, err = s.key.Sign(rand.Reader, hash[:], crypto.Hash(0))
+	default:
+		sig, err = s.key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", fmt.Errorf("email: DKIM signing: %w", err)
+	}
+
+	return value + dkimFold(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// dkimField is a header field of an email
+type dkimField struct {
+	name  string // Name as written
+	key   string // Lowercase name
+	value string // Value with the folding, without the final CRLF
+}
+
+// dkimHeaderFields splits the header of an email into its fields. Lines starting with
+// whitespace continue the field before them.
+func dkimHeaderFields(header []byte) []dkimField {
+	var fields []dkimField
+	for line := range strings.SplitSeq(string(header), "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(fields) > 0 {
+			fields[len(fields)-1].value += "\r\n" + line
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields = append(fields, dkimField{name: name, key: strings.ToLower(strings.TrimSpace(name)), value: value})
+	}
+	return fields
+}
+
+// dkimRelaxedHeader canonicalizes a header field with the relaxed algorithm: a lowercase
+// name, an unfolded value with runs of whitespace as one space, and no whitespace around
+// the colon or at the end.
+func dkimRelaxedHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.Fields(value), " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value + "\r\n"
+}
+
+// dkimRelaxedBody canonicalizes a body with the relaxed algorithm: runs of whitespace
+// in a line as one space, no whitespace at the end of lines, and no empty lines at the
+// end of the body.
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		var b strings.Builder
+		inSpace := false
+		for _, r := range line {
+			if r == ' ' || r == '\t' {
+				inSpace = true
+				continue
+			}
+			if inSpace {
+				b.WriteByte(' ')
+				inSpace = false
+			}
+			b.WriteRune(r)
+		}
+		lines[i] = b.String()
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// dkimFold folds the signature into lines of 72 characters. Receivers ignore the
+// whitespace in the b= tag.
+func dkimFold(sig string) string {
+	var b strings.Builder
+	for len(sig) > 72 {
+		b.WriteString(sig[:72] + "\r\n\t")
+		sig = sig[72:]
+	}
+	b.WriteString(sig)
+	return b.String()
+}
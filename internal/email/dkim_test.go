@@ -0,0 +1,184 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/wneessen/go-mail"
+)
+
+func TestDKIMRelaxed(t *testing.T) {
+	t.Parallel()
+
+	// The example of RFC 6376 section 3.4.5
+	fields := dkimHeaderFields([]byte("A: X\r\nB : Y\t\r\n\tZ  "))
+	var header string
+	for _, f := range fields {
+		header += dkimRelaxedHeader(f.name, f.value)
+	}
+	assert.Equal(t, "a:X\r\nb:Y Z\r\n", header)
+	assert.Equal(t, " C\r\nD E\r\n", string(dkimRelaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))))
+
+	// An empty body stays empty
+	assert.Equal(t, "", string(dkimRelaxedBody([]byte("\r\n\r\n"))))
+}
+
+func TestNewDKIMSigner(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		pem           []byte
+		wantAlgorithm string
+		wantErr       bool
+	}{
+		{"rsa pkcs1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), "rsa-sha256", false},
+		{"ed25519 pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), "ed25519-sha256", false},
+		{"not pem", []byte("secret"), "", true},
+		{"public key", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("key")}), "", true},
+		{"bad key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewDKIMSigner("example.com", "mail", tt.pem)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAlgorithm, s.algorithm)
+		})
+	}
+
+	_, err = NewDKIMSigner("example.com", "", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	if err == nil {
+		t.Error("expected an error for a missing selector")
+	}
+}
+
+func TestDKIMSigner(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		pem    []byte
+		verify func(hash, sig []byte) bool
+	}{
+		{
+			name: "rsa",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			verify: func(hash, sig []byte) bool {
+				return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, hash, sig) == nil
+			},
+		},
+		{
+			name: "ed25519",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+			verify: func(hash, sig []byte) bool {
+				return ed25519.Verify(edPublic, hash, sig)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewDKIMSigner("example.com", "mail", tt.pem)
+			assert.NoError(t, err)
+			signer.Clock = clock.NewFake(time.Unix(1700000000, 0))
+
+			content, err := Render(notificationData, "notification.tmpl")
+			assert.NoError(t, err)
+			msg, err := newMsg("App <app@example.com>", &Message{
+				To:          []string{"ana@example.com"},
+				Cc:          []string{"bo@example.com"},
+				Attachments: testAttachments,
+			}, content, mail.WithMiddleware(signer))
+			assert.NoError(t, err)
+
+			buf := new(bytes.Buffer)
+			_, err = msg.WriteTo(buf)
+			assert.NoError(t, err)
+
+			verifyDKIM(t, buf.Bytes(), tt.verify)
+		})
+	}
+}
+
+// verifyDKIM checks the DKIM-Signature header of a written email like a receiver
+func verifyDKIM(t *testing.T, email []byte, verify func(hash, sig []byte) bool) {
+	t.Helper()
+
+	header, body, _ := bytes.Cut(email, []byte("\r\n\r\n"))
+	fields := dkimHeaderFields(header)
+
+	var signature dkimField
+	for _, f := range fields {
+		if f.key == "dkim-signature" {
+			signature = f
+		}
+	}
+	if signature.key == "" {
+		t.Fatalf("no DKIM-Signature header in:\n%s", header)
+	}
+
+	tags := map[string]string{}
+	for tag := range strings.SplitSeq(signature.value, ";") {
+		name, value, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), "")
+	}
+	assert.Equal(t, "example.com", tags["d"])
+	assert.Equal(t, "mail", tags["s"])
+	assert.Equal(t, "1700000000", tags["t"])
+	assert.Equal(t, "from:subject:date:to:cc:message-id:mime-version:content-type", tags["h"])
+
+	bodyHash := sha256.Sum256(dkimRelaxedBody(body))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(bodyHash[:]), tags["bh"])
+
+	// The signed data is the signed headers and the signature header without b=
+	var signed strings.Builder
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if fields[i].key == name {
+				signed.WriteString(dkimRelaxedHeader(fields[i].name, fields[i].value))
+				break
+			}
+		}
+	}
+	unsigned := regexp.MustCompile(`b=[^;]*$`).ReplaceAllString(signature.value, "b=")
+	signed.WriteString(strings.TrimSuffix(dkimRelaxedHeader(signature.name, unsigned), "\r\n"))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	assert.NoError(t, err)
+	hash := sha256.Sum256([]byte(signed.String()))
+	if !verify(hash[:], sig) {
+		t.Errorf("DKIM signature doesn't verify for:\n%s", email)
+	}
+}
@@ -2,11 +2,18 @@ package email
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
 	"time"
 
 	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/clock"
 	"github.com/sglmr/gowebstart/internal/funcs"
 	"github.com/wneessen/go-mail"
 
@@ -16,15 +23,61 @@ import (
 
 const defaultTimeout = 10 * time.Second
 
+// Attachment is a file sent with an email. An attachment with a ContentID is an inline
+// image instead, which the HTML body shows with <img src="cid:{ContentID}">.
 type Attachment struct {
-	Filename string
-	Data     []byte
+	Filename    string
+	Data        []byte
+	ContentType string // Detected from the filename or the data when empty
+	ContentID   string // Makes the attachment an inline image of the HTML body
+}
+
+// Inline returns whether the attachment is an inline image of the HTML body
+func (a Attachment) Inline() bool {
+	return a.ContentID != ""
+}
+
+// contentType returns the content type of the attachment, detected from the filename
+// or the data when it isn't set.
+func (a Attachment) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if t := mime.TypeByExtension(filepath.Ext(a.Filename)); t != "" {
+		return t
+	}
+	return http.DetectContentType(a.Data)
+}
+
+// ErrNoRecipients is returned by Send for a message without a To, Cc, or Bcc address.
+var ErrNoRecipients = errors.New("email: message has no recipients")
+
+// Message is an email to send. It's rendered from the email templates with Data.
+// Every address can have a name, like "Name <name@example.com>", and one message goes
+// to every To, Cc, and Bcc recipient at once.
+type Message struct {
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo string            // Optional
+	Headers map[string]string // Optional extra headers, like List-Unsubscribe
+
+	Data        any
+	Templates   []string
+	Attachments []Attachment // Optional. Attachments with a ContentID are inline images.
+}
+
+// validate checks that a message has recipients
+func (m *Message) validate() error {
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return ErrNoRecipients
+	}
+	return nil
 }
 
 // MailerInterface enables exchanging between a Mailer and LogMailer.
 type MailerInterface interface {
-	Send(recipient string, replyTo string, data any, templates ...string) error
-	SendWithAttachment(recipient, replyTo string, data any, attachment Attachment, templates ...string) error
+	Send(ctx context.Context, msg Message) error
 }
 
 //=============================================================================
@@ -33,6 +86,9 @@ type MailerInterface interface {
 
 // Mailer that sends SMTP emails
 type Mailer struct {
+	// DKIM signs the sent emails when it's set, see NewDKIMSigner
+	DKIM *DKIMSigner
+
 	client *mail.Client
 	from   string
 }
@@ -52,169 +108,184 @@ func NewMailer(host string, port int, username, password, from string) (*Mailer,
 	return mailer, nil
 }
 
-// Send an email to a recipient with data for a specified template name (patterns)
-//   - Reply to is optional and can be blank.
-func (m *Mailer) Send(recipient string, replyTo string, data any, templates ...string) error {
-	// Create a slice from the patterns argument
-	for i := range templates {
-		// templates[i] = "emails/" + templates[i]
-		templates[i] = "emails/" + templates[i]
-	}
-
-	// Initialize a new mail message
-	msg := mail.NewMsg()
-
-	err := msg.To(recipient)
+// Ping dials and authenticates with the SMTP server without sending anything, so it
+// can be used as a health check.
+func (m *Mailer) Ping(ctx context.Context) error {
+	client, err := m.client.DialToSMTPClientWithContext(ctx)
 	if err != nil {
 		return err
 	}
+	return m.client.CloseWithSMTPClient(client)
+}
 
-	if len(replyTo) > 0 {
-		err = msg.ReplyTo(replyTo)
-		if err != nil {
-			return err
-		}
+// Send renders a message and sends it to every recipient in one SMTP session. Cancelling
+// ctx aborts the session. A failed send isn't retried, so send emails with a job to
+// retry them.
+func (m *Mailer) Send(ctx context.Context, message Message) error {
+	if err := message.validate(); err != nil {
+		return err
 	}
 
-	err = msg.From(m.from)
+	content, err := Render(message.Data, message.Templates...)
 	if err != nil {
 		return err
 	}
 
-	ts, err := textTemplate.New("").Funcs(funcs.TemplateFuncs).ParseFS(assets.EmbeddedFiles, templates...)
+	var opts []mail.MsgOption
+	if m.DKIM != nil {
+		opts = append(opts, mail.WithMiddleware(m.DKIM))
+	}
+	msg, err := newMsg(m.from, &message, content, opts...)
 	if err != nil {
 		return err
 	}
 
-	subject := new(bytes.Buffer)
-	err = ts.ExecuteTemplate(subject, "subject", data)
+	// Sends aren't retried here. The send_email jobs are retried with the job queue
+	// backoff, which doesn't hold a worker or the shutdown drain while it waits.
+	return m.client.DialAndSendWithContext(ctx, msg)
+}
+
+// newMsg creates a mail message of a rendered email
+func newMsg(from string, message *Message, content *Content, opts ...mail.MsgOption) (*mail.Msg, error) {
+	// Initialize a new mail message
+	msg := mail.NewMsg(opts...)
+
+	err := msg.From(from)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	msg.Subject(subject.String())
+	if len(message.To) > 0 {
+		err = msg.To(message.To...)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	plainBody := new(bytes.Buffer)
-	err = ts.ExecuteTemplate(plainBody, "plainBody", data)
-	if err != nil {
-		return err
+	if len(message.Cc) > 0 {
+		err = msg.Cc(message.Cc...)
+		if err != nil {
+			return nil, err
+		}
 	}
-	msg.SetBodyString(mail.TypeTextPlain, plainBody.String())
 
-	if ts.Lookup("htmlBody") != nil {
-		ts, err := htmlTemplate.New("").Funcs(funcs.TemplateFuncs).ParseFS(assets.EmbeddedFiles, templates...)
+	// go-mail leaves Bcc out of the written message, and sends to it over SMTP
+	if len(message.Bcc) > 0 {
+		err = msg.Bcc(message.Bcc...)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
 
-		htmlBody := new(bytes.Buffer)
-		err = ts.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if len(message.ReplyTo) > 0 {
+		err = msg.ReplyTo(message.ReplyTo)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
 
-		msg.AddAlternativeString(mail.TypeTextHTML, htmlBody.String())
+	for name, value := range message.Headers {
+		msg.SetGenHeader(mail.Header(name), value)
 	}
 
-	// Retry up to 3 times
-	for i := 1; i <= 3; i++ {
-		err = m.client.DialAndSend(msg)
+	content.apply(msg)
 
-		if nil == err {
-			return nil
+	for _, a := range message.Attachments {
+		contentType := mail.WithFileContentType(mail.ContentType(a.contentType()))
+		if a.Inline() {
+			// go-mail sets the Content-ID header as is, and it needs angle brackets
+			err = msg.EmbedReader(a.Filename, bytes.NewReader(a.Data), contentType, mail.WithFileContentID("<"+a.ContentID+">"))
+		} else {
+			err = msg.AttachReader(a.Filename, bytes.NewReader(a.Data), contentType)
 		}
-
-		if i != 3 {
-			time.Sleep(2 * time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach %s: %w", a.Filename, err)
 		}
 	}
 
-	return err
+	return msg, nil
 }
 
-// SendWithAttachment is an enhanced version of the Send method that adds an attachment
-func (m *Mailer) SendWithAttachment(
-	recipient, replyTo string,
-	data any,
-	attachment Attachment,
-	templates ...string,
-) error {
-	// Create a slice from the patterns argument
-	for i := range templates {
-		templates[i] = "emails/" + templates[i]
-	}
+// Content is a rendered email.
+type Content struct {
+	Subject   string
+	PlainBody string
+	// HTMLBody is empty for templates without an "htmlBody" template
+	HTMLBody string
+}
 
-	// Initialize a new mail message
-	msg := mail.NewMsg()
+// ErrNoBody is returned by Render for email templates without a "plainBody" or an
+// "htmlBody" template.
+var ErrNoBody = errors.New(`email: template has no "plainBody" or "htmlBody"`)
 
-	err := msg.To(recipient)
-	if err != nil {
-		return err
-	}
+// Render executes the "subject", "plainBody", and "htmlBody" templates of the email
+// templates with data, without sending anything. Templates need a plainBody, an
+// htmlBody, or both. Without a plainBody, the plain body is converted from the HTML.
+func Render(data any, templates ...string) (*Content, error) {
+	return RenderFS(assets.EmbeddedFiles, data, templates...)
+}
 
-	if len(replyTo) > 0 {
-		err = msg.ReplyTo(replyTo)
-		if err != nil {
-			return err
-		}
+// RenderFS is Render with the templates in the emails folder of fsys, like
+// os.DirFS("assets") to preview template edits without rebuilding.
+func RenderFS(fsys fs.FS, data any, templates ...string) (*Content, error) {
+	patterns := make([]string, len(templates))
+	for i := range templates {
+		patterns[i] = "emails/" + templates[i]
 	}
+	// Emails don't load stylesheets or scripts, so they don't need integrity attributes
+	templateFuncs := funcs.New(clock.System, false)
 
-	err = msg.From(m.from)
+	ts, err := textTemplate.New("").Funcs(templateFuncs).ParseFS(fsys, patterns...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	ts, err := textTemplate.New("").Funcs(funcs.TemplateFuncs).ParseFS(assets.EmbeddedFiles, templates...)
-	if err != nil {
-		return err
+	if ts.Lookup("plainBody") == nil && ts.Lookup("htmlBody") == nil {
+		return nil, ErrNoBody
 	}
 
 	subject := new(bytes.Buffer)
 	if err := ts.ExecuteTemplate(subject, "subject", data); err != nil {
-		return err
+		return nil, err
 	}
-	msg.Subject(subject.String())
 
-	plainBody := new(bytes.Buffer)
-	if err := ts.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
-		return err
+	content := &Content{Subject: subject.String()}
+
+	if ts.Lookup("plainBody") != nil {
+		plainBody := new(bytes.Buffer)
+		if err := ts.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+			return nil, err
+		}
+		content.PlainBody = plainBody.String()
 	}
-	msg.SetBodyString(mail.TypeTextPlain, plainBody.String())
 
 	if ts.Lookup("htmlBody") != nil {
-		ts, err := htmlTemplate.New("").Funcs(funcs.TemplateFuncs).ParseFS(assets.EmbeddedFiles, templates...)
+		ts, err := htmlTemplate.New("").Funcs(templateFuncs).ParseFS(fsys, patterns...)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		htmlBody := new(bytes.Buffer)
 		if err := ts.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
-			return err
+			return nil, err
 		}
-
-		msg.AddAlternativeString(mail.TypeTextHTML, htmlBody.String())
+		content.HTMLBody = htmlBody.String()
 	}
 
-	// Add the CSV as an attachment
-	err = msg.AttachReader(attachment.Filename, bytes.NewReader(attachment.Data))
-	if err != nil {
-		return fmt.Errorf("failed to attach CSV: %w", err)
+	// Templates with only an HTML body get a plain body converted from it
+	if ts.Lookup("plainBody") == nil {
+		content.PlainBody = htmlToText(content.HTMLBody)
 	}
 
-	// Retry up to 3 times
-	for i := 1; i <= 3; i++ {
-		err = m.client.DialAndSend(msg)
-
-		if nil == err {
-			return nil
-		}
+	return content, nil
+}
 
-		if i != 3 {
-			time.Sleep(2 * time.Second)
-		}
+// apply sets the subject and bodies of msg
+func (m *Content) apply(msg *mail.Msg) {
+	msg.Subject(m.Subject)
+	msg.SetBodyString(mail.TypeTextPlain, m.PlainBody)
+	if m.HTMLBody != "" {
+		msg.AddAlternativeString(mail.TypeTextHTML, m.HTMLBody)
 	}
-
-	return err
 }
 
 //=============================================================================
@@ -233,21 +304,18 @@ func NewLogMailer(l *slog.Logger) *LogMailer {
 	}
 }
 
-// Send method takes the recipient email, template file name, and any dynamic data for the templates
-// as an any parameter.
-func (m *LogMailer) Send(recipient string, replyTo string, data any, templates ...string) error {
-	m.log.Info("send email", "recipient", recipient, "replyTo", replyTo, "templates", templates, "data", data)
-	return nil
-}
-
-// SendWithAttachment is a version of the Send() method that supports attachments
-func (m *LogMailer) SendWithAttachment(
-	recipient, replyTo string,
-	data any,
-	attachment Attachment,
-	templates ...string,
-) error {
-	m.log.Info("send email with attachment", "recipient", recipient, "replyTo", replyTo, "templates", templates, "attachment", attachment.Filename, "data", data)
+// Send logs a message instead of sending it.
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	if err := message.validate(); err != nil {
+		return err
+	}
 
+	filenames := make([]string, len(message.Attachments))
+	for i, a := range message.Attachments {
+		filenames[i] = a.Filename
+	}
+	m.log.Info("send email",
+		"to", message.To, "cc", message.Cc, "bcc", message.Bcc, "replyTo", message.ReplyTo,
+		"templates", message.Templates, "attachments", filenames, "data", message.Data)
 	return nil
 }
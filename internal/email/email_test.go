@@ -2,8 +2,11 @@ package email
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"log/slog"
 	"testing"
+	"testing/fstest"
 
 	"github.com/sglmr/gowebstart/internal/assert"
 )
@@ -27,7 +30,14 @@ func TestLogMailer_Send(t *testing.T) {
 	patterns := []string{"welcome.tmpl", "notification.tmpl"}
 
 	// Call the Send method
-	err := logMailer.Send(recipient, replyTo, testData, patterns...)
+	err := logMailer.Send(context.Background(), Message{
+		To:          []string{recipient},
+		Cc:          []string{"cc@example.com"},
+		ReplyTo:     replyTo,
+		Data:        testData,
+		Templates:   patterns,
+		Attachments: []Attachment{{Filename: "notes.csv"}},
+	})
 
 	// Assert no error was returned
 	assert.NoError(t, err)
@@ -35,13 +45,29 @@ func TestLogMailer_Send(t *testing.T) {
 	// Assert the log StringIn the expected information
 	logOutput := logBuffer.String()
 	assert.StringIn(t, "send email", logOutput)
-	assert.StringIn(t, "recipient=test@example.com", logOutput)
+	assert.StringIn(t, "to=[test@example.com]", logOutput)
+	assert.StringIn(t, "cc=[cc@example.com]", logOutput)
 	assert.StringIn(t, "name", logOutput)
 	assert.StringIn(t, "Test User", logOutput)
 	assert.StringIn(t, "message", logOutput)
 	assert.StringIn(t, "Hello World", logOutput)
 	assert.StringIn(t, "welcome.tmpl", logOutput)
 	assert.StringIn(t, "notification.tmpl", logOutput)
+	assert.StringIn(t, "notes.csv", logOutput)
+}
+
+func TestSendWithoutRecipients(t *testing.T) {
+	t.Parallel()
+
+	logMailer := NewLogMailer(slog.New(slog.DiscardHandler))
+	err := logMailer.Send(context.Background(), Message{ReplyTo: "reply@example.com", Templates: []string{"example.tmpl"}})
+	if !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("Send() error = %v, want %v", err, ErrNoRecipients)
+	}
+
+	// A Bcc recipient is enough
+	err = logMailer.Send(context.Background(), Message{Bcc: []string{"audit@example.com"}, Templates: []string{"example.tmpl"}})
+	assert.NoError(t, err)
 }
 
 // TestLogMailerImplementsInterface ensures that LogMailer correctly implements MailerInterface
@@ -56,3 +82,75 @@ func TestMailerImplementsInterface(t *testing.T) {
 	t.Parallel()
 	var _ MailerInterface = (*Mailer)(nil)
 }
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	message, err := Render(map[string]string{
+		"Title": "Export ready",
+		"Body":  "Your <notes> export is ready.",
+	}, "notification.tmpl")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Export ready", message.Subject)
+	assert.MatchesGolden(t, message.PlainBody, "testdata/notification.txt.golden")
+	assert.MatchesGolden(t, message.HTMLBody, "testdata/notification.html.golden")
+
+	// Templates without an htmlBody are plain text only
+	message, err = Render(map[string]string{"BaseURL": "https://example.com"}, "error-notification.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "", message.HTMLBody)
+}
+
+func TestRenderFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"emails/draft.tmpl": {Data: []byte(`{{define "subject"}}Hi {{.Name}}{{end}}{{define "plainBody"}}Draft{{end}}`)},
+	}
+	message, err := RenderFS(fsys, map[string]string{"Name": "Ana"}, "draft.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi Ana", message.Subject)
+	assert.Equal(t, "Draft", message.PlainBody)
+
+	// Only the templates of fsys are used
+	_, err = RenderFS(fsys, nil, "notification.tmpl")
+	if err == nil {
+		t.Fatal("expected an error for a template that isn't in fsys")
+	}
+}
+
+func TestRenderHTMLOnly(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"emails/html.tmpl":  {Data: []byte(`{{define "subject"}}Welcome{{end}}{{define "htmlBody"}}<p>Hi {{.Name}},</p><p><a href="{{.URL}}">Get started</a></p>{{end}}`)},
+		"emails/empty.tmpl": {Data: []byte(`{{define "subject"}}Empty{{end}}`)},
+	}
+
+	// The plain body is converted from the HTML body
+	message, err := RenderFS(fsys, map[string]string{"Name": "Ana & Bo", "URL": "https://example.com/start"}, "html.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Hi Ana &amp; Bo,</p><p><a href=\"https://example.com/start\">Get started</a></p>", message.HTMLBody)
+	assert.Equal(t, "Hi Ana & Bo,\n\nGet started (https://example.com/start)\n", message.PlainBody)
+
+	// Templates need a body
+	_, err = RenderFS(fsys, nil, "empty.tmpl")
+	assert.Equal(t, ErrNoBody, err)
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		attachment Attachment
+		want       string
+	}{
+		{Attachment{Filename: "notes.csv"}, "text/csv; charset=utf-8"},
+		{Attachment{Filename: "logo", Data: []byte("\x89PNG\r\n\x1a\n")}, "image/png"},
+		{Attachment{Filename: "notes.csv", ContentType: "text/plain"}, "text/plain"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.attachment.contentType())
+	}
+}
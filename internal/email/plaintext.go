@@ -0,0 +1,251 @@
+package email
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//=============================================================================
+//	HTML to plain text
+//=============================================================================
+
+// textSkipElements are the HTML elements without text for the reader
+var textSkipElements = map[string]bool{
+	"head": true, "title": true, "style": true, "script": true, "template": true, "noscript": true,
+}
+
+// textParagraphElements are the HTML elements with a blank line before and after them
+var textParagraphElements = map[string]bool{
+	"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "table": true, "blockquote": true, "pre": true, "hr": true,
+}
+
+// textLineElements are the HTML elements that start and end a line
+var textLineElements = map[string]bool{
+	"div": true, "section": true, "article": true, "header": true, "footer": true, "main": true,
+	"nav": true, "aside": true, "address": true, "figure": true, "form": true, "tr": true,
+	"li": true, "dl": true, "dt": true, "dd": true,
+}
+
+// htmlToText converts the HTML body of an email to a plain text body. Whitespace is
+// collapsed like a browser does, blocks like paragraphs are separated by blank lines,
+// list items start with "- " or their number, and links are followed by their URL in
+// parentheses. Malformed HTML is converted as far as it can be read.
+func htmlToText(body string) string {
+	d := xml.NewDecoder(strings.NewReader(body))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var w textWriter
+	var skip, pre int
+	var lists []int // Next number of every open list, or 0 for bullets
+	type link struct {
+		href  string
+		start int
+	}
+	var links []link
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(tok.Name.Local)
+			if skip > 0 || textSkipElements[name] {
+				skip++
+				continue
+			}
+
+			switch {
+			case textParagraphElements[name]:
+				w.blankLine()
+			case textLineElements[name]:
+				w.newline()
+			}
+
+			switch name {
+			case "pre":
+				pre++
+			case "ul":
+				lists = append(lists, 0)
+			case "ol":
+				lists = append(lists, 1)
+			case "li":
+				w.bullet(lists)
+			case "br":
+				w.lineBreak()
+			case "td", "th":
+				w.space = true
+			case "hr":
+				w.write("---")
+			case "img":
+				if alt := textAttr(tok, "alt"); alt != "" {
+					w.text(alt)
+				}
+			case "a":
+				links = append(links, link{href: textAttr(tok, "href"), start: w.b.Len()})
+			}
+
+		case xml.EndElement:
+			name := strings.ToLower(tok.Name.Local)
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			switch name {
+			case "pre":
+				pre = max(pre-1, 0)
+			case "ul", "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			case "a":
+				if len(links) == 0 {
+					break
+				}
+				l := links[len(links)-1]
+				links = links[:len(links)-1]
+				w.link(l.href, l.start)
+			}
+
+			switch {
+			case textParagraphElements[name]:
+				w.blankLine()
+			case textLineElements[name]:
+				w.newline()
+			}
+
+		case xml.CharData:
+			switch {
+			case skip > 0:
+			case pre > 0:
+				w.write(string(tok))
+			default:
+				w.text(string(tok))
+			}
+		}
+	}
+
+	return w.String()
+}
+
+// textAttr returns the value of an attribute of an HTML element
+func textAttr(el xml.StartElement, name string) string {
+	for _, attr := range el.Attr {
+		if strings.EqualFold(attr.Name.Local, name) {
+			return strings.TrimSpace(attr.Value)
+		}
+	}
+	return ""
+}
+
+// textWriter writes the plain text of an HTML document
+type textWriter struct {
+	b strings.Builder
+	// space is true when a space is due before the next word on the line
+	space bool
+}
+
+// text writes text with its whitespace collapsed to single spaces
+func (w *textWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	if first, _ := utf8.DecodeRuneInString(s); unicode.IsSpace(first) {
+		w.space = true
+	}
+	for word := range strings.FieldsSeq(s) {
+		w.writeSpace()
+		w.b.WriteString(word)
+		w.space = true
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	w.space = unicode.IsSpace(last)
+}
+
+// write writes text as it is, like the text of a <pre> element
+func (w *textWriter) write(s string) {
+	w.writeSpace()
+	w.b.WriteString(s)
+	w.space = false
+}
+
+// writeSpace writes the space that's due before the next word, unless the line is
+// empty or already ends with a space
+func (w *textWriter) writeSpace() {
+	if w.space && !w.lineStart() && !strings.HasSuffix(w.b.String(), " ") {
+		w.b.WriteByte(' ')
+	}
+}
+
+// newline ends the current line, unless it's empty
+func (w *textWriter) newline() {
+	w.space = false
+	if !w.lineStart() {
+		w.b.WriteByte('\n')
+	}
+}
+
+// lineBreak ends the current line, even when it's empty
+func (w *textWriter) lineBreak() {
+	w.space = false
+	w.b.WriteByte('\n')
+}
+
+// blankLine ends the current line and adds a blank line, unless there is one
+func (w *textWriter) blankLine() {
+	w.newline()
+	if s := w.b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		w.b.WriteByte('\n')
+	}
+}
+
+// bullet starts a list item of the innermost list
+func (w *textWriter) bullet(lists []int) {
+	if len(lists) == 0 || lists[len(lists)-1] == 0 {
+		w.write("- ")
+		return
+	}
+	w.write(strconv.Itoa(lists[len(lists)-1]) + ". ")
+	lists[len(lists)-1]++
+}
+
+// link writes the URL of a link after its text, which starts at start, unless the text
+// is the URL already
+func (w *textWriter) link(href string, start int) {
+	if href == "" || strings.HasPrefix(href, "#") {
+		return
+	}
+	text := strings.TrimSpace(w.b.String()[start:])
+	if text == href || "mailto:"+text == href {
+		return
+	}
+	w.space = text != ""
+	w.write("(" + href + ")")
+}
+
+// lineStart returns whether nothing was written on the current line yet
+func (w *textWriter) lineStart() bool {
+	s := w.b.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// String returns the text without whitespace at the end of lines and at the end
+func (w *textWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	text := strings.TrimSpace(strings.Join(lines, "\n"))
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
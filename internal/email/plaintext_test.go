@@ -0,0 +1,40 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestHTMLToText(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"empty", "", ""},
+		{"text", "Hello,   <b>Person</b>!", "Hello, Person!\n"},
+		{"paragraphs", "<p>One\n  two</p><p>Three</p>", "One two\n\nThree\n"},
+		{"line breaks", "Line one<br>Line two<br/><br>Line four", "Line one\nLine two\n\nLine four\n"},
+		{"entities", "<p>Fish &amp; chips &lt;3&nbsp;you</p>", "Fish & chips <3 you\n"},
+		{"head and style", "<html><head><title>Title</title><style>p { color: red; }</style></head><body><p>Body</p></body></html>", "Body\n"},
+		{"link", `<p>Open <a href="https://example.com/reset">this link</a>.</p>`, "Open this link (https://example.com/reset).\n"},
+		{"link with its URL", `<a href="https://example.com">https://example.com</a>`, "https://example.com\n"},
+		{"mailto link", `<a href="mailto:ana@example.com">ana@example.com</a>`, "ana@example.com\n"},
+		{"anchor link", `<a href="#top">Top</a>`, "Top\n"},
+		{"image link", `<a href="https://example.com"><img src="logo.png" alt="Logo"></a>`, "Logo (https://example.com)\n"},
+		{"bullets", "<p>Items:</p><ul><li>Milk</li><li> Eggs </li></ul><p>Done</p>", "Items:\n\n- Milk\n- Eggs\n\nDone\n"},
+		{"numbers", "<ol><li>First<li>Second</ol>", "1. First\n2. Second\n"},
+		{"table", "<table><tr><th>Name</th><th>Qty</th></tr><tr><td>Milk</td><td>2</td></tr></table>", "Name Qty\nMilk 2\n"},
+		{"pre", "<pre>a  b\n  c</pre>", "a  b\n  c\n"},
+		{"heading", "<h1>Title</h1>Text", "Title\n\nText\n"},
+		{"unclosed tags", "<p>One<p>Two <b>bold", "One\n\nTwo bold\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, htmlToText(tt.html))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned by Queue.Send when the queue has no room for another email.
+	ErrQueueFull = errors.New("email: queue is full")
+
+	// ErrQueueClosed is returned by Queue.Send after the Queue has started shutting down.
+	ErrQueueClosed = errors.New("email: queue is shut down")
+)
+
+// QueueConfig are the workers, size, and retries of a Queue.
+type QueueConfig struct {
+	// Workers is the number of emails sent at once, at least 1.
+	Workers int
+	// Size is the number of emails that can wait for a worker.
+	Size int
+	// MaxAttempts is the number of times an email is sent before it's dropped, at least 1.
+	MaxAttempts int
+	// Backoff returns the wait before the next attempt after an email failed attempt
+	// times. No wait when nil.
+	Backoff func(attempt int) time.Duration
+	// Timeout limits each attempt by cancelling the context of the send. No limit when 0.
+	Timeout time.Duration
+}
+
+// queuedMessage is an email in a Queue with its retry state
+type queuedMessage struct {
+	msg       Message
+	attempts  int
+	lastError error
+}
+
+// Queue sends emails in the background with a mailer, on a fixed number of workers
+// taking emails from a bounded queue. Failed emails are retried with a backoff until
+// they run out of attempts. Shutdown sends the queued emails before it returns.
+//
+// Emails in a Queue are lost when the application stops, so it's meant for apps without
+// a database. The jobs package saves emails in the database before they're sent.
+type Queue struct {
+	mailer   MailerInterface
+	logger   *slog.Logger
+	cfg      QueueConfig
+	messages chan *queuedMessage
+	wg       sync.WaitGroup
+
+	// ctx is cancelled when the shutdown deadline passes
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue creates a Queue that sends emails with mailer, and starts its workers.
+func NewQueue(mailer MailerInterface, logger *slog.Logger, cfg QueueConfig) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cfg.Workers = max(cfg.Workers, 1)
+	cfg.MaxAttempts = max(cfg.MaxAttempts, 1)
+	q := &Queue{
+		mailer:   mailer,
+		logger:   logger,
+		cfg:      cfg,
+		messages: make(chan *queuedMessage, max(cfg.Size, 0)),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	for range cfg.Workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Send queues an email to send in the background, so it implements MailerInterface.
+// It returns ErrNoRecipients right away for an email without recipients, ErrQueueFull
+// when every worker is busy and the queue is full, or ErrQueueClosed after Shutdown.
+// The email is sent after ctx is done, like after the request that queued it.
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.messages <- &queuedMessage{msg: msg}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting new emails and waits for the queued emails to be sent,
+// including their retries. When ctx is done first, the context of the sends is
+// cancelled, the emails that weren't sent are dropped, and Shutdown returns the ctx error.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+// work sends emails from the queue until it's closed and empty
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for m := range q.messages {
+		if err := q.sendWithRetries(m); err != nil {
+			q.logger.Error("email dropped", "to", m.msg.To, "templates", m.msg.Templates, "attempts", m.attempts, "error", err)
+		}
+	}
+}
+
+// sendWithRetries sends an email until it succeeds or runs out of attempts
+func (q *Queue) sendWithRetries(m *queuedMessage) error {
+	for {
+		m.attempts++
+		m.lastError = q.sendOnce(m.msg)
+		if m.lastError == nil || m.attempts >= q.cfg.MaxAttempts {
+			return m.lastError
+		}
+
+		var backoff time.Duration
+		if q.cfg.Backoff != nil {
+			backoff = q.cfg.Backoff(m.attempts)
+		}
+		q.logger.Warn("email retry", "to", m.msg.To, "attempt", m.attempts, "backoff", backoff, "error", m.lastError)
+
+		// Wait before the next attempt unless the shutdown deadline passes
+		select {
+		case <-time.After(backoff):
+		case <-q.ctx.Done():
+			return fmt.Errorf("%w (retry cancelled: %w)", m.lastError, q.ctx.Err())
+		}
+	}
+}
+
+// sendOnce makes a single attempt to send an email, recovering any panic of the mailer
+func (q *Queue) sendOnce(msg Message) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+
+	ctx := q.ctx
+	if q.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.cfg.Timeout)
+		defer cancel()
+	}
+	return q.mailer.Send(ctx, msg)
+}
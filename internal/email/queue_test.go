@@ -0,0 +1,130 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+// funcMailer is a mailer that sends emails with a function
+type funcMailer func(ctx context.Context, msg Message) error
+
+func (f funcMailer) Send(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+func newTestQueue(mailer MailerInterface, cfg QueueConfig) *Queue {
+	return NewQueue(mailer, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+}
+
+func TestQueueImplementsInterface(t *testing.T) {
+	var _ MailerInterface = (*Queue)(nil)
+}
+
+func TestQueueRetries(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	mailer := funcMailer(func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[msg.To[0]]++
+		switch {
+		case msg.To[0] == "flaky@example.com" && attempts[msg.To[0]] < 3:
+			return errors.New("try again")
+		case msg.To[0] == "broken@example.com":
+			return errors.New("still broken")
+		}
+		return nil
+	})
+
+	q := newTestQueue(mailer, QueueConfig{
+		Workers:     2,
+		Size:        10,
+		MaxAttempts: 3,
+		Backoff:     func(int) time.Duration { return time.Millisecond },
+	})
+	assert.NoError(t, q.Send(context.Background(), Message{To: []string{"flaky@example.com"}}))
+	assert.NoError(t, q.Send(context.Background(), Message{To: []string{"broken@example.com"}}))
+
+	// Emails without recipients aren't queued
+	assert.Equal(t, ErrNoRecipients, q.Send(context.Background(), Message{}))
+
+	// Shutdown waits for the retries
+	assert.NoError(t, q.Shutdown(context.Background()))
+	assert.Equal(t, 3, attempts["flaky@example.com"])
+	assert.Equal(t, 3, attempts["broken@example.com"])
+
+	// No emails are accepted after shutdown
+	assert.Equal(t, ErrQueueClosed, q.Send(context.Background(), Message{To: []string{"late@example.com"}}))
+}
+
+func TestQueueFull(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mailer := funcMailer(func(ctx context.Context, msg Message) error {
+		if msg.To[0] == "first@example.com" {
+			close(started)
+		}
+		<-release
+		return nil
+	})
+
+	q := newTestQueue(mailer, QueueConfig{Workers: 1, Size: 1})
+	msg := func(to string) Message { return Message{To: []string{to}} }
+
+	// One email is being sent and one waits, so there's no room for a third
+	assert.NoError(t, q.Send(context.Background(), msg("first@example.com")))
+	<-started
+	assert.NoError(t, q.Send(context.Background(), msg("second@example.com")))
+	assert.Equal(t, ErrQueueFull, q.Send(context.Background(), msg("third@example.com")))
+
+	close(release)
+	assert.NoError(t, q.Shutdown(context.Background()))
+}
+
+func TestQueueShutdownDeadline(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	mailer := funcMailer(func(ctx context.Context, msg Message) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	q := newTestQueue(mailer, QueueConfig{Workers: 1, Size: 1, MaxAttempts: 5})
+	assert.NoError(t, q.Send(context.Background(), Message{To: []string{"slow@example.com"}}))
+	<-started
+
+	// Shutdown gives up when its context is done and cancels the send
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.Shutdown(ctx))
+}
+
+func TestQueueTimeout(t *testing.T) {
+	t.Parallel()
+
+	errs := make(chan error, 1)
+	mailer := funcMailer(func(ctx context.Context, msg Message) error {
+		<-ctx.Done()
+		errs <- ctx.Err()
+		return ctx.Err()
+	})
+
+	// Each attempt is cancelled after the timeout
+	q := newTestQueue(mailer, QueueConfig{Workers: 1, Size: 1, Timeout: 5 * time.Millisecond})
+	assert.NoError(t, q.Send(context.Background(), Message{To: []string{"slow@example.com"}}))
+	assert.Equal(t, context.DeadlineExceeded, <-errs)
+	assert.NoError(t, q.Shutdown(context.Background()))
+}
@@ -0,0 +1,135 @@
+package email
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+//=============================================================================
+//	Amazon SES
+//=============================================================================
+
+// sesRequest creates a signed request of the SES v2 SendEmail API. The email is sent
+// as a raw MIME message, which keeps attachments and the HTML alternative. The raw
+// message has no Bcc header, so the recipients are listed in the destination.
+func (m *APIMailer) sesRequest(message *Message, content *Content) (*http.Request, error) {
+	msg, err := newMsg(m.cfg.From, message, content)
+	if err != nil {
+		return nil, err
+	}
+	raw := new(bytes.Buffer)
+	if _, err := msg.WriteTo(raw); err != nil {
+		return nil, err
+	}
+
+	// []byte fields are base64 encoded, like the API expects
+	var body struct {
+		Destination struct {
+			ToAddresses  []string `json:",omitempty"`
+			CcAddresses  []string `json:",omitempty"`
+			BccAddresses []string `json:",omitempty"`
+		}
+		Content struct {
+			Raw struct {
+				Data []byte
+			}
+		}
+	}
+	body.Destination.ToAddresses = message.To
+	body.Destination.CcAddresses = message.Cc
+	body.Destination.BccAddresses = message.Bcc
+	body.Content.Raw.Data = raw.Bytes()
+	js, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.baseURL+"/v2/email/outbound-emails", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signV4(req, js, m.cfg.KeyID, m.cfg.APIKey, m.cfg.Region, "ses", m.Clock.Now())
+	return req, nil
+}
+
+// signV4 adds the AWS Signature Version 4 Authorization header to a request with a
+// body. It signs the host, content-type, and x-amz-* headers.
+//
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+func signV4(req *http.Request, body []byte, keyID, secret, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// Canonical headers are lowercase, sorted, and trimmed
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+keyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// sha256Hex returns the hex encoded SHA-256 hash of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,117 @@
+// Package fingerprint maps static file paths to content hashed file names, like
+// "static/css/main.css" to "static/css/main.1a2b3c4d.css", so that the files can
+// be cached forever and still change when their contents change.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// hashLength is the number of hex characters of the content hash in a file name
+const hashLength = 8
+
+// integrityExts are the file extensions that get Subresource Integrity hashes
+var integrityExts = map[string]bool{".css": true, ".js": true}
+
+// Manifest maps logical file paths to fingerprinted file paths and back.
+type Manifest struct {
+	hashed    map[string]string // logical path -> hashed path
+	logical   map[string]string // hashed path -> logical path
+	integrity map[string]string // logical path -> Subresource Integrity hash
+	etags     map[string]string // logical path -> ETag
+}
+
+// New walks the dir directory in fsys and builds a Manifest for every file in it.
+func New(fsys fs.FS, dir string) (*Manifest, error) {
+	m := &Manifest{
+		hashed:    map[string]string{},
+		logical:   map[string]string{},
+		integrity: map[string]string{},
+		etags:     map[string]string{},
+	}
+
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		hashedName := hashedPath(name, hex.EncodeToString(sum[:])[:hashLength])
+
+		m.hashed[name] = hashedName
+		m.logical[hashedName] = name
+		m.etags[name] = `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		if integrityExts[path.Ext(name)] {
+			sri := sha512.Sum384(data)
+			m.integrity[name] = "sha384-" + base64.StdEncoding.EncodeToString(sri[:])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// hashedPath inserts the hash before the file extension.
+func hashedPath(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// Path returns the fingerprinted version of a logical path, like "/static/css/main.css"
+// to "/static/css/main.1a2b3c4d.css". Paths that aren't in the manifest are returned as is.
+func (m *Manifest) Path(logicalPath string) string {
+	name, hasSlash := strings.CutPrefix(logicalPath, "/")
+
+	hashedName, ok := m.hashed[name]
+	if !ok {
+		return logicalPath
+	}
+
+	if hasSlash {
+		return "/" + hashedName
+	}
+	return hashedName
+}
+
+// Resolve returns the logical path for a fingerprinted path. The boolean is false
+// when the path isn't a fingerprinted path from the manifest.
+func (m *Manifest) Resolve(hashedPath string) (string, bool) {
+	name, hasSlash := strings.CutPrefix(hashedPath, "/")
+
+	logicalName, ok := m.logical[name]
+	if !ok {
+		return hashedPath, false
+	}
+
+	if hasSlash {
+		return "/" + logicalName, true
+	}
+	return logicalName, true
+}
+
+// ETag returns the strong ETag of a file from its content hash, like `"1a2b..."`. It
+// returns an empty string for paths that aren't in the manifest.
+func (m *Manifest) ETag(logicalPath string) string {
+	return m.etags[strings.TrimPrefix(logicalPath, "/")]
+}
+
+// Integrity returns the Subresource Integrity hash, like "sha384-...", for a CSS or JS
+// file. It returns an empty string for other files and paths that aren't in the manifest.
+func (m *Manifest) Integrity(logicalPath string) string {
+	return m.integrity[strings.TrimPrefix(logicalPath, "/")]
+}
@@ -0,0 +1,79 @@
+package fingerprint
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestManifest(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"static/css/main.css":         {Data: []byte("body{}")},
+		"static/images/favicon.ico":   {Data: []byte("icon")},
+		"templates/ignored/base.tmpl": {Data: []byte("base")},
+	}
+
+	m, err := New(fsys, "static")
+	assert.NoError(t, err)
+
+	// sha256("body{}") starts with 7c98040a
+	hashed := m.Path("/static/css/main.css")
+	assert.Equal(t, "/static/css/main.7c98040a.css", hashed)
+	assert.Equal(t, "static/css/main.7c98040a.css", m.Path("static/css/main.css"))
+
+	// Resolve maps the fingerprinted path back to the file
+	logical, ok := m.Resolve(hashed)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "/static/css/main.css", logical)
+
+	// Unknown paths are passed through
+	assert.Equal(t, "/static/js/missing.js", m.Path("/static/js/missing.js"))
+	assert.Equal(t, "/templates/ignored/base.tmpl", m.Path("/templates/ignored/base.tmpl"))
+	_, ok = m.Resolve("/static/css/main.css")
+	assert.Equal(t, false, ok)
+	_, ok = m.Resolve("/static/css/main.00000000.css")
+	assert.Equal(t, false, ok)
+}
+
+func TestManifestIntegrity(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"static/css/main.css":       {Data: []byte("body{}")},
+		"static/js/app.js":          {Data: []byte("alert(1)")},
+		"static/images/favicon.ico": {Data: []byte("icon")},
+	}
+
+	m, err := New(fsys, "static")
+	assert.NoError(t, err)
+
+	// echo -n 'body{}' | openssl dgst -sha384 -binary | openssl base64 -A
+	assert.Equal(t, "sha384-myyg/hQ74aSgjBBvVME/QXAXEkT4Y9dHbVQ5C0lIyGpldvNLJV2IWc5ElXbqLi06", m.Integrity("/static/css/main.css"))
+	assert.Equal(t, m.Integrity("/static/css/main.css"), m.Integrity("static/css/main.css"))
+	assert.StringIn(t, "sha384-", m.Integrity("/static/js/app.js"))
+
+	// Only CSS and JS files get a hash
+	assert.Equal(t, "", m.Integrity("/static/images/favicon.ico"))
+	assert.Equal(t, "", m.Integrity("/static/js/missing.js"))
+}
+
+func TestManifestETag(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"static/css/main.css":       {Data: []byte("body{}")},
+		"static/images/favicon.ico": {Data: []byte("icon")},
+	}
+
+	m, err := New(fsys, "static")
+	assert.NoError(t, err)
+
+	// The first 16 bytes of sha256("body{}")
+	assert.Equal(t, `"7c98040a541657584690ae2a1cc3b42a"`, m.ETag("/static/css/main.css"))
+	assert.Equal(t, m.ETag("/static/css/main.css"), m.ETag("static/css/main.css"))
+	assert.NotEqual(t, m.ETag("/static/css/main.css"), m.ETag("/static/images/favicon.ico"))
+	assert.Equal(t, "", m.ETag("/static/js/missing.js"))
+}
@@ -10,42 +10,66 @@ import (
 	"time"
 	"unicode"
 
+	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/i18n"
+	"github.com/sglmr/gowebstart/internal/pagination"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
 var printer = message.NewPrinter(language.English)
 
-var TemplateFuncs = template.FuncMap{
-	// Time functions
-	"now":        time.Now,
-	"timeSince":  time.Since,
-	"timeUntil":  time.Until,
-	"formatTime": formatTime,
-
-	// String functions
-	"uppercase":      strings.ToUpper,
-	"lowercase":      strings.ToLower,
-	"slugify":        slugify,
-	"safeHTML":       safeHTML,
-	"stringContains": strings.Contains,
-
-	// Slice functions
-	"join": strings.Join,
-
-	// Number functions
-	"formatInt":   formatInt,
-	"formatFloat": formatFloat,
-
-	// Boolean functions
-	"yesno": yesno,
-
-	// URL functions
-	"urlSetParam": urlSetParam,
-	"urlDelParam": urlDelParam,
+// New returns the template functions. The now, timeSince, and timeUntil functions tell
+// the time with clk, like a clock.Fake in tests. Without sri, sriAttr outputs nothing,
+// for dev mode, where static files are served from disk and can change after the hashes
+// were computed from the embedded files.
+func New(clk clock.Clock, sri bool) template.FuncMap {
+	sriAttrFunc := sriAttr
+	if !sri {
+		sriAttrFunc = func(string) template.HTMLAttr { return "" }
+	}
 
-	// generic functions
+	return template.FuncMap{
+		// Time functions
+		"now":        func() time.Time { return clk.Now() },
+		"timeSince":  func(t time.Time) time.Duration { return clk.Now().Sub(t) },
+		"timeUntil":  func(t time.Time) time.Duration { return t.Sub(clk.Now()) },
+		"formatTime": formatTime,
+
+		// String functions
+		"uppercase":      strings.ToUpper,
+		"lowercase":      strings.ToLower,
+		"slugify":        slugify,
+		"safeHTML":       safeHTML,
+		"stringContains": strings.Contains,
+
+		// Slice functions
+		"join": strings.Join,
+
+		// Number functions
+		"formatInt":   formatInt,
+		"formatFloat": formatFloat,
+
+		// Boolean functions
+		"yesno": yesno,
+
+		// URL functions
+		"urlSetParam": urlSetParam,
+		"urlDelParam": urlDelParam,
+		"pageURL":     pageURL,
+		"prevPageURL": prevPageURL,
+		"nextPageURL": nextPageURL,
+		"asset":       asset,
+		"sriAttr":     sriAttrFunc,
+
+		// Translation functions
+		"t":          translate,
+		"localeName": i18n.DisplayName,
+
+		// generic functions
 
+	}
 }
 
 func formatTime(format string, t time.Time) string {
@@ -118,6 +142,46 @@ func urlDelParam(u *url.URL, key string) *url.URL {
 	return &nu
 }
 
+// pageURL returns u with the "page" query parameter set to page, keeping the other
+// parameters like filters, as in {{pageURL .RequestURL 3}}
+func pageURL(u *url.URL, page int) *url.URL {
+	return urlSetParam(u, "page", page)
+}
+
+// prevPageURL returns the URL of the page before the current one of p
+func prevPageURL(u *url.URL, p pagination.Pagination) *url.URL {
+	return pageURL(u, p.PrevPage())
+}
+
+// nextPageURL returns the URL of the page after the current one of p
+func nextPageURL(u *url.URL, p pagination.Pagination) *url.URL {
+	return pageURL(u, p.NextPage())
+}
+
+// asset returns the fingerprinted URL path for a static file, like
+// "/static/css/main.css" to "/static/css/main.1a2b3c4d.css".
+func asset(path string) string {
+	return assets.StaticManifest().Path(path)
+}
+
+// translate returns the translation of a message for a locale from the embedded message
+// catalogs, like {{t .Locale "Contact Us"}}. Messages with args are fmt format strings,
+// like {{t .Locale "Page %d of %d" .Page .TotalPages}}.
+func translate(locale, message string, args ...any) string {
+	return assets.Locales().Translate(locale, message, args...)
+}
+
+// sriAttr returns the integrity and crossorigin attributes for an embedded CSS or JS
+// file, like `integrity="sha384-..." crossorigin="anonymous"`. It returns nothing for
+// other files.
+func sriAttr(path string) template.HTMLAttr {
+	integrity := assets.StaticManifest().Integrity(path)
+	if integrity == "" {
+		return ""
+	}
+	return template.HTMLAttr(fmt.Sprintf(`integrity="%s" crossorigin="anonymous"`, integrity))
+}
+
 func toInt64(i any) (int64, error) {
 	switch v := i.(type) {
 	case int:
@@ -1,8 +1,15 @@
 package funcs
 
 import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/pagination"
 	"gotest.tools/assert"
 )
 
@@ -39,3 +46,73 @@ func TestSlugify(t *testing.T) {
 		})
 	}
 }
+
+func TestNewClock(t *testing.T) {
+	t.Parallel()
+
+	// The time functions tell the time with the clock of the func map
+	clk := clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	ts := template.Must(template.New("").Funcs(New(clk, true)).Parse(`{{formatTime "2006-01-02" now}} {{timeSince .}} {{timeUntil .}}`))
+
+	buf := new(bytes.Buffer)
+	err := ts.Execute(buf, clk.Now().Add(-time.Hour))
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), "2025-03-01 1h0m0s -1h0m0s")
+}
+
+func TestAsset(t *testing.T) {
+	t.Parallel()
+
+	// Embedded static files get a content hash in the file name
+	got := asset("/static/css/main.css")
+	assert.Check(t, strings.HasPrefix(got, "/static/css/main."))
+	assert.Check(t, strings.HasSuffix(got, ".css"))
+	assert.Check(t, got != "/static/css/main.css")
+
+	// Unknown files are passed through
+	assert.Equal(t, asset("/static/js/missing.js"), "/static/js/missing.js")
+}
+
+func TestSRIAttr(t *testing.T) {
+	t.Parallel()
+
+	// Embedded CSS files get an integrity attribute
+	got := string(sriAttr("/static/css/main.css"))
+	assert.Check(t, strings.HasPrefix(got, `integrity="sha384-`))
+	assert.Check(t, strings.HasSuffix(got, `" crossorigin="anonymous"`))
+
+	// Other and unknown files don't
+	assert.Equal(t, string(sriAttr("/static/images/favicon.ico")), "")
+	assert.Equal(t, string(sriAttr("/static/js/missing.js")), "")
+
+	// Nothing is added when SRI is turned off
+	noSRIAttr := New(clock.System, false)["sriAttr"].(func(string) template.HTMLAttr)
+	assert.Equal(t, string(noSRIAttr("/static/css/main.css")), "")
+}
+
+func TestTranslate(t *testing.T) {
+	t.Parallel()
+
+	// Messages are translated from the embedded catalogs
+	assert.Equal(t, translate("es", "Contact Us"), "Contáctenos")
+	assert.Equal(t, translate("es", "Page %d of %d", 1, 3), "Página 1 de 3")
+
+	// The default locale and untranslated messages keep the original text
+	assert.Equal(t, translate("en", "Contact Us"), "Contact Us")
+	assert.Equal(t, translate("es", "Not translated"), "Not translated")
+}
+
+func TestPageURL(t *testing.T) {
+	t.Parallel()
+
+	u, err := url.Parse("/notes/?q=todo&page=2")
+	assert.NilError(t, err)
+	p := pagination.New(2, 10, 50)
+
+	assert.Equal(t, "/notes/?page=5&q=todo", pageURL(u, 5).String())
+	assert.Equal(t, "/notes/?page=1&q=todo", prevPageURL(u, p).String())
+	assert.Equal(t, "/notes/?page=3&q=todo", nextPageURL(u, p).String())
+
+	// The URL of the request isn't changed
+	assert.Equal(t, "/notes/?q=todo&page=2", u.String())
+}
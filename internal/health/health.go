@@ -0,0 +1,121 @@
+// Package health runs named dependency checks for readiness probes.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// CheckFunc checks a single dependency and returns an error when it isn't available.
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of a single named check.
+type Result struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the combined outcome of all of the registered checks.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK returns true when every check in the report passed.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Checker holds the registered dependency checks.
+type Checker struct {
+	mu      sync.RWMutex
+	names   []string
+	checks  map[string]CheckFunc
+	timeout time.Duration
+}
+
+// New creates a Checker that gives each check up to timeout to finish.
+func New(timeout time.Duration) *Checker {
+	return &Checker{
+		checks:  map[string]CheckFunc{},
+		timeout: timeout,
+	}
+}
+
+// Register adds a named check. Registering a name again replaces the earlier check.
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.checks[name]; !exists {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run executes all of the registered checks concurrently and returns a report
+// with the results in registration order.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make([]Result, len(names)),
+	}
+
+	wg := sync.WaitGroup{}
+	for i := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, names[i], checks[i])
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusError
+		}
+	}
+
+	return report
+}
+
+// runCheck runs a single check, treating a panic as a failed check.
+func runCheck(ctx context.Context, name string, check CheckFunc) (result Result) {
+	start := time.Now()
+	result = Result{Name: name, Status: StatusOK}
+
+	defer func() {
+		if err := recover(); err != nil {
+			result.Status = StatusError
+			result.Error = "panic during check"
+		}
+		result.Duration = time.Since(start).Round(time.Microsecond).String()
+	}()
+
+	if err := check(ctx); err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestCheckerRun(t *testing.T) {
+	t.Parallel()
+
+	checker := New(time.Second)
+	checker.Register("db", func(ctx context.Context) error { return nil })
+	checker.Register("smtp", func(ctx context.Context) error { return errors.New("connection refused") })
+	checker.Register("panics", func(ctx context.Context) error { panic("oops") })
+
+	report := checker.Run(context.Background())
+
+	assert.Equal(t, false, report.OK())
+	assert.Equal(t, StatusError, report.Status)
+	assert.Equal(t, 3, len(report.Checks))
+
+	// Results are in registration order
+	assert.Equal(t, "db", report.Checks[0].Name)
+	assert.Equal(t, StatusOK, report.Checks[0].Status)
+	assert.Equal(t, "smtp", report.Checks[1].Name)
+	assert.Equal(t, StatusError, report.Checks[1].Status)
+	assert.Equal(t, "connection refused", report.Checks[1].Error)
+	assert.Equal(t, StatusError, report.Checks[2].Status)
+}
+
+func TestCheckerRunNoChecks(t *testing.T) {
+	t.Parallel()
+
+	report := New(time.Second).Run(context.Background())
+
+	assert.Equal(t, true, report.OK())
+	assert.Equal(t, 0, len(report.Checks))
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	t.Parallel()
+
+	checker := New(10 * time.Millisecond)
+	checker.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := checker.Run(context.Background())
+
+	assert.Equal(t, false, report.OK())
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks[0].Error)
+}
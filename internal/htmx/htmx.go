@@ -0,0 +1,123 @@
+// Package htmx reads the request headers sent by htmx and sets the response headers
+// that htmx acts on. See https://htmx.org/reference/#headers.
+package htmx
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+//=============================================================================
+//	Request headers
+//=============================================================================
+
+// IsRequest reports whether htmx made the request.
+func IsRequest(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// IsBoosted reports whether the request came from an element with hx-boost. Boosted
+// requests swap the whole body, so they should get a full page.
+func IsBoosted(r *http.Request) bool {
+	return r.Header.Get("HX-Boosted") == "true"
+}
+
+// IsHistoryRestore reports whether htmx is restoring a page missing from its history
+// cache. It needs a full page.
+func IsHistoryRestore(r *http.Request) bool {
+	return r.Header.Get("HX-History-Restore-Request") == "true"
+}
+
+// IsFragment reports whether the request only wants the part of the page it swaps,
+// rather than a full page.
+func IsFragment(r *http.Request) bool {
+	return IsRequest(r) && !IsBoosted(r) && !IsHistoryRestore(r)
+}
+
+// Target returns the id of the target element, if it has one.
+func Target(r *http.Request) string {
+	return r.Header.Get("HX-Target")
+}
+
+// TriggerID returns the id of the element that triggered the request, if it has one.
+func TriggerID(r *http.Request) string {
+	return r.Header.Get("HX-Trigger")
+}
+
+// TriggerName returns the name of the element that triggered the request, if it has one.
+func TriggerName(r *http.Request) string {
+	return r.Header.Get("HX-Trigger-Name")
+}
+
+// CurrentURL returns the URL of the browser when it made the request.
+func CurrentURL(r *http.Request) string {
+	return r.Header.Get("HX-Current-URL")
+}
+
+// Prompt returns the user's answer to an hx-prompt.
+func Prompt(r *http.Request) string {
+	return r.Header.Get("HX-Prompt")
+}
+
+//=============================================================================
+//	Response headers
+//=============================================================================
+
+// Redirect makes htmx do a full page redirect to url.
+func Redirect(w http.ResponseWriter, url string) {
+	w.Header().Set("HX-Redirect", url)
+}
+
+// Location makes htmx load url with an ajax request, without a full page reload.
+func Location(w http.ResponseWriter, url string) {
+	w.Header().Set("HX-Location", url)
+}
+
+// Refresh makes htmx reload the whole page.
+func Refresh(w http.ResponseWriter) {
+	w.Header().Set("HX-Refresh", "true")
+}
+
+// PushURL pushes url into the browser history.
+func PushURL(w http.ResponseWriter, url string) {
+	w.Header().Set("HX-Push-Url", url)
+}
+
+// ReplaceURL replaces the current url in the browser location bar.
+func ReplaceURL(w http.ResponseWriter, url string) {
+	w.Header().Set("HX-Replace-Url", url)
+}
+
+// Retarget swaps the response into the element matching a CSS selector, instead
+// of the hx-target of the request.
+func Retarget(w http.ResponseWriter, selector string) {
+	w.Header().Set("HX-Retarget", selector)
+}
+
+// Reswap changes how the response is swapped, like "outerHTML".
+func Reswap(w http.ResponseWriter, swap string) {
+	w.Header().Set("HX-Reswap", swap)
+}
+
+// Trigger triggers client side events as soon as the response arrives.
+func Trigger(w http.ResponseWriter, events ...string) {
+	w.Header().Set("HX-Trigger", strings.Join(events, ", "))
+}
+
+// TriggerDetail triggers client side events with details, like
+// {"showMessage": {"level": "info", "message": "Saved"}}.
+func TriggerDetail(w http.ResponseWriter, events map[string]any) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("HX-Trigger", string(data))
+	return nil
+}
+
+// Vary tells caches that the response depends on whether htmx made the request, so a
+// cached fragment isn't served for a full page load.
+func Vary(w http.ResponseWriter) {
+	w.Header().Add("Vary", "HX-Request")
+}
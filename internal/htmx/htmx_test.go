@@ -0,0 +1,67 @@
+package htmx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		request  bool
+		boosted  bool
+		fragment bool
+	}{
+		{"plain request", nil, false, false, false},
+		{"htmx request", map[string]string{"HX-Request": "true"}, true, false, true},
+		{"boosted", map[string]string{"HX-Request": "true", "HX-Boosted": "true"}, true, true, false},
+		{"history restore", map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"}, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.request, IsRequest(r))
+			assert.Equal(t, tt.boosted, IsBoosted(r))
+			assert.Equal(t, tt.fragment, IsFragment(r))
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("HX-Target", "list")
+	r.Header.Set("HX-Trigger", "save")
+	r.Header.Set("HX-Current-URL", "https://example.com/notes/")
+	assert.Equal(t, "list", Target(r))
+	assert.Equal(t, "save", TriggerID(r))
+	assert.Equal(t, "https://example.com/notes/", CurrentURL(r))
+}
+
+func TestResponseHeaders(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	Redirect(w, "/login/")
+	Refresh(w)
+	Retarget(w, "#errors")
+	Trigger(w, "saved", "closeModal")
+	Vary(w)
+
+	assert.Equal(t, "/login/", w.Header().Get("HX-Redirect"))
+	assert.Equal(t, "true", w.Header().Get("HX-Refresh"))
+	assert.Equal(t, "#errors", w.Header().Get("HX-Retarget"))
+	assert.Equal(t, "saved, closeModal", w.Header().Get("HX-Trigger"))
+	assert.Equal(t, "HX-Request", w.Header().Get("Vary"))
+
+	err := TriggerDetail(w, map[string]any{"showMessage": "Saved"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"showMessage":"Saved"}`, w.Header().Get("HX-Trigger"))
+}
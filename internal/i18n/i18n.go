@@ -0,0 +1,152 @@
+// Package i18n translates messages with catalogs of JSON files, one for every locale,
+// and picks the locale of a request.
+//
+// Messages are looked up by their text in the default locale, so the default locale
+// doesn't need a catalog and untranslated messages fall back to their original text.
+// A catalog like locales/es.json maps messages to their translations:
+//
+//	{
+//	    "Contact Us": "Contáctenos",
+//	    "Deleted %q.": "Se eliminó %q."
+//	}
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+const (
+	// QueryParam is the query parameter that picks the locale of a request, like ?lang=es
+	QueryParam = "lang"
+
+	// CookieName is the cookie that remembers the locale picked by a user
+	CookieName = "lang"
+)
+
+// Bundle holds the message catalogs of the supported locales.
+type Bundle struct {
+	defaultLocale string
+	locales       []string
+	catalogs      map[string]map[string]string
+	matcher       language.Matcher
+}
+
+// New loads a catalog for every "{locale}.json" file in dir of fsys. The default locale
+// is always supported, with or without a catalog.
+func New(fsys fs.FS, dir, defaultLocale string) (*Bundle, error) {
+	b := &Bundle{
+		defaultLocale: defaultLocale,
+		locales:       []string{defaultLocale},
+		catalogs:      map[string]map[string]string{},
+	}
+
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		locale := strings.TrimSuffix(path.Base(file), ".json")
+		if _, err := language.Parse(locale); err != nil {
+			return nil, fmt.Errorf("i18n: catalog %s isn't named after a locale: %w", file, err)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("i18n: invalid catalog %s: %w", file, err)
+		}
+
+		b.catalogs[locale] = catalog
+		if locale != defaultLocale {
+			b.locales = append(b.locales, locale)
+		}
+	}
+
+	tags := make([]language.Tag, len(b.locales))
+	for i, locale := range b.locales {
+		tags[i] = language.Make(locale)
+	}
+	b.matcher = language.NewMatcher(tags)
+
+	return b, nil
+}
+
+// DefaultLocale returns the locale of the messages.
+func (b *Bundle) DefaultLocale() string {
+	return b.defaultLocale
+}
+
+// Locales returns the supported locales, starting with the default locale.
+func (b *Bundle) Locales() []string {
+	return slices.Clone(b.locales)
+}
+
+// Supported reports whether locale has a catalog or is the default locale.
+func (b *Bundle) Supported(locale string) bool {
+	return slices.Contains(b.locales, locale)
+}
+
+// DisplayName returns the name of a locale in its own language, like "español" for
+// "es", for language pickers.
+func DisplayName(locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return locale
+	}
+	if name := display.Self.Name(tag); name != "" {
+		return name
+	}
+	return locale
+}
+
+// Translate returns the translation of a message for locale, or the message itself when
+// it isn't translated. With args, the translation is a fmt format string.
+func (b *Bundle) Translate(locale, message string, args ...any) string {
+	if translation, ok := b.catalogs[locale][message]; ok && translation != "" {
+		message = translation
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Match returns the supported locale that best matches an Accept-Language header, or
+// the default locale.
+func (b *Bundle) Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return b.defaultLocale
+	}
+
+	_, index, confidence := b.matcher.Match(tags...)
+	if confidence == language.No {
+		return b.defaultLocale
+	}
+	return b.locales[index]
+}
+
+// Detect returns the locale of a request from, in order, the QueryParam query
+// parameter, the saved locale picked by the user, like from the CookieName cookie, and
+// the Accept-Language header.
+func (b *Bundle) Detect(r *http.Request, saved string) string {
+	if locale := r.URL.Query().Get(QueryParam); b.Supported(locale) {
+		return locale
+	}
+	if b.Supported(saved) {
+		return saved
+	}
+	return b.Match(r.Header.Get("Accept-Language"))
+}
@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func newTestBundle(t *testing.T) *Bundle {
+	t.Helper()
+
+	fsys := fstest.MapFS{
+		"locales/es.json": {Data: []byte(`{"Hello": "Hola", "Deleted %q.": "Se eliminó %q."}`)},
+		"locales/fr.json": {Data: []byte(`{"Hello": "Bonjour"}`)},
+	}
+	b, err := New(fsys, "locales", "en")
+	assert.NoError(t, err)
+	return b
+}
+
+func TestTranslate(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBundle(t)
+	assert.EqualSlices(t, []string{"en", "es", "fr"}, b.Locales())
+
+	assert.Equal(t, "Hola", b.Translate("es", "Hello"))
+	assert.Equal(t, "Hello", b.Translate("en", "Hello"))
+	assert.Equal(t, `Se eliminó "Groceries".`, b.Translate("es", "Deleted %q.", "Groceries"))
+
+	// Untranslated messages and unknown locales fall back to the message
+	assert.Equal(t, "Goodbye", b.Translate("fr", "Goodbye"))
+	assert.Equal(t, "Hello", b.Translate("de", "Hello"))
+}
+
+func TestDisplayName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "English", DisplayName("en"))
+	assert.Equal(t, "español", DisplayName("es"))
+	assert.Equal(t, "not a locale", DisplayName("not a locale"))
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBundle(t)
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", "en"},
+		{"es", "es"},
+		{"es-MX,es;q=0.9", "es"},
+		{"de-DE,fr;q=0.8,en;q=0.5", "fr"},
+		{"de", "en"},
+		{"not a language!", "en"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, b.Match(tt.acceptLanguage))
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBundle(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "fr")
+	assert.Equal(t, "fr", b.Detect(r, ""))
+
+	// The saved locale wins over the header, unless it isn't supported
+	assert.Equal(t, "es", b.Detect(r, "es"))
+	assert.Equal(t, "fr", b.Detect(r, "xx"))
+
+	// The query parameter wins over both, unless it isn't supported
+	r.URL.RawQuery = "lang=en"
+	assert.Equal(t, "en", b.Detect(r, "es"))
+	r.URL.RawQuery = "lang=xx"
+	assert.Equal(t, "es", b.Detect(r, "es"))
+}
+
+func TestNewErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(fstest.MapFS{"locales/es.json": {Data: []byte(`not json`)}}, "locales", "en")
+	assert.Equal(t, true, err != nil)
+
+	_, err = New(fstest.MapFS{"locales/not a locale.json": {Data: []byte(`{}`)}}, "locales", "en")
+	assert.Equal(t, true, err != nil)
+}
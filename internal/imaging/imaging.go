@@ -0,0 +1,196 @@
+// Package imaging strips the metadata of uploaded images, like the GPS location of a photo,
+// and makes resized variants of them, like thumbnails and avatars, in a storage backend.
+// Variants are re-encoded upright, after applying the EXIF orientation.
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+
+	"github.com/sglmr/gowebstart/internal/storage"
+	"golang.org/x/image/draw"
+)
+
+// MaxPixels is the largest image, in pixels, that will be decoded. It guards against
+// small files that decode to huge images.
+const MaxPixels = 50_000_000
+
+// jpegQuality is the quality for re-encoded JPEG images
+const jpegQuality = 85
+
+var (
+	// ErrUnsupported is returned for files that aren't JPEG, PNG, or GIF images.
+	ErrUnsupported = errors.New("imaging: unsupported image format")
+	// ErrTooLarge is returned for images with more than MaxPixels pixels.
+	ErrTooLarge = errors.New("imaging: image is too large")
+)
+
+// Variant is a resized version of an image. Images are scaled down to fit inside
+// Width x Height, keeping their aspect ratio. Smaller images aren't scaled up.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// Processor makes image variants of files in a storage backend.
+type Processor struct {
+	store    storage.Backend
+	variants map[string]Variant
+}
+
+// NewProcessor returns a Processor that stores the variants in store.
+func NewProcessor(store storage.Backend, variants ...Variant) *Processor {
+	p := &Processor{store: store, variants: map[string]Variant{}}
+	for _, v := range variants {
+		p.variants[v.Name] = v
+	}
+	return p
+}
+
+// Variant returns the variant with the name.
+func (p *Processor) Variant(name string) (Variant, bool) {
+	v, ok := p.variants[name]
+	return v, ok
+}
+
+// VariantKey returns the storage key of a variant of the image at key, like
+// "variants/thumb/avatars/42.png".
+func (p *Processor) VariantKey(key, name string) string {
+	return path.Join("variants", name, key)
+}
+
+// Save stores an uploaded file at key. JPEG, PNG, and GIF images are stored without their
+// metadata, see Strip, and other files as is. It reports whether the file is an image, with
+// variants to make with Process.
+func (p *Processor) Save(key string, r io.Reader) (isImage bool, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+
+	stripped, err := Strip(data)
+	switch {
+	case errors.Is(err, ErrUnsupported):
+		return false, p.store.Save(key, bytes.NewReader(data))
+	case err != nil:
+		return false, fmt.Errorf("imaging %s: %w", key, err)
+	}
+	return true, p.store.Save(key, bytes.NewReader(stripped))
+}
+
+// Process stores all the variants of the image at key, which was stored with Save. It's
+// meant to run in a background task after an upload. Running it again replaces the variants.
+func (p *Processor) Process(ctx context.Context, key string) error {
+	img, format, err := p.load(key)
+	if err != nil {
+		return fmt.Errorf("imaging %s: %w", key, err)
+	}
+
+	for _, v := range p.variants {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.save(p.VariantKey(key, v.Name), Resize(img, v.Width, v.Height), format); err != nil {
+			return fmt.Errorf("imaging %s variant %s: %w", key, v.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteVariants removes all the variants of the image at key, like when the image is deleted.
+func (p *Processor) DeleteVariants(key string) error {
+	var errs []error
+	for name := range p.variants {
+		errs = append(errs, p.store.Delete(p.VariantKey(key, name)))
+	}
+	return errors.Join(errs...)
+}
+
+// load reads and decodes the image at key with its EXIF orientation applied
+func (p *Processor) load(key string) (image.Image, string, error) {
+	f, err := p.store.Open(key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Decode(data)
+}
+
+// save encodes img in format and stores it at key
+func (p *Processor) save(key string, img image.Image, format string) error {
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, img, format); err != nil {
+		return err
+	}
+	return p.store.Save(key, buf)
+}
+
+// Decode decodes a JPEG, PNG, or GIF image and applies its EXIF orientation. It
+// returns the image format, like "jpeg".
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "jpeg" {
+		img = Orient(img, exifOrientation(data))
+	}
+
+	return img, format, nil
+}
+
+// Encode writes img in format. GIF images are written as PNG, so only the first frame
+// of an animated GIF is kept.
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case "png", "gif":
+		return png.Encode(w, img)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// Resize scales img down to fit inside width x height, keeping its aspect ratio. Images
+// that already fit are returned as is.
+func Resize(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width && b.Dy() <= height {
+		return img
+	}
+
+	// Scale by the side that needs to shrink the most
+	scale := min(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	w := max(1, int(float64(b.Dx())*scale+0.5))
+	h := max(1, int(float64(b.Dy())*scale+0.5))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
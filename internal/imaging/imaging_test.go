@@ -0,0 +1,283 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/storage"
+)
+
+// newTestImage returns a width x height image with a red top left pixel
+func newTestImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.White)
+		}
+	}
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	return img
+}
+
+// withEXIFOrientation inserts a little endian EXIF segment with an orientation tag
+// right after the start of image marker of JPEG data
+func withEXIFOrientation(t *testing.T, data []byte, orientation uint16) []byte {
+	t.Helper()
+
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("II")
+	binary.Write(tiff, binary.LittleEndian, uint16(42))
+	binary.Write(tiff, binary.LittleEndian, uint32(8))      // offset of IFD0
+	binary.Write(tiff, binary.LittleEndian, uint16(1))      // number of entries
+	binary.Write(tiff, binary.LittleEndian, uint16(0x0112)) // orientation tag
+	binary.Write(tiff, binary.LittleEndian, uint16(3))      // SHORT type
+	binary.Write(tiff, binary.LittleEndian, uint32(1))      // count
+	binary.Write(tiff, binary.LittleEndian, orientation)
+	binary.Write(tiff, binary.LittleEndian, uint16(0)) // padding
+	binary.Write(tiff, binary.LittleEndian, uint32(0)) // no next IFD
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buf, img, nil))
+	return buf.Bytes()
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	t.Parallel()
+
+	data := encodeJPEG(t, newTestImage(4, 2))
+	assert.Equal(t, 1, exifOrientation(data))
+	assert.Equal(t, 6, exifOrientation(withEXIFOrientation(t, data, 6)))
+
+	// Invalid or missing data is the normal orientation
+	assert.Equal(t, 1, exifOrientation(nil))
+	assert.Equal(t, 1, exifOrientation([]byte("not a jpeg")))
+	assert.Equal(t, 1, exifOrientation(withEXIFOrientation(t, data, 9)))
+}
+
+func TestOrient(t *testing.T) {
+	t.Parallel()
+
+	img := newTestImage(4, 2)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		redX, redY    int
+	}{
+		{1, 4, 2, 0, 0},
+		{2, 4, 2, 3, 0},
+		{3, 4, 2, 3, 1},
+		{4, 4, 2, 0, 1},
+		{5, 2, 4, 0, 0},
+		{6, 2, 4, 1, 0},
+		{7, 2, 4, 1, 3},
+		{8, 2, 4, 0, 3},
+	}
+
+	for _, tt := range tests {
+		got := Orient(img, tt.orientation)
+		assert.Equal(t, tt.width, got.Bounds().Dx())
+		assert.Equal(t, tt.height, got.Bounds().Dy())
+
+		r, g, _, _ := got.At(tt.redX, tt.redY).RGBA()
+		if r != 0xffff || g != 0 {
+			t.Errorf("orientation %d: want the red pixel at %d,%d", tt.orientation, tt.redX, tt.redY)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+
+	// Images are scaled to fit, keeping the aspect ratio
+	got := Resize(newTestImage(400, 200), 100, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), got.Bounds())
+
+	got = Resize(newTestImage(200, 400), 100, 100)
+	assert.Equal(t, image.Rect(0, 0, 50, 100), got.Bounds())
+
+	// Small images aren't scaled up
+	small := newTestImage(20, 10)
+	assert.Equal(t, image.Image(small), Resize(small, 100, 100))
+}
+
+func TestDecodeUnsupported(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := Decode([]byte("plain text"))
+	assert.Equal(t, ErrUnsupported, err)
+
+	// A tiny PNG header that claims a huge image
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, newTestImage(1, 1)))
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100_000) // width
+	binary.BigEndian.PutUint32(data[20:], 100_000) // height
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	_, _, err = Decode(data)
+	assert.Equal(t, ErrTooLarge, err)
+}
+
+func TestStripJPEG(t *testing.T) {
+	t.Parallel()
+
+	// A photo with EXIF and XMP data, and a comment
+	photo := encodeJPEG(t, newTestImage(40, 30))
+	xmp := append([]byte{0xFF, 0xE1, 0, 2 + 29}, "http://ns.adobe.com/xap/1.0/\x00"...)
+	comment := append([]byte{0xFF, 0xFE, 0, 2 + 7}, "GPS 1,2"...)
+	data := withEXIFOrientation(t, photo, 6)
+	data = append(data[:2], append(append(xmp, comment...), data[2:]...)...)
+
+	stripped, err := Strip(data)
+	assert.NoError(t, err)
+	assert.Equal(t, false, bytes.Contains(stripped, []byte("xap")))
+	assert.Equal(t, false, bytes.Contains(stripped, []byte("GPS")))
+
+	// The orientation is kept, and the image data isn't re-encoded
+	assert.Equal(t, 6, exifOrientation(stripped))
+	assert.Equal(t, true, bytes.HasSuffix(stripped, photo[2:]))
+	assert.Equal(t, len(photo)+len(orientationSegment(6)), len(stripped))
+
+	// Photos without an orientation don't get one
+	stripped, err = Strip(photo)
+	assert.NoError(t, err)
+	assert.Equal(t, true, bytes.Equal(photo, stripped))
+}
+
+func TestStripPNG(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, newTestImage(4, 2)))
+	data := buf.Bytes()
+
+	// Insert a text chunk after the IHDR chunk
+	text := []byte("Location\x00Home")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	withText := append(append(append([]byte{}, data[:33]...), chunk...), data[33:]...)
+
+	stripped, err := Strip(withText)
+	assert.NoError(t, err)
+	assert.Equal(t, true, bytes.Equal(data, stripped))
+}
+
+func TestStripGIF(t *testing.T) {
+	t.Parallel()
+
+	// An animated GIF with a comment
+	palette := color.Palette{color.White, color.Black}
+	frame := func() *image.Paletted { return image.NewPaletted(image.Rect(0, 0, 4, 2), palette) }
+	buf := new(bytes.Buffer)
+	assert.NoError(t, gif.EncodeAll(buf, &gif.GIF{Image: []*image.Paletted{frame(), frame(), frame()}, Delay: []int{10, 10, 10}}))
+	data := buf.Bytes()
+	comment := []byte{0x21, 0xFE, 7, 'G', 'P', 'S', ' ', '1', ',', '2', 0}
+	i := bytes.IndexByte(data[13+6:], 0x21) + 13 + 6 // the first extension after the global color table
+	withComment := append(append(append([]byte{}, data[:i]...), comment...), data[i:]...)
+
+	stripped, err := Strip(withComment)
+	assert.NoError(t, err)
+	assert.Equal(t, true, bytes.Equal(data, stripped))
+
+	// Every frame is kept
+	g, err := gif.DecodeAll(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(g.Image))
+}
+
+func TestStripUnsupported(t *testing.T) {
+	t.Parallel()
+
+	_, err := Strip([]byte("plain text"))
+	assert.Equal(t, ErrUnsupported, err)
+
+	// Truncated images are invalid
+	photo := encodeJPEG(t, newTestImage(4, 2))
+	_, err = Strip(photo[:10])
+	if err == nil || errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected an invalid image error, got %v", err)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewLocal(t.TempDir())
+	p := NewProcessor(store,
+		Variant{Name: "thumb", Width: 50, Height: 50},
+		Variant{Name: "medium", Width: 200, Height: 200},
+	)
+
+	read := func(key string) []byte {
+		f, err := store.Open(key)
+		assert.NoError(t, err)
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		return data
+	}
+
+	// A landscape photo from a camera held upright is saved without its metadata
+	photo := withEXIFOrientation(t, encodeJPEG(t, newTestImage(400, 300)), 6)
+	isImage, err := p.Save("avatars/42.jpg", bytes.NewReader(photo))
+	assert.NoError(t, err)
+	assert.Equal(t, true, isImage)
+	original := read("avatars/42.jpg")
+	assert.Equal(t, 6, exifOrientation(original))
+
+	// Processing leaves the original as is
+	assert.NoError(t, p.Process(context.Background(), "avatars/42.jpg"))
+	assert.Equal(t, true, bytes.Equal(original, read("avatars/42.jpg")))
+
+	// Each variant is stored upright
+	assert.Equal(t, "variants/thumb/avatars/42.jpg", p.VariantKey("avatars/42.jpg", "thumb"))
+	thumb := read("variants/thumb/avatars/42.jpg")
+	assert.Equal(t, false, bytes.Contains(thumb, []byte("Exif")))
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+	assert.NoError(t, err)
+	assert.Equal(t, 38, cfg.Width)
+	assert.Equal(t, 50, cfg.Height)
+	cfg, err = jpeg.DecodeConfig(bytes.NewReader(read("variants/medium/avatars/42.jpg")))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, cfg.Height)
+
+	// Deleting the variants
+	assert.NoError(t, p.DeleteVariants("avatars/42.jpg"))
+	_, err = store.Open("variants/thumb/avatars/42.jpg")
+	if err == nil {
+		t.Fatal("expected the variant to be deleted")
+	}
+
+	// Other files are saved as is, without variants
+	isImage, err = p.Save("notes.txt", strings.NewReader("notes"))
+	assert.NoError(t, err)
+	assert.Equal(t, false, isImage)
+	assert.Equal(t, "notes", string(read("notes.txt")))
+	assert.Equal(t, true, errors.Is(p.Process(context.Background(), "notes.txt"), ErrUnsupported))
+}
@@ -0,0 +1,216 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errInvalid is returned for JPEG, PNG, and GIF files that can't be parsed
+var errInvalid = errors.New("invalid image data")
+
+// Strip returns a copy of JPEG, PNG, or GIF data without metadata, like EXIF, XMP, and
+// comments, which can hold the GPS location of a photo. The image data itself is kept as
+// is, so JPEG images aren't re-encoded and animated GIFs keep their frames. The EXIF
+// orientation of a JPEG image is kept, so photos stay upright. It returns ErrUnsupported
+// for other files.
+func Strip(data []byte) ([]byte, error) {
+	var out []byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		out, err = stripJPEG(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		out, err = stripPNG(data)
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		out, err = stripGIF(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("imaging: %w", err)
+	}
+	return out, nil
+}
+
+// stripJPEG removes the application segments and comments of JPEG data, except for the
+// JFIF header, the ICC color profile, and the Adobe color transform, which are needed
+// to show the image. An EXIF segment with only the orientation takes the place of the
+// original EXIF data.
+func stripJPEG(data []byte) ([]byte, error) {
+	const (
+		markerSOS   = 0xDA
+		markerAPP0  = 0xE0
+		markerAPP2  = 0xE2
+		markerAPP14 = 0xEE
+		markerAPP15 = 0xEF
+		markerCOM   = 0xFE
+	)
+
+	out := append(make([]byte, 0, len(data)), data[:2]...)
+	if orientation := exifOrientation(data); orientation != 1 {
+		out = append(out, orientationSegment(orientation)...)
+	}
+
+	// Copy the segments up to the start of the image data, which is kept as is
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, errInvalid
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Markers can be padded with fill bytes
+			i++
+			continue
+		}
+		if marker == markerSOS {
+			return append(out, data[i:]...), nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, errInvalid
+		}
+		segment := data[i : i+2+length]
+		i += 2 + length
+
+		keep := true
+		switch {
+		case marker == markerAPP2:
+			keep = bytes.HasPrefix(segment[4:], []byte("ICC_PROFILE\x00"))
+		case marker == markerAPP14:
+			keep = bytes.HasPrefix(segment[4:], []byte("Adobe"))
+		case marker > markerAPP0 && marker <= markerAPP15, marker == markerCOM:
+			keep = false
+		}
+		if keep {
+			out = append(out, segment...)
+		}
+	}
+}
+
+// orientationSegment returns a big endian EXIF segment with only an orientation tag
+func orientationSegment(orientation int) []byte {
+	segment := []byte{
+		0xFF, 0xE1, 0, 34, // APP1 marker and length
+		'E', 'x', 'i', 'f', 0, 0,
+		'M', 'M', 0, 42, 0, 0, 0, 8, // TIFF header with the offset of IFD0
+		0, 1, // number of entries
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0, // orientation tag, SHORT type, count, and value
+		0, 0, 0, 0, // no next IFD
+	}
+	binary.BigEndian.PutUint16(segment[28:], uint16(orientation))
+	return segment
+}
+
+// stripPNG removes the text, EXIF, and time chunks of PNG data
+func stripPNG(data []byte) ([]byte, error) {
+	out := append(make([]byte, 0, len(data)), data[:8]...)
+	for i := 8; i < len(data); {
+		if i+12 > len(data) {
+			return nil, errInvalid
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if i+12+length > len(data) {
+			return nil, errInvalid
+		}
+		chunk := data[i : i+12+length]
+		i += 12 + length
+
+		switch string(chunk[4:8]) {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+		default:
+			out = append(out, chunk...)
+		}
+	}
+	return out, nil
+}
+
+// stripGIF removes the comments and application extensions of GIF data, like XMP,
+// except for the loop count of animated GIFs
+func stripGIF(data []byte) ([]byte, error) {
+	const (
+		blockExtension      = 0x21
+		blockImage          = 0x2C
+		blockTrailer        = 0x3B
+		extensionComment    = 0xFE
+		extensionApp        = 0xFF
+		flagColorTable      = 0x80
+		imageDescriptorSize = 10
+		screenDescriptorEnd = 13
+	)
+
+	// colorTableSize returns the size of the color table that follows a descriptor with flags
+	colorTableSize := func(flags byte) int {
+		if flags&flagColorTable == 0 {
+			return 0
+		}
+		return 3 << (flags&0x07 + 1)
+	}
+
+	// subBlocksEnd returns the index after the data sub-blocks that start at i
+	subBlocksEnd := func(i int) (int, error) {
+		for {
+			if i >= len(data) {
+				return 0, errInvalid
+			}
+			size := int(data[i])
+			i += 1 + size
+			if size == 0 {
+				return i, nil
+			}
+		}
+	}
+
+	if len(data) < screenDescriptorEnd {
+		return nil, errInvalid
+	}
+	header := screenDescriptorEnd + colorTableSize(data[10])
+	if header > len(data) {
+		return nil, errInvalid
+	}
+	out := append(make([]byte, 0, len(data)), data[:header]...)
+
+	for i := header; i < len(data); {
+		start := i
+		switch data[i] {
+		case blockTrailer:
+			return append(out, data[i]), nil
+		case blockExtension:
+			if i+2 > len(data) {
+				return nil, errInvalid
+			}
+			end, err := subBlocksEnd(i + 2)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+
+			switch data[start+1] {
+			case extensionComment:
+				continue
+			case extensionApp:
+				app := data[start+2 : end]
+				if !bytes.HasPrefix(app, []byte("\x0bNETSCAPE2.0")) && !bytes.HasPrefix(app, []byte("\x0bANIMEXTS1.0")) {
+					continue
+				}
+			}
+		case blockImage:
+			if i+imageDescriptorSize > len(data) {
+				return nil, errInvalid
+			}
+			// The descriptor, local color table, and LZW code size come before the image data
+			end, err := subBlocksEnd(i + imageDescriptorSize + colorTableSize(data[i+9]) + 1)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		default:
+			return nil, errInvalid
+		}
+		out = append(out, data[start:i]...)
+	}
+
+	// Keep GIFs that are missing the trailer, since browsers show them anyway
+	return out, nil
+}
@@ -0,0 +1,423 @@
+// Package jobs is a durable background job queue. Jobs are saved in a Store before
+// they run, so they aren't lost when the application restarts. Failed jobs are retried
+// with a backoff until they run out of attempts and move to a dead letter list.
+//
+// Use jobs for work that has to happen, like sending emails and webhooks. The tasks
+// package is a lighter fit for work that can be redone, like making image variants.
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+var (
+	// ErrUnknownKind is returned by Enqueue for a job kind without a registered Handler.
+	ErrUnknownKind = errors.New("jobs: no handler for job kind")
+
+	// ErrClosed is returned by Enqueue after the Queue has started shutting down.
+	ErrClosed = errors.New("jobs: queue is shut down")
+
+	// ErrNotFound is returned by a Store for a job that doesn't exist.
+	ErrNotFound = errors.New("jobs: job not found")
+)
+
+// State is where a job is in its life cycle. Finished jobs are deleted.
+type State string
+
+const (
+	StatePending State = "pending" // Waiting for RunAt to run
+	StateRunning State = "running" // Claimed by a worker
+	StateDead    State = "dead"    // Out of attempts, in the dead letter list
+)
+
+// Job is a unit of work saved in a Store.
+type Job struct {
+	ID          int64
+	Kind        string
+	Payload     json.RawMessage
+	State       State
+	Attempts    int       // Attempts started so far
+	MaxAttempts int       // Attempts before the job moves to the dead letter list
+	RunAt       time.Time // When a pending job is due, or when a running job was claimed
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// Decode unmarshals the job payload into v.
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler does the work for a kind of job. The context is cancelled when the shutdown
+// deadline passes, so long running jobs should stop when it's done.
+type Handler func(ctx context.Context, job *Job) error
+
+// Store saves jobs. Implementations have to be safe for concurrent use, and Claim
+// must never give the same job to two workers.
+type Store interface {
+	// Insert saves a new pending job and sets its ID and CreatedAt.
+	Insert(ctx context.Context, job *Job) error
+
+	// Claim marks the next due job as running, adds an attempt, and returns it. Due
+	// jobs are pending jobs with a RunAt at or before now, and running jobs claimed
+	// longer than lease ago, like the jobs of a worker that crashed. Claim returns
+	// nil when no jobs are due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error)
+
+	// Complete deletes a finished job.
+	Complete(ctx context.Context, id int64) error
+
+	// Retry marks a job as pending again to run at runAt.
+	Retry(ctx context.Context, id int64, runAt time.Time, lastError string) error
+
+	// Kill moves a job to the dead letter list.
+	Kill(ctx context.Context, id int64, lastError string) error
+
+	// Dead returns the jobs in the dead letter list, oldest first.
+	Dead(ctx context.Context) ([]Job, error)
+
+	// Revive moves a dead job back to pending, with no attempts, to run at runAt.
+	Revive(ctx context.Context, id int64, runAt time.Time) error
+}
+
+// Option configures a single job.
+type Option func(*Job)
+
+// WithMaxAttempts sets the number of attempts before a job moves to the dead letter list.
+func WithMaxAttempts(attempts int) Option {
+	return func(j *Job) {
+		j.MaxAttempts = max(attempts, 1)
+	}
+}
+
+// WithDelay delays the first attempt of a job.
+func WithDelay(delay time.Duration) Option {
+	return func(j *Job) {
+		j.RunAt = j.RunAt.Add(delay)
+	}
+}
+
+// DefaultMaxAttempts is the number of attempts for a job without WithMaxAttempts
+const DefaultMaxAttempts = 5
+
+// DefaultBackoff waits 10 seconds after the first failed attempt and doubles the wait
+// after every attempt, up to an hour.
+func DefaultBackoff(attempt int) time.Duration {
+	backoff := 10 * time.Second
+	for range attempt - 1 {
+		backoff *= 2
+		if backoff >= time.Hour {
+			return time.Hour
+		}
+	}
+	return backoff
+}
+
+// ExponentialBackoff waits base after the first failed attempt and doubles the wait
+// after every attempt, up to maxBackoff. Jitter takes up to that fraction of the wait
+// off at random, like 0.2 for up to 20%, so jobs that failed together don't all retry
+// at once.
+func ExponentialBackoff(base, maxBackoff time.Duration, jitter float64) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		backoff := base
+		for range attempt - 1 {
+			backoff *= 2
+			if backoff >= maxBackoff {
+				backoff = maxBackoff
+				break
+			}
+		}
+		backoff = min(backoff, maxBackoff)
+		if jitter > 0 {
+			backoff -= time.Duration(rand.Float64() * min(jitter, 1) * float64(backoff))
+		}
+		return backoff
+	}
+}
+
+// Policy is how a kind of job is retried. Zero fields use the defaults of the Queue.
+type Policy struct {
+	// MaxAttempts are the attempts of jobs enqueued without WithMaxAttempts,
+	// DefaultMaxAttempts by default.
+	MaxAttempts int
+	// Backoff returns the wait before the next attempt, Queue.Backoff by default.
+	Backoff func(attempt int) time.Duration
+	// Timeout limits each attempt by cancelling the context of the handler. No limit
+	// by default.
+	Timeout time.Duration
+}
+
+// Queue runs the jobs in a Store on a fixed number of workers.
+type Queue struct {
+	store   Store
+	logger  *slog.Logger
+	workers int
+
+	// PollInterval is how often idle workers check the store for due jobs.
+	PollInterval time.Duration
+	// Lease is how long a job can run before another worker claims it again.
+	Lease time.Duration
+	// Backoff returns the wait before the next attempt after a job fails attempt times.
+	Backoff func(attempt int) time.Duration
+	// Clock tells when jobs are due, clock.System by default.
+	Clock clock.Clock
+
+	handlers map[string]Handler
+	policies map[string]Policy
+	wake     chan struct{}
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	// ctx is cancelled when the shutdown deadline passes
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+}
+
+// New creates a Queue for the jobs in store. Register the handlers for every job kind,
+// then call Start to run the workers.
+func New(store Store, logger *slog.Logger, workers int) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Queue{
+		store:        store,
+		logger:       logger,
+		workers:      max(workers, 1),
+		PollInterval: time.Second,
+		Lease:        10 * time.Minute,
+		Backoff:      DefaultBackoff,
+		Clock:        clock.System,
+		handlers:     map[string]Handler{},
+		policies:     map[string]Policy{},
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Register sets the handler for a kind of job. Register every handler before Start.
+func (q *Queue) Register(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// SetPolicy sets how a kind of job is retried, instead of the defaults of the Queue.
+func (q *Queue) SetPolicy(kind string, p Policy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policies[kind] = p
+}
+
+// policy returns the retry policy of a kind of job
+func (q *Queue) policy(kind string) Policy {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.policies[kind]
+}
+
+// Start starts the workers.
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.started || q.closed {
+		return
+	}
+	q.started = true
+
+	for range q.workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Enqueue saves a job with a JSON payload to run in the background. It returns
+// ErrUnknownKind for a kind without a handler, or ErrClosed after Shutdown.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any, opts ...Option) error {
+	q.mu.RLock()
+	_, ok := q.handlers[kind]
+	closed := q.closed
+	q.mu.RUnlock()
+
+	switch {
+	case closed:
+		return ErrClosed
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("jobs: encoding %s payload: %w", kind, err)
+	}
+
+	job := &Job{
+		Kind:        kind,
+		Payload:     data,
+		State:       StatePending,
+		MaxAttempts: cmp.Or(q.policy(kind).MaxAttempts, DefaultMaxAttempts),
+		RunAt:       q.Clock.Now(),
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	if err := q.store.Insert(ctx, job); err != nil {
+		return fmt.Errorf("jobs: saving %s job: %w", kind, err)
+	}
+
+	// Wake an idle worker
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Dead returns the jobs in the dead letter list.
+func (q *Queue) Dead(ctx context.Context) ([]Job, error) {
+	return q.store.Dead(ctx)
+}
+
+// Revive moves a job from the dead letter list back into the queue to run again.
+func (q *Queue) Revive(ctx context.Context, id int64) error {
+	return q.store.Revive(ctx, id, q.Clock.Now())
+}
+
+// Shutdown stops claiming new jobs and waits for the running jobs to finish. Pending
+// jobs stay in the store for the next start. When ctx is done first, the context passed
+// to the jobs is cancelled and Shutdown returns the ctx error.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+// stopping reports whether Shutdown was called
+func (q *Queue) stopping() bool {
+	select {
+	case <-q.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// work runs due jobs until the queue shuts down, and waits for new jobs in between.
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	timer := time.NewTimer(q.PollInterval)
+	defer timer.Stop()
+
+	for {
+		for !q.stopping() && q.runNext() {
+		}
+
+		timer.Reset(q.PollInterval)
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// runNext claims and runs the next due job. It returns false when there was no job to run.
+func (q *Queue) runNext() bool {
+	job, err := q.store.Claim(q.ctx, q.Clock.Now(), q.Lease)
+	if err != nil {
+		q.logger.Error("job claim", "error", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	err = q.run(job)
+
+	// Record the result even if the shutdown deadline passed
+	ctx := context.WithoutCancel(q.ctx)
+	switch {
+	case err == nil:
+		err = q.store.Complete(ctx, job.ID)
+	case job.Attempts >= job.MaxAttempts || errors.Is(err, ErrUnknownKind):
+		q.logger.Error("job dead", "id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", err)
+		err = q.store.Kill(ctx, job.ID, err.Error())
+	default:
+		backoffFunc := q.Backoff
+		if policy := q.policy(job.Kind); policy.Backoff != nil {
+			backoffFunc = policy.Backoff
+		}
+		backoff := backoffFunc(job.Attempts)
+		q.logger.Warn("job retry", "id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "backoff", backoff, "error", err)
+		err = q.store.Retry(ctx, job.ID, q.Clock.Now().Add(backoff), err.Error())
+	}
+	if err != nil {
+		q.logger.Error("job result", "id", job.ID, "kind", job.Kind, "error", err)
+	}
+
+	return true
+}
+
+// run runs a job with its handler, recovering any panic so that a panic doesn't
+// kill the whole application.
+func (q *Queue) run(job *Job) (err error) {
+	q.mu.RLock()
+	h, ok := q.handlers[job.Kind]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+
+	ctx := q.ctx
+	if timeout := q.policy(job.Kind).Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+
+	return h(ctx, job)
+}
@@ -0,0 +1,235 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+func newTestQueue(store Store) *Queue {
+	q := New(store, slog.New(slog.NewTextHandler(io.Discard, nil)), 2)
+	q.PollInterval = 5 * time.Millisecond
+	q.Backoff = func(int) time.Duration { return time.Millisecond }
+	return q
+}
+
+// waitFor polls until cond is true or fails the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the jobs")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueEnqueue(t *testing.T) {
+	t.Parallel()
+
+	q := newTestQueue(NewMemoryStore())
+
+	type payload struct{ Name string }
+	var got atomic.Value
+	q.Register("greet", func(ctx context.Context, job *Job) error {
+		var p payload
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		got.Store(p.Name)
+		return nil
+	})
+	q.Start()
+
+	err := q.Enqueue(context.Background(), "greet", payload{Name: "Person"})
+	assert.NoError(t, err)
+	waitFor(t, func() bool { return got.Load() != nil })
+	assert.Equal(t, "Person", got.Load().(string))
+
+	// Jobs without a handler aren't saved
+	err = q.Enqueue(context.Background(), "missing", nil)
+	assert.Equal(t, true, errors.Is(err, ErrUnknownKind))
+
+	// No jobs are accepted after shutdown
+	assert.NoError(t, q.Shutdown(context.Background()))
+	err = q.Enqueue(context.Background(), "greet", payload{})
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestQueueRetries(t *testing.T) {
+	t.Parallel()
+	testQueueRetries(t, NewMemoryStore())
+}
+
+// testQueueRetries checks the retries and dead letter list of a queue with store
+func testQueueRetries(t *testing.T, store Store) {
+	q := newTestQueue(store)
+
+	// Succeeds on the third attempt
+	var flaky atomic.Int64
+	q.Register("flaky", func(ctx context.Context, job *Job) error {
+		if flaky.Add(1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+
+	// Fails every attempt, or panics
+	var broken atomic.Int64
+	q.Register("broken", func(ctx context.Context, job *Job) error {
+		if broken.Add(1) == 1 {
+			panic("boom")
+		}
+		return errors.New("still broken")
+	})
+	q.Start()
+	defer q.Shutdown(context.Background())
+
+	assert.NoError(t, q.Enqueue(context.Background(), "flaky", nil))
+	assert.NoError(t, q.Enqueue(context.Background(), "broken", nil, WithMaxAttempts(2)))
+
+	// The broken job moves to the dead letter list after its last attempt
+	waitFor(t, func() bool {
+		dead, _ := q.Dead(context.Background())
+		return len(dead) == 1 && flaky.Load() == 3
+	})
+	dead, err := q.Dead(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "broken", dead[0].Kind)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, "still broken", dead[0].LastError)
+	assert.Equal(t, int64(2), broken.Load())
+
+	// The flaky job finished and was deleted
+	job, err := store.Claim(context.Background(), time.Now(), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, true, job == nil)
+
+	// A revived job runs again
+	assert.NoError(t, q.Revive(context.Background(), dead[0].ID))
+	waitFor(t, func() bool { return broken.Load() == 4 })
+	assert.Equal(t, ErrNotFound, q.Revive(context.Background(), 999))
+}
+
+func TestQueueDelay(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	q := newTestQueue(NewMemoryStore())
+	q.Clock = fake
+	var ran atomic.Bool
+	q.Register("later", func(ctx context.Context, job *Job) error {
+		ran.Store(true)
+		return nil
+	})
+	q.Start()
+	defer q.Shutdown(context.Background())
+
+	// Delayed jobs aren't due until the clock passes their delay
+	assert.NoError(t, q.Enqueue(context.Background(), "later", nil, WithDelay(time.Hour)))
+	time.Sleep(10 * q.PollInterval)
+	assert.Equal(t, false, ran.Load())
+
+	fake.Add(time.Hour)
+	waitFor(t, ran.Load)
+}
+
+func TestQueuePolicy(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryStore()
+	q := newTestQueue(store)
+
+	// Every attempt runs out of time, and the backoff of the policy replaces the queue's
+	var attempts atomic.Int64
+	var backoffs atomic.Int64
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		attempts.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	q.SetPolicy("slow", Policy{
+		MaxAttempts: 3,
+		Backoff: func(int) time.Duration {
+			backoffs.Add(1)
+			return time.Millisecond
+		},
+		Timeout: 10 * time.Millisecond,
+	})
+	q.Start()
+	defer q.Shutdown(context.Background())
+
+	assert.NoError(t, q.Enqueue(context.Background(), "slow", nil))
+	waitFor(t, func() bool {
+		dead, _ := q.Dead(context.Background())
+		return len(dead) == 1
+	})
+	dead, err := q.Dead(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, dead[0].MaxAttempts)
+	assert.Equal(t, context.DeadlineExceeded.Error(), dead[0].LastError)
+	assert.Equal(t, int64(3), attempts.Load())
+	assert.Equal(t, int64(2), backoffs.Load())
+
+	// WithMaxAttempts still overrides the policy
+	assert.NoError(t, q.Enqueue(context.Background(), "slow", nil, WithMaxAttempts(1)))
+	waitFor(t, func() bool {
+		dead, _ := q.Dead(context.Background())
+		return len(dead) == 2
+	})
+	dead, err = q.Dead(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dead[1].MaxAttempts)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	t.Parallel()
+
+	backoff := ExponentialBackoff(time.Second, 10*time.Second, 0)
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 8*time.Second, backoff(4))
+	assert.Equal(t, 10*time.Second, backoff(5))
+	assert.Equal(t, 10*time.Second, backoff(100))
+
+	// Jitter takes up to a fraction of the wait off
+	backoff = ExponentialBackoff(time.Second, 10*time.Second, 0.2)
+	for attempt := 1; attempt <= 10; attempt++ {
+		want := min(time.Second<<(attempt-1), 10*time.Second)
+		got := backoff(attempt)
+		if got > want || got < want*8/10 {
+			t.Errorf("backoff(%d) = %s, want between %s and %s", attempt, got, want*8/10, want)
+		}
+	}
+}
+
+func TestQueueShutdown(t *testing.T) {
+	t.Parallel()
+
+	q := newTestQueue(NewMemoryStore())
+
+	started := make(chan struct{})
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	q.Start()
+
+	assert.NoError(t, q.Enqueue(context.Background(), "slow", nil))
+	<-started
+
+	// Shutdown gives up when its context is done and cancels the running job
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := q.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
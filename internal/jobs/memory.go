@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+// MemoryStore is a Store that keeps jobs in memory. Jobs are lost when the application
+// stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*Job
+
+	// Clock tells the time of CreatedAt, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[int64]*Job{}, Clock: clock.System}
+}
+
+// Insert saves a new pending job and sets its ID and CreatedAt.
+func (s *MemoryStore) Insert(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	job.ID = s.nextID
+	job.State = StatePending
+	job.CreatedAt = s.Clock.Now()
+
+	saved := *job
+	s.jobs[job.ID] = &saved
+	return nil
+}
+
+// Claim marks the next due job as running and returns a copy of it.
+func (s *MemoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Pick the due job with the earliest RunAt
+	var next *Job
+	for _, job := range s.jobs {
+		due := (job.State == StatePending && !job.RunAt.After(now)) ||
+			(job.State == StateRunning && job.RunAt.Add(lease).Before(now))
+		if due && (next == nil || job.RunAt.Before(next.RunAt) || (job.RunAt.Equal(next.RunAt) && job.ID < next.ID)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.State = StateRunning
+	next.RunAt = now
+	next.Attempts++
+
+	claimed := *next
+	return &claimed, nil
+}
+
+// Complete deletes a finished job.
+func (s *MemoryStore) Complete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+// Retry marks a job as pending again to run at runAt.
+func (s *MemoryStore) Retry(ctx context.Context, id int64, runAt time.Time, lastError string) error {
+	return s.update(id, func(job *Job) {
+		job.State = StatePending
+		job.RunAt = runAt
+		job.LastError = lastError
+	})
+}
+
+// Kill moves a job to the dead letter list.
+func (s *MemoryStore) Kill(ctx context.Context, id int64, lastError string) error {
+	return s.update(id, func(job *Job) {
+		job.State = StateDead
+		job.LastError = lastError
+	})
+}
+
+// Dead returns the jobs in the dead letter list, oldest first.
+func (s *MemoryStore) Dead(ctx context.Context) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dead []Job
+	for _, job := range s.jobs {
+		if job.State == StateDead {
+			dead = append(dead, *job)
+		}
+	}
+	slices.SortFunc(dead, func(a, b Job) int { return cmp.Compare(a.ID, b.ID) })
+	return dead, nil
+}
+
+// Revive moves a dead job back to pending, with no attempts, to run at runAt.
+func (s *MemoryStore) Revive(ctx context.Context, id int64, runAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || job.State != StateDead {
+		return ErrNotFound
+	}
+	job.State = StatePending
+	job.Attempts = 0
+	job.RunAt = runAt
+	return nil
+}
+
+// update changes a saved job
+func (s *MemoryStore) update(id int64, fn func(job *Job)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(job)
+	return nil
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SQLStore is a Store that saves jobs in the jobs table of a PostgreSQL database. The
+// table is created by the assets/migrations/001_create_jobs.sql migration.
+//
+// Claim locks the next due job with FOR UPDATE SKIP LOCKED, so any number of
+// application instances can share the same table.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore for the jobs table in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Insert saves a new pending job and sets its ID and CreatedAt.
+func (s *SQLStore) Insert(ctx context.Context, job *Job) error {
+	job.State = StatePending
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO jobs (kind, payload, state, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		job.Kind, []byte(job.Payload), job.State, job.MaxAttempts, job.RunAt,
+	).Scan(&job.ID, &job.CreatedAt)
+}
+
+// Claim marks the next due job as running and returns it.
+func (s *SQLStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	row := s.db.QueryRowContext(ctx, `
+		UPDATE jobs SET state = $1, run_at = $2, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (state = $3 AND run_at <= $2) OR (state = $1 AND run_at < $4)
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		StateRunning, now, StatePending, now.Add(-lease),
+	)
+
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Complete deletes a finished job.
+func (s *SQLStore) Complete(ctx context.Context, id int64) error {
+	return s.exec(ctx, `DELETE FROM jobs WHERE id = $1`, id)
+}
+
+// Retry marks a job as pending again to run at runAt.
+func (s *SQLStore) Retry(ctx context.Context, id int64, runAt time.Time, lastError string) error {
+	return s.exec(ctx, `UPDATE jobs SET state = $2, run_at = $3, last_error = $4 WHERE id = $1`,
+		id, StatePending, runAt, lastError)
+}
+
+// Kill moves a job to the dead letter list.
+func (s *SQLStore) Kill(ctx context.Context, id int64, lastError string) error {
+	return s.exec(ctx, `UPDATE jobs SET state = $2, last_error = $3 WHERE id = $1`,
+		id, StateDead, lastError)
+}
+
+// Dead returns the jobs in the dead letter list, oldest first.
+func (s *SQLStore) Dead(ctx context.Context) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE state = $1 ORDER BY id`, StateDead)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dead []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		dead = append(dead, *job)
+	}
+	return dead, rows.Err()
+}
+
+// Revive moves a dead job back to pending, with no attempts, to run at runAt.
+func (s *SQLStore) Revive(ctx context.Context, id int64, runAt time.Time) error {
+	return s.exec(ctx, `UPDATE jobs SET state = $2, attempts = 0, run_at = $3 WHERE id = $1 AND state = $4`,
+		id, StatePending, runAt, StateDead)
+}
+
+// jobColumns are the columns read into a Job by scanJob
+const jobColumns = `id, kind, payload, state, attempts, max_attempts, run_at, last_error, created_at`
+
+// scanJob reads the jobColumns of a row into a Job
+func scanJob(row interface{ Scan(dest ...any) error }) (*Job, error) {
+	var job Job
+	var payload []byte
+	err := row.Scan(&job.ID, &job.Kind, &payload, &job.State, &job.Attempts,
+		&job.MaxAttempts, &job.RunAt, &job.LastError, &job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = payload
+	return &job, nil
+}
+
+// exec runs a statement that changes one job, and returns ErrNotFound when no job changed
+func (s *SQLStore) exec(ctx context.Context, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/dbtest"
+)
+
+func TestSQLStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewSQLStore(dbtest.New(t)))
+}
+
+func TestSQLQueueRetries(t *testing.T) {
+	t.Parallel()
+	testQueueRetries(t, NewSQLStore(dbtest.New(t)))
+}
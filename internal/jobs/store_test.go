@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewMemoryStore())
+}
+
+// testStore checks the life cycle of a job in a store
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Millisecond)
+
+	job := &Job{Kind: "crash", Payload: []byte(`{"n":1}`), RunAt: now, MaxAttempts: 3}
+	assert.NoError(t, store.Insert(ctx, job))
+	assert.Equal(t, StatePending, job.State)
+
+	// Jobs aren't claimed before they're due
+	claimed, err := store.Claim(ctx, now.Add(-time.Second), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, true, claimed == nil)
+
+	claimed, err = store.Claim(ctx, now, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, job.ID, claimed.ID)
+	assert.Equal(t, StateRunning, claimed.State)
+	assert.Equal(t, 1, claimed.Attempts)
+	var payload struct{ N int }
+	assert.NoError(t, claimed.Decode(&payload))
+	assert.Equal(t, 1, payload.N)
+
+	// A running job isn't claimed again until its lease runs out
+	again, err := store.Claim(ctx, now.Add(time.Second), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, true, again == nil)
+
+	again, err = store.Claim(ctx, now.Add(2*time.Minute), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, job.ID, again.ID)
+	assert.Equal(t, 2, again.Attempts)
+
+	// A retried job is due again at its new time
+	assert.NoError(t, store.Retry(ctx, job.ID, now.Add(time.Hour), "try again"))
+	claimed, err = store.Claim(ctx, now.Add(30*time.Minute), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, true, claimed == nil)
+
+	// Killed jobs are in the dead letter list until they're revived
+	assert.NoError(t, store.Kill(ctx, job.ID, "still broken"))
+	dead, err := store.Dead(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(dead))
+	assert.Equal(t, "still broken", dead[0].LastError)
+	assert.Equal(t, StateDead, dead[0].State)
+
+	assert.NoError(t, store.Revive(ctx, job.ID, now))
+	assert.Equal(t, ErrNotFound, store.Revive(ctx, job.ID, now))
+	claimed, err = store.Claim(ctx, now, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, claimed.Attempts)
+
+	// Completed jobs are deleted
+	assert.NoError(t, store.Complete(ctx, job.ID))
+	assert.Equal(t, ErrNotFound, store.Complete(ctx, job.ID))
+	assert.Equal(t, ErrNotFound, store.Retry(ctx, job.ID, now, ""))
+	assert.Equal(t, ErrNotFound, store.Kill(ctx, job.ID, ""))
+}
@@ -0,0 +1,153 @@
+// Package livereload tells browsers to reload the page when files change on disk.
+// It's meant for development only: it polls directories for changes and streams a
+// "reload" server-sent event to every connected browser.
+package livereload
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Script is the browser side of the live reload. It reloads the page on a "reload"
+// event, and when the connection comes back after the server restarts.
+const Script = `(function () {
+  var disconnected = false;
+  var source = new EventSource("/dev/livereload");
+  source.addEventListener("reload", function () { location.reload(); });
+  source.onerror = function () { disconnected = true; };
+  source.onopen = function () { if (disconnected) { location.reload(); } };
+})();`
+
+// Reloader watches directories and notifies the connected browsers of changes.
+type Reloader struct {
+	dirs     []string
+	interval time.Duration
+
+	// last is the snapshot of the files when they were last checked
+	last string
+
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+	done    chan struct{}
+}
+
+// New creates a Reloader that checks the dirs for changes every interval.
+func New(interval time.Duration, dirs ...string) *Reloader {
+	l := &Reloader{
+		dirs:     dirs,
+		interval: interval,
+		clients:  map[chan struct{}]struct{}{},
+		done:     make(chan struct{}),
+	}
+	l.last = l.snapshot()
+	return l
+}
+
+// Watch polls the directories until ctx is done. Once it returns, the connected
+// browsers are disconnected so that the server can shut down.
+func (l *Reloader) Watch(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := l.snapshot()
+			if current != l.last {
+				l.last = current
+				l.notify()
+			}
+		}
+	}
+}
+
+// snapshot summarizes the files in the directories, so that any added,
+// removed, or modified file changes the result.
+func (l *Reloader) snapshot() string {
+	var count int
+	var size int64
+	var latest time.Time
+
+	for _, dir := range l.dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			count++
+			size += info.Size()
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+			return nil
+		})
+	}
+
+	return fmt.Sprintf("%d-%d-%d", count, size, latest.UnixNano())
+}
+
+// notify sends a reload to every connected browser
+func (l *Reloader) notify() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for client := range l.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+			// The client already has a reload waiting
+		}
+	}
+}
+
+// ServeHTTP streams reload events to a browser until it disconnects or Watch returns.
+func (l *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// The stream stays open much longer than the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan struct{}, 1)
+	l.mu.Lock()
+	l.clients[client] = struct{}{}
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.clients, client)
+		l.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	rc.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-l.done:
+			return
+		case <-client:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			rc.Flush()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package livereload
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "main.css"), []byte("body{}"), 0o644)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloader := New(5*time.Millisecond, dir)
+	go reloader.Watch(ctx)
+
+	ts := httptest.NewServer(reloader)
+	defer ts.Close()
+
+	response, err := http.Get(ts.URL)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	// Wait for the connection comment before changing a file
+	reader := bufio.NewReader(response.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+	reader.ReadString('\n')
+
+	// Adding a file sends a reload event
+	err = os.WriteFile(filepath.Join(dir, "main.js"), []byte("alert(1)"), 0o644)
+	assert.NoError(t, err)
+
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: reload\n", line)
+
+	// Stopping the watcher ends the stream
+	cancel()
+	for err == nil {
+		_, err = reader.ReadString('\n')
+	}
+	assert.Equal(t, true, strings.Contains(err.Error(), "EOF"))
+}
@@ -0,0 +1,39 @@
+// Package logins records the successful logins of users, so they can see when and from
+// where their account was used.
+//
+// Like notes, logins belong to the tenant in the request context (see tenant.ID).
+package logins
+
+import (
+	"context"
+	"time"
+)
+
+// Login is a successful login of a user.
+type Login struct {
+	ID        int64
+	Tenant    string // ID of the tenant of the login, or "" for the main site
+	Email     string // Email of the user that logged in
+	IP        string // Client IP address of the login request
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// Store saves logins. Implementations have to be safe for concurrent use.
+type Store interface {
+	// Insert saves a new login and sets its ID, Tenant, and CreatedAt.
+	Insert(ctx context.Context, l *Login) error
+
+	// List returns a page of the user's logins in the tenant, newest first, and the
+	// user's total number of logins.
+	List(ctx context.Context, email string, limit, offset int) ([]Login, int, error)
+}
+
+// Last returns the user's most recent login, or nil when they never logged in before.
+func Last(ctx context.Context, store Store, email string) (*Login, error) {
+	list, _, err := store.List(ctx, email, 1, 0)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return &list[0], nil
+}
@@ -0,0 +1,59 @@
+package logins
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// MemoryStore is a Store that keeps logins in memory. Logins are lost when the
+// application stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	logins []Login // Oldest first
+
+	// Clock tells the time of CreatedAt, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{Clock: clock.System}
+}
+
+// Insert saves a new login and sets its ID, Tenant, and CreatedAt.
+func (s *MemoryStore) Insert(ctx context.Context, l *Login) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	l.ID = s.nextID
+	l.Tenant = tenant.ID(ctx)
+	l.CreatedAt = s.Clock.Now()
+	s.logins = append(s.logins, *l)
+	return nil
+}
+
+// List returns a page of the user's logins in the tenant, newest first, and the user's
+// total number of logins.
+func (s *MemoryStore) List(ctx context.Context, email string, limit, offset int) ([]Login, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	var list []Login
+	for _, l := range slices.Backward(s.logins) {
+		if l.Tenant == tenantID && l.Email == email {
+			list = append(list, l)
+		}
+	}
+
+	total := len(list)
+	offset = min(max(offset, 0), total)
+	end := min(offset+limit, total)
+	return list[offset:end], total, nil
+}
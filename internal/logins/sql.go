@@ -0,0 +1,63 @@
+package logins
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// SQLStore is a Store that saves logins in the logins table of a PostgreSQL database.
+// The table is created by the assets/migrations/007_create_logins.sql migration.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore for the logins table in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Insert saves a new login and sets its ID, Tenant, and CreatedAt.
+func (s *SQLStore) Insert(ctx context.Context, l *Login) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO logins (tenant_id, email, ip, user_agent) VALUES ($1, $2, $3, $4)
+		RETURNING id, tenant_id, created_at`,
+		tenant.ID(ctx), l.Email, l.IP, l.UserAgent,
+	).Scan(&l.ID, &l.Tenant, &l.CreatedAt)
+}
+
+// List returns a page of the user's logins in the tenant, newest first, and the user's
+// total number of logins.
+func (s *SQLStore) List(ctx context.Context, email string, limit, offset int) ([]Login, int, error) {
+	var total int
+	tenantID := tenant.ID(ctx)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM logins WHERE tenant_id = $1 AND email = $2`, tenantID, email,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, tenant_id, email, ip, user_agent, created_at FROM logins
+		WHERE tenant_id = $1 AND email = $2
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`,
+		tenantID, email, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var list []Login
+	for rows.Next() {
+		var l Login
+		if err := rows.Scan(&l.ID, &l.Tenant, &l.Email, &l.IP, &l.UserAgent, &l.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		list = append(list, l)
+	}
+	return list, total, rows.Err()
+}
@@ -0,0 +1,47 @@
+package logins
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewMemoryStore())
+}
+
+// testStore tests the behavior every Store has
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	// Users without logins don't have a last login
+	last, err := Last(ctx, store, "a@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, true, last == nil)
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		assert.NoError(t, store.Insert(ctx, &Login{Email: "a@example.com", IP: ip, UserAgent: "Firefox"}))
+	}
+	assert.NoError(t, store.Insert(ctx, &Login{Email: "b@example.com", IP: "10.0.0.4"}))
+
+	// Lists only have the user's logins, newest first
+	list, total, err := store.List(ctx, "a@example.com", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "10.0.0.3", list[0].IP)
+	assert.Equal(t, "10.0.0.2", list[1].IP)
+
+	last, err = Last(ctx, store, "a@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.3", last.IP)
+	assert.Equal(t, "Firefox", last.UserAgent)
+
+	// Logins of other tenants can't be seen
+	acme := tenant.WithTenant(ctx, &tenant.Tenant{ID: "acme"})
+	_, total, _ = store.List(acme, "a@example.com", 10, 0)
+	assert.Equal(t, 0, total)
+}
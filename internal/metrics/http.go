@@ -0,0 +1,22 @@
+package metrics
+
+// HTTP are the request metrics of an HTTP server.
+type HTTP struct {
+	// Requests counts the handled requests by method, route, and status code
+	Requests *Counter
+
+	// InFlight is the number of requests being handled
+	InFlight *Gauge
+
+	// Duration is the latency of requests in seconds by method and route
+	Duration *Histogram
+}
+
+// NewHTTP registers the HTTP server metrics with r.
+func NewHTTP(r *Registry) *HTTP {
+	return &HTTP{
+		Requests: r.Counter("http_requests_total", "Total HTTP requests by method, route, and status code.", "method", "route", "status"),
+		InFlight: r.Gauge("http_requests_in_flight", "HTTP requests being handled."),
+		Duration: r.Histogram("http_request_duration_seconds", "Latency of HTTP requests in seconds.", DefaultBuckets, "method", "route"),
+	}
+}
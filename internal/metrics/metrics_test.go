@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Total requests.", "method", "path")
+	inFlight := r.Gauge("in_flight", "Requests in flight.")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{1, 0.1}, "method")
+
+	requests.Inc("GET", "/")
+	requests.Add(2, "GET", "/")
+	requests.Inc("POST", `/say "hi"`)
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.Observe(0.05, "GET")
+	latency.Observe(0.5, "GET")
+	latency.Observe(3, "GET")
+
+	assert.Equal(t, 3.0, requests.Value("GET", "/"))
+	assert.Equal(t, 0.0, requests.Value("GET", "/missing"))
+	assert.Equal(t, 1.0, inFlight.Value())
+	assert.Equal(t, uint64(3), latency.Count("GET"))
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	assert.NoError(t, err)
+	want := `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/"} 3
+requests_total{method="POST",path="/say \"hi\""} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="GET",le="0.1"} 1
+latency_seconds_bucket{method="GET",le="1"} 2
+latency_seconds_bucket{method="GET",le="+Inf"} 3
+latency_seconds_sum{method="GET"} 3.55
+latency_seconds_count{method="GET"} 3
+`
+	assert.Equal(t, want, b.String())
+}
+
+func TestRegistryFuncs(t *testing.T) {
+	t.Parallel()
+
+	// Func metrics are read at every scrape
+	r := NewRegistry()
+	queued := 2.0
+	r.GaugeFunc("queued", "Queued tasks.", func() float64 { return queued })
+	r.CounterFunc("failed_total", "Failed tasks.", func() float64 { return 5 })
+	queued = 1
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	assert.NoError(t, err)
+	want := `# HELP queued Queued tasks.
+# TYPE queued gauge
+queued 1
+# HELP failed_total Failed tasks.
+# TYPE failed_total counter
+failed_total 5
+`
+	assert.Equal(t, want, b.String())
+}
+
+func TestRegistryMisuse(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	c := r.Counter("requests_total", "Total requests.", "method")
+
+	assert.PanicsWith(t, "metrics: requests_total is already registered", func() { r.Gauge("requests_total", "") })
+	assert.PanicsWith(t, "metrics: requests_total has 1 labels, got 0 values", func() { c.Inc() })
+	assert.PanicsWith(t, "metrics: counter requests_total can't go down", func() { c.Add(-1, "GET") })
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	m := NewHTTP(r)
+	m.Requests.Inc("GET", "/", "200")
+
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.StringIn(t, "text/plain; version=0.0.4", rr.Header().Get("Content-Type"))
+	assert.StringIn(t, `http_requests_total{method="GET",route="/",status="200"} 1`, rr.Body.String())
+	assert.StringIn(t, "# TYPE http_request_duration_seconds histogram", rr.Body.String())
+}
@@ -0,0 +1,288 @@
+// Package migrate applies the SQL migrations of the app to a PostgreSQL database and
+// records them in the schema_migrations table. A migration is a file named like
+// 002_create_notes.sql, with an optional 002_create_notes.down.sql that reverts it.
+// Each migration runs in a transaction that holds an advisory lock, so instances
+// starting at the same time don't apply a migration twice.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockID is the key of the advisory lock that migrations hold
+const lockID = 72_616_572
+
+var (
+	// ErrNoDown is returned by Down for a migration without a down file.
+	ErrNoDown = errors.New("migrate: migration has no down file")
+
+	// ErrUnknownVersion is returned by Down when the latest applied migration isn't one
+	// of the migrations, like after rolling back to an older build.
+	ErrUnknownVersion = errors.New("migrate: applied migration isn't known")
+)
+
+// Migration is one schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down reverts Up, or is empty when the migration can't be reverted
+	Down string
+}
+
+// Status is a migration and when it was applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load reads the migrations in the dir of fsys, sorted by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(file, ".sql") {
+			continue
+		}
+
+		name, down := strings.CutSuffix(strings.TrimSuffix(file, ".sql"), ".down")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s doesn't start with a version number", file)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		if m.Name != "" && m.Name != name {
+			return nil, fmt.Errorf("migrate: %s and %s have the same version", m.Name, name)
+		}
+		m.Name = name
+		if down {
+			m.Down = string(data)
+		} else {
+			m.Up = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: %s has a down file without an up file", m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a Migrator for the migrations from Load.
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up applies the migrations that haven't been applied yet, in order, and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range m.migrations {
+		ok, err := m.run(ctx, func(tx *sql.Tx) (bool, error) {
+			var exists bool
+			err := tx.QueryRowContext(ctx, `
+				SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version,
+			).Scan(&exists)
+			if err != nil || exists {
+				return false, err
+			}
+
+			if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+				return false, fmt.Errorf("migrate: %s: %w", migration.Name, err)
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+				migration.Version, migration.Name,
+			)
+			return err == nil, err
+		})
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Down reverts the latest applied migration and returns it, or nil when no migration
+// is applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var reverted *Migration
+	_, err := m.run(ctx, func(tx *sql.Tx) (bool, error) {
+		var version int64
+		err := tx.QueryRowContext(ctx, `
+			SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`,
+		).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		migration := m.find(version)
+		switch {
+		case migration == nil:
+			return false, fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		case migration.Down == "":
+			return false, fmt.Errorf("%w: %s", ErrNoDown, migration.Name)
+		}
+
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return false, fmt.Errorf("migrate: %s: %w", migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, version); err != nil {
+			return false, err
+		}
+		reverted = migration
+		return true, nil
+	})
+	return reverted, err
+}
+
+// Status returns every migration and whether it's applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+
+	appliedAt, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		at, ok := appliedAt[migration.Version]
+		statuses[i] = Status{Migration: migration, Applied: ok, AppliedAt: at}
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that aren't applied yet. Unlike Status, it doesn't
+// create the schema_migrations table, so it only reads for frequent checks, like
+// readiness probes. It returns an error when the table doesn't exist.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	appliedAt, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := appliedAt[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// applied returns when every applied migration was applied, by version
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return appliedAt, nil
+}
+
+// createTable creates the schema_migrations table
+func (m *Migrator) createTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+// run calls fn in a transaction with the advisory lock, and commits when fn changed
+// something
+func (m *Migrator) run(ctx context.Context, fn func(tx *sql.Tx) (bool, error)) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return false, err
+	}
+
+	changed, err := fn(tx)
+	if err != nil || !changed {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// find returns the migration with a version, or nil
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"migrations/002_create_notes.sql":     {Data: []byte("CREATE TABLE notes ();")},
+		"migrations/001_create_jobs.sql":      {Data: []byte("CREATE TABLE jobs ();")},
+		"migrations/001_create_jobs.down.sql": {Data: []byte("DROP TABLE jobs;")},
+		"migrations/README.md":                {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys, "migrations")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(migrations))
+	assert.Equal(t, Migration{Version: 1, Name: "001_create_jobs", Up: "CREATE TABLE jobs ();", Down: "DROP TABLE jobs;"}, migrations[0])
+	assert.Equal(t, Migration{Version: 2, Name: "002_create_notes", Up: "CREATE TABLE notes ();"}, migrations[1])
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]fstest.MapFS{
+		"no version": {
+			"migrations/create_jobs.sql": {Data: []byte("CREATE TABLE jobs ();")},
+		},
+		"duplicate version": {
+			"migrations/001_create_jobs.sql":  {Data: []byte("CREATE TABLE jobs ();")},
+			"migrations/001_create_notes.sql": {Data: []byte("CREATE TABLE notes ();")},
+		},
+		"down without up": {
+			"migrations/001_create_jobs.down.sql": {Data: []byte("DROP TABLE jobs;")},
+		},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Load(fsys, "migrations")
+			assert.NotEqual(t, nil, err)
+		})
+	}
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	t.Parallel()
+
+	// Every migration of the app can be reverted
+	migrations, err := Load(assets.EmbeddedFiles, "migrations")
+	assert.NoError(t, err)
+	for _, migration := range migrations {
+		assert.NotEqual(t, "", migration.Down)
+	}
+}
@@ -0,0 +1,87 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/dbtest"
+	"github.com/sglmr/gowebstart/internal/migrate"
+)
+
+func TestMigrator(t *testing.T) {
+	t.Parallel()
+
+	db := dbtest.New(t)
+	ctx := context.Background()
+
+	// dbtest.New applied the app's migrations, so these come after them
+	migrations := []migrate.Migration{
+		{Version: 1001, Name: "1001_create_things", Up: "CREATE TABLE things (id INT)", Down: "DROP TABLE things"},
+		{Version: 1002, Name: "1002_create_stuff", Up: "CREATE TABLE stuff (id INT)"},
+	}
+	migrator := migrate.New(db, migrations)
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(applied))
+
+	// Applying again does nothing
+	applied, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(applied))
+
+	pending, err := migrator.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(pending))
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, true, statuses[1].Applied)
+	assert.Equal(t, false, statuses[1].AppliedAt.IsZero())
+
+	// The latest migration has no down file
+	_, err = migrator.Down(ctx)
+	assert.Equal(t, true, errors.Is(err, migrate.ErrNoDown))
+
+	_, err = db.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = 1002")
+	assert.NoError(t, err)
+
+	pending, err = migrator.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pending))
+	assert.Equal(t, "1002_create_stuff", pending[0].Name)
+
+	reverted, err := migrator.Down(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "1001_create_things", reverted.Name)
+
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, false, statuses[0].Applied)
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	t.Parallel()
+
+	db := dbtest.New(t)
+	ctx := context.Background()
+
+	migrations, err := migrate.Load(assets.EmbeddedFiles, "migrations")
+	assert.NoError(t, err)
+	migrator := migrate.New(db, migrations)
+
+	// Every migration of the app reverts, and applies again afterwards
+	for {
+		reverted, err := migrator.Down(ctx)
+		assert.NoError(t, err)
+		if reverted == nil {
+			break
+		}
+	}
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), len(applied))
+}
@@ -0,0 +1,104 @@
+package notes
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// MemoryStore is a Store that keeps notes in memory. Notes are lost when the
+// application stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	notes  map[int64]Note
+
+	// Clock tells the time of CreatedAt and UpdatedAt, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{notes: map[int64]Note{}, Clock: clock.System}
+}
+
+// List returns a page of the owner's notes in the tenant, newest first, and the owner's
+// total number of notes.
+func (s *MemoryStore) List(ctx context.Context, owner string, limit, offset int) ([]Note, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	var owned []Note
+	for _, note := range s.notes {
+		if note.Tenant == tenantID && note.Owner == owner {
+			owned = append(owned, note)
+		}
+	}
+	slices.SortFunc(owned, func(a, b Note) int { return cmp.Compare(b.ID, a.ID) })
+
+	total := len(owned)
+	offset = min(max(offset, 0), total)
+	end := min(offset+limit, total)
+	return owned[offset:end], total, nil
+}
+
+// Get returns a note, or ErrNotFound for a note of another tenant.
+func (s *MemoryStore) Get(ctx context.Context, id int64) (*Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || note.Tenant != tenant.ID(ctx) {
+		return nil, ErrNotFound
+	}
+	return &note, nil
+}
+
+// Insert saves a new note and sets its ID, Tenant, CreatedAt, and UpdatedAt.
+func (s *MemoryStore) Insert(ctx context.Context, note *Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	note.ID = s.nextID
+	note.Tenant = tenant.ID(ctx)
+	note.CreatedAt = s.Clock.Now()
+	note.UpdatedAt = note.CreatedAt
+	s.notes[note.ID] = *note
+	return nil
+}
+
+// Update saves the title and body of a note and sets its UpdatedAt.
+func (s *MemoryStore) Update(ctx context.Context, note *Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, ok := s.notes[note.ID]
+	if !ok || saved.Tenant != tenant.ID(ctx) {
+		return ErrNotFound
+	}
+	saved.Title = note.Title
+	saved.Body = note.Body
+	saved.UpdatedAt = s.Clock.Now()
+	s.notes[note.ID] = saved
+
+	note.UpdatedAt = saved.UpdatedAt
+	return nil
+}
+
+// Delete deletes a note.
+func (s *MemoryStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if note, ok := s.notes[id]; !ok || note.Tenant != tenant.ID(ctx) {
+		return ErrNotFound
+	}
+	delete(s.notes, id)
+	return nil
+}
@@ -0,0 +1,45 @@
+// Package notes stores the notes of the example notes module. It's meant as a pattern
+// to copy for other features: a model, a Store interface, and a memory and SQL store.
+//
+// Notes belong to the tenant in the request context (see tenant.ID). Stores save it
+// with new notes and only ever find the notes of that tenant.
+package notes
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for a note that doesn't exist.
+var ErrNotFound = errors.New("notes: note not found")
+
+// Note is a titled piece of text owned by a user.
+type Note struct {
+	ID        int64
+	Tenant    string // ID of the tenant of the note, or "" for the main site
+	Owner     string // Email of the user who wrote the note
+	Title     string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Store saves notes. Implementations have to be safe for concurrent use.
+type Store interface {
+	// List returns a page of the owner's notes in the tenant, newest first, and the
+	// owner's total number of notes.
+	List(ctx context.Context, owner string, limit, offset int) ([]Note, int, error)
+
+	// Get returns a note, or ErrNotFound for a note of another tenant.
+	Get(ctx context.Context, id int64) (*Note, error)
+
+	// Insert saves a new note and sets its ID, Tenant, CreatedAt, and UpdatedAt.
+	Insert(ctx context.Context, note *Note) error
+
+	// Update saves the title and body of a note and sets its UpdatedAt.
+	Update(ctx context.Context, note *Note) error
+
+	// Delete deletes a note.
+	Delete(ctx context.Context, id int64) error
+}
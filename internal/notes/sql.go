@@ -0,0 +1,112 @@
+package notes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// SQLStore is a Store that saves notes in the notes table of a PostgreSQL database. The
+// table is created by the assets/migrations/002_create_notes.sql migration, and
+// 005_add_notes_tenant.sql adds the tenant_id column that every query filters by.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore for the notes table in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// List returns a page of the owner's notes in the tenant, newest first, and the owner's
+// total number of notes.
+func (s *SQLStore) List(ctx context.Context, owner string, limit, offset int) ([]Note, int, error) {
+	var total int
+	tenantID := tenant.ID(ctx)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM notes WHERE tenant_id = $1 AND owner = $2`, tenantID, owner,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, tenant_id, owner, title, body, created_at, updated_at FROM notes
+		WHERE tenant_id = $1 AND owner = $2
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`,
+		tenantID, owner, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var list []Note
+	for rows.Next() {
+		var note Note
+		err := rows.Scan(&note.ID, &note.Tenant, &note.Owner, &note.Title, &note.Body, &note.CreatedAt, &note.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, note)
+	}
+	return list, total, rows.Err()
+}
+
+// Get returns a note, or ErrNotFound for a note of another tenant.
+func (s *SQLStore) Get(ctx context.Context, id int64) (*Note, error) {
+	var note Note
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, tenant_id, owner, title, body, created_at, updated_at FROM notes
+		WHERE id = $1 AND tenant_id = $2`, id, tenant.ID(ctx),
+	).Scan(&note.ID, &note.Tenant, &note.Owner, &note.Title, &note.Body, &note.CreatedAt, &note.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// Insert saves a new note and sets its ID, Tenant, CreatedAt, and UpdatedAt.
+func (s *SQLStore) Insert(ctx context.Context, note *Note) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO notes (tenant_id, owner, title, body) VALUES ($1, $2, $3, $4)
+		RETURNING id, tenant_id, created_at, updated_at`,
+		tenant.ID(ctx), note.Owner, note.Title, note.Body,
+	).Scan(&note.ID, &note.Tenant, &note.CreatedAt, &note.UpdatedAt)
+}
+
+// Update saves the title and body of a note and sets its UpdatedAt.
+func (s *SQLStore) Update(ctx context.Context, note *Note) error {
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE notes SET title = $3, body = $4, updated_at = now()
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING updated_at`,
+		note.ID, tenant.ID(ctx), note.Title, note.Body,
+	).Scan(&note.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Delete deletes a note.
+func (s *SQLStore) Delete(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM notes WHERE id = $1 AND tenant_id = $2`, id, tenant.ID(ctx))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
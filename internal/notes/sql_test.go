@@ -0,0 +1,17 @@
+package notes
+
+import (
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/dbtest"
+)
+
+func TestSQLStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewSQLStore(dbtest.New(t)))
+}
+
+func TestSQLStoreTenants(t *testing.T) {
+	t.Parallel()
+	testStoreTenants(t, NewSQLStore(dbtest.New(t)))
+}
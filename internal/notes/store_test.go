@@ -0,0 +1,87 @@
+package notes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreTenants(t *testing.T) {
+	t.Parallel()
+	testStoreTenants(t, NewMemoryStore())
+}
+
+// testStore tests the behavior every Store has
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	for _, title := range []string{"one", "two", "three"} {
+		assert.NoError(t, store.Insert(ctx, &Note{Owner: "a@example.com", Title: title}))
+	}
+	assert.NoError(t, store.Insert(ctx, &Note{Owner: "b@example.com", Title: "other"}))
+
+	// Lists only have the owner's notes, newest first
+	list, total, err := store.List(ctx, "a@example.com", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "three", list[0].Title)
+
+	list, _, err = store.List(ctx, "a@example.com", 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, "one", list[0].Title)
+
+	// Updates change the title and body
+	note := &Note{ID: list[0].ID, Title: "first", Body: "text"}
+	assert.NoError(t, store.Update(ctx, note))
+	got, err := store.Get(ctx, note.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", got.Title)
+	assert.Equal(t, "a@example.com", got.Owner)
+
+	// Deleted notes are gone
+	assert.NoError(t, store.Delete(ctx, note.ID))
+	_, err = store.Get(ctx, note.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, store.Delete(ctx, note.ID))
+	assert.Equal(t, ErrNotFound, store.Update(ctx, note))
+}
+
+// testStoreTenants tests that a Store keeps the notes of tenants apart
+func testStoreTenants(t *testing.T, store Store) {
+	mainSite := context.Background()
+	acme := tenant.WithTenant(mainSite, &tenant.Tenant{ID: "acme"})
+
+	note := &Note{Owner: "a@example.com", Title: "acme"}
+	assert.NoError(t, store.Insert(acme, note))
+	assert.Equal(t, "acme", note.Tenant)
+	assert.NoError(t, store.Insert(mainSite, &Note{Owner: "a@example.com", Title: "main"}))
+
+	// Each tenant only sees its own notes
+	list, total, err := store.List(acme, "a@example.com", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "acme", list[0].Title)
+
+	list, _, err = store.List(mainSite, "a@example.com", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "main", list[0].Title)
+
+	// Other tenants can't find, change, or delete the note
+	_, err = store.Get(mainSite, note.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, store.Update(mainSite, note))
+	assert.Equal(t, ErrNotFound, store.Delete(mainSite, note.ID))
+
+	got, err := store.Get(acme, note.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", got.Title)
+}
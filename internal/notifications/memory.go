@@ -0,0 +1,113 @@
+package notifications
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// MemoryStore is a Store that keeps notifications in memory. Notifications are lost
+// when the application stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu            sync.Mutex
+	nextID        int64
+	notifications map[int64]Notification
+
+	// Clock tells the time of CreatedAt and ReadAt, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{notifications: map[int64]Notification{}, Clock: clock.System}
+}
+
+// Insert saves a new notification and sets its ID, Tenant, and CreatedAt.
+func (s *MemoryStore) Insert(ctx context.Context, n *Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	n.ID = s.nextID
+	n.Tenant = tenant.ID(ctx)
+	n.CreatedAt = s.Clock.Now()
+	s.notifications[n.ID] = *n
+	return nil
+}
+
+// List returns a page of the recipient's notifications in the tenant, newest first, and
+// the recipient's total number of notifications.
+func (s *MemoryStore) List(ctx context.Context, recipient string, limit, offset int) ([]Notification, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.received(ctx, recipient)
+	slices.SortFunc(list, func(a, b Notification) int { return cmp.Compare(b.ID, a.ID) })
+
+	total := len(list)
+	offset = min(max(offset, 0), total)
+	end := min(offset+limit, total)
+	return list[offset:end], total, nil
+}
+
+// Unread returns the number of the recipient's unread notifications.
+func (s *MemoryStore) Unread(ctx context.Context, recipient string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unread := 0
+	for _, n := range s.received(ctx, recipient) {
+		if n.Unread() {
+			unread++
+		}
+	}
+	return unread, nil
+}
+
+// MarkRead marks one of the recipient's notifications as read, or returns ErrNotFound.
+func (s *MemoryStore) MarkRead(ctx context.Context, recipient string, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notifications[id]
+	if !ok || n.Tenant != tenant.ID(ctx) || n.Recipient != recipient {
+		return ErrNotFound
+	}
+	if n.Unread() {
+		n.ReadAt = s.Clock.Now()
+		s.notifications[id] = n
+	}
+	return nil
+}
+
+// MarkAllRead marks all of the recipient's notifications as read.
+func (s *MemoryStore) MarkAllRead(ctx context.Context, recipient string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Clock.Now()
+	for _, n := range s.received(ctx, recipient) {
+		if n.Unread() {
+			n.ReadAt = now
+			s.notifications[n.ID] = n
+		}
+	}
+	return nil
+}
+
+// received returns the recipient's notifications in the tenant of ctx. The caller has
+// to hold the lock.
+func (s *MemoryStore) received(ctx context.Context, recipient string) []Notification {
+	tenantID := tenant.ID(ctx)
+	var list []Notification
+	for _, n := range s.notifications {
+		if n.Tenant == tenantID && n.Recipient == recipient {
+			list = append(list, n)
+		}
+	}
+	return list
+}
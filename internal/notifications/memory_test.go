@@ -0,0 +1,54 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	for _, title := range []string{"one", "two", "three"} {
+		assert.NoError(t, store.Insert(ctx, &Notification{Recipient: "a@example.com", Title: title}))
+	}
+	assert.NoError(t, store.Insert(ctx, &Notification{Recipient: "b@example.com", Title: "other"}))
+
+	// Lists only have the recipient's notifications, newest first
+	list, total, err := store.List(ctx, "a@example.com", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "three", list[0].Title)
+	assert.Equal(t, true, list[0].Unread())
+
+	unread, err := store.Unread(ctx, "a@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, unread)
+
+	// Users can only mark their own notifications as read
+	assert.Equal(t, ErrNotFound, store.MarkRead(ctx, "b@example.com", list[0].ID))
+	assert.NoError(t, store.MarkRead(ctx, "a@example.com", list[0].ID))
+	unread, _ = store.Unread(ctx, "a@example.com")
+	assert.Equal(t, 2, unread)
+
+	list, _, _ = store.List(ctx, "a@example.com", 1, 0)
+	assert.Equal(t, false, list[0].Unread())
+
+	assert.NoError(t, store.MarkAllRead(ctx, "a@example.com"))
+	unread, _ = store.Unread(ctx, "a@example.com")
+	assert.Equal(t, 0, unread)
+	unread, _ = store.Unread(ctx, "b@example.com")
+	assert.Equal(t, 1, unread)
+
+	// Notifications of other tenants can't be seen or changed
+	acme := tenant.WithTenant(ctx, &tenant.Tenant{ID: "acme"})
+	_, total, _ = store.List(acme, "b@example.com", 10, 0)
+	assert.Equal(t, 0, total)
+	assert.Equal(t, ErrNotFound, store.MarkRead(acme, "a@example.com", list[0].ID))
+}
@@ -0,0 +1,52 @@
+// Package notifications stores in-app notifications for users, like mentions and admin
+// alerts, with their read state.
+//
+// Like notes, notifications belong to the tenant in the request context (see tenant.ID).
+package notifications
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for a notification that doesn't exist or belongs
+// to another user.
+var ErrNotFound = errors.New("notifications: notification not found")
+
+// Notification is a message for a user inside the application.
+type Notification struct {
+	ID        int64
+	Tenant    string // ID of the tenant of the notification, or "" for the main site
+	Recipient string // Email of the user the notification is for
+	Title     string
+	Body      string
+	URL       string    // Optional local path of the page the notification is about
+	ReadAt    time.Time // Zero until the recipient reads the notification
+	CreatedAt time.Time
+}
+
+// Unread reports whether the recipient hasn't read the notification yet.
+func (n Notification) Unread() bool {
+	return n.ReadAt.IsZero()
+}
+
+// Store saves notifications. Implementations have to be safe for concurrent use.
+type Store interface {
+	// Insert saves a new notification and sets its ID, Tenant, and CreatedAt.
+	Insert(ctx context.Context, n *Notification) error
+
+	// List returns a page of the recipient's notifications in the tenant, newest
+	// first, and the recipient's total number of notifications.
+	List(ctx context.Context, recipient string, limit, offset int) ([]Notification, int, error)
+
+	// Unread returns the number of the recipient's unread notifications.
+	Unread(ctx context.Context, recipient string) (int, error)
+
+	// MarkRead marks one of the recipient's notifications as read, or returns
+	// ErrNotFound.
+	MarkRead(ctx context.Context, recipient string, id int64) error
+
+	// MarkAllRead marks all of the recipient's notifications as read.
+	MarkAllRead(ctx context.Context, recipient string) error
+}
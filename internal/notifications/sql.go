@@ -0,0 +1,105 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// SQLStore is a Store that saves notifications in the notifications table of a
+// PostgreSQL database. The table is created by the
+// assets/migrations/006_create_notifications.sql migration.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore for the notifications table in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Insert saves a new notification and sets its ID, Tenant, and CreatedAt.
+func (s *SQLStore) Insert(ctx context.Context, n *Notification) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO notifications (tenant_id, recipient, title, body, url) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, tenant_id, created_at`,
+		tenant.ID(ctx), n.Recipient, n.Title, n.Body, n.URL,
+	).Scan(&n.ID, &n.Tenant, &n.CreatedAt)
+}
+
+// List returns a page of the recipient's notifications in the tenant, newest first, and
+// the recipient's total number of notifications.
+func (s *SQLStore) List(ctx context.Context, recipient string, limit, offset int) ([]Notification, int, error) {
+	var total int
+	tenantID := tenant.ID(ctx)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM notifications WHERE tenant_id = $1 AND recipient = $2`, tenantID, recipient,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, tenant_id, recipient, title, body, url, read_at, created_at FROM notifications
+		WHERE tenant_id = $1 AND recipient = $2
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`,
+		tenantID, recipient, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var list []Notification
+	for rows.Next() {
+		var n Notification
+		var readAt sql.NullTime
+		err := rows.Scan(&n.ID, &n.Tenant, &n.Recipient, &n.Title, &n.Body, &n.URL, &readAt, &n.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		n.ReadAt = readAt.Time
+		list = append(list, n)
+	}
+	return list, total, rows.Err()
+}
+
+// Unread returns the number of the recipient's unread notifications.
+func (s *SQLStore) Unread(ctx context.Context, recipient string) (int, error) {
+	var unread int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM notifications
+		WHERE tenant_id = $1 AND recipient = $2 AND read_at IS NULL`, tenant.ID(ctx), recipient,
+	).Scan(&unread)
+	return unread, err
+}
+
+// MarkRead marks one of the recipient's notifications as read, or returns ErrNotFound.
+func (s *SQLStore) MarkRead(ctx context.Context, recipient string, id int64) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = coalesce(read_at, now())
+		WHERE id = $1 AND tenant_id = $2 AND recipient = $3`, id, tenant.ID(ctx), recipient,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks all of the recipient's notifications as read.
+func (s *SQLStore) MarkAllRead(ctx context.Context, recipient string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = now()
+		WHERE tenant_id = $1 AND recipient = $2 AND read_at IS NULL`, tenant.ID(ctx), recipient,
+	)
+	return err
+}
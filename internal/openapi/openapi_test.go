@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+type base struct {
+	ID int64 `json:"id"`
+}
+
+type note struct {
+	base
+	Title     string            `json:"title"`
+	Tags      []string          `json:"tags,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	Secret    string            `json:"-"`
+	internal  string
+}
+
+func TestSchemaOf(t *testing.T) {
+	t.Parallel()
+
+	s := SchemaOf(note{})
+	assert.Equal(t, "object", s.Type)
+	assert.EqualSlices(t, []string{"id", "title", "created_at"}, s.Required)
+	assert.Equal(t, 5, len(s.Properties))
+	assert.Equal(t, "int64", s.Properties["id"].Format)
+	assert.Equal(t, "array", s.Properties["tags"].Type)
+	assert.Equal(t, "string", s.Properties["tags"].Items.Type)
+	assert.Equal(t, "string", s.Properties["meta"].AdditionalProperties.Type)
+	assert.Equal(t, "date-time", s.Properties["created_at"].Format)
+}
+
+func TestDocument(t *testing.T) {
+	t.Parallel()
+
+	d := New("Test API", "1.0")
+	d.AddSecurityScheme("bearer", SecurityScheme{Type: "http", Scheme: "bearer"})
+	ref := d.Schema("Note", note{})
+	assert.Equal(t, "#/components/schemas/Note", ref.Ref)
+
+	d.Add("GET /notes/{id}/{$}", Operation{
+		Summary:   "Get a note",
+		Responses: map[string]Response{"200": JSONResponse("The note", ref)},
+	})
+	d.Add("DELETE /notes/{id}/{$}", Operation{
+		Parameters: []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}}},
+		Responses:  map[string]Response{"204": {Description: "Deleted"}},
+	})
+	d.Add("GET /files/{key...}", Operation{})
+
+	// Wildcards become path parameters, without the {$} and ... of the mux patterns
+	item := d.Paths["/notes/{id}/"]
+	assert.Equal(t, 2, len(item))
+	assert.Equal(t, "id", item["get"].Parameters[0].Name)
+	assert.Equal(t, "string", item["get"].Parameters[0].Schema.Type)
+	assert.Equal(t, 1, len(item["delete"].Parameters))
+	assert.Equal(t, "integer", item["delete"].Parameters[0].Schema.Type)
+	assert.Equal(t, "key", d.Paths["/files/{key}"]["get"].Parameters[0].Name)
+
+	data, err := json.Marshal(d)
+	assert.NoError(t, err)
+	assert.StringIn(t, `"openapi":"3.0.3"`, string(data))
+	assert.StringIn(t, `"security":[{"bearer":[]}]`, string(data))
+	assert.StringIn(t, `"$ref":"#/components/schemas/Note"`, string(data))
+}
@@ -0,0 +1,88 @@
+// Package pagination splits lists into numbered pages for templates.
+package pagination
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Pagination describes one page of a list with Total items.
+type Pagination struct {
+	Page    int // Current page, starting at 1
+	PerPage int
+	Total   int
+}
+
+// New returns the pagination for a page. Pages out of range are moved to the
+// first or last page.
+func New(page, perPage, total int) Pagination {
+	p := Pagination{Page: page, PerPage: max(perPage, 1), Total: max(total, 0)}
+	p.Page = min(max(p.Page, 1), p.TotalPages())
+	return p
+}
+
+// FromRequest reads the page number from the "page" query parameter, 1 when it's
+// missing or invalid. Call New with it once the total is known.
+func FromRequest(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// PerPageFromRequest reads the number of items on a page from the "per_page" query
+// parameter, at most maxPerPage. It's defaultPerPage when it's missing or invalid.
+func PerPageFromRequest(r *http.Request, defaultPerPage, maxPerPage int) int {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		return defaultPerPage
+	}
+	return min(perPage, maxPerPage)
+}
+
+// TotalPages returns the number of pages, at least 1 so an empty list has a page.
+func (p Pagination) TotalPages() int {
+	return max((p.Total+p.PerPage-1)/p.PerPage, 1)
+}
+
+// Offset returns the number of items before the current page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// HasPrev reports whether there is a page before the current one.
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+// HasNext reports whether there is a page after the current one.
+func (p Pagination) HasNext() bool {
+	return p.Page < p.TotalPages()
+}
+
+// PrevPage returns the number of the previous page.
+func (p Pagination) PrevPage() int {
+	return max(p.Page-1, 1)
+}
+
+// NextPage returns the number of the next page.
+func (p Pagination) NextPage() int {
+	return min(p.Page+1, p.TotalPages())
+}
+
+// Window returns the numbers of up to size pages around the current one for page links,
+// like [3 4 5 6 7] for page 5 of 10. The window moves in at the first and last pages,
+// so it has size pages whenever there are enough.
+func (p Pagination) Window(size int) []int {
+	size = min(max(size, 1), p.TotalPages())
+
+	first := max(p.Page-size/2, 1)
+	first = min(first, p.TotalPages()-size+1)
+
+	pages := make([]int, size)
+	for i := range pages {
+		pages[i] = first + i
+	}
+	return pages
+}
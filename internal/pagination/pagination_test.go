@@ -0,0 +1,85 @@
+package pagination
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		page       int
+		total      int
+		wantPage   int
+		wantPages  int
+		wantOffset int
+		hasPrev    bool
+		hasNext    bool
+	}{
+		{"empty list", 1, 0, 1, 1, 0, false, false},
+		{"first page", 1, 25, 1, 3, 0, false, true},
+		{"middle page", 2, 25, 2, 3, 10, true, true},
+		{"last page", 3, 25, 3, 3, 20, true, false},
+		{"past the end", 9, 25, 3, 3, 20, true, false},
+		{"before the start", -1, 25, 1, 3, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.page, 10, tt.total)
+			assert.Equal(t, tt.wantPage, p.Page)
+			assert.Equal(t, tt.wantPages, p.TotalPages())
+			assert.Equal(t, tt.wantOffset, p.Offset())
+			assert.Equal(t, tt.hasPrev, p.HasPrev())
+			assert.Equal(t, tt.hasNext, p.HasNext())
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	t.Parallel()
+
+	for query, want := range map[string]int{"": 1, "?page=3": 3, "?page=abc": 1, "?page=0": 1} {
+		r := httptest.NewRequest(http.MethodGet, "/notes/"+query, nil)
+		assert.Equal(t, want, FromRequest(r))
+	}
+}
+
+func TestPerPageFromRequest(t *testing.T) {
+	t.Parallel()
+
+	for query, want := range map[string]int{"": 20, "?per_page=5": 5, "?per_page=500": 100, "?per_page=abc": 20, "?per_page=0": 20} {
+		r := httptest.NewRequest(http.MethodGet, "/notes/"+query, nil)
+		assert.Equal(t, want, PerPageFromRequest(r, 20, 100))
+	}
+}
+
+func TestWindow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		page  int
+		total int
+		size  int
+		want  []int
+	}{
+		{"middle page", 5, 100, 5, []int{3, 4, 5, 6, 7}},
+		{"first page", 1, 100, 5, []int{1, 2, 3, 4, 5}},
+		{"last page", 10, 100, 5, []int{6, 7, 8, 9, 10}},
+		{"even size", 5, 100, 4, []int{3, 4, 5, 6}},
+		{"fewer pages than the size", 2, 30, 5, []int{1, 2, 3}},
+		{"empty list", 1, 0, 5, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualSlices(t, tt.want, New(tt.page, 10, tt.total).Window(tt.size))
+		})
+	}
+}
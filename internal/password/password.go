@@ -0,0 +1,68 @@
+// Package password verifies password hashes in any of the supported formats, so apps
+// moving from bcrypt can keep their users' hashes and rehash them with argon2id as
+// they log in. New hashes are always argon2id.
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sglmr/gowebstart/internal/argon2id"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownFormat is returned by Verify for a hash in an unsupported format.
+var ErrUnknownFormat = errors.New("password: unknown hash format")
+
+// Hash formats returned by Format
+const (
+	FormatArgon2id = "argon2id"
+	FormatBcrypt   = "bcrypt"
+)
+
+// Format returns the format of a hash, or "" for an unknown format.
+func Format(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return FormatArgon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return FormatBcrypt
+	}
+	return ""
+}
+
+// Hash returns a new argon2id hash of a password.
+func Hash(password string, params *argon2id.Params) (string, error) {
+	return argon2id.CreateHash(password, params)
+}
+
+// Verify reports whether a password matches a hash in any supported format, with the
+// peppers of params for argon2id hashes. When it matches, rehash reports whether the
+// hash should be replaced with a new Hash of the password with params: bcrypt hashes,
+// and argon2id hashes weaker than params. A nil params never asks for a rehash, and
+// only verifies hashes without a pepper.
+func Verify(password, hash string, params *argon2id.Params) (match, rehash bool, err error) {
+	switch Format(hash) {
+	case FormatArgon2id:
+		var peppers map[string][]byte
+		if params != nil {
+			peppers = params.Peppers
+		}
+		match, hashParams, err := argon2id.CheckHash(password, hash, peppers)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, params != nil && argon2id.NeedsRehash(hashParams, params), nil
+
+	case FormatBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, params != nil, nil
+	}
+	return false, false, ErrUnknownFormat
+}
@@ -0,0 +1,49 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/argon2id"
+	"github.com/sglmr/gowebstart/internal/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	params := &argon2id.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	stronger := &argon2id.Params{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	argonHash, err := Hash("password", params)
+	assert.NoError(t, err)
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		password   string
+		hash       string
+		params     *argon2id.Params
+		wantMatch  bool
+		wantRehash bool
+	}{
+		{"argon2id", "password", argonHash, params, true, false},
+		{"argon2id wrong password", "wrong", argonHash, params, false, false},
+		{"argon2id weaker params", "password", argonHash, stronger, true, true},
+		{"bcrypt", "password", string(bcryptHash), params, true, true},
+		{"bcrypt wrong password", "wrong", string(bcryptHash), params, false, false},
+		{"bcrypt without params", "password", string(bcryptHash), nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := Verify(tt.password, tt.hash, tt.params)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMatch, match)
+			assert.Equal(t, tt.wantRehash, rehash)
+		})
+	}
+
+	_, _, err = Verify("password", "$1$md5$hash", nil)
+	assert.Equal(t, ErrUnknownFormat, err)
+	assert.Equal(t, FormatBcrypt, Format("$2y$10$abc"))
+}
@@ -0,0 +1,150 @@
+// Package pwned checks whether passwords appeared in data breaches, with the Have I Been
+// Pwned range API or an offline list of password hashes.
+//
+// The range API uses k-anonymity: only the first 5 characters of the SHA-1 hash of a
+// password are sent, and the matching is done locally.
+package pwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checker reports how often a password appeared in data breaches, 0 for never.
+type Checker interface {
+	Count(ctx context.Context, password string) (int, error)
+}
+
+// New returns the Checker for a source: "api" for the range API with a request timeout,
+// or the name of a list file for OpenList. "" and "off" return a nil Checker.
+func New(source string, timeout time.Duration) (Checker, error) {
+	switch source {
+	case "", "off":
+		return nil, nil
+	case "api":
+		return NewClient(timeout), nil
+	}
+	return OpenList(source)
+}
+
+// hash returns the uppercase hex SHA-1 hash of a password, like the API uses
+func hash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+//=============================================================================
+//	Range API client
+//=============================================================================
+
+// DefaultURL is the Have I Been Pwned range API.
+const DefaultURL = "https://api.pwnedpasswords.com/range/"
+
+// Client is a Checker that asks the Have I Been Pwned range API.
+type Client struct {
+	// URL is the range API, which the hash prefix is added to
+	URL    string
+	client *http.Client
+}
+
+// NewClient creates a Client for the range API with a request timeout.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{URL: DefaultURL, client: &http.Client{Timeout: timeout}}
+}
+
+// Count returns how often a password appeared in data breaches.
+func (c *Client) Count(ctx context.Context, password string) (int, error) {
+	h := hash(password)
+	prefix, suffix := h[:5], h[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Padding hides the number of matching hashes from anyone watching the response size
+	req.Header.Set("Add-Padding", "true")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("pwned: range request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("pwned: range request: %s", res.Status)
+	}
+
+	// Every line is a hash suffix and a count, like "0018A45C4D1DEF81644B54AB7F969B88D65:10".
+	// Padding lines have a count of 0.
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		s, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(s, suffix) {
+			return strconv.Atoi(count)
+		}
+	}
+	return 0, scanner.Err()
+}
+
+//=============================================================================
+//	Offline list
+//=============================================================================
+
+// List is a Checker with an offline list of SHA-1 password hashes, for servers that
+// can't reach the API. It keeps the list in memory, so use a list of the most common
+// passwords rather than the whole Have I Been Pwned download.
+type List struct {
+	counts map[string]int
+}
+
+// ReadList reads a list of SHA-1 password hashes, one per line, with an optional count
+// like the Have I Been Pwned downloads: "7C4A8D09CA3762AF61E59520943DC26494F8941B:100".
+func ReadList(r io.Reader) (*List, error) {
+	l := &List{counts: map[string]int{}}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		h, countText, hasCount := strings.Cut(text, ":")
+		if len(h) != 40 {
+			return nil, fmt.Errorf("pwned: line %d: not a SHA-1 hash", line)
+		}
+		count := 1
+		if hasCount {
+			n, err := strconv.Atoi(countText)
+			if err != nil {
+				return nil, fmt.Errorf("pwned: line %d: invalid count: %w", line, err)
+			}
+			count = max(n, 1)
+		}
+		l.counts[strings.ToUpper(h)] = count
+	}
+	return l, scanner.Err()
+}
+
+// OpenList reads a list of SHA-1 password hashes from a file, see ReadList.
+func OpenList(name string) (*List, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadList(f)
+}
+
+// Count returns how often a password appeared in data breaches.
+func (l *List) Count(ctx context.Context, password string) (int, error) {
+	return l.counts[hash(password)], nil
+}
@@ -0,0 +1,62 @@
+package pwned
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+// The SHA-1 hash of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	var gotPath, gotPadding string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotPadding = r.URL.Path, r.Header.Get("Add-Padding")
+		w.Write([]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:52256179\r\nFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:0\r\n"))
+	}))
+	defer api.Close()
+
+	client := NewClient(time.Second)
+	client.URL = api.URL + "/range/"
+
+	count, err := client.Count(context.Background(), "password")
+	assert.NoError(t, err)
+	assert.Equal(t, 52256179, count)
+
+	// Only the hash prefix is sent
+	assert.Equal(t, "/range/5BAA6", gotPath)
+	assert.Equal(t, "true", gotPadding)
+
+	count, err = client.Count(context.Background(), "correct horse battery staple")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Unreachable APIs are errors
+	client.URL = "http://127.0.0.1:1/range/"
+	_, err = client.Count(context.Background(), "password")
+	assert.Equal(t, true, err != nil)
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	list, err := ReadList(strings.NewReader("# common passwords\n5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:12\n\n7C4A8D09CA3762AF61E59520943DC26494F8941B\n"))
+	assert.NoError(t, err)
+
+	count, _ := list.Count(context.Background(), "password")
+	assert.Equal(t, 12, count)
+	count, _ = list.Count(context.Background(), "123456")
+	assert.Equal(t, 1, count)
+	count, _ = list.Count(context.Background(), "correct horse battery staple")
+	assert.Equal(t, 0, count)
+
+	_, err = ReadList(strings.NewReader("not a hash\n"))
+	assert.Equal(t, true, err != nil)
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+// Lockout locks a key out after repeated failures, like the failed logins of an email.
+// The first lock starts at the free+1st failure in a row and lasts delay, and every
+// further failure doubles it, up to maxDelay. Failures are forgotten maxDelay after the
+// last one, or on Reset.
+type Lockout struct {
+	free     int
+	delay    time.Duration
+	maxDelay time.Duration
+
+	// Clock tells the time for the locks, clock.System by default.
+	Clock clock.Clock
+
+	mu        sync.Mutex
+	failures  map[string]*failures
+	lastSweep time.Time
+}
+
+type failures struct {
+	count int
+	last  time.Time
+	until time.Time // End of the lock, zero when the key isn't locked
+}
+
+// NewLockout creates a Lockout that allows free failures in a row before it locks a key
+// for delay, doubling up to maxDelay.
+func NewLockout(free int, delay, maxDelay time.Duration) *Lockout {
+	return &Lockout{
+		free:     max(free, 0),
+		delay:    delay,
+		maxDelay: max(maxDelay, delay),
+		Clock:    clock.System,
+		failures: map[string]*failures{},
+	}
+}
+
+// Locked reports whether key is locked out, and how long until the lock ends.
+func (l *Lockout) Locked(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[key]
+	if !ok {
+		return false, 0
+	}
+	if wait := f.until.Sub(l.Clock.Now()); wait > 0 {
+		return true, wait
+	}
+	return false, 0
+}
+
+// Fail records a failure for key. It returns how long key is locked out for, or zero
+// while it has free failures left.
+func (l *Lockout) Fail(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Clock.Now()
+	l.sweep(now)
+
+	f, ok := l.failures[key]
+	if !ok {
+		f = &failures{}
+		l.failures[key] = f
+	}
+	f.count++
+	f.last = now
+
+	if f.count <= l.free {
+		return 0
+	}
+
+	// Double the delay for every failure past the free ones, without overflowing
+	wait := l.delay
+	for range f.count - l.free - 1 {
+		if wait >= l.maxDelay {
+			break
+		}
+		wait *= 2
+	}
+	wait = min(wait, l.maxDelay)
+	f.until = now.Add(wait)
+	return wait
+}
+
+// Reset forgets the failures of key, like after a successful login.
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+// sweep deletes the failures that are forgotten, once a minute, so the map doesn't grow
+// with every key ever seen
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, f := range l.failures {
+		if now.Sub(f.last) > l.maxDelay && !now.Before(f.until) {
+			delete(l.failures, key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+func TestLockout(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := NewLockout(2, time.Minute, 5*time.Minute)
+	l.Clock = clk
+
+	// The free failures don't lock the key
+	assert.Equal(t, time.Duration(0), l.Fail("a"))
+	assert.Equal(t, time.Duration(0), l.Fail("a"))
+	locked, _ := l.Locked("a")
+	assert.Equal(t, false, locked)
+
+	// Then every failure doubles the lock, up to the maximum
+	assert.Equal(t, time.Minute, l.Fail("a"))
+	locked, wait := l.Locked("a")
+	assert.Equal(t, true, locked)
+	assert.Equal(t, time.Minute, wait)
+	assert.Equal(t, 2*time.Minute, l.Fail("a"))
+	assert.Equal(t, 4*time.Minute, l.Fail("a"))
+	assert.Equal(t, 5*time.Minute, l.Fail("a"))
+
+	// Other keys have their own failures
+	locked, _ = l.Locked("b")
+	assert.Equal(t, false, locked)
+
+	// Locks end after their delay
+	clk.Add(5 * time.Minute)
+	locked, _ = l.Locked("a")
+	assert.Equal(t, false, locked)
+
+	// Resets forget the failures
+	l.Reset("a")
+	assert.Equal(t, time.Duration(0), l.Fail("a"))
+
+	// Old failures are swept away
+	l.Fail("b")
+	clk.Add(time.Hour)
+	l.Fail("c")
+	assert.Equal(t, 1, len(l.failures))
+}
@@ -0,0 +1,96 @@
+// Package ratelimit limits how often a key, like a client IP or API key, can do
+// something, with a token bucket for every key. A Lockout locks a key out after repeated
+// failures instead.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+// Limiter allows rate events per second for every key, with bursts of up to burst events.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	// Clock tells the time for refilling the buckets, clock.System by default.
+	Clock clock.Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter that allows rate events per second for every key, with bursts
+// of up to burst events.
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		Clock:   clock.System,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// PerMinute creates a Limiter that allows n events a minute for every key, all of
+// which can happen at once.
+func PerMinute(n int) *Limiter {
+	return New(float64(n)/60, n)
+}
+
+// PerHour creates a Limiter that allows n events an hour for every key, all of which
+// can happen at once.
+func PerHour(n int) *Limiter {
+	return New(float64(n)/3600, n)
+}
+
+// Allow uses up an event for key. It returns false, and how long until the next event
+// is allowed, when key is over the limit.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Clock.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill the bucket for the time since the last event
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep deletes the buckets that have refilled, once a minute, so the map doesn't
+// grow with every key ever seen
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
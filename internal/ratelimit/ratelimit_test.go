@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := New(1, 2)
+	l.Clock = clk
+
+	// The burst is allowed right away
+	ok, _ := l.Allow("a")
+	assert.Equal(t, true, ok)
+	ok, _ = l.Allow("a")
+	assert.Equal(t, true, ok)
+
+	// Then the key has to wait for the bucket to refill
+	ok, wait := l.Allow("a")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// Other keys have their own bucket
+	ok, _ = l.Allow("b")
+	assert.Equal(t, true, ok)
+
+	clk.Add(time.Second)
+	ok, _ = l.Allow("a")
+	assert.Equal(t, true, ok)
+
+	// Idle buckets are swept away
+	clk.Add(time.Hour)
+	l.Allow("c")
+	assert.Equal(t, 1, len(l.buckets))
+}
@@ -0,0 +1,110 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Cache keeps parsed template sets, so templates aren't parsed again for every request.
+// Each page is parsed with the base template and partials once, and is keyed by its name.
+// Other template sets are parsed the first time they're rendered.
+type Cache struct {
+	fsys   fs.FS
+	funcs  template.FuncMap
+	reload bool
+
+	mu   sync.RWMutex
+	sets map[string]*template.Template
+}
+
+// NewCache parses every page in the templates/pages folder of fsys with the template
+// functions of funcMap, like funcs.New(clock.System). It returns an error for the first
+// page that doesn't parse, so broken templates stop the app at startup.
+//
+// With reload, nothing is parsed up front and every render parses the templates again,
+// so template edits on disk show up without a restart. It's for development mode with
+// os.DirFS("assets").
+func NewCache(fsys fs.FS, funcMap template.FuncMap, reload bool) (*Cache, error) {
+	c := &Cache{fsys: fsys, funcs: funcMap, reload: reload, sets: map[string]*template.Template{}}
+	if reload {
+		return c, nil
+	}
+
+	pages, err := fs.Glob(fsys, "templates/pages/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		patterns := pagePatterns(path.Base(page))
+		ts, err := c.parse(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing page %s: %w", path.Base(page), err)
+		}
+		c.sets[path.Base(page)] = ts
+	}
+
+	return c, nil
+}
+
+// page returns the parsed template set of a page, like "home.tmpl"
+func (c *Cache) page(pageName string) (*template.Template, error) {
+	return c.get(pageName, pagePatterns(pageName))
+}
+
+// templates returns the parsed template set of the patterns, relative to the templates
+// folder
+func (c *Cache) templates(patterns ...string) (*template.Template, error) {
+	return c.get(strings.Join(patterns, ","), patterns)
+}
+
+// get returns the cached template set of key, or parses the patterns and caches them
+func (c *Cache) get(key string, patterns []string) (*template.Template, error) {
+	if c.reload {
+		return c.parse(patterns)
+	}
+
+	c.mu.RLock()
+	ts, ok := c.sets[key]
+	c.mu.RUnlock()
+	if ok {
+		return ts, nil
+	}
+
+	ts, err := c.parse(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.sets[key] = ts
+	c.mu.Unlock()
+	return ts, nil
+}
+
+// parse parses the template files of the patterns with the template functions
+func (c *Cache) parse(patterns []string) (*template.Template, error) {
+	ts, err := template.New("").Funcs(c.funcs).ParseFS(c.fsys, templatePaths(patterns)...)
+	if err != nil {
+		return nil, newError(fmt.Errorf("template.New: %w", err), c.fsys, templatePaths(patterns), nil)
+	}
+	return ts, nil
+}
+
+// pagePatterns returns the template patterns of a page: the base template, the partials,
+// and the page itself
+func pagePatterns(pageName string) []string {
+	return []string{"base.tmpl", "partials/*.tmpl", "pages/" + pageName}
+}
+
+// templatePaths makes patterns relative to the templates folder relative to the root
+func templatePaths(patterns []string) []string {
+	paths := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		paths[i] = "templates/" + pattern
+	}
+	return paths
+}
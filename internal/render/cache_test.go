@@ -0,0 +1,99 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sglmr/gowebstart/assets"
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/funcs"
+)
+
+func testTemplates() fstest.MapFS {
+	return fstest.MapFS{
+		"templates/base.tmpl":            {Data: []byte(`{{define "base"}}<main>{{template "page:main" .}}</main>{{end}}`)},
+		"templates/partials/footer.tmpl": {Data: []byte(`{{define "partial:footer"}}footer{{end}}`)},
+		"templates/pages/home.tmpl":      {Data: []byte(`{{define "page:main"}}home {{.}}{{end}}`)},
+		"templates/pages/about.tmpl":     {Data: []byte(`{{define "page:main"}}about{{end}}`)},
+		"templates/emails/plain.tmpl":    {Data: []byte(`{{define "body"}}plain{{end}}`)},
+	}
+}
+
+func TestNewCache(t *testing.T) {
+	t.Parallel()
+
+	fsys := testTemplates()
+	c, err := NewCache(fsys, funcs.New(clock.System, true), false)
+	assert.NoError(t, err)
+
+	// Every page is parsed at startup
+	assert.Equal(t, 2, len(c.sets))
+
+	// Edits after startup don't change the cached pages
+	fsys["templates/pages/home.tmpl"] = &fstest.MapFile{Data: []byte(`{{define "page:main"}}edited{{end}}`)}
+	ts, err := c.page("home.tmpl")
+	assert.NoError(t, err)
+	buf := new(bytes.Buffer)
+	err = ts.ExecuteTemplate(buf, "base", "page")
+	assert.NoError(t, err)
+	assert.Equal(t, "<main>home page</main>", buf.String())
+
+	// Other template sets are cached the first time they're used
+	ts, err = c.templates("emails/plain.tmpl")
+	assert.NoError(t, err)
+	again, err := c.templates("emails/plain.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, ts, again)
+}
+
+func TestNewCacheReload(t *testing.T) {
+	t.Parallel()
+
+	fsys := testTemplates()
+	c, err := NewCache(fsys, funcs.New(clock.System, true), true)
+	assert.NoError(t, err)
+
+	// Templates are read again for every render
+	fsys["templates/pages/home.tmpl"] = &fstest.MapFile{Data: []byte(`{{define "page:main"}}edited{{end}}`)}
+	ts, err := c.page("home.tmpl")
+	assert.NoError(t, err)
+	buf := new(bytes.Buffer)
+	err = ts.ExecuteTemplate(buf, "base", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<main>edited</main>", buf.String())
+}
+
+func TestNewCacheParseError(t *testing.T) {
+	t.Parallel()
+
+	fsys := testTemplates()
+	fsys["templates/pages/broken.tmpl"] = &fstest.MapFile{Data: []byte("{{define \"page:main\"}}\n{{undefinedFunc}}\n{{end}}")}
+
+	// A broken page stops the startup
+	_, err := NewCache(fsys, funcs.New(clock.System, true), false)
+	var renderErr *Error
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("expected a template error, got %v", err)
+	}
+	assert.Equal(t, "broken.tmpl", renderErr.Template)
+	assert.Equal(t, 2, renderErr.Line)
+
+	// In reload mode, the error is returned when the page is rendered
+	c, err := NewCache(fsys, funcs.New(clock.System, true), true)
+	assert.NoError(t, err)
+	_, err = c.page("broken.tmpl")
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("expected a template error, got %v", err)
+	}
+}
+
+func TestNewCacheEmbedded(t *testing.T) {
+	t.Parallel()
+
+	// Every page of the app parses
+	_, err := NewCache(assets.EmbeddedFiles, funcs.New(clock.System, true), false)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,144 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Error describes a template that failed to parse or execute. It has the
+// details for a diagnostic error page in development mode.
+type Error struct {
+	Template   string   // Template file name, like "home.tmpl"
+	Line       int      // Line number in the template file, zero when unknown
+	Column     int      // Column number in the line, zero when unknown
+	Definition string   // Name of the executing {{define}} block, like "page:main"
+	Expression string   // The expression that failed, like ".Form.Name"
+	Message    string   // The error message without the location
+	DataKeys   []string // Keys or field names of the template data
+	Source     []SourceLine
+	Err        error
+}
+
+// SourceLine is a line of template source around the error.
+type SourceLine struct {
+	Number  int
+	Text    string
+	IsError bool
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// rxTemplateError matches the template location in parse and execution errors, like:
+//
+//	template: home.tmpl:5:12: executing "page:main" at <.Foo>: can't evaluate field Foo
+//	template: home.tmpl:3: function "bar" not defined
+//	html/template:home.tmpl:7:10: no such template "missing"
+var rxTemplateError = regexp.MustCompile(`(?s)^(?:html/)?template: ?([^:]+):(\d+)(?::(\d+))?: (?:executing "([^"]*)" at <(.*?)>: )?(.*)$`)
+
+// newError wraps a template error with the details parsed from its message, the
+// template source around the error from fsys, and the keys of the template data.
+func newError(err error, fsys fs.FS, patterns []string, data any) *Error {
+	e := &Error{Err: err, Message: err.Error(), DataKeys: dataKeys(data)}
+
+	// Find the innermost template error message
+	msg := err.Error()
+	if i := strings.Index(msg, "template:"); i >= 0 {
+		if i > 5 && msg[i-5:i] == "html/" {
+			i -= 5
+		}
+		msg = msg[i:]
+	}
+
+	matches := rxTemplateError.FindStringSubmatch(msg)
+	if matches == nil {
+		return e
+	}
+
+	e.Template = matches[1]
+	e.Line, _ = strconv.Atoi(matches[2])
+	e.Column, _ = strconv.Atoi(matches[3])
+	e.Definition = matches[4]
+	e.Expression = matches[5]
+	e.Message = matches[6]
+	e.Source = sourceLines(fsys, patterns, e.Template, e.Line)
+
+	return e
+}
+
+// sourceLines returns a few lines of template source around line. Templates are named
+// after their base file name, so the file is found by matching the parsed patterns.
+func sourceLines(fsys fs.FS, patterns []string, name string, line int) []SourceLine {
+	const context = 3
+
+	if line < 1 {
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			if path.Base(file) != name {
+				continue
+			}
+
+			src, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return nil
+			}
+
+			var lines []SourceLine
+			scanner := bufio.NewScanner(bytes.NewReader(src))
+			for n := 1; scanner.Scan(); n++ {
+				if n >= line-context && n <= line+context {
+					lines = append(lines, SourceLine{Number: n, Text: scanner.Text(), IsError: n == line})
+				}
+			}
+			return lines
+		}
+	}
+
+	return nil
+}
+
+// dataKeys returns the sorted map keys or exported struct field names of the template data.
+func dataKeys(data any) []string {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	var keys []string
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			keys = append(keys, fmt.Sprint(k.Interface()))
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				keys = append(keys, v.Type().Field(i).Name)
+			}
+		}
+	}
+
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestNewErrorExec(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/pages/home.tmpl": {Data: []byte("line 1\n{{define \"page:main\"}}\n<p>{{.Missing.Field}}</p>\n{{end}}\n")},
+	}
+	patterns := []string{"templates/pages/*.tmpl"}
+
+	ts := template.Must(template.ParseFS(fsys, patterns...))
+	data := map[string]any{"Title": "Home", "Missing": 42}
+	err := ts.ExecuteTemplate(new(bytes.Buffer), "page:main", data)
+	if err == nil {
+		t.Fatal("expected an execution error")
+	}
+
+	e := newError(err, fsys, patterns, data)
+	assert.Equal(t, "home.tmpl", e.Template)
+	assert.Equal(t, 3, e.Line)
+	assert.Equal(t, "page:main", e.Definition)
+	assert.Equal(t, ".Missing.Field", e.Expression)
+	assert.StringIn(t, "can't evaluate field Field", e.Message)
+	assert.EqualSlices(t, []string{"Missing", "Title"}, e.DataKeys)
+	assert.Equal(t, 4, len(e.Source))
+	assert.Equal(t, true, e.Source[2].IsError)
+	assert.Equal(t, "<p>{{.Missing.Field}}</p>", e.Source[2].Text)
+	assert.Equal(t, true, errors.Is(e, err))
+}
+
+func TestNewErrorParse(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/base.tmpl": {Data: []byte("<html>\n{{undefinedFunc}}\n</html>\n")},
+	}
+	patterns := []string{"templates/base.tmpl"}
+
+	_, err := template.ParseFS(fsys, patterns...)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+
+	e := newError(err, fsys, patterns, struct{ Name, private string }{})
+	assert.Equal(t, "base.tmpl", e.Template)
+	assert.Equal(t, 2, e.Line)
+	assert.Equal(t, "", e.Expression)
+	assert.StringIn(t, `function "undefinedFunc" not defined`, e.Message)
+	assert.EqualSlices(t, []string{"Name"}, e.DataKeys)
+	assert.Equal(t, 3, len(e.Source))
+}
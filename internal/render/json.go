@@ -0,0 +1,53 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+)
+
+// jsonIndentKey is the context key of WithJSONIndent
+type jsonIndentKey struct{}
+
+// WithJSONIndent returns a context that makes the JSON responses of its request
+// indented, so they're easier to read. Use it in dev mode.
+func WithJSONIndent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, jsonIndentKey{}, true)
+}
+
+// Envelope wraps the data of a JSON response in an object with a named key, like
+// {"note": {...}}. Clients can tell what they got, and fields can be added next to the
+// data later, like pagination links, without breaking them.
+type Envelope map[string]any
+
+// JSON writes data as a JSON response to r with the provided HTTP status code.
+// It's a convenience wrapper around JSONWithHeaders with no additional headers.
+func JSON(w http.ResponseWriter, r *http.Request, status int, data any) error {
+	return JSONWithHeaders(w, r, status, data, nil)
+}
+
+// JSONWithHeaders writes data as a JSON response to r with the provided HTTP status
+// code and custom HTTP headers. The JSON is indented when the request context is from
+// WithJSONIndent. Nothing is written when data can't be marshaled, so the caller can
+// still send an error response.
+func JSONWithHeaders(w http.ResponseWriter, r *http.Request, status int, data any, headers http.Header) error {
+	var js []byte
+	var err error
+	if indent, _ := r.Context().Value(jsonIndentKey{}).(bool); indent {
+		js, err = json.MarshalIndent(data, "", "  ")
+	} else {
+		js, err = json.Marshal(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Set any provided custom HTTP headers
+	maps.Copy(w.Header(), headers)
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(status)
+	_, err = w.Write(append(js, '\n'))
+	return err
+}
@@ -0,0 +1,50 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	headers := http.Header{"Cache-Control": {"no-store"}}
+
+	err := JSONWithHeaders(w, r, http.StatusCreated, Envelope{"note": map[string]int{"id": 1}}, headers)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, `{"note":{"id":1}}`+"\n", w.Body.String())
+}
+
+func TestJSONIndent(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(WithJSONIndent(r.Context()))
+	err := JSON(w, r, http.StatusOK, Envelope{"note": map[string]int{"id": 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"note\": {\n    \"id\": 1\n  }\n}\n", w.Body.String())
+}
+
+func TestJSONMarshalError(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// Nothing is written, so the caller can send an error response
+	err := JSON(w, r, http.StatusOK, Envelope{"bad": make(chan int)})
+	if err == nil {
+		t.Fatal("expected a marshal error")
+	}
+	assert.Equal(t, "", w.Header().Get("Content-Type"))
+	assert.Equal(t, 0, w.Body.Len())
+}
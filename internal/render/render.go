@@ -2,59 +2,95 @@ package render
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"maps"
 	"net/http"
 
-	"github.com/sglmr/gowebstart/assets"
-	"github.com/sglmr/gowebstart/internal/funcs"
+	"github.com/sglmr/gowebstart/internal/htmx"
 )
 
 // Page renders a template page with the provided data and HTTP status code.
 // It's a convenience wrapper around PageWithHeaders with no additional headers.
-func Page(w http.ResponseWriter, status int, data any, pagePath string) error {
-	return PageWithHeaders(w, status, data, nil, pagePath)
+func (c *Cache) Page(w http.ResponseWriter, status int, data any, pagePath string) error {
+	return c.PageWithHeaders(w, status, data, nil, pagePath)
 }
 
 // PageWithHeaders renders a template page with the provided data, HTTP status code,
 // and custom HTTP headers. This function combines the base template, partials, and named page templates.
-func PageWithHeaders(w http.ResponseWriter, status int, data any, headers http.Header, pageName string) error {
-	// Define templates to be included for this page render
-	patterns := []string{"base.tmpl", "partials/*.tmpl", fmt.Sprintf("pages/%s", pageName)}
+func (c *Cache) PageWithHeaders(w http.ResponseWriter, status int, data any, headers http.Header, pageName string) error {
+	ts, err := c.page(pageName)
+	if err != nil {
+		return withDataKeys(err, data)
+	}
+
+	// Render the base template of the page
+	return execute(w, status, data, headers, c.fsys, ts, "base", pagePatterns(pageName))
+}
+
+// Fragment renders a single block of a template page, like "page:main", without the base
+// template around it. It's for htmx requests that only swap part of the page.
+func (c *Cache) Fragment(w http.ResponseWriter, status int, data any, pageName, block string) error {
+	// Use the same templates as a full page so the block can use the partials
+	ts, err := c.page(pageName)
+	if err != nil {
+		return withDataKeys(err, data)
+	}
+
+	return execute(w, status, data, nil, c.fsys, ts, block, pagePatterns(pageName))
+}
+
+// Partial renders only a block of a template page, like "page:main", for htmx requests
+// that swap part of the page, and the full page for other requests. Boosted and history
+// restore requests get the full page, since htmx swaps the whole body for them.
+func (c *Cache) Partial(w http.ResponseWriter, r *http.Request, status int, data any, pageName, block string) error {
+	// Caches have to keep the fragment and the full page apart
+	htmx.Vary(w)
 
-	// Render the base template with the specified patterns
-	return NamedTemplateWithHeaders(w, status, data, headers, "base", patterns...)
+	if htmx.IsFragment(r) {
+		return c.Fragment(w, status, data, pageName, block)
+	}
+	return c.Page(w, status, data, pageName)
 }
 
 // NamedTemplate renders a specific named template with the provided data and HTTP status code.
 // It's a convenience wrapper around NamedTemplateWithHeaders with no additional headers.
-func NamedTemplate(w http.ResponseWriter, status int, data any, templateName string, patterns ...string) error {
-	return NamedTemplateWithHeaders(w, status, data, nil, templateName, patterns...)
+func (c *Cache) NamedTemplate(w http.ResponseWriter, status int, data any, templateName string, patterns ...string) error {
+	return c.NamedTemplateWithHeaders(w, status, data, nil, templateName, patterns...)
 }
 
 // NamedTemplateWithHeaders renders a specific named template with the provided data,
-// HTTP status code, and custom HTTP headers.
-func NamedTemplateWithHeaders(w http.ResponseWriter, status int, data any, headers http.Header, templateName string, patterns ...string) error {
-	// Prepend "templates/" to all patterns to make them relative to the root
-	for i := range patterns {
-		patterns[i] = "templates/" + patterns[i]
+// HTTP status code, and custom HTTP headers. The patterns are relative to the templates folder.
+func (c *Cache) NamedTemplateWithHeaders(w http.ResponseWriter, status int, data any, headers http.Header, templateName string, patterns ...string) error {
+	ts, err := c.templates(patterns...)
+	if err != nil {
+		return withDataKeys(err, data)
 	}
 
-	// Create a new template with custom functions and parse all template files
-	// from the embedded filesystem
-	ts, err := template.New("").Funcs(funcs.TemplateFuncs).ParseFS(assets.EmbeddedFiles, patterns...)
-	if err != nil {
-		return fmt.Errorf("template.New: %w", err)
+	return execute(w, status, data, headers, c.fsys, ts, templateName, patterns)
+}
+
+// withDataKeys adds the keys of the template data to a template parse error
+func withDataKeys(err error, data any) error {
+	var renderErr *Error
+	if errors.As(err, &renderErr) {
+		renderErr.DataKeys = dataKeys(data)
 	}
+	return err
+}
 
+// execute renders a template of the parsed template set ts, which was parsed from the
+// patterns in fsys
+func execute(w http.ResponseWriter, status int, data any, headers http.Header, fsys fs.FS, ts *template.Template, templateName string, patterns []string) error {
 	// Create a buffer to store the rendered template output
 	buf := new(bytes.Buffer)
 
 	// Execute the specified template with the provided data
-	err = ts.ExecuteTemplate(buf, templateName, data)
+	err := ts.ExecuteTemplate(buf, templateName, data)
 	if err != nil {
-		return fmt.Errorf("ExecuteTemplate: %w", err)
+		return newError(fmt.Errorf("ExecuteTemplate: %w", err), fsys, templatePaths(patterns), data)
 	}
 
 	// Set any provided custom HTTP headers
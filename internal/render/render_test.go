@@ -0,0 +1,44 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/funcs"
+)
+
+func TestPartial(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCache(testTemplates(), funcs.New(clock.System, true), false)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"full page", nil, "<main>home page</main>"},
+		{"htmx request", map[string]string{"HX-Request": "true"}, "home page"},
+		{"boosted request", map[string]string{"HX-Request": "true", "HX-Boosted": "true"}, "<main>home page</main>"},
+		{"history restore", map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"}, "<main>home page</main>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			err := c.Partial(w, r, http.StatusCreated, "page", "home.tmpl", "page:main")
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+			assert.Equal(t, "HX-Request", w.Header().Get("Vary"))
+		})
+	}
+}
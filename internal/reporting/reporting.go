@@ -0,0 +1,140 @@
+// Package reporting sends server errors to an error tracking service, so they're noticed
+// without reading the logs.
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrorReporter reports a server error of a request. Report is called before the error
+// response is sent, so it shouldn't block.
+type ErrorReporter interface {
+	Report(ctx context.Context, err error, r *http.Request)
+}
+
+// Nop is an ErrorReporter that drops every error. The logs still have them.
+type Nop struct{}
+
+// Report does nothing.
+func (Nop) Report(ctx context.Context, err error, r *http.Request) {}
+
+// Report is the JSON body Webhook posts for an error.
+type Report struct {
+	Error     string    `json:"error"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	RequestID string    `json:"request_id,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Webhook is an ErrorReporter that posts every error as a JSON Report to a URL, like a
+// chat webhook or the ingest endpoint of an error tracker. Reports are sent in the
+// background, and dropped when too many are already being sent.
+type Webhook struct {
+	url    string
+	client *http.Client
+	logger *slog.Logger
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	// RequestID returns the ID of a request for the report. nil leaves it out.
+	RequestID func(r *http.Request) string
+
+	// Version is the version of the application for the report
+	Version string
+}
+
+// maxPending is the number of reports a Webhook sends at once
+const maxPending = 10
+
+// NewWebhook creates a Webhook that posts to url with a timeout. Failed reports are
+// logged to logger.
+func NewWebhook(url string, timeout time.Duration, logger *slog.Logger) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		logger: logger,
+		sem:    make(chan struct{}, maxPending),
+	}
+}
+
+// Report sends the error in the background. Only the path of the request URL is sent,
+// since query strings can have secrets, like tokens.
+func (wh *Webhook) Report(ctx context.Context, err error, r *http.Request) {
+	report := Report{
+		Error:   err.Error(),
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Version: wh.Version,
+		Time:    time.Now().UTC(),
+	}
+	if wh.RequestID != nil {
+		report.RequestID = wh.RequestID(r)
+	}
+
+	select {
+	case wh.sem <- struct{}{}:
+	default:
+		wh.logger.Warn("error report dropped", "reason", "too many pending reports", "error", err)
+		return
+	}
+
+	// The report outlives the request
+	ctx = context.WithoutCancel(ctx)
+	wh.wg.Add(1)
+	go func() {
+		defer wh.wg.Done()
+		defer func() { <-wh.sem }()
+		if err := wh.send(ctx, report); err != nil {
+			wh.logger.Warn("error report failed", "error", err)
+		}
+	}()
+}
+
+// Shutdown waits for the reports being sent, or until ctx is done.
+func (wh *Webhook) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wh.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send posts a report
+func (wh *Webhook) send(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("reporting: %s responded with %s", wh.url, res.Status)
+	}
+	return nil
+}
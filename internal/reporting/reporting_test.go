@@ -0,0 +1,90 @@
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		reports []Report
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var report Report
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+		mu.Lock()
+		reports = append(reports, report)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	wh := NewWebhook(server.URL, time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	wh.Version = "v1.2.3"
+	wh.RequestID = func(r *http.Request) string { return "req-1" }
+
+	// The request context is canceled once the response is sent, which doesn't stop the report
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/notes/?token=secret", nil)
+	wh.Report(ctx, errors.New("database is down"), r)
+	cancel()
+	assert.NoError(t, wh.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, "database is down", reports[0].Error)
+	assert.Equal(t, http.MethodPost, reports[0].Method)
+	assert.Equal(t, "/notes/", reports[0].Path)
+	assert.Equal(t, "req-1", reports[0].RequestID)
+	assert.Equal(t, "v1.2.3", reports[0].Version)
+}
+
+func TestWebhookFailure(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	var logs safeBuffer
+	wh := NewWebhook(server.URL, time.Second, slog.New(slog.NewTextHandler(&logs, nil)))
+	wh.Report(context.Background(), errors.New("boom"), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, wh.Shutdown(context.Background()))
+
+	assert.StringIn(t, "error report failed", logs.String())
+	assert.StringIn(t, "502 Bad Gateway", logs.String())
+}
+
+// safeBuffer is a log buffer for reports logged from their goroutine
+type safeBuffer struct {
+	mu sync.Mutex
+	b  []byte
+}
+
+func (sb *safeBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.b = append(sb.b, p...)
+	return len(p), nil
+}
+
+func (sb *safeBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return string(sb.b)
+}
@@ -0,0 +1,128 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// redisMaxIdle is the number of idle connections a RedisStore keeps for reuse
+	redisMaxIdle = 8
+	// redisTimeout limits the dial and every command
+	redisTimeout = 5 * time.Second
+)
+
+// RedisStore is a session store that saves sessions in Redis, with a key for every
+// session that Redis expires at the session's expiry time, like the scs redisstore. It
+// uses a redigo connection pool.
+type RedisStore struct {
+	pool *redis.Pool
+
+	// Prefix is put before the session tokens in the Redis keys
+	Prefix string
+}
+
+// NewRedisStore returns a RedisStore for a Redis URL, like
+// redis://:secret@localhost:6379/0, or rediss:// for TLS. The URL has an optional user
+// and password for the AUTH command, and the database number as its path. Connections
+// are made when the store is used.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("sessions: invalid Redis URL: %w", err)
+	}
+	if (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("sessions: invalid Redis URL %q, it needs to look like redis://localhost:6379/0", u.Redacted())
+	}
+
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if db, err := strconv.Atoi(path); err != nil || db < 0 {
+			return nil, fmt.Errorf("sessions: invalid Redis database %q", path)
+		}
+	}
+
+	pool := &redis.Pool{
+		MaxIdle:     redisMaxIdle,
+		IdleTimeout: 5 * time.Minute,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return redis.DialURLContext(ctx, rawURL,
+				redis.DialConnectTimeout(redisTimeout),
+				redis.DialReadTimeout(redisTimeout),
+				redis.DialWriteTimeout(redisTimeout),
+			)
+		},
+	}
+	return &RedisStore{pool: pool, Prefix: "scs:session:"}, nil
+}
+
+// Find returns the data of a session, or false when it doesn't exist or expired.
+func (s *RedisStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of a session, or false when it doesn't exist or expired.
+func (s *RedisStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	data, err := redis.Bytes(s.do(ctx, "GET", s.Prefix+token))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Commit saves the data of a session, which Redis deletes at expiry.
+func (s *RedisStore) Commit(token string, data []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, data, expiry)
+}
+
+// CommitCtx saves the data of a session, which Redis deletes at expiry.
+func (s *RedisStore) CommitCtx(ctx context.Context, token string, data []byte, expiry time.Time) error {
+	ttl := time.Until(expiry).Milliseconds()
+	if ttl <= 0 {
+		return s.DeleteCtx(ctx, token)
+	}
+	_, err := s.do(ctx, "SET", s.Prefix+token, data, "PX", ttl)
+	return err
+}
+
+// Delete deletes a session. Deleting a session that doesn't exist isn't an error.
+func (s *RedisStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx deletes a session. Deleting a session that doesn't exist isn't an error.
+func (s *RedisStore) DeleteCtx(ctx context.Context, token string) error {
+	_, err := s.do(ctx, "DEL", s.Prefix+token)
+	return err
+}
+
+// Ping checks the connection to Redis, for health checks.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	_, err := s.do(ctx, "PING")
+	return err
+}
+
+// Close closes the pooled connections, for a shutdown hook.
+func (s *RedisStore) Close(ctx context.Context) error {
+	return s.pool.Close()
+}
+
+// do runs a command on a pooled connection. It stops when ctx is done.
+func (s *RedisStore) do(ctx context.Context, command string, args ...any) (any, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return redis.DoContext(conn, ctx, command, args...)
+}
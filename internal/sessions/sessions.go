@@ -0,0 +1,17 @@
+// Package sessions has session stores for scs.SessionManager that keep sessions outside
+// the application process, so sessions survive restarts and work across several
+// instances: a SQLStore for PostgreSQL and a RedisStore for Redis.
+//
+// Both implement scs.CtxStore. The default scs memstore is enough for a single
+// instance in development.
+package sessions
+
+import (
+	"github.com/alexedwards/scs/v2"
+)
+
+// Check that the stores implement the scs interfaces
+var (
+	_ scs.CtxStore = (*SQLStore)(nil)
+	_ scs.CtxStore = (*RedisStore)(nil)
+)
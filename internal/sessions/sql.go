@@ -0,0 +1,120 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SQLStore is a session store that saves sessions in the sessions table of a PostgreSQL
+// database. The table is created by the assets/migrations/012_create_sessions.sql
+// migration. Expired sessions aren't found, and StartCleanup deletes them.
+type SQLStore struct {
+	db *sql.DB
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewSQLStore returns a SQLStore for the sessions table in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Find returns the data of a session, or false when it doesn't exist or expired.
+func (s *SQLStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of a session, or false when it doesn't exist or expired.
+func (s *SQLStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT data FROM sessions WHERE token = $1 AND expiry > now()`, token,
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Commit saves the data and expiry time of a session.
+func (s *SQLStore) Commit(token string, data []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, data, expiry)
+}
+
+// CommitCtx saves the data and expiry time of a session.
+func (s *SQLStore) CommitCtx(ctx context.Context, token string, data []byte, expiry time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sessions (token, data, expiry) VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE SET data = EXCLUDED.data, expiry = EXCLUDED.expiry`,
+		token, data, expiry,
+	)
+	return err
+}
+
+// Delete deletes a session. Deleting a session that doesn't exist isn't an error.
+func (s *SQLStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx deletes a session. Deleting a session that doesn't exist isn't an error.
+func (s *SQLStore) DeleteCtx(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token = $1`, token)
+	return err
+}
+
+// DeleteExpired deletes the expired sessions and returns how many there were.
+func (s *SQLStore) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expiry <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StartCleanup deletes the expired sessions every interval in the background, until
+// Shutdown. Errors are passed to onError, which may be nil.
+func (s *SQLStore) StartCleanup(interval time.Duration, onError func(error)) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if _, err := s.DeleteExpired(context.Background()); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Shutdown stops the cleanup of StartCleanup and waits for a running cleanup to finish,
+// or for ctx to be done.
+func (s *SQLStore) Shutdown(ctx context.Context) error {
+	if s.stop == nil {
+		return nil
+	}
+	s.once.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
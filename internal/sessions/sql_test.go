@@ -0,0 +1,27 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/dbtest"
+)
+
+func TestSQLStore(t *testing.T) {
+	t.Parallel()
+
+	store := NewSQLStore(dbtest.New(t))
+	testStore(t, store)
+
+	// Expired sessions are deleted by the cleanup
+	ctx := context.Background()
+	assert.NoError(t, store.CommitCtx(ctx, "expired", []byte("old"), time.Now().Add(-time.Second)))
+	n, err := store.DeleteExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	store.StartCleanup(time.Hour, nil)
+	assert.NoError(t, store.Shutdown(ctx))
+}
@@ -0,0 +1,49 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+// testStore tests the behavior every store has
+func testStore(t *testing.T, store scs.CtxStore) {
+	ctx := context.Background()
+
+	// Unknown sessions aren't found, without an error
+	_, found, err := store.FindCtx(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, false, found)
+
+	// Commits save and replace sessions
+	assert.NoError(t, store.CommitCtx(ctx, "a", []byte("first"), time.Now().Add(time.Hour)))
+	assert.NoError(t, store.CommitCtx(ctx, "a", []byte("second"), time.Now().Add(time.Hour)))
+	data, found, err := store.FindCtx(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, true, found)
+	assert.Equal(t, "second", string(data))
+
+	// Expired sessions aren't found
+	assert.NoError(t, store.CommitCtx(ctx, "b", []byte("old"), time.Now().Add(-time.Second)))
+	_, found, err = store.FindCtx(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, false, found)
+
+	// Deletes work for sessions that exist and ones that don't
+	assert.NoError(t, store.DeleteCtx(ctx, "a"))
+	assert.NoError(t, store.DeleteCtx(ctx, "a"))
+	_, found, err = store.FindCtx(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, false, found)
+
+	// The methods without a context work the same
+	assert.NoError(t, store.Commit("c", []byte("third"), time.Now().Add(time.Hour)))
+	data, found, err = store.Find("c")
+	assert.NoError(t, err)
+	assert.Equal(t, true, found)
+	assert.Equal(t, "third", string(data))
+	assert.NoError(t, store.Delete("c"))
+}
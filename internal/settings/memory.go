@@ -0,0 +1,34 @@
+package settings
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps settings in memory. Changes are lost when the
+// application stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: map[string]string{}}
+}
+
+// All returns the stored value of every setting that has one.
+func (s *MemoryStore) All(ctx context.Context) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.values), nil
+}
+
+// Set saves the value of a setting.
+func (s *MemoryStore) Set(ctx context.Context, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	return nil
+}
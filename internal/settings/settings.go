@@ -0,0 +1,188 @@
+// Package settings keeps application settings, like the site name, in a Store so they
+// can be changed without a new build. Every setting has a Definition with its type and
+// default, and Settings caches the stored values so reading them doesn't hit the Store
+// on every request.
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned by Settings.Set for a key without a Definition.
+var ErrUnknownKey = errors.New("settings: unknown key")
+
+// Type is the type of a setting's value. Values are stored as strings and parsed by
+// the typed getters.
+type Type string
+
+const (
+	TypeString Type = "string" // A single line of text
+	TypeText   Type = "text"   // Multiple lines of text
+	TypeEmail  Type = "email"  // An email address, like "Name <name@example.com>"
+	TypeInt    Type = "int"
+	TypeBool   Type = "bool" // "true" or "false"
+)
+
+// Definition describes a setting.
+type Definition struct {
+	Key     string
+	Label   string
+	Help    string
+	Type    Type
+	Default string
+}
+
+// Validate returns an error when value isn't valid for the setting's type.
+func (d Definition) Validate(value string) error {
+	switch d.Type {
+	case TypeString:
+		if strings.ContainsAny(value, "\r\n") {
+			return errors.New("must be a single line")
+		}
+	case TypeEmail:
+		if _, err := mail.ParseAddress(value); err != nil {
+			return errors.New("must be a valid email address")
+		}
+	case TypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return errors.New("must be a whole number")
+		}
+	case TypeBool:
+		if value != "true" && value != "false" {
+			return errors.New("must be true or false")
+		}
+	}
+	return nil
+}
+
+// Store saves the values of settings. Implementations have to be safe for concurrent use.
+type Store interface {
+	// All returns the stored value of every setting that has one.
+	All(ctx context.Context) (map[string]string, error)
+
+	// Set saves the value of a setting.
+	Set(ctx context.Context, key, value string) error
+}
+
+// Settings reads and writes the defined settings in a Store, with a cache that is
+// reloaded after a TTL, so changes made by other instances show up.
+type Settings struct {
+	store       Store
+	ttl         time.Duration
+	definitions []Definition
+
+	// now is the clock, replaced in tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	values   map[string]string
+	loadedAt time.Time
+}
+
+// New creates Settings for the definitions, that cache the stored values for ttl.
+func New(store Store, ttl time.Duration, definitions ...Definition) *Settings {
+	return &Settings{
+		store:       store,
+		ttl:         ttl,
+		definitions: definitions,
+		now:         time.Now,
+	}
+}
+
+// Definitions returns the definitions of the settings, in the order they were given.
+func (s *Settings) Definitions() []Definition {
+	return s.definitions
+}
+
+// Definition returns the definition of a setting.
+func (s *Settings) Definition(key string) (Definition, bool) {
+	for _, d := range s.definitions {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Values returns the value of every setting, or its default when it isn't stored. When
+// the store fails, it returns the last loaded values, or the defaults, with the error.
+func (s *Settings) Values(ctx context.Context) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.values == nil || s.now().Sub(s.loadedAt) >= s.ttl {
+		err = s.load(ctx)
+	}
+
+	values := make(map[string]string, len(s.definitions))
+	for _, d := range s.definitions {
+		values[d.Key] = d.Default
+	}
+	maps.Copy(values, s.values)
+	return values, err
+}
+
+// load reads the stored values into the cache
+func (s *Settings) load(ctx context.Context) error {
+	stored, err := s.store.All(ctx)
+	if err != nil {
+		return fmt.Errorf("loading settings: %w", err)
+	}
+
+	s.values = map[string]string{}
+	for _, d := range s.definitions {
+		if value, ok := stored[d.Key]; ok {
+			s.values[d.Key] = value
+		}
+	}
+	s.loadedAt = s.now()
+	return nil
+}
+
+// String returns the value of a setting, or its default when the store fails.
+func (s *Settings) String(ctx context.Context, key string) string {
+	values, _ := s.Values(ctx)
+	return values[key]
+}
+
+// Int returns the value of an int setting, or 0 when it isn't a number.
+func (s *Settings) Int(ctx context.Context, key string) int {
+	n, _ := strconv.Atoi(s.String(ctx, key))
+	return n
+}
+
+// Bool returns the value of a bool setting.
+func (s *Settings) Bool(ctx context.Context, key string) bool {
+	return s.String(ctx, key) == "true"
+}
+
+// Set validates and saves the value of a setting.
+func (s *Settings) Set(ctx context.Context, key, value string) error {
+	d, ok := s.Definition(key)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, key)
+	}
+	if err := d.Validate(value); err != nil {
+		return fmt.Errorf("setting %q %w", key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.Set(ctx, key, value); err != nil {
+		return err
+	}
+
+	// Reload the cache on the next read
+	s.values = nil
+	return nil
+}
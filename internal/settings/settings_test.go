@@ -0,0 +1,90 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+// failingStore is a Store that can't be read
+type failingStore struct{ *MemoryStore }
+
+func (failingStore) All(context.Context) (map[string]string, error) {
+	return nil, errors.New("database is down")
+}
+
+var testDefinitions = []Definition{
+	{Key: "site_name", Type: TypeString, Default: "Some Site"},
+	{Key: "contact", Type: TypeEmail, Default: "admin@example.com"},
+	{Key: "page_size", Type: TypeInt, Default: "10"},
+	{Key: "signups", Type: TypeBool, Default: "false"},
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		typ   Type
+		value string
+		valid bool
+	}{
+		{TypeString, "My Site", true},
+		{TypeString, "two\nlines", false},
+		{TypeText, "two\nlines", true},
+		{TypeEmail, "Name <name@example.com>", true},
+		{TypeEmail, "not an email", false},
+		{TypeInt, "42", true},
+		{TypeInt, "4.2", false},
+		{TypeBool, "true", true},
+		{TypeBool, "yes", false},
+	}
+	for _, tt := range tests {
+		err := Definition{Type: tt.typ}.Validate(tt.value)
+		assert.Equal(t, tt.valid, err == nil)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	s := New(store, time.Minute, testDefinitions...)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// Unset settings have their defaults
+	assert.Equal(t, "Some Site", s.String(ctx, "site_name"))
+	assert.Equal(t, 10, s.Int(ctx, "page_size"))
+	assert.Equal(t, false, s.Bool(ctx, "signups"))
+
+	// Set validates and saves values
+	assert.NoError(t, s.Set(ctx, "site_name", "My Site"))
+	assert.NoError(t, s.Set(ctx, "signups", "true"))
+	assert.Equal(t, "My Site", s.String(ctx, "site_name"))
+	assert.Equal(t, true, s.Bool(ctx, "signups"))
+
+	assert.Equal(t, true, s.Set(ctx, "page_size", "ten") != nil)
+	assert.Equal(t, true, errors.Is(s.Set(ctx, "unknown", "x"), ErrUnknownKey))
+
+	// Values changed in the store by another instance show up after the TTL
+	store.Set(ctx, "site_name", "Other Site")
+	assert.Equal(t, "My Site", s.String(ctx, "site_name"))
+	now = now.Add(time.Minute)
+	assert.Equal(t, "Other Site", s.String(ctx, "site_name"))
+}
+
+func TestSettingsStoreError(t *testing.T) {
+	t.Parallel()
+
+	s := New(failingStore{NewMemoryStore()}, time.Minute, testDefinitions...)
+
+	// The defaults are still returned when the store fails
+	values, err := s.Values(context.Background())
+	assert.Equal(t, true, err != nil)
+	assert.Equal(t, "Some Site", values["site_name"])
+}
@@ -0,0 +1,68 @@
+// Package shutdown collects the hooks that components need to run when the
+// application shuts down, like draining queues or closing connection pools.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Hook releases a component's resources. It should return once it's done or
+// when the context is cancelled, whichever comes first.
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// Registry is an ordered list of shutdown hooks.
+type Registry struct {
+	mu    sync.Mutex
+	hooks []namedHook
+}
+
+// New creates an empty shutdown hook Registry.
+func New() *Registry {
+	return &Registry{}
+}
+
+// Register adds a named hook to the registry. Hooks run in reverse registration order,
+// like deferred function calls, so components registered first (a database pool) are
+// shut down after the components that depend on them (workers using the pool).
+func (r *Registry) Register(name string, hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hooks = append(r.hooks, namedHook{name: name, hook: hook})
+}
+
+// Run executes the hooks one at a time in reverse registration order. Every hook runs
+// even when an earlier one fails, and the returned error joins all of the hook errors.
+func (r *Registry) Run(ctx context.Context) error {
+	r.mu.Lock()
+	hooks := append([]namedHook(nil), r.hooks...)
+	r.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := runHook(ctx, hooks[i].hook); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hooks[i].name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// runHook runs a single hook, turning a panic into an error.
+func runHook(ctx context.Context, hook Hook) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return hook(ctx)
+}
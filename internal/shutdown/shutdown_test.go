@@ -0,0 +1,47 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestRegistryRunOrder(t *testing.T) {
+	t.Parallel()
+
+	var order []string
+	registry := New()
+	for _, name := range []string{"db", "queue", "workers"} {
+		registry.Register(name, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	err := registry.Run(context.Background())
+
+	assert.NoError(t, err)
+	assert.EqualSlices(t, []string{"workers", "queue", "db"}, order)
+}
+
+func TestRegistryRunErrors(t *testing.T) {
+	t.Parallel()
+
+	ran := false
+	registry := New()
+	registry.Register("last", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	registry.Register("fails", func(ctx context.Context) error { return errors.New("close failed") })
+	registry.Register("panics", func(ctx context.Context) error { panic("oops") })
+
+	err := registry.Run(context.Background())
+
+	// Every hook runs and all the errors are returned
+	assert.Equal(t, true, ran)
+	assert.StringIn(t, "fails: close failed", err.Error())
+	assert.StringIn(t, "panics: panic: oops", err.Error())
+}
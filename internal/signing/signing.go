@@ -0,0 +1,169 @@
+// Package signing creates and verifies HMAC-signed URLs for links that work without a
+// login, like download, unsubscribe, or password reset links. A signature covers the
+// path, the query, an optional expiry time, and a purpose, so a link for one purpose
+// can't be used for another. Tokens work the same for links with the signed data in their
+// path instead of the query.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+// Query parameters added to signed URLs
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+var (
+	// ErrInvalidSignature is returned by Verify for a missing or forged signature.
+	ErrInvalidSignature = errors.New("signing: invalid signature")
+
+	// ErrExpired is returned by Verify for a URL past its expiry time.
+	ErrExpired = errors.New("signing: link expired")
+)
+
+// Signer signs and verifies URLs.
+type Signer struct {
+	secret []byte
+
+	// Clock tells the time for expiry times, clock.System by default.
+	Clock clock.Clock
+}
+
+// New creates a Signer that signs URLs with secret. An empty secret is replaced with a
+// random one, so links don't survive a restart.
+func New(secret []byte) *Signer {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &Signer{secret: secret, Clock: clock.System}
+}
+
+// Sign returns rawURL with a signature for purpose. The link expires after ttl, or never
+// when ttl is zero. The host of an absolute URL isn't signed.
+func (s *Signer) Sign(rawURL, purpose string, ttl time.Duration) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Del(SignatureParam)
+	query.Del(ExpiresParam)
+	if ttl != 0 {
+		query.Set(ExpiresParam, strconv.FormatInt(s.Clock.Now().Add(ttl).Unix(), 10))
+	}
+	query.Set(SignatureParam, s.sign(u.Path, query, purpose))
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Verify returns an error unless u has a valid signature for purpose that hasn't
+// expired.
+func (s *Signer) Verify(u *url.URL, purpose string) error {
+	query := u.Query()
+	signature := query.Get(SignatureParam)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(s.sign(u.Path, query, purpose))) {
+		return ErrInvalidSignature
+	}
+
+	if expires := query.Get(ExpiresParam); expires != "" {
+		unix, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		if s.Clock.Now().After(time.Unix(unix, 0)) {
+			return ErrExpired
+		}
+	}
+	return nil
+}
+
+// Token returns a URL-safe token with data for purpose, for links that have the token in
+// their path, like /reset-password/{token}. The token expires after ttl, or never when
+// ttl is zero. The data isn't encrypted, so don't put secrets in it.
+func (s *Signer) Token(data, purpose string, ttl time.Duration) string {
+	var expires int64
+	if ttl != 0 {
+		expires = s.Clock.Now().Add(ttl).Unix()
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(data)) + "." + strconv.FormatInt(expires, 10)
+	return payload + "." + s.mac(purpose+"\n"+payload)
+}
+
+// VerifyToken returns the data of a token, or an error unless it has a valid signature
+// for purpose that hasn't expired.
+func (s *Signer) VerifyToken(token, purpose string) (string, error) {
+	data, expires, ok := parseToken(token)
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+	i := strings.LastIndexByte(token, '.')
+	if !hmac.Equal([]byte(token[i+1:]), []byte(s.mac(purpose+"\n"+token[:i]))) {
+		return "", ErrInvalidSignature
+	}
+	if expires != 0 && s.Clock.Now().After(time.Unix(expires, 0)) {
+		return "", ErrExpired
+	}
+	return data, nil
+}
+
+// TokenData returns the data of a token without verifying it, for looking up what the
+// purpose of VerifyToken depends on, like the user of a password reset link. Don't trust
+// the data until VerifyToken accepted the token.
+func TokenData(token string) (string, error) {
+	data, _, ok := parseToken(token)
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+	return data, nil
+}
+
+// parseToken returns the data and expiry time of a token
+func parseToken(token string) (data string, expires int64, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", 0, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", 0, false
+	}
+	expires, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return string(b), expires, true
+}
+
+// sign returns the base64 HMAC-SHA256 of the purpose, path, and query without the
+// signature parameter
+func (s *Signer) sign(path string, query url.Values, purpose string) string {
+	signed := url.Values{}
+	for key, values := range query {
+		if key != SignatureParam {
+			signed[key] = values
+		}
+	}
+	return s.mac(purpose + "\n" + path + "?" + signed.Encode())
+}
+
+// mac returns the base64 HMAC-SHA256 of message
+func (s *Signer) mac(message string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,134 @@
+package signing
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	signer := New([]byte("secret"))
+	signer.Clock = clock.NewFake(now)
+
+	link, err := signer.Sign("/files/report.pdf?variant=thumb", "download", time.Hour)
+	assert.NoError(t, err)
+	forever, err := signer.Sign("https://example.com/unsubscribe/?email=a%40example.com", "unsubscribe", 0)
+	assert.NoError(t, err)
+	other, err := New([]byte("other")).Sign("/files/report.pdf?variant=thumb", "download", time.Hour)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		link    string
+		purpose string
+		elapsed time.Duration
+		want    error
+	}{
+		{"valid", link, "download", time.Minute, nil},
+		{"no expiry", forever, "unsubscribe", 365 * 24 * time.Hour, nil},
+		{"expired", link, "download", 2 * time.Hour, ErrExpired},
+		{"other purpose", link, "unsubscribe", time.Minute, ErrInvalidSignature},
+		{"other secret", other, "download", time.Minute, ErrInvalidSignature},
+		{"unsigned", "/files/report.pdf", "download", time.Minute, ErrInvalidSignature},
+		{"changed path", replace(t, link, func(u *url.URL) { u.Path = "/files/secret.pdf" }), "download", time.Minute, ErrInvalidSignature},
+		{"changed query", replace(t, link, func(u *url.URL) { u.RawQuery += "&variant=medium" }), "download", time.Minute, ErrInvalidSignature},
+		{"changed expiry", replace(t, link, func(u *url.URL) {
+			q := u.Query()
+			q.Set(ExpiresParam, "9999999999")
+			u.RawQuery = q.Encode()
+		}), "download", time.Minute, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.link)
+			assert.NoError(t, err)
+
+			s := New([]byte("secret"))
+			s.Clock = clock.NewFake(now.Add(tt.elapsed))
+			assert.Equal(t, tt.want, s.Verify(u, tt.purpose))
+		})
+	}
+}
+
+func TestSignKeepsQuery(t *testing.T) {
+	t.Parallel()
+
+	signer := New(nil)
+	link, err := signer.Sign("/download/?name=report&signature=old", "download", time.Minute)
+	assert.NoError(t, err)
+
+	u, err := url.Parse(link)
+	assert.NoError(t, err)
+	assert.Equal(t, "report", u.Query().Get("name"))
+	assert.NotEqual(t, "old", u.Query().Get(SignatureParam))
+	assert.NotEqual(t, "", u.Query().Get(ExpiresParam))
+	assert.NoError(t, signer.Verify(u, "download"))
+}
+
+// replace returns link after changing its URL with fn
+func replace(t *testing.T, link string, fn func(*url.URL)) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	assert.NoError(t, err)
+	fn(u)
+	return u.String()
+}
+
+func TestVerifyToken(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	signer := New([]byte("secret"))
+	signer.Clock = clock.NewFake(now)
+
+	token := signer.Token("42", "password-reset", time.Hour)
+	forever := signer.Token("a@example.com", "unsubscribe", 0)
+	other := New([]byte("other")).Token("42", "password-reset", time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		elapsed time.Duration
+		want    string
+		wantErr error
+	}{
+		{"valid", token, "password-reset", time.Minute, "42", nil},
+		{"no expiry", forever, "unsubscribe", 365 * 24 * time.Hour, "a@example.com", nil},
+		{"expired", token, "password-reset", 2 * time.Hour, "", ErrExpired},
+		{"other purpose", token, "unsubscribe", time.Minute, "", ErrInvalidSignature},
+		{"other secret", other, "password-reset", time.Minute, "", ErrInvalidSignature},
+		{"malformed", "not-a-token", "password-reset", time.Minute, "", ErrInvalidSignature},
+		{"changed data", replacePart(token, 0, base64.RawURLEncoding.EncodeToString([]byte("43"))), "password-reset", time.Minute, "", ErrInvalidSignature},
+		{"changed expiry", replacePart(token, 1, "9999999999"), "password-reset", time.Minute, "", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New([]byte("secret"))
+			s.Clock = clock.NewFake(now.Add(tt.elapsed))
+			got, err := s.VerifyToken(tt.token, tt.purpose)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// The data can be read before the purpose is known
+	data, err := TokenData(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", data)
+}
+
+// replacePart returns token with one of its dot separated parts replaced
+func replacePart(token string, i int, part string) string {
+	parts := strings.Split(token, ".")
+	parts[i] = part
+	return strings.Join(parts, ".")
+}
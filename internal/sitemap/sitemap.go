@@ -0,0 +1,165 @@
+// Package sitemap collects the URLs that handlers and modules register and
+// writes them as sitemap.xml files, split into a sitemap index when there are
+// more URLs than fit in a single sitemap.
+package sitemap
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxURLs is the most URLs the sitemap protocol allows in a single sitemap file.
+const MaxURLs = 50000
+
+const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// URL is a single sitemap entry. Loc can be a path like "/contact/", which
+// is joined to the base URL when the sitemap is written.
+type URL struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string  // always, hourly, daily, weekly, monthly, yearly, or never
+	Priority   float64 // 0.0 to 1.0, zero leaves out the priority
+}
+
+// Source returns URLs for content that changes while the app runs, like database records.
+type Source func(ctx context.Context) ([]URL, error)
+
+// Registry holds the registered sitemap sources.
+type Registry struct {
+	mu       sync.RWMutex
+	sources  []Source
+	pageSize int
+}
+
+// New creates a Registry that splits the sitemap into pages of pageSize URLs.
+// A pageSize outside of 1 to MaxURLs uses MaxURLs.
+func New(pageSize int) *Registry {
+	if pageSize < 1 || pageSize > MaxURLs {
+		pageSize = MaxURLs
+	}
+	return &Registry{pageSize: pageSize}
+}
+
+// Add registers fixed URLs, like the pages of the site.
+func (r *Registry) Add(urls ...URL) {
+	r.AddSource(func(ctx context.Context) ([]URL, error) {
+		return urls, nil
+	})
+}
+
+// AddSource registers a function that returns URLs each time the sitemap is built.
+func (r *Registry) AddSource(source Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sources = append(r.sources, source)
+}
+
+// URLs returns the URLs from all of the sources in registration order.
+func (r *Registry) URLs(ctx context.Context) ([]URL, error) {
+	r.mu.RLock()
+	sources := append([]Source(nil), r.sources...)
+	r.mu.RUnlock()
+
+	var urls []URL
+	for _, source := range sources {
+		sourceURLs, err := source(ctx)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, sourceURLs...)
+	}
+	return urls, nil
+}
+
+// Pages returns the number of sitemap pages needed for n URLs.
+func (r *Registry) Pages(n int) int {
+	return max(1, (n+r.pageSize-1)/r.pageSize)
+}
+
+// Page returns the URLs on a 1-indexed page. The boolean is false when the page doesn't exist.
+func (r *Registry) Page(urls []URL, page int) ([]URL, bool) {
+	if page < 1 || page > r.Pages(len(urls)) {
+		return nil, false
+	}
+
+	start := (page - 1) * r.pageSize
+	end := min(start+r.pageSize, len(urls))
+	return urls[start:end], true
+}
+
+type xmlURLSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	URLs    []xmlURL `xml:"url"`
+}
+
+type xmlURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type xmlIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []xmlSitemap `xml:"sitemap"`
+}
+
+type xmlSitemap struct {
+	Loc string `xml:"loc"`
+}
+
+// WriteURLSet writes a sitemap urlset with the URLs. Relative URL paths are joined to baseURL.
+func WriteURLSet(w io.Writer, baseURL string, urls []URL) error {
+	set := xmlURLSet{Xmlns: xmlns, URLs: make([]xmlURL, len(urls))}
+
+	for i, u := range urls {
+		set.URLs[i] = xmlURL{
+			Loc:        absolute(baseURL, u.Loc),
+			ChangeFreq: u.ChangeFreq,
+		}
+		if !u.LastMod.IsZero() {
+			set.URLs[i].LastMod = u.LastMod.UTC().Format(time.RFC3339)
+		}
+		if u.Priority > 0 {
+			set.URLs[i].Priority = strconv.FormatFloat(u.Priority, 'f', 1, 64)
+		}
+	}
+
+	return write(w, set)
+}
+
+// WriteIndex writes a sitemap index that links to the sitemap locations.
+// Relative paths are joined to baseURL.
+func WriteIndex(w io.Writer, baseURL string, locs []string) error {
+	index := xmlIndex{Xmlns: xmlns, Sitemaps: make([]xmlSitemap, len(locs))}
+
+	for i, loc := range locs {
+		index.Sitemaps[i] = xmlSitemap{Loc: absolute(baseURL, loc)}
+	}
+
+	return write(w, index)
+}
+
+func write(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// absolute joins a path to the base URL, leaving absolute URLs unchanged.
+func absolute(baseURL, loc string) string {
+	if strings.HasPrefix(loc, "http://") || strings.HasPrefix(loc, "https://") {
+		return loc
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(loc, "/")
+}
@@ -0,0 +1,80 @@
+package sitemap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestRegistryURLs(t *testing.T) {
+	t.Parallel()
+
+	r := New(0)
+	r.Add(URL{Loc: "/"}, URL{Loc: "/contact/"})
+	r.AddSource(func(ctx context.Context) ([]URL, error) {
+		return []URL{{Loc: "/notes/1/"}}, nil
+	})
+
+	urls, err := r.URLs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(urls))
+	assert.Equal(t, "/notes/1/", urls[2].Loc)
+
+	// Source errors are returned
+	r.AddSource(func(ctx context.Context) ([]URL, error) {
+		return nil, errors.New("db down")
+	})
+	_, err = r.URLs(context.Background())
+	assert.Equal(t, "db down", err.Error())
+}
+
+func TestRegistryPages(t *testing.T) {
+	t.Parallel()
+
+	r := New(2)
+	urls := []URL{{Loc: "/1"}, {Loc: "/2"}, {Loc: "/3"}}
+
+	assert.Equal(t, 1, r.Pages(0))
+	assert.Equal(t, 2, r.Pages(len(urls)))
+
+	page, ok := r.Page(urls, 2)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, len(page))
+	assert.Equal(t, "/3", page[0].Loc)
+
+	_, ok = r.Page(urls, 3)
+	assert.Equal(t, false, ok)
+	_, ok = r.Page(urls, 0)
+	assert.Equal(t, false, ok)
+}
+
+func TestWriteURLSet(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.Buffer{}
+	err := WriteURLSet(&buf, "https://example.com/", []URL{
+		{Loc: "/contact/", LastMod: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), ChangeFreq: "monthly", Priority: 0.5},
+		{Loc: "https://other.example.com/?a=1&b=2"},
+	})
+	assert.NoError(t, err)
+
+	body := buf.String()
+	assert.StringIn(t, `<?xml version="1.0" encoding="UTF-8"?>`, body)
+	assert.StringIn(t, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`, body)
+	assert.StringIn(t, `<url><loc>https://example.com/contact/</loc><lastmod>2025-03-01T00:00:00Z</lastmod><changefreq>monthly</changefreq><priority>0.5</priority></url>`, body)
+	assert.StringIn(t, `<url><loc>https://other.example.com/?a=1&amp;b=2</loc></url>`, body)
+}
+
+func TestWriteIndex(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.Buffer{}
+	err := WriteIndex(&buf, "https://example.com", []string{"/sitemap.xml?page=1"})
+	assert.NoError(t, err)
+
+	assert.StringIn(t, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>https://example.com/sitemap.xml?page=1</loc></sitemap></sitemapindex>`, buf.String())
+}
@@ -0,0 +1,169 @@
+// Package sse streams server-sent events to browsers. A Broker keeps a queue for every
+// connected client, sends heartbeats so proxies don't close idle streams, and ends the
+// streams when it's closed so the server can shut down.
+package sse
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single server-sent event. Only Data is required.
+type Event struct {
+	ID   string // Sent back by the browser in Last-Event-ID when it reconnects
+	Name string // Event type for addEventListener, "message" when empty
+	Data string // Payload, sent as one data line per line
+}
+
+// WriteTo writes the event in the text/event-stream format.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Name)
+	}
+	for _, line := range strings.Split(e.Data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Broker sends published events to every connected client.
+type Broker struct {
+	heartbeat  time.Duration
+	bufferSize int
+
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+// New creates a Broker that sends a heartbeat comment to idle clients every heartbeat
+// and queues up to bufferSize events for every client.
+func New(heartbeat time.Duration, bufferSize int) *Broker {
+	return &Broker{
+		heartbeat:  heartbeat,
+		bufferSize: max(bufferSize, 1),
+		clients:    map[chan Event]struct{}{},
+		done:       make(chan struct{}),
+	}
+}
+
+// Publish sends an event to every connected client. Clients that fall a whole buffer
+// behind are disconnected, so one slow client doesn't hold up the others. Browsers
+// reconnect on their own.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for client := range b.clients {
+		select {
+		case client <- e:
+		default:
+			delete(b.clients, client)
+			close(client)
+		}
+	}
+}
+
+// Clients returns the number of connected clients.
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// Close ends every stream and rejects new clients. Register it with
+// http.Server.RegisterOnShutdown, because the server waits for open streams to end.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+}
+
+// subscribe adds a client queue, or returns false after Close
+func (b *Broker) subscribe() (chan Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, false
+	}
+	client := make(chan Event, b.bufferSize)
+	b.clients[client] = struct{}{}
+	return client, true
+}
+
+// unsubscribe removes a client queue unless Publish already dropped it
+func (b *Broker) unsubscribe(client chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, client)
+}
+
+// ServeHTTP streams the published events to a client until it disconnects, falls
+// behind, or the Broker is closed.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// The stream stays open much longer than the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	client, ok := b.subscribe()
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer b.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Ask nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(b.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-client:
+			if !ok {
+				return
+			}
+			if _, err := e.WriteTo(w); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
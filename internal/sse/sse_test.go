@@ -0,0 +1,102 @@
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestEventWriteTo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{"data only", Event{Data: "hello"}, "data: hello\n\n"},
+		{"all fields", Event{ID: "7", Name: "note", Data: "hi"}, "id: 7\nevent: note\ndata: hi\n\n"},
+		{"multi line", Event{Data: "a\nb"}, "data: a\ndata: b\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			_, err := tt.event.WriteTo(&b)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+}
+
+// readUntil reads lines from the stream until it reads want
+func readUntil(t *testing.T, reader *bufio.Reader, want string) {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		if line == want {
+			return
+		}
+	}
+}
+
+func TestBroker(t *testing.T) {
+	t.Parallel()
+
+	broker := New(10*time.Millisecond, 10)
+	ts := httptest.NewServer(broker)
+	defer ts.Close()
+
+	response, err := http.Get(ts.URL)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(response.Body)
+	readUntil(t, reader, ": connected\n")
+	assert.Equal(t, 1, broker.Clients())
+
+	// Idle streams get heartbeats
+	readUntil(t, reader, ": heartbeat\n")
+
+	// Published events are streamed
+	broker.Publish(Event{Name: "note", Data: "hello"})
+	readUntil(t, reader, "event: note\n")
+	readUntil(t, reader, "data: hello\n")
+
+	// Closing the broker ends the stream and rejects new clients
+	broker.Close()
+	for err == nil {
+		_, err = reader.ReadString('\n')
+	}
+	assert.Equal(t, true, strings.Contains(err.Error(), "EOF"))
+
+	response, err = http.Get(ts.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func TestBrokerSlowClient(t *testing.T) {
+	t.Parallel()
+
+	broker := New(time.Hour, 1)
+	client, ok := broker.subscribe()
+	assert.Equal(t, true, ok)
+
+	// A client with a full queue is dropped
+	broker.Publish(Event{Data: "1"})
+	broker.Publish(Event{Data: "2"})
+	assert.Equal(t, 0, broker.Clients())
+
+	e := <-client
+	assert.Equal(t, "1", e.Data)
+	_, open := <-client
+	assert.Equal(t, false, open)
+}
@@ -0,0 +1,118 @@
+// Package storage stores user uploaded files, separate from the embedded static files.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrInvalidKey is returned for keys that aren't a clean, relative slash separated
+// path, like "../secret" or "/etc/passwd".
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// File is a stored file. It can seek so that it can be served with range requests.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// Backend is where user uploaded files are stored. Keys are slash separated
+// paths, like "avatars/42.png". Missing files return an error that matches
+// fs.ErrNotExist.
+type Backend interface {
+	Open(key string) (File, error)
+	Save(key string, r io.Reader) error
+	Delete(key string) error
+}
+
+// Local is a Backend that stores files in a directory on the local disk.
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a Backend that stores files in dir. The directory is created
+// when the first file is saved.
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+// path returns the file path on disk for a key
+func (l *Local) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Open opens the file stored at key.
+func (l *Local) Open(key string) (File, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories aren't files that can be served
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+	}
+
+	return f, nil
+}
+
+// Save stores the contents of r at key, replacing any existing file. The file is
+// written to a temporary file first so readers never see a partial file.
+func (l *Local) Save(key string, r io.Reader) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// Delete removes the file stored at key. Deleting a missing file isn't an error.
+func (l *Local) Delete(key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+
+	store := NewLocal(t.TempDir())
+
+	// Save creates the directories for the key
+	err := store.Save("avatars/42.png", strings.NewReader("image data"))
+	assert.NoError(t, err)
+
+	f, err := store.Open("avatars/42.png")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "image data", string(data))
+
+	// Save replaces existing files
+	err = store.Save("avatars/42.png", strings.NewReader("new"))
+	assert.NoError(t, err)
+	f, err = store.Open("avatars/42.png")
+	assert.NoError(t, err)
+	info, err := f.Stat()
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, int64(3), info.Size())
+
+	// Directories can't be opened
+	_, err = store.Open("avatars")
+	assert.Equal(t, true, errors.Is(err, fs.ErrNotExist))
+
+	// Delete removes the file, and deleting it again is fine
+	assert.NoError(t, store.Delete("avatars/42.png"))
+	assert.NoError(t, store.Delete("avatars/42.png"))
+	_, err = store.Open("avatars/42.png")
+	assert.Equal(t, true, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestLocalInvalidKey(t *testing.T) {
+	t.Parallel()
+
+	store := NewLocal(t.TempDir())
+
+	for _, key := range []string{"", ".", "../secret", "/etc/passwd", "a/../../b", `a\..\b/`} {
+		_, err := store.Open(key)
+		assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+
+		err = store.Save(key, strings.NewReader(""))
+		assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+
+		err = store.Delete(key)
+		assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+	}
+}
@@ -0,0 +1,213 @@
+// Package tasks runs named background tasks on a bounded pool of workers with
+// retries, panic recovery, and a graceful shutdown.
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned by Run when the task queue has no room for another task.
+	ErrQueueFull = errors.New("tasks: queue is full")
+
+	// ErrClosed is returned by Run after the Manager has started shutting down.
+	ErrClosed = errors.New("tasks: manager is shut down")
+)
+
+// Func is the work done by a task. The context is cancelled when the shutdown
+// deadline passes, so long running tasks should stop when it's done.
+type Func func(ctx context.Context) error
+
+// Option configures a single task.
+type Option func(*task)
+
+// WithRetries retries a failed task up to retries more times. The wait between
+// attempts starts at backoff and doubles after every attempt.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(t *task) {
+		t.retries = retries
+		t.backoff = backoff
+	}
+}
+
+type task struct {
+	name    string
+	fn      Func
+	retries int
+	backoff time.Duration
+}
+
+// Stats are counters for the tasks handled by a Manager.
+type Stats struct {
+	Queued    int64 // Tasks waiting for a worker
+	Running   int64 // Tasks being run by a worker
+	Succeeded int64 // Tasks that finished without an error
+	Failed    int64 // Tasks that failed on their last attempt or panicked
+	Retried   int64 // Retry attempts across all tasks
+}
+
+// Manager runs tasks on a fixed number of workers.
+type Manager struct {
+	logger *slog.Logger
+	queue  chan task
+	wg     sync.WaitGroup
+
+	// ctx is cancelled when the shutdown deadline passes
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+
+	queued    atomic.Int64
+	running   atomic.Int64
+	succeeded atomic.Int64
+	failed    atomic.Int64
+	retried   atomic.Int64
+}
+
+// New creates a Manager with workers goroutines and room for queueSize tasks
+// waiting to run, and starts the workers.
+func New(logger *slog.Logger, workers, queueSize int) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m := &Manager{
+		logger: logger,
+		queue:  make(chan task, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for range max(workers, 1) {
+		m.wg.Add(1)
+		go m.work()
+	}
+
+	return m
+}
+
+// Run queues a named task to run in the background. It returns ErrQueueFull when
+// every worker is busy and the queue is full, or ErrClosed after Shutdown.
+func (m *Manager) Run(name string, fn Func, opts ...Option) error {
+	t := task{name: name, fn: fn}
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	select {
+	case m.queue <- t:
+		m.queued.Add(1)
+		return nil
+	default:
+		m.logger.Error("task", "name", name, "error", ErrQueueFull)
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting new tasks and waits for the queued and running tasks to
+// finish. When ctx is done first, the context passed to the tasks is cancelled and
+// Shutdown returns the ctx error.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		m.cancel()
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the task counters.
+func (m *Manager) Stats() Stats {
+	return Stats{
+		Queued:    m.queued.Load(),
+		Running:   m.running.Load(),
+		Succeeded: m.succeeded.Load(),
+		Failed:    m.failed.Load(),
+		Retried:   m.retried.Load(),
+	}
+}
+
+// work runs tasks from the queue until it's closed and empty.
+func (m *Manager) work() {
+	defer m.wg.Done()
+
+	for t := range m.queue {
+		m.queued.Add(-1)
+		m.running.Add(1)
+
+		if err := m.runWithRetries(t); err != nil {
+			m.failed.Add(1)
+			m.logger.Error("task", "name", t.name, "error", err)
+		} else {
+			m.succeeded.Add(1)
+		}
+
+		m.running.Add(-1)
+	}
+}
+
+// runWithRetries runs a task until it succeeds or runs out of retries.
+// Panics are not retried.
+func (m *Manager) runWithRetries(t task) error {
+	backoff := t.backoff
+
+	for attempt := 0; ; attempt++ {
+		panicked, err := m.runOnce(t)
+		if err == nil || panicked || attempt >= t.retries {
+			return err
+		}
+
+		m.retried.Add(1)
+		m.logger.Warn("task retry", "name", t.name, "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		// Wait before the next attempt unless the shutdown deadline passes
+		select {
+		case <-time.After(backoff):
+		case <-m.ctx.Done():
+			return fmt.Errorf("%w (retry cancelled: %w)", err, m.ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+// runOnce runs a single attempt of a task, recovering any panic so that
+// a panic doesn't kill the whole application.
+func (m *Manager) runOnce(t task) (panicked bool, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			panicked = true
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+
+	return false, t.fn(m.ctx)
+}
@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func newTestManager(workers, queueSize int) *Manager {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), workers, queueSize)
+}
+
+func TestManagerRun(t *testing.T) {
+	t.Parallel()
+
+	m := newTestManager(2, 10)
+
+	var count atomic.Int64
+	for range 5 {
+		err := m.Run("count", func(ctx context.Context) error {
+			count.Add(1)
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	// Shutdown waits for every queued task
+	err := m.Shutdown(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), count.Load())
+	assert.Equal(t, Stats{Succeeded: 5}, m.Stats())
+
+	// No tasks are accepted after shutdown
+	err = m.Run("late", func(ctx context.Context) error { return nil })
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestManagerRetries(t *testing.T) {
+	t.Parallel()
+
+	m := newTestManager(1, 10)
+
+	// Succeeds on the third attempt
+	var attempts atomic.Int64
+	err := m.Run("flaky", func(ctx context.Context) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	}, WithRetries(3, time.Millisecond))
+	assert.NoError(t, err)
+
+	// Fails every attempt
+	err = m.Run("broken", func(ctx context.Context) error {
+		return errors.New("broken")
+	}, WithRetries(1, time.Millisecond))
+	assert.NoError(t, err)
+
+	// Panics aren't retried
+	err = m.Run("panics", func(ctx context.Context) error {
+		panic("oops")
+	}, WithRetries(5, time.Millisecond))
+	assert.NoError(t, err)
+
+	err = m.Shutdown(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(3), attempts.Load())
+	assert.Equal(t, Stats{Succeeded: 1, Failed: 2, Retried: 3}, m.Stats())
+}
+
+func TestRunOncePanic(t *testing.T) {
+	t.Parallel()
+
+	m := newTestManager(1, 1)
+	defer m.Shutdown(context.Background())
+
+	// A panicking task is recovered and reported as an error with the panic value
+	var panicked bool
+	var err error
+	assert.NotPanics(t, func() {
+		panicked, err = m.runOnce(task{name: "panics", fn: func(ctx context.Context) error {
+			panic("oops")
+		}})
+	})
+	assert.Equal(t, true, panicked)
+	assert.StringIn(t, "panic: oops", err.Error())
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	t.Parallel()
+
+	m := newTestManager(1, 1)
+
+	// Block the only worker until the test is done
+	release := make(chan struct{})
+	started := make(chan struct{})
+	err := m.Run("blocker", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	assert.NoError(t, err)
+	<-started
+
+	// The first task fills the queue and the second is rejected
+	err = m.Run("queued", func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+	err = m.Run("rejected", func(ctx context.Context) error { return nil })
+	assert.Equal(t, ErrQueueFull, err)
+
+	close(release)
+	err = m.Shutdown(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestManagerShutdownDeadline(t *testing.T) {
+	t.Parallel()
+
+	m := newTestManager(1, 1)
+
+	// The task runs until its context is cancelled
+	cancelled := make(chan struct{})
+	err := m.Run("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = m.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The task context is cancelled once the deadline passes
+	<-cancelled
+}
@@ -0,0 +1,169 @@
+// Package tenant finds the tenant of a request, from its subdomain or a header set by
+// a trusted proxy, and carries it in the request context so stores can keep every
+// tenant's data apart.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrUnknown is returned by Resolver.Resolve for a request to a tenant that doesn't exist.
+var ErrUnknown = errors.New("tenant: unknown tenant")
+
+// rxID matches tenant IDs, which have to work as a subdomain
+var rxID = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Tenant is a customer of the application with its own users and data.
+type Tenant struct {
+	ID   string // Subdomain of the tenant, like "acme"
+	Name string
+}
+
+// Parse parses a comma separated list of tenants, like "acme=Acme Inc,globex=Globex".
+// The name is optional and defaults to the ID.
+func Parse(list string) ([]Tenant, error) {
+	var tenants []Tenant
+	for item := range strings.SplitSeq(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		id, name, _ := strings.Cut(item, "=")
+		id, name = strings.TrimSpace(id), strings.TrimSpace(name)
+		if !rxID.MatchString(id) {
+			return nil, fmt.Errorf("tenant: invalid tenant ID %q, use lowercase letters, digits, and dashes", id)
+		}
+		if name == "" {
+			name = id
+		}
+		tenants = append(tenants, Tenant{ID: id, Name: name})
+	}
+	return tenants, nil
+}
+
+// Resolver finds the tenant of a request.
+type Resolver struct {
+	tenants []Tenant
+
+	// Domain is the main domain of the site, like "example.com". Requests to a
+	// subdomain, like "acme.example.com", are for the tenant with that ID.
+	Domain string
+
+	// Header is a request header with the tenant ID, like "X-Tenant-ID". Only set it
+	// behind a proxy that sets or removes the header, since clients can send any value.
+	Header string
+}
+
+// NewResolver creates a Resolver for the tenants.
+func NewResolver(tenants ...Tenant) *Resolver {
+	return &Resolver{tenants: tenants}
+}
+
+// Enabled reports whether there are any tenants.
+func (res *Resolver) Enabled() bool {
+	return len(res.tenants) > 0
+}
+
+// Lookup returns the tenant with an ID.
+func (res *Resolver) Lookup(id string) (*Tenant, bool) {
+	i := slices.IndexFunc(res.tenants, func(t Tenant) bool { return t.ID == id })
+	if i < 0 {
+		return nil, false
+	}
+	t := res.tenants[i]
+	return &t, true
+}
+
+// Resolve returns the tenant of a request from the Header, then the subdomain of Domain.
+// It returns nil for requests to the main site, and ErrUnknown for a tenant that
+// doesn't exist.
+func (res *Resolver) Resolve(r *http.Request) (*Tenant, error) {
+	id := ""
+	if res.Header != "" {
+		id = strings.ToLower(strings.TrimSpace(r.Header.Get(res.Header)))
+	}
+	if id == "" && res.Domain != "" {
+		id = subdomain(r.Host, res.Domain)
+	}
+	if id == "" {
+		return nil, nil
+	}
+
+	t, ok := res.Lookup(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknown, id)
+	}
+	return t, nil
+}
+
+// subdomain returns the first label of host below domain, like "acme" for
+// "acme.example.com:8000" and "example.com", and "" for any other host. "www" is the
+// main site.
+func subdomain(host, domain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	prefix, ok := strings.CutSuffix(host, "."+strings.ToLower(domain))
+	if !ok || prefix == "www" {
+		return ""
+	}
+
+	// Only the label right below the domain, so a.b.example.com is tenant "b"
+	if i := strings.LastIndexByte(prefix, '.'); i >= 0 {
+		prefix = prefix[i+1:]
+	}
+	return prefix
+}
+
+//=============================================================================
+//	Request context
+//=============================================================================
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx with the tenant.
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tenant in ctx, or nil for the main site.
+func FromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(contextKey{}).(*Tenant)
+	return t
+}
+
+// ID returns the ID of the tenant in ctx, or "" for the main site. Stores save it with
+// every row and filter every query by it, so tenants never see each other's data.
+func ID(ctx context.Context) string {
+	if t := FromContext(ctx); t != nil {
+		return t.ID
+	}
+	return ""
+}
+
+// URL returns the URL of the tenant in ctx on a site with base URL, like
+// "https://acme.example.com" for "https://example.com" or "https://www.example.com",
+// for links in emails. It returns base for the main site, or when base isn't a URL.
+func URL(ctx context.Context, base string) string {
+	id := ID(ctx)
+	if id == "" {
+		return base
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" {
+		return base
+	}
+	u.Host = id + "." + strings.TrimPrefix(u.Host, "www.")
+	return u.String()
+}
@@ -0,0 +1,82 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tenants, err := Parse("acme=Acme Inc, globex ,")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(tenants))
+	assert.Equal(t, Tenant{ID: "acme", Name: "Acme Inc"}, tenants[0])
+	assert.Equal(t, Tenant{ID: "globex", Name: "globex"}, tenants[1])
+
+	_, err = Parse("Not Valid=Name")
+	assert.Equal(t, true, err != nil)
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	res := NewResolver(Tenant{ID: "acme", Name: "Acme"})
+	res.Domain = "example.com"
+	res.Header = "X-Tenant-ID"
+
+	tests := []struct {
+		host    string
+		header  string
+		want    string
+		unknown bool
+	}{
+		{"example.com", "", "", false},
+		{"www.example.com", "", "", false},
+		{"acme.example.com:8000", "", "acme", false},
+		{"ACME.Example.com", "", "acme", false},
+		{"app.acme.example.com", "", "acme", false},
+		{"other.example.com", "", "", true},
+		{"acme.example.org", "", "", false},
+		{"example.com", "acme", "acme", false},
+		{"example.com", "nope", "", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tt.host
+		if tt.header != "" {
+			r.Header.Set("X-Tenant-ID", tt.header)
+		}
+
+		got, err := res.Resolve(r)
+		assert.Equal(t, tt.unknown, errors.Is(err, ErrUnknown))
+		assert.Equal(t, tt.want, ID(WithTenant(context.Background(), got)))
+	}
+}
+
+func TestID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Equal(t, "", ID(ctx))
+
+	ctx = WithTenant(ctx, &Tenant{ID: "acme"})
+	assert.Equal(t, "acme", ID(ctx))
+}
+
+func TestURL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Equal(t, "https://example.com", URL(ctx, "https://example.com"))
+
+	ctx = WithTenant(ctx, &Tenant{ID: "acme"})
+	assert.Equal(t, "https://acme.example.com", URL(ctx, "https://example.com"))
+	assert.Equal(t, "https://acme.example.com:8443", URL(ctx, "https://www.example.com:8443"))
+	assert.Equal(t, "", URL(ctx, ""))
+}
@@ -0,0 +1,138 @@
+package users
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// MemoryStore is a Store that keeps users in memory. Users are lost when the
+// application stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	users  map[int64]User
+
+	// Clock tells the time of CreatedAt, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: map[int64]User{}, Clock: clock.System}
+}
+
+// Insert saves a new user and sets its ID, Tenant, Email, Role, and CreatedAt, or
+// returns ErrDuplicateEmail. A VerifiedAt time is saved too.
+func (s *MemoryStore) Insert(ctx context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	email := NormalizeEmail(u.Email)
+	for _, existing := range s.users {
+		if existing.Tenant == tenantID && existing.Email == email {
+			return ErrDuplicateEmail
+		}
+	}
+
+	s.nextID++
+	u.ID = s.nextID
+	u.Tenant = tenantID
+	u.Email = email
+	if u.Role == "" {
+		u.Role = RoleViewer
+	}
+	u.CreatedAt = s.Clock.Now()
+	s.users[u.ID] = *u
+	return nil
+}
+
+// Get returns a user, or ErrNotFound for a user of another tenant.
+func (s *MemoryStore) Get(ctx context.Context, id int64) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.get(ctx, id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+// GetByEmail returns the user with an email in the tenant, or ErrNotFound.
+func (s *MemoryStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	email = NormalizeEmail(email)
+	for _, u := range s.users {
+		if u.Tenant == tenantID && u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SetPasswordHash replaces the password hash of a user.
+func (s *MemoryStore) SetPasswordHash(ctx context.Context, id int64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.get(ctx, id)
+	if !ok {
+		return ErrNotFound
+	}
+	u.PasswordHash = hash
+	s.users[id] = u
+	return nil
+}
+
+// SetVerified marks the email of a user as verified at a time. A user that's already
+// verified keeps the first time.
+func (s *MemoryStore) SetVerified(ctx context.Context, id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.get(ctx, id)
+	if !ok {
+		return ErrNotFound
+	}
+	if u.VerifiedAt.IsZero() {
+		u.VerifiedAt = at
+		s.users[id] = u
+	}
+	return nil
+}
+
+// SetRole changes the role of a user, or returns ErrInvalidRole.
+func (s *MemoryStore) SetRole(ctx context.Context, id int64, role string) error {
+	if !slices.Contains(Roles, role) {
+		return ErrInvalidRole
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.get(ctx, id)
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	s.users[id] = u
+	return nil
+}
+
+// get returns a user of the tenant in ctx. s.mu has to be locked.
+func (s *MemoryStore) get(ctx context.Context, id int64) (User, bool) {
+	u, ok := s.users[id]
+	if !ok || u.Tenant != tenant.ID(ctx) {
+		return User{}, false
+	}
+	return u, true
+}
@@ -0,0 +1,117 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+// SQLStore is a Store that saves users in the users table of a PostgreSQL database.
+// The table is created by the assets/migrations/008_create_users.sql migration, and
+// 013_add_users_tenant.sql adds the tenant_id column that every query filters by.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore for the users table in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Insert saves a new user and sets its ID, Tenant, Email, Role, and CreatedAt, or
+// returns ErrDuplicateEmail. A VerifiedAt time is saved too.
+func (s *SQLStore) Insert(ctx context.Context, u *User) error {
+	role := u.Role
+	if role == "" {
+		role = RoleViewer
+	}
+
+	// Nothing is returned when the email is taken, which works the same with every driver
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO users (tenant_id, email, password_hash, verified_at, role) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, email) DO NOTHING
+		RETURNING id, tenant_id, email, role, created_at`,
+		tenant.ID(ctx), NormalizeEmail(u.Email), u.PasswordHash, nullTime(u.VerifiedAt), role,
+	).Scan(&u.ID, &u.Tenant, &u.Email, &u.Role, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+// Get returns a user, or ErrNotFound for a user of another tenant.
+func (s *SQLStore) Get(ctx context.Context, id int64) (*User, error) {
+	return s.get(ctx, `
+		SELECT id, tenant_id, email, password_hash, verified_at, role, created_at FROM users
+		WHERE tenant_id = $1 AND id = $2`,
+		tenant.ID(ctx), id,
+	)
+}
+
+// GetByEmail returns the user with an email in the tenant, or ErrNotFound.
+func (s *SQLStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return s.get(ctx, `
+		SELECT id, tenant_id, email, password_hash, verified_at, role, created_at FROM users
+		WHERE tenant_id = $1 AND email = $2`,
+		tenant.ID(ctx), NormalizeEmail(email),
+	)
+}
+
+// SetPasswordHash replaces the password hash of a user.
+func (s *SQLStore) SetPasswordHash(ctx context.Context, id int64, hash string) error {
+	return s.update(ctx, `UPDATE users SET password_hash = $1 WHERE tenant_id = $2 AND id = $3`, hash, tenant.ID(ctx), id)
+}
+
+// SetVerified marks the email of a user as verified at a time. A user that's already
+// verified keeps the first time.
+func (s *SQLStore) SetVerified(ctx context.Context, id int64, at time.Time) error {
+	return s.update(ctx, `UPDATE users SET verified_at = COALESCE(verified_at, $1) WHERE tenant_id = $2 AND id = $3`, at, tenant.ID(ctx), id)
+}
+
+// SetRole changes the role of a user, or returns ErrInvalidRole.
+func (s *SQLStore) SetRole(ctx context.Context, id int64, role string) error {
+	if !slices.Contains(Roles, role) {
+		return ErrInvalidRole
+	}
+	return s.update(ctx, `UPDATE users SET role = $1 WHERE tenant_id = $2 AND id = $3`, role, tenant.ID(ctx), id)
+}
+
+// update runs a query that changes one user, or returns ErrNotFound
+func (s *SQLStore) update(ctx context.Context, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// get returns the user of a query, or ErrNotFound
+func (s *SQLStore) get(ctx context.Context, query string, args ...any) (*User, error) {
+	var u User
+	var verifiedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&u.ID, &u.Tenant, &u.Email, &u.PasswordHash, &verifiedAt, &u.Role, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.VerifiedAt = verifiedAt.Time
+	return &u, nil
+}
+
+// nullTime returns NULL for the zero time
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,12 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/dbtest"
+)
+
+func TestSQLStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewSQLStore(dbtest.New(t)))
+}
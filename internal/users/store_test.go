@@ -0,0 +1,111 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+	"github.com/sglmr/gowebstart/internal/clock"
+	"github.com/sglmr/gowebstart/internal/tenant"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewMemoryStore())
+}
+
+// testStore tests the behavior every Store has
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	// Emails are saved in lower case
+	u := &User{Email: " Alice@Example.com", PasswordHash: "hash"}
+	assert.NoError(t, store.Insert(ctx, u))
+	assert.NotEqual(t, int64(0), u.ID)
+	assert.Equal(t, "alice@example.com", u.Email)
+	assert.Equal(t, false, u.CreatedAt.IsZero())
+
+	// An email can only sign up once, in any case
+	err := store.Insert(ctx, &User{Email: "ALICE@example.com", PasswordHash: "other"})
+	assert.Equal(t, ErrDuplicateEmail, err)
+
+	got, err := store.GetByEmail(ctx, "Alice@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, got.ID)
+	assert.Equal(t, "hash", got.PasswordHash)
+
+	assert.NoError(t, store.SetPasswordHash(ctx, u.ID, "new hash"))
+	got, err = store.Get(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "new hash", got.PasswordHash)
+
+	// New users aren't verified until they are
+	assert.Equal(t, false, got.Verified())
+	verifiedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.SetVerified(ctx, u.ID, verifiedAt))
+	assert.NoError(t, store.SetVerified(ctx, u.ID, verifiedAt.Add(time.Hour)))
+	got, err = store.Get(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.EqualTime(t, verifiedAt, got.VerifiedAt, time.Second)
+	assert.Equal(t, ErrNotFound, store.SetVerified(ctx, u.ID+100, verifiedAt))
+
+	_, err = store.Get(ctx, u.ID+100)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = store.GetByEmail(ctx, "bob@example.com")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, store.SetPasswordHash(ctx, u.ID+100, "hash"))
+
+	// New users are viewers
+	assert.Equal(t, RoleViewer, got.Role)
+	assert.NoError(t, store.SetRole(ctx, u.ID, RoleEditor))
+	got, err = store.Get(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleEditor, got.Role)
+	assert.Equal(t, ErrInvalidRole, store.SetRole(ctx, u.ID, "owner"))
+	assert.Equal(t, ErrNotFound, store.SetRole(ctx, u.ID+100, RoleAdmin))
+
+	// Ensure keeps an existing user, and only raises its role
+	ensured, err := Ensure(ctx, store, clock.System, "alice@example.com", "ignored", RoleViewer)
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, ensured.ID)
+	assert.Equal(t, "new hash", ensured.PasswordHash)
+	assert.Equal(t, RoleEditor, ensured.Role)
+
+	_, err = Ensure(ctx, store, clock.System, "alice@example.com", "ignored", RoleAdmin)
+	assert.NoError(t, err)
+	got, err = store.Get(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleAdmin, got.Role)
+
+	// Ensure creates a missing user
+	ensured, err = Ensure(ctx, store, clock.System, "bob@example.com", "bob hash", RoleAdmin)
+	assert.NoError(t, err)
+	got, err = store.GetByEmail(ctx, "bob@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, ensured.ID, got.ID)
+	assert.Equal(t, true, got.Verified())
+	assert.Equal(t, RoleAdmin, got.Role)
+
+	// Each tenant has its own users, so the same email can sign up in another tenant
+	acme := tenant.WithTenant(ctx, &tenant.Tenant{ID: "acme"})
+	_, err = store.GetByEmail(acme, "alice@example.com")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = store.Get(acme, u.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, store.SetPasswordHash(acme, u.ID, "acme hash"))
+	assert.Equal(t, ErrNotFound, store.SetRole(acme, u.ID, RoleViewer))
+
+	acmeAlice := &User{Email: "alice@example.com", PasswordHash: "acme hash"}
+	assert.NoError(t, store.Insert(acme, acmeAlice))
+	assert.Equal(t, "acme", acmeAlice.Tenant)
+	assert.NotEqual(t, u.ID, acmeAlice.ID)
+	got, err = store.GetByEmail(acme, "alice@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, acmeAlice.ID, got.ID)
+	assert.Equal(t, "acme hash", got.PasswordHash)
+	got, err = store.GetByEmail(ctx, "alice@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, got.ID)
+	assert.Equal(t, "", got.Tenant)
+}
@@ -0,0 +1,118 @@
+// Package users stores the accounts that users sign up for and log in with.
+//
+// Users belong to the tenant in the request context (see tenant.ID), like notes. Stores
+// save it with new users and only ever find the users of that tenant, so an account
+// can't log in to another tenant. Emails are compared in lower case, so an address can
+// only sign up once in each tenant.
+package users
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+var (
+	// ErrNotFound is returned by a Store for a user that doesn't exist.
+	ErrNotFound = errors.New("users: user not found")
+
+	// ErrDuplicateEmail is returned by Insert for an email that already has a user.
+	ErrDuplicateEmail = errors.New("users: email already in use")
+
+	// ErrInvalidRole is returned by SetRole for a role that isn't one of Roles.
+	ErrInvalidRole = errors.New("users: invalid role")
+)
+
+// Roles of users, from the fewest permissions to the most. A role has the permissions of
+// the roles before it, so an admin is an editor and a viewer too.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Roles are the valid roles, from the fewest permissions to the most.
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// HasRole reports whether a user with role has the permissions of required. Unknown
+// roles have no permissions.
+func HasRole(role, required string) bool {
+	have, want := slices.Index(Roles, role), slices.Index(Roles, required)
+	return have >= 0 && want >= 0 && have >= want
+}
+
+// User is an account that can log in.
+type User struct {
+	ID           int64
+	Tenant       string // ID of the tenant of the user, or "" for the main site
+	Email        string
+	PasswordHash string    // argon2id hash from internal/password
+	VerifiedAt   time.Time // When the user verified their email, zero until then
+	Role         string    // One of Roles, RoleViewer when empty on Insert
+	CreatedAt    time.Time
+}
+
+// HasRole reports whether the user has the permissions of role.
+func (u *User) HasRole(role string) bool {
+	return HasRole(u.Role, role)
+}
+
+// Verified reports whether the user verified their email.
+func (u *User) Verified() bool {
+	return !u.VerifiedAt.IsZero()
+}
+
+// Store saves users. Implementations have to be safe for concurrent use.
+type Store interface {
+	// Insert saves a new user and sets its ID, Tenant, Email, Role, and CreatedAt, or
+	// returns ErrDuplicateEmail. A VerifiedAt time is saved too.
+	Insert(ctx context.Context, u *User) error
+
+	// Get returns a user, or ErrNotFound for a user of another tenant.
+	Get(ctx context.Context, id int64) (*User, error)
+
+	// GetByEmail returns the user with an email in the tenant, or ErrNotFound.
+	GetByEmail(ctx context.Context, email string) (*User, error)
+
+	// SetPasswordHash replaces the password hash of a user.
+	SetPasswordHash(ctx context.Context, id int64, hash string) error
+
+	// SetVerified marks the email of a user as verified at a time. A user that's
+	// already verified keeps the first time.
+	SetVerified(ctx context.Context, id int64, at time.Time) error
+
+	// SetRole changes the role of a user, or returns ErrInvalidRole.
+	SetRole(ctx context.Context, id int64, role string) error
+}
+
+// NormalizeEmail returns the email the stores save and look up.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Ensure creates a user with the email, password hash, and role unless the email already
+// has one, like the admin account of the -auth-email flag. The email of a new user comes
+// from the configuration rather than a signup, so it's verified. An existing user gets
+// the role when it has fewer permissions. clk tells the time of VerifiedAt.
+func Ensure(ctx context.Context, store Store, clk clock.Clock, email, hash, role string) (*User, error) {
+	u, err := store.GetByEmail(ctx, email)
+	if err == nil && !u.HasRole(role) {
+		err = store.SetRole(ctx, u.ID, role)
+		u.Role = role
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return u, err
+	}
+
+	u = &User{Email: email, PasswordHash: hash, VerifiedAt: clk.Now(), Role: role}
+	err = store.Insert(ctx, u)
+	if errors.Is(err, ErrDuplicateEmail) {
+		// Another instance created it in the meantime
+		return store.GetByEmail(ctx, email)
+	}
+	return u, err
+}
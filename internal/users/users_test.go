@@ -0,0 +1,27 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestHasRole(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleViewer, true},
+		{RoleEditor, RoleEditor, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleViewer, RoleEditor, false},
+		{"", RoleViewer, false},
+		{RoleAdmin, "owner", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, HasRole(tt.role, tt.required))
+	}
+}
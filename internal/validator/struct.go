@@ -0,0 +1,120 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// printer formats the numbers of error messages, like "1,000"
+var printer = message.NewPrinter(language.English)
+
+// ValidateStruct checks the fields of a struct, or a pointer to one, with the rules in
+// their "validate" tags and adds an error for the first rule each field breaks. Errors
+// are keyed by the field name, like form.Check, and their code is the name of the rule.
+// The rules are comma separated:
+//
+//	required    the string isn't blank, or the number isn't zero
+//	email       the string is empty or an email, see IsEmail
+//	url         the string is empty or a URL, see IsURL
+//	min=N       the string has at least N runes, or the number is at least N
+//	max=N       the string has at most N runes, or the number is at most N
+//	oneof=a b   the string is empty or one of the space separated values
+//
+// Fields without a tag aren't checked. Unknown rules and rules on fields of other types
+// panic, since they're mistakes in the code rather than in the input.
+//
+//	type noteForm struct {
+//		Title string `validate:"required,max=100"`
+//		validator.Validator
+//	}
+//
+//	form.ValidateStruct(form)
+func (v *Validator) ValidateStruct(s any) {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: ValidateStruct of %T, not a struct", s))
+	}
+
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		for rule := range strings.SplitSeq(tag, ",") {
+			name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+			if valid, message := checkRule(field.Name, rv.Field(i), name, param); !valid {
+				v.AddErrorCode(field.Name, name, message)
+				break
+			}
+		}
+	}
+}
+
+// checkRule checks a field value with a rule of its validate tag. It returns false and
+// the error message when the value breaks the rule.
+func checkRule(fieldName string, value reflect.Value, rule, param string) (bool, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return checkString(fieldName, value.String(), rule, param)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return checkInt(fieldName, value.Int(), rule, param)
+	}
+	panic(fmt.Sprintf("validator: rule %q on field %s of unsupported type %s", rule, fieldName, value.Type()))
+}
+
+// checkString checks a string field with a rule
+func checkString(fieldName, value, rule, param string) (bool, string) {
+	switch rule {
+	case "required":
+		return NotBlank(value), fmt.Sprintf("%s is required.", fieldName)
+	case "email":
+		return value == "" || IsEmail(value), fmt.Sprintf("%s must be a valid email address.", fieldName)
+	case "url":
+		return value == "" || IsURL(value), fmt.Sprintf("%s must be a valid URL.", fieldName)
+	case "min":
+		n := ruleInt(fieldName, rule, param)
+		return MinRunes(value, n), printer.Sprintf("%s must be at least %d characters.", fieldName, n)
+	case "max":
+		n := ruleInt(fieldName, rule, param)
+		return MaxRunes(value, n), printer.Sprintf("%s must be less than %d characters.", fieldName, n)
+	case "oneof":
+		values := strings.Fields(param)
+		return value == "" || In(value, values...), fmt.Sprintf("%s must be one of %s.", fieldName, strings.Join(values, ", "))
+	}
+	panic(fmt.Sprintf("validator: unknown rule %q on field %s", rule, fieldName))
+}
+
+// checkInt checks a number field with a rule
+func checkInt(fieldName string, value int64, rule, param string) (bool, string) {
+	switch rule {
+	case "required":
+		return value != 0, fmt.Sprintf("%s is required.", fieldName)
+	case "min":
+		n := ruleInt(fieldName, rule, param)
+		return value >= int64(n), printer.Sprintf("%s must be at least %d.", fieldName, n)
+	case "max":
+		n := ruleInt(fieldName, rule, param)
+		return value <= int64(n), printer.Sprintf("%s must be at most %d.", fieldName, n)
+	}
+	panic(fmt.Sprintf("validator: unknown rule %q on number field %s", rule, fieldName))
+}
+
+// ruleInt parses the number of a rule, like the 100 of max=100
+func ruleInt(fieldName, rule, param string) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validator: rule %q on field %s needs a number, like %s=10", rule, fieldName, rule))
+	}
+	return n
+}
@@ -0,0 +1,136 @@
+package validator
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateStruct(t *testing.T) {
+	type form struct {
+		Name    string `validate:"required,max=5"`
+		Email   string `validate:"email"`
+		Website string `validate:"url"`
+		Message string `validate:"min=3,max=1000"`
+		Color   string `validate:"oneof=red green"`
+		Age     int    `validate:"min=18,max=130"`
+		Notes   string
+		Validator
+	}
+
+	tests := []struct {
+		name string
+		form form
+		want map[string]string
+	}{
+		{
+			name: "valid",
+			form: form{Name: "Ana", Email: "ana@example.com", Website: "https://example.com", Message: "Hello", Color: "red", Age: 30},
+			want: map[string]string{},
+		},
+		{
+			name: "empty optional fields",
+			form: form{Name: "Ana", Message: "Hello", Age: 30},
+			want: map[string]string{},
+		},
+		{
+			name: "invalid",
+			form: form{Name: " ", Email: "ana", Website: "example.com", Message: "Hi", Color: "blue", Age: 12},
+			want: map[string]string{
+				"Name":    "Name is required.",
+				"Email":   "Email must be a valid email address.",
+				"Website": "Website must be a valid URL.",
+				"Message": "Message must be at least 3 characters.",
+				"Color":   "Color must be one of red, green.",
+				"Age":     "Age must be at least 18.",
+			},
+		},
+		{
+			name: "too long",
+			form: form{Name: "Annabel", Message: strings.Repeat("a", 1001), Age: 200},
+			want: map[string]string{
+				"Name":    "Name must be less than 5 characters.",
+				"Message": "Message must be less than 1,000 characters.",
+				"Age":     "Age must be at most 130.",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.form
+			f.ValidateStruct(&f)
+
+			if got := f.Errors; !maps.Equal(got, tt.want) {
+				t.Errorf("Errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStructCodes(t *testing.T) {
+	type form struct {
+		Name  string `validate:"required"`
+		Email string `validate:"email"`
+		Age   int    `validate:"min=18"`
+		Validator
+	}
+
+	// The code of each error is the rule it broke
+	f := form{Email: "ana", Age: 12}
+	f.ValidateStruct(f)
+	want := []FieldError{
+		{Field: "Age", Code: "min", Message: "Age must be at least 18."},
+		{Field: "Email", Code: "email", Message: "Email must be a valid email address."},
+		{Field: "Name", Code: "required", Message: "Name is required."},
+	}
+	if got := f.FieldErrors(); !slices.Equal(got, want) {
+		t.Errorf("FieldErrors() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateStructKeepsErrors(t *testing.T) {
+	type form struct {
+		Name string `validate:"required"`
+		Validator
+	}
+
+	// Errors added before aren't replaced
+	f := form{}
+	f.AddError("Name", "Name is taken.")
+	f.ValidateStruct(f)
+	if got := f.Errors["Name"]; got != "Name is taken." {
+		t.Errorf("Errors[Name] = %q, want %q", got, "Name is taken.")
+	}
+}
+
+func TestValidateStructPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		s    any
+	}{
+		{"not a struct", "name"},
+		{"unknown rule", struct {
+			Name string `validate:"uppercase"`
+		}{}},
+		{"rule without a number", struct {
+			Name string `validate:"max=ten"`
+		}{}},
+		{"unsupported type", struct {
+			Tags []string `validate:"required"`
+		}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			var v Validator
+			v.ValidateStruct(tt.s)
+		})
+	}
+}
@@ -1,17 +1,36 @@
 package validator
 
 import (
+	"cmp"
+	"context"
+	"maps"
 	"net/url"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 	"unicode/utf8"
 
+	"github.com/sglmr/gowebstart/internal/pwned"
 	"golang.org/x/exp/constraints"
 )
 
 // Validator is a type with helper functions for Validation
 type Validator struct {
 	Errors map[string]string
+
+	// codes are the machine readable codes of the errors, like "required", for FieldErrors
+	codes map[string]string
+}
+
+// CodeInvalid is the code of errors added without one, like by Check and AddError
+const CodeInvalid = "invalid"
+
+// FieldError is an error of a field in the JSON responses of APIs
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"` // Machine readable reason, like "required" or "invalid"
+	Message string `json:"message"`
 }
 
 //=============================================================================
@@ -30,12 +49,22 @@ func (v Validator) HasErrors() bool {
 
 // AddError adds a message for a given key to the map of errors.
 func (v *Validator) AddError(key, message string) {
+	v.AddErrorCode(key, CodeInvalid, message)
+}
+
+// AddErrorCode adds a message with a machine readable code, like "required", for a
+// given key to the map of errors.
+func (v *Validator) AddErrorCode(key, code, message string) {
 	if v.Errors == nil {
 		v.Errors = map[string]string{}
 	}
+	if v.codes == nil {
+		v.codes = map[string]string{}
+	}
 
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
+		v.codes[key] = code
 	}
 }
 
@@ -46,6 +75,20 @@ func (v *Validator) Check(key string, ok bool, message string) {
 	}
 }
 
+// FieldErrors returns the errors sorted by field, for JSON responses like
+// [{"field": "Title", "code": "required", "message": "Title is required."}].
+func (v Validator) FieldErrors() []FieldError {
+	errs := make([]FieldError, 0, len(v.Errors))
+	for _, field := range slices.Sorted(maps.Keys(v.Errors)) {
+		errs = append(errs, FieldError{
+			Field:   field,
+			Code:    cmp.Or(v.codes[field], CodeInvalid),
+			Message: v.Errors[field],
+		})
+	}
+	return errs
+}
+
 //=============================================================================
 //	Validaton checks
 //=============================================================================
@@ -136,3 +179,146 @@ func IsURL(value string) bool {
 
 	return u.Scheme != "" && u.Host != ""
 }
+
+// phoneRegion is the calling code and national number rules of a phone region
+type phoneRegion struct {
+	callingCode string
+	trunkPrefix string // Prefix of national numbers dialed within the country, like the 0 of 020 7946 0018
+	minDigits   int    // Digits of national numbers, without the trunk prefix
+	maxDigits   int
+}
+
+// phoneRegions are the regions that IsPhone and NormalizePhone know, by ISO 3166 code.
+// Add more as they're needed.
+var phoneRegions = map[string]phoneRegion{
+	"US": {"1", "", 10, 10},
+	"CA": {"1", "", 10, 10},
+	"MX": {"52", "", 10, 10},
+	"GB": {"44", "0", 9, 10},
+	"IE": {"353", "0", 7, 9},
+	"DE": {"49", "0", 6, 13},
+	"FR": {"33", "0", 9, 9},
+	"ES": {"34", "", 9, 9},
+	"IT": {"39", "", 6, 11},
+	"NL": {"31", "0", 9, 9},
+	"AU": {"61", "0", 9, 9},
+	"NZ": {"64", "0", 8, 10},
+	"IN": {"91", "0", 10, 10},
+	"BR": {"55", "0", 10, 11},
+	"JP": {"81", "0", 9, 10},
+}
+
+// rxPhoneSeparators matches the characters people put between the digits of phone numbers
+var rxPhoneSeparators = regexp.MustCompile(`[\s.\-()/]`)
+
+// NormalizePhone returns a phone number in the E.164 format, like "+14155550123". Numbers
+// starting with + or 00 are international, and other numbers are national numbers of
+// region, like "US" or "GB", with their trunk prefix removed. Spaces, dots, dashes,
+// slashes, and parentheses between the digits are ignored. The boolean is false when
+// the number isn't valid or region is unknown.
+//
+// It only checks the length of numbers, not whether they're assigned.
+func NormalizePhone(value, region string) (string, bool) {
+	// The (0) of "+44 (0)20 7946 0018" is the trunk prefix, which isn't dialed from abroad
+	number := strings.ReplaceAll(strings.TrimSpace(value), "(0)", "")
+	number = rxPhoneSeparators.ReplaceAllString(number, "")
+
+	// International numbers only need a plausible E.164 length
+	international := strings.HasPrefix(number, "+") || strings.HasPrefix(number, "00")
+	if international {
+		number = strings.TrimPrefix(strings.TrimPrefix(number, "+"), "00")
+		if !isDigits(number) || !Between(len(number), 8, 15) || number[0] == '0' {
+			return "", false
+		}
+		return "+" + number, true
+	}
+
+	r, ok := phoneRegions[strings.ToUpper(region)]
+	if !ok || !isDigits(number) {
+		return "", false
+	}
+
+	// Drop the trunk prefix, or the calling code that some people dial nationally, like
+	// the 1 of 1-415-555-0123
+	switch {
+	case r.trunkPrefix != "" && strings.HasPrefix(number, r.trunkPrefix):
+		number = strings.TrimPrefix(number, r.trunkPrefix)
+	case len(number) > r.maxDigits && strings.HasPrefix(number, r.callingCode):
+		number = strings.TrimPrefix(number, r.callingCode)
+	}
+
+	if !Between(len(number), r.minDigits, r.maxDigits) || number[0] == '0' {
+		return "", false
+	}
+	return "+" + r.callingCode + number, true
+}
+
+// IsPhone returns true when the value is a phone number, international or national to
+// region. See NormalizePhone for the formats it accepts and to store the E.164 number.
+func IsPhone(value, region string) bool {
+	_, ok := NormalizePhone(value, region)
+	return ok
+}
+
+// isDigits returns true when s only has ASCII digits, and at least one
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// DateLayout is the format of the value of <input type="date">, like "2026-10-16"
+const DateLayout = "2006-01-02"
+
+// IsDate parses a date in the layout, like DateLayout, and returns true when it's valid.
+// Dates without a time zone are in UTC.
+//
+//	date, ok := validator.IsDate(form.Date, validator.DateLayout)
+//	form.Check("Date", ok, "Date must be a date, like 2026-10-16.")
+func IsDate(value, layout string) (time.Time, bool) {
+	t, err := time.Parse(layout, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// IsTime parses the time of day of <input type="time">, like "14:30" or "14:30:15", and
+// returns true when it's valid. The time is on January 1 of year 0 in UTC, so combine
+// it with a date like time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc).
+func IsTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// After returns true when t is after min, like a date that has to be in the future.
+func After(t, min time.Time) bool {
+	return t.After(min)
+}
+
+// Before returns true when t is before max, like a birth date that has to be in the past.
+func Before(t, max time.Time) bool {
+	return t.Before(max)
+}
+
+// NotPwned returns true when the password hasn't appeared in a data breach known to the
+// checker. It fails open, returning true when checker is nil or fails, so an outage of
+// the Have I Been Pwned API doesn't stop users from setting a password.
+func NotPwned(ctx context.Context, checker pwned.Checker, password string) bool {
+	if checker == nil {
+		return true
+	}
+	count, err := checker.Count(ctx, password)
+	return err != nil || count == 0
+}
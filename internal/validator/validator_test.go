@@ -1,8 +1,12 @@
 package validator
 
 import (
+	"context"
+	"errors"
 	"regexp"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestValidatorValid(t *testing.T) {
@@ -736,3 +740,174 @@ func TestIsURL(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		region   string
+		expected string
+		valid    bool
+	}{
+		{name: "international", value: "+1 (415) 555-0123", region: "", expected: "+14155550123", valid: true},
+		{name: "international with 00", value: "0044 20 7946 0018", region: "US", expected: "+442079460018", valid: true},
+		{name: "international with a trunk prefix", value: "+44 (0)20 7946 0018", region: "", expected: "+442079460018", valid: true},
+		{name: "US national", value: "(415) 555-0123", region: "US", expected: "+14155550123", valid: true},
+		{name: "US national with the calling code", value: "1-415-555-0123", region: "us", expected: "+14155550123", valid: true},
+		{name: "GB national", value: "020 7946 0018", region: "GB", expected: "+442079460018", valid: true},
+		{name: "DE national", value: "030/12345678", region: "DE", expected: "+493012345678", valid: true},
+		{name: "ES national", value: "612.345.678", region: "ES", expected: "+34612345678", valid: true},
+		{name: "too short", value: "555-0123", region: "US", valid: false},
+		{name: "too long", value: "+1234567890123456", region: "", valid: false},
+		{name: "letters", value: "415-CALL-NOW", region: "US", valid: false},
+		{name: "unknown region", value: "0123456789", region: "XX", valid: false},
+		{name: "national without a region", value: "4155550123", region: "", valid: false},
+		{name: "empty", value: "", region: "US", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizePhone(tt.value, tt.region)
+			if got != tt.expected || ok != tt.valid {
+				t.Errorf("NormalizePhone(%q, %q) = %q, %v, want %q, %v", tt.value, tt.region, got, ok, tt.expected, tt.valid)
+			}
+			if IsPhone(tt.value, tt.region) != tt.valid {
+				t.Errorf("IsPhone(%q, %q) = %v, want %v", tt.value, tt.region, !tt.valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestIsDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		layout   string
+		expected time.Time
+		valid    bool
+	}{
+		{name: "date input", value: "2026-10-16", layout: DateLayout, expected: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), valid: true},
+		{name: "spaces", value: " 2026-10-16 ", layout: DateLayout, expected: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), valid: true},
+		{name: "other layout", value: "16/10/2026", layout: "02/01/2006", expected: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), valid: true},
+		{name: "day out of range", value: "2026-02-30", layout: DateLayout, valid: false},
+		{name: "wrong layout", value: "10/16/2026", layout: DateLayout, valid: false},
+		{name: "empty", value: "", layout: DateLayout, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := IsDate(tt.value, tt.layout)
+			if !got.Equal(tt.expected) || ok != tt.valid {
+				t.Errorf("IsDate(%q, %q) = %v, %v, want %v, %v", tt.value, tt.layout, got, ok, tt.expected, tt.valid)
+			}
+		})
+	}
+}
+
+func TestIsTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		hour   int
+		minute int
+		second int
+		valid  bool
+	}{
+		{name: "hours and minutes", value: "14:30", hour: 14, minute: 30, valid: true},
+		{name: "with seconds", value: "09:05:15", hour: 9, minute: 5, second: 15, valid: true},
+		{name: "hour out of range", value: "25:00", valid: false},
+		{name: "12 hour clock", value: "2:30 PM", valid: false},
+		{name: "empty", value: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := IsTime(tt.value)
+			if ok != tt.valid || got.Hour() != tt.hour || got.Minute() != tt.minute || got.Second() != tt.second {
+				t.Errorf("IsTime(%q) = %v, %v, want %02d:%02d:%02d, %v", tt.value, got, ok, tt.hour, tt.minute, tt.second, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAfterBefore(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		t      time.Time
+		after  bool
+		before bool
+	}{
+		{name: "earlier", t: now.Add(-time.Hour), after: false, before: true},
+		{name: "same time", t: now, after: false, before: false},
+		{name: "later", t: now.Add(time.Hour), after: true, before: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := After(tt.t, now); got != tt.after {
+				t.Errorf("After(%v, %v) = %v, want %v", tt.t, now, got, tt.after)
+			}
+			if got := Before(tt.t, now); got != tt.before {
+				t.Errorf("Before(%v, %v) = %v, want %v", tt.t, now, got, tt.before)
+			}
+		})
+	}
+}
+
+// fakeChecker is a pwned.Checker with fixed results
+type fakeChecker struct {
+	count int
+	err   error
+}
+
+func (c fakeChecker) Count(ctx context.Context, password string) (int, error) {
+	return c.count, c.err
+}
+
+func TestNotPwned(t *testing.T) {
+	tests := []struct {
+		name     string
+		checker  *fakeChecker
+		expected bool
+	}{
+		{name: "no checker", checker: nil, expected: true},
+		{name: "not pwned", checker: &fakeChecker{}, expected: true},
+		{name: "pwned", checker: &fakeChecker{count: 3}, expected: false},
+		{name: "checker fails open", checker: &fakeChecker{err: errors.New("timeout")}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			if tt.checker == nil {
+				got = NotPwned(context.Background(), nil, "password")
+			} else {
+				got = NotPwned(context.Background(), *tt.checker, "password")
+			}
+			if got != tt.expected {
+				t.Errorf("NotPwned() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidatorFieldErrors(t *testing.T) {
+	var v Validator
+	v.Check("Title", false, "Title is too long.")
+	v.AddErrorCode("Body", "required", "Body is required.")
+	v.AddErrorCode("Body", "max", "Body is too long.") // The first error is kept
+
+	want := []FieldError{
+		{Field: "Body", Code: "required", Message: "Body is required."},
+		{Field: "Title", Code: CodeInvalid, Message: "Title is too long."},
+	}
+	if got := v.FieldErrors(); !slices.Equal(got, want) {
+		t.Errorf("FieldErrors() = %v, want %v", got, want)
+	}
+
+	// No errors marshal as an empty list rather than null
+	if got := (Validator{}).FieldErrors(); got == nil || len(got) != 0 {
+		t.Errorf("FieldErrors() = %#v, want an empty slice", got)
+	}
+}
@@ -4,41 +4,64 @@ import (
 	"fmt"
 	"os"
 	"runtime/debug"
+	"time"
 )
 
-func Version() string {
-	var modified bool
-	var revision string
-	var time string
+// buildSettings holds the vcs settings embedded in the binary by the go build tool.
+type buildSettings struct {
+	revision string
+	time     string
+	modified bool
+}
 
-	// GIT_REV is a environment variable on dokku
-	if os.Getenv("GIT_REV") != "" {
-		return os.Getenv("GIT_REV")
-	}
+// readBuildSettings gets the vcs settings from the build info of the currently running binary
+func readBuildSettings() buildSettings {
+	var settings buildSettings
 
-	// Get the build info from the currently running binary
 	bi, ok := debug.ReadBuildInfo()
-	if ok {
-		for _, s := range bi.Settings {
-			switch s.Key {
-			case "vcs.revision":
-				revision = s.Value
-			case "vcs.modified":
-				if s.Value == "true" {
-					modified = true
-				}
-			case "vcs.time":
-				time = s.Value
+	if !ok {
+		return settings
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			settings.revision = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				settings.modified = true
 			}
+		case "vcs.time":
+			settings.time = s.Value
 		}
 	}
-	if revision == "" {
+	return settings
+}
+
+func Version() string {
+	// GIT_REV is a environment variable on dokku
+	if os.Getenv("GIT_REV") != "" {
+		return os.Getenv("GIT_REV")
+	}
+
+	settings := readBuildSettings()
+	if settings.revision == "" {
 		return "unavailable"
 	}
 
-	if modified {
-		return fmt.Sprintf("%s-%s+dirty", time, revision)
+	if settings.modified {
+		return fmt.Sprintf("%s-%s+dirty", settings.time, settings.revision)
 	}
 
-	return fmt.Sprintf("%s-%s", time, revision)
+	return fmt.Sprintf("%s-%s", settings.time, settings.revision)
+}
+
+// BuildTime returns the vcs commit time the binary was built from. The boolean
+// is false when the binary was built without vcs information, like with go run.
+func BuildTime() (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, readBuildSettings().time)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
 }
@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+// MemoryStore is a Store that keeps endpoints and deliveries in memory. They're lost
+// when the application stops, so it's meant for tests and development.
+type MemoryStore struct {
+	mu             sync.Mutex
+	nextID         int64
+	endpoints      []Endpoint
+	deliveries     []Delivery
+	maxDeliveries  int
+	nextDeliveryID int64
+
+	// Clock tells the time of CreatedAt, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewMemoryStore returns an empty MemoryStore that keeps the latest maxDeliveries
+// deliveries.
+func NewMemoryStore(maxDeliveries int) *MemoryStore {
+	return &MemoryStore{maxDeliveries: max(maxDeliveries, 1), Clock: clock.System}
+}
+
+// Endpoints returns every endpoint, oldest first.
+func (s *MemoryStore) Endpoints(ctx context.Context) ([]Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.endpoints), nil
+}
+
+// Endpoint returns an endpoint, or ErrNotFound.
+func (s *MemoryStore) Endpoint(ctx context.Context, id int64) (*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.endpoints, func(e Endpoint) bool { return e.ID == id })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	endpoint := s.endpoints[i]
+	return &endpoint, nil
+}
+
+// AddEndpoint saves a new endpoint and sets its ID and CreatedAt.
+func (s *MemoryStore) AddEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	endpoint.ID = s.nextID
+	endpoint.CreatedAt = s.Clock.Now()
+	s.endpoints = append(s.endpoints, *endpoint)
+	return nil
+}
+
+// DeleteEndpoint deletes an endpoint.
+func (s *MemoryStore) DeleteEndpoint(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.endpoints, func(e Endpoint) bool { return e.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.endpoints = slices.Delete(s.endpoints, i, i+1)
+	return nil
+}
+
+// LogDelivery saves a delivery and sets its ID and CreatedAt. The oldest deliveries
+// are dropped past the limit.
+func (s *MemoryStore) LogDelivery(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextDeliveryID++
+	delivery.ID = s.nextDeliveryID
+	delivery.CreatedAt = s.Clock.Now()
+	s.deliveries = append(s.deliveries, *delivery)
+	if len(s.deliveries) > s.maxDeliveries {
+		s.deliveries = slices.Delete(s.deliveries, 0, len(s.deliveries)-s.maxDeliveries)
+	}
+	return nil
+}
+
+// Deliveries returns the latest limit deliveries, newest first.
+func (s *MemoryStore) Deliveries(ctx context.Context, limit int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := slices.Clone(s.deliveries)
+	slices.Reverse(deliveries)
+	return deliveries[:min(limit, len(deliveries))], nil
+}
@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SQLStore is a Store that saves endpoints and deliveries in a PostgreSQL database. The
+// tables are created by the assets/migrations/003_create_webhooks.sql migration.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore for the webhook tables in db.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Endpoints returns every endpoint, oldest first.
+func (s *SQLStore) Endpoints(ctx context.Context) ([]Endpoint, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, url, secret, events, created_at FROM webhook_endpoints ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []Endpoint
+	for rows.Next() {
+		endpoint, err := scanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, *endpoint)
+	}
+	return endpoints, rows.Err()
+}
+
+// Endpoint returns an endpoint, or ErrNotFound.
+func (s *SQLStore) Endpoint(ctx context.Context, id int64) (*Endpoint, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT id, url, secret, events, created_at FROM webhook_endpoints WHERE id = $1`, id)
+	endpoint, err := scanEndpoint(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return endpoint, err
+}
+
+// AddEndpoint saves a new endpoint and sets its ID and CreatedAt.
+func (s *SQLStore) AddEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints (url, secret, events) VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		endpoint.URL, endpoint.Secret, strings.Join(endpoint.Events, ","),
+	).Scan(&endpoint.ID, &endpoint.CreatedAt)
+}
+
+// DeleteEndpoint deletes an endpoint.
+func (s *SQLStore) DeleteEndpoint(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// LogDelivery saves a delivery and sets its ID and CreatedAt.
+func (s *SQLStore) LogDelivery(ctx context.Context, delivery *Delivery) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, url, event_id, event_type, status_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		delivery.EndpointID, delivery.URL, delivery.EventID, delivery.EventType,
+		delivery.StatusCode, delivery.Error, delivery.Duration.Milliseconds(),
+	).Scan(&delivery.ID, &delivery.CreatedAt)
+}
+
+// Deliveries returns the latest limit deliveries, newest first.
+func (s *SQLStore) Deliveries(ctx context.Context, limit int) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, endpoint_id, url, event_id, event_type, status_code, error, duration_ms, created_at
+		FROM webhook_deliveries ORDER BY id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		var ms int64
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.URL, &d.EventID, &d.EventType, &d.StatusCode, &d.Error, &ms, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Duration = time.Duration(ms) * time.Millisecond
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// scanEndpoint reads an endpoint row, with the events stored comma separated
+func scanEndpoint(row interface{ Scan(dest ...any) error }) (*Endpoint, error) {
+	var endpoint Endpoint
+	var events string
+	if err := row.Scan(&endpoint.ID, &endpoint.URL, &endpoint.Secret, &events, &endpoint.CreatedAt); err != nil {
+		return nil, err
+	}
+	if events != "" {
+		endpoint.Events = strings.Split(events, ",")
+	}
+	return &endpoint, nil
+}
@@ -0,0 +1,226 @@
+// Package webhooks sends signed JSON events to the endpoint URLs registered in a Store,
+// and logs every delivery attempt.
+//
+// Every request has these headers:
+//
+//	X-Webhook-ID:        the event ID, the same for every retry
+//	X-Webhook-Event:     the event type, like "contact.submitted"
+//	X-Webhook-Timestamp: unix seconds when the request was signed
+//	X-Webhook-Signature: "sha256=" and the hex HMAC-SHA256 of "{timestamp}.{body}"
+//
+// Receivers check the signature with the endpoint secret, and reject old timestamps
+// to stop replayed requests.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/clock"
+)
+
+// Event types sent by the application
+const (
+	EventContactSubmitted = "contact.submitted"
+	EventUserRegistered   = "user.registered"
+)
+
+// ErrNotFound is returned by a Store for an endpoint that doesn't exist.
+var ErrNotFound = errors.New("webhooks: endpoint not found")
+
+// Endpoint is a URL that receives events.
+type Endpoint struct {
+	ID        int64
+	URL       string
+	Secret    string   // Key for the HMAC signature of every request
+	Events    []string // Event types to send, or every event when empty
+	CreatedAt time.Time
+}
+
+// Wants reports whether the endpoint receives events of a type.
+func (e Endpoint) Wants(eventType string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, eventType)
+}
+
+// Event is a JSON message sent to the endpoints.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewEvent creates an event with a random ID and data encoded as JSON.
+func NewEvent(eventType string, data any) (Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("webhooks: encoding %s data: %w", eventType, err)
+	}
+	return Event{
+		ID:        "evt_" + rand.Text(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      encoded,
+	}, nil
+}
+
+// Delivery is the log entry of one attempt to send an event to an endpoint.
+type Delivery struct {
+	ID         int64
+	EndpointID int64
+	URL        string
+	EventID    string
+	EventType  string
+	StatusCode int    // Response status, zero when the request failed
+	Error      string // Empty for a successful delivery
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+// Store saves the endpoints and the delivery log. Implementations have to be safe
+// for concurrent use.
+type Store interface {
+	// Endpoints returns every endpoint, oldest first.
+	Endpoints(ctx context.Context) ([]Endpoint, error)
+
+	// Endpoint returns an endpoint, or ErrNotFound.
+	Endpoint(ctx context.Context, id int64) (*Endpoint, error)
+
+	// AddEndpoint saves a new endpoint and sets its ID and CreatedAt.
+	AddEndpoint(ctx context.Context, endpoint *Endpoint) error
+
+	// DeleteEndpoint deletes an endpoint.
+	DeleteEndpoint(ctx context.Context, id int64) error
+
+	// LogDelivery saves a delivery and sets its ID and CreatedAt.
+	LogDelivery(ctx context.Context, delivery *Delivery) error
+
+	// Deliveries returns the latest limit deliveries, newest first.
+	Deliveries(ctx context.Context, limit int) ([]Delivery, error)
+}
+
+// NewSecret returns a random endpoint secret.
+func NewSecret() string {
+	return "whsec_" + rand.Text()
+}
+
+// Sign returns the X-Webhook-Signature header value for a request body.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether a signature matches the body, in constant time.
+func Verify(secret string, timestamp time.Time, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Subscribers returns the endpoints in store that receive events of a type.
+func Subscribers(ctx context.Context, store Store, eventType string) ([]Endpoint, error) {
+	endpoints, err := store.Endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(endpoints, func(e Endpoint) bool { return !e.Wants(eventType) }), nil
+}
+
+// Dispatcher sends events to endpoints.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+
+	// Clock tells the time of the signatures, clock.System by default.
+	Clock clock.Clock
+}
+
+// NewDispatcher creates a Dispatcher for the endpoints in store. Requests time out
+// after timeout.
+func NewDispatcher(store Store, timeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: &http.Client{Timeout: timeout},
+		Clock:  clock.System,
+	}
+}
+
+// Deliver sends an event to an endpoint and logs the attempt. It returns an error for
+// a failed request or a response status outside 2xx, so the caller can retry. Events
+// for a deleted endpoint are dropped without an error.
+func (d *Dispatcher) Deliver(ctx context.Context, endpointID int64, event Event) error {
+	endpoint, err := d.store.Endpoint(ctx, endpointID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("webhooks: encoding event: %w", err)
+	}
+
+	delivery := &Delivery{
+		EndpointID: endpoint.ID,
+		URL:        endpoint.URL,
+		EventID:    event.ID,
+		EventType:  event.Type,
+	}
+
+	start := time.Now()
+	err = d.send(ctx, endpoint, event, body, delivery)
+	delivery.Duration = time.Since(start)
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	if logErr := d.store.LogDelivery(context.WithoutCancel(ctx), delivery); logErr != nil {
+		return errors.Join(err, logErr)
+	}
+	return err
+}
+
+// send posts the signed event body to the endpoint
+func (d *Dispatcher) send(ctx context.Context, endpoint *Endpoint, event Event, body []byte, delivery *Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	now := d.Clock.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gowebstart-webhooks")
+	req.Header.Set("X-Webhook-ID", event.ID)
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-Webhook-Signature", Sign(endpoint.Secret, now, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Read a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	delivery.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhooks: %s responded %s", endpoint.URL, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	signature := Sign("secret", ts, body)
+
+	assert.Equal(t, true, Verify("secret", ts, body, signature))
+	assert.Equal(t, false, Verify("other", ts, body, signature))
+	assert.Equal(t, false, Verify("secret", ts.Add(time.Second), body, signature))
+	assert.Equal(t, false, Verify("secret", ts, []byte(`{}`), signature))
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	t.Parallel()
+
+	status := http.StatusOK
+	received := make(chan *http.Request, 2)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		if !Verify("secret", time.Unix(timestamp, 0), body, r.Header.Get("X-Webhook-Signature")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event Event
+		json.Unmarshal(body, &event)
+		r.Header.Set("Test-Data", string(event.Data))
+		received <- r
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	endpoint := &Endpoint{URL: receiver.URL, Secret: "secret", Events: []string{EventContactSubmitted}}
+	assert.NoError(t, store.AddEndpoint(ctx, endpoint))
+	assert.NoError(t, store.AddEndpoint(ctx, &Endpoint{URL: receiver.URL, Secret: "other", Events: []string{EventUserRegistered}}))
+
+	dispatcher := NewDispatcher(store, time.Second)
+
+	// Only endpoints subscribed to the event type receive it
+	subscribers, err := Subscribers(ctx, store, EventContactSubmitted)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(subscribers))
+	assert.Equal(t, endpoint.ID, subscribers[0].ID)
+
+	event, err := NewEvent(EventContactSubmitted, map[string]string{"name": "Person"})
+	assert.NoError(t, err)
+
+	// A signed event is delivered and logged
+	assert.NoError(t, dispatcher.Deliver(ctx, endpoint.ID, event))
+	r := <-received
+	assert.Equal(t, event.ID, r.Header.Get("X-Webhook-ID"))
+	assert.Equal(t, EventContactSubmitted, r.Header.Get("X-Webhook-Event"))
+	assert.Equal(t, `{"name":"Person"}`, r.Header.Get("Test-Data"))
+
+	// Failed responses are errors, so the delivery is retried
+	status = http.StatusInternalServerError
+	err = dispatcher.Deliver(ctx, endpoint.ID, event)
+	assert.Equal(t, true, err != nil)
+	<-received
+
+	deliveries, err := store.Deliveries(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(deliveries))
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].StatusCode)
+	assert.Equal(t, true, deliveries[0].Error != "")
+	assert.Equal(t, http.StatusOK, deliveries[1].StatusCode)
+	assert.Equal(t, "", deliveries[1].Error)
+
+	// Events for deleted endpoints are dropped
+	assert.NoError(t, store.DeleteEndpoint(ctx, endpoint.ID))
+	assert.NoError(t, dispatcher.Deliver(ctx, endpoint.ID, event))
+}
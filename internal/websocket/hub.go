@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrHubClosed is returned by Hub.Add after the Hub has shut down.
+var ErrHubClosed = errors.New("websocket: hub is shut down")
+
+// Hub keeps track of the open connections under a group, like a tenant ID, and a key,
+// like a user ID or session token, so messages can be sent to every connection, to the
+// connections of one group, or to the connections of one key.
+type Hub struct {
+	writeTimeout time.Duration
+
+	mu     sync.Mutex
+	conns  map[*Conn]member
+	closed bool
+}
+
+// member is the group and key a connection is registered under
+type member struct {
+	group string
+	key   string
+}
+
+// NewHub creates a Hub that gives up on a write to a connection after writeTimeout.
+func NewHub(writeTimeout time.Duration) *Hub {
+	return &Hub{
+		writeTimeout: writeTimeout,
+		conns:        map[*Conn]member{},
+	}
+}
+
+// Add registers a connection under a group and key. It returns ErrHubClosed after Shutdown.
+func (h *Hub) Add(c *Conn, group, key string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrHubClosed
+	}
+	h.conns[c] = member{group: group, key: key}
+	return nil
+}
+
+// Remove unregisters a connection.
+func (h *Hub) Remove(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c)
+}
+
+// Count returns the number of open connections.
+func (h *Hub) Count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns)
+}
+
+// Broadcast sends a message to every connection of every group.
+func (h *Hub) Broadcast(messageType MessageType, data []byte) {
+	h.send(func(member) bool { return true }, messageType, data)
+}
+
+// BroadcastGroup sends a message to every connection registered under group.
+func (h *Hub) BroadcastGroup(group string, messageType MessageType, data []byte) {
+	h.send(func(m member) bool { return m.group == group }, messageType, data)
+}
+
+// SendTo sends a message to every connection registered under key.
+func (h *Hub) SendTo(key string, messageType MessageType, data []byte) {
+	h.send(func(m member) bool { return m.key == key }, messageType, data)
+}
+
+// send writes a message to the matching connections. Connections that fail the write
+// are closed, so a slow client doesn't hold up the others.
+func (h *Hub) send(match func(m member) bool, messageType MessageType, data []byte) {
+	h.mu.Lock()
+	var conns []*Conn
+	for c, m := range h.conns {
+		if match(m) {
+			conns = append(conns, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		c.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+		if err := c.WriteMessage(messageType, data); err != nil {
+			h.Remove(c)
+			c.CloseWithStatus(CloseGoingAway, "")
+		}
+	}
+}
+
+// Shutdown closes every connection with a "going away" status and rejects new ones.
+// The http server doesn't track upgraded connections, so register it as a shutdown hook.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	conns := h.conns
+	h.conns = map[*Conn]member{}
+	h.mu.Unlock()
+
+	for c := range conns {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.CloseWithStatus(CloseGoingAway, "server shutting down")
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+// Package websocket is a small server side implementation of the WebSocket protocol
+// (RFC 6455), and a Hub to keep track of the open connections. It covers what the
+// application needs: text and binary messages, pings, and close handshakes. It
+// doesn't support extensions like compression.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// Frame opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close status codes
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+)
+
+// DefaultReadLimit is the largest message, in bytes, a Conn reads by default.
+const DefaultReadLimit = 64 << 10
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrBadHandshake is returned by Upgrade for a request that isn't a WebSocket handshake.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+
+	// ErrBadOrigin is returned by Upgrade for a cross origin request that isn't allowed.
+	ErrBadOrigin = errors.New("websocket: origin not allowed")
+
+	// ErrMessageTooBig is returned by ReadMessage for a message over the read limit.
+	ErrMessageTooBig = errors.New("websocket: message too big")
+)
+
+// CloseError is returned by ReadMessage when the peer closes the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed %d %s", e.Code, e.Reason)
+}
+
+// Upgrader upgrades HTTP requests to WebSocket connections.
+type Upgrader struct {
+	// CheckOrigin reports whether a request from another origin is allowed. When it's
+	// nil, only requests without an Origin header or from the same host are allowed,
+	// because browsers don't apply the same origin policy to WebSockets.
+	CheckOrigin func(r *http.Request) bool
+
+	// ReadLimit is the largest message a Conn reads, DefaultReadLimit when it's zero.
+	ReadLimit int64
+}
+
+// Upgrade completes the WebSocket handshake and takes over the connection. When the
+// handshake fails, Upgrade writes an error response and returns an error.
+func (u Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" ||
+		r.Header.Get("Sec-WebSocket-Key") == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, ErrBadOrigin
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+
+	// The server read and write deadlines don't apply to the connection anymore
+	netConn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", AcceptKey(r.Header.Get("Sec-WebSocket-Key")))
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+
+	readLimit := u.ReadLimit
+	if readLimit <= 0 {
+		readLimit = DefaultReadLimit
+	}
+
+	return &Conn{conn: netConn, reader: rw.Reader, readLimit: readLimit}, nil
+}
+
+// AcceptKey returns the Sec-WebSocket-Accept header value for a Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma separated header contains token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin allows requests without an Origin header or from the request host
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Conn is a server side WebSocket connection. One goroutine can read while
+// others write.
+type Conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	readLimit int64
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// RemoteAddr returns the address of the client.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline for ReadMessage. A zero time means no deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// ReadMessage reads the next data message. It answers pings and close frames on the
+// way, and returns a *CloseError once the client closes the connection.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var messageType MessageType
+	var message []byte
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			closeErr := &CloseError{Code: CloseNormal}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			c.CloseWithStatus(closeErr.Code, "")
+			return 0, nil, closeErr
+		case opText, opBinary:
+			if messageType != 0 {
+				c.CloseWithStatus(CloseProtocolError, "")
+				return 0, nil, fmt.Errorf("websocket: new message before the last one finished")
+			}
+			messageType = MessageType(opcode)
+		case opContinuation:
+			if messageType == 0 {
+				c.CloseWithStatus(CloseProtocolError, "")
+				return 0, nil, fmt.Errorf("websocket: continuation frame without a message")
+			}
+		default:
+			c.CloseWithStatus(CloseProtocolError, "")
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", opcode)
+		}
+
+		if int64(len(message)+len(payload)) > c.readLimit {
+			c.CloseWithStatus(CloseMessageTooBig, "")
+			return 0, nil, ErrMessageTooBig
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return messageType, message, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks a single frame
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		c.CloseWithStatus(CloseProtocolError, "")
+		return false, 0, nil, errors.New("websocket: reserved bits set without an extension")
+	}
+
+	// Clients have to mask every frame
+	if !masked {
+		c.CloseWithStatus(CloseProtocolError, "")
+		return false, 0, nil, errors.New("websocket: unmasked client frame")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	// Control frames are at most 125 bytes, data frames at most the read limit
+	if (opcode >= opClose && (length > 125 || !fin)) || length < 0 {
+		c.CloseWithStatus(CloseProtocolError, "")
+		return false, 0, nil, errors.New("websocket: bad control frame")
+	}
+	if length > c.readLimit {
+		c.CloseWithStatus(CloseMessageTooBig, "")
+		return false, 0, nil, ErrMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends a data message in a single frame.
+func (c *Conn) WriteMessage(messageType MessageType, data []byte) error {
+	return c.writeFrame(byte(messageType), data)
+}
+
+// Ping sends a ping. The client answers with a pong, which ReadMessage reads.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// SetWriteDeadline sets the deadline for writes. A zero time means no deadline.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// writeFrame writes a single unmasked frame
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *Conn) Close() error {
+	return c.CloseWithStatus(CloseNormal, "")
+}
+
+// CloseWithStatus sends a close frame with a status code and reason, then closes the
+// connection. Closing a closed connection does nothing.
+func (c *Conn) CloseWithStatus(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	// Don't wait long on a client that isn't reading
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(opClose, payload)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
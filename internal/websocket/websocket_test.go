@@ -0,0 +1,241 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sglmr/gowebstart/internal/assert"
+)
+
+// testClient is the client side of a connection, which masks its frames
+type testClient struct {
+	rwc    io.ReadWriteCloser
+	reader *bufio.Reader
+}
+
+// dial opens a WebSocket connection to url
+func dial(t *testing.T, url string) *testClient {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", response.Header.Get("Sec-WebSocket-Accept"))
+
+	rwc := response.Body.(io.ReadWriteCloser)
+	t.Cleanup(func() { rwc.Close() })
+	return &testClient{rwc: rwc, reader: bufio.NewReader(rwc)}
+}
+
+// write sends a masked frame
+func (c *testClient) write(t *testing.T, fin bool, opcode byte, payload []byte) {
+	t.Helper()
+
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.rwc.Write(frame)
+	assert.NoError(t, err)
+}
+
+// read reads an unmasked server frame
+func (c *testClient) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	_, err := io.ReadFull(c.reader, header[:])
+	assert.NoError(t, err)
+
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.reader, payload)
+	assert.NoError(t, err)
+	return header[0] & 0x0F, payload
+}
+
+func TestAcceptKey(t *testing.T) {
+	t.Parallel()
+
+	// The example from RFC 6455
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Upgrader{}.Upgrade(w, r)
+	}))
+	defer ts.Close()
+
+	// Plain requests aren't upgraded
+	response, err := http.Get(ts.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	// Cross origin requests aren't allowed
+	request, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	assert.NoError(t, err)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	request.Header.Set("Origin", "https://evil.example.com")
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+}
+
+func TestConn(t *testing.T) {
+	t.Parallel()
+
+	closed := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrader{ReadLimit: 10}.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		// Echo messages until the connection closes
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+	defer ts.Close()
+
+	client := dial(t, ts.URL)
+
+	// Messages are echoed
+	client.write(t, true, opText, []byte("hello"))
+	opcode, payload := client.read(t)
+	assert.Equal(t, byte(opText), opcode)
+	assert.Equal(t, "hello", string(payload))
+
+	// Fragmented messages are put back together, with pings answered in between
+	client.write(t, false, opBinary, []byte("ab"))
+	client.write(t, true, opPing, []byte("p"))
+	client.write(t, true, opContinuation, []byte("cd"))
+	opcode, payload = client.read(t)
+	assert.Equal(t, byte(opPong), opcode)
+	assert.Equal(t, "p", string(payload))
+	opcode, payload = client.read(t)
+	assert.Equal(t, byte(opBinary), opcode)
+	assert.Equal(t, "abcd", string(payload))
+
+	// Closing from the client is answered with a close frame
+	client.write(t, true, opClose, binary.BigEndian.AppendUint16(nil, CloseNormal))
+	opcode, _ = client.read(t)
+	assert.Equal(t, byte(opClose), opcode)
+
+	var closeErr *CloseError
+	assert.Equal(t, true, errors.As(<-closed, &closeErr))
+	assert.Equal(t, CloseNormal, closeErr.Code)
+}
+
+func TestConnReadLimit(t *testing.T) {
+	t.Parallel()
+
+	closed := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrader{ReadLimit: 4}.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		_, _, err = conn.ReadMessage()
+		closed <- err
+	}))
+	defer ts.Close()
+
+	client := dial(t, ts.URL)
+	client.write(t, true, opText, []byte("too long"))
+
+	opcode, payload := client.read(t)
+	assert.Equal(t, byte(opClose), opcode)
+	assert.Equal(t, CloseMessageTooBig, int(binary.BigEndian.Uint16(payload)))
+	assert.Equal(t, ErrMessageTooBig, <-closed)
+}
+
+func TestHub(t *testing.T) {
+	t.Parallel()
+
+	hub := NewHub(time.Second)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrader{}.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		if err := hub.Add(conn, r.URL.Query().Get("team"), r.URL.Query().Get("user")); err != nil {
+			conn.Close()
+			return
+		}
+		defer hub.Remove(conn)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	alice := dial(t, ts.URL+"?team=red&user=alice")
+	bob := dial(t, ts.URL+"?team=blue&user=bob")
+	for hub.Count() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Broadcasts go to everyone
+	hub.Broadcast(TextMessage, []byte("all"))
+	_, payload := alice.read(t)
+	assert.Equal(t, "all", string(payload))
+	_, payload = bob.read(t)
+	assert.Equal(t, "all", string(payload))
+
+	// Group broadcasts only go to the connections of one group
+	hub.BroadcastGroup("red", TextMessage, []byte("red only"))
+	_, payload = alice.read(t)
+	assert.Equal(t, "red only", string(payload))
+
+	// SendTo only goes to the connections of one key
+	hub.SendTo("bob", TextMessage, []byte("bob only"))
+	_, payload = bob.read(t)
+	assert.Equal(t, "bob only", string(payload))
+
+	// Shutdown closes every connection as going away
+	assert.NoError(t, hub.Shutdown(context.Background()))
+	opcode, payload := alice.read(t)
+	assert.Equal(t, byte(opClose), opcode)
+	assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	assert.Equal(t, 0, hub.Count())
+}